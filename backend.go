@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import "context"
+
+// The interfaces below group the operations of the clients by object type,
+// so code can depend on them instead of a concrete backend.
+// Methods returning D-Bus object paths are not part of these interfaces,
+// as they are specific to the D-Bus transport.
+
+// ZoneConfig manages zones in the permanent configuration.
+type ZoneConfig interface {
+	GetZoneNames(ctx context.Context) ([]string, error)
+	GetZoneSettings(ctx context.Context, zoneName string) (ZoneSettings, error)
+	AddZone(ctx context.Context, zoneName string, settings ZoneSettings) error
+	UpdateZone(ctx context.Context, zoneName string, settings ZoneSettings) error
+	RemoveZone(ctx context.Context, zoneName string) error
+	ApplyZoneChanges(ctx context.Context, zoneName string, changes []ZoneChange) error
+}
+
+// ServiceConfig manages services in the permanent configuration.
+type ServiceConfig interface {
+	GetServiceNames(ctx context.Context) ([]string, error)
+	GetServiceSettings(ctx context.Context, serviceName string) (ServiceSettings, error)
+	AddService(ctx context.Context, serviceName string, settings ServiceSettings) error
+	UpdateService(ctx context.Context, serviceName string, settings ServiceSettings) error
+	RemoveService(ctx context.Context, serviceName string) error
+}
+
+// IPSetConfig manages ipsets in the permanent configuration.
+type IPSetConfig interface {
+	GetIPSetNames(ctx context.Context) ([]string, error)
+	GetIPSetSettings(ctx context.Context, ipsetName string) (IPSetSettings, error)
+	AddIPSet(ctx context.Context, ipsetName string, settings IPSetSettings) error
+	UpdateIPSet(ctx context.Context, ipsetName string, settings IPSetSettings) error
+	RemoveIPSet(ctx context.Context, ipsetName string) error
+}
+
+// PolicyConfig manages policies in the permanent configuration.
+type PolicyConfig interface {
+	GetPolicyNames(ctx context.Context) ([]string, error)
+	GetPolicySettings(ctx context.Context, policyName string) (PolicySettings, error)
+	AddPolicy(ctx context.Context, policyName string, settings PolicySettings) error
+	UpdatePolicy(ctx context.Context, policyName string, settings PolicySettings) error
+	RemovePolicy(ctx context.Context, policyName string) error
+}
+
+// HelperConfig manages helpers in the permanent configuration.
+type HelperConfig interface {
+	GetHelperNames(ctx context.Context) ([]string, error)
+	GetHelperSettings(ctx context.Context, helperName string) (HelperSettings, error)
+	AddHelper(ctx context.Context, helperName string, settings HelperSettings) error
+	UpdateHelper(ctx context.Context, helperName string, settings HelperSettings) error
+	RemoveHelper(ctx context.Context, helperName string) error
+}
+
+// Config is the permanent configuration,
+// implemented by ConfigClient over D-Bus and by the offline package on files.
+type Config interface {
+	ZoneConfig
+	ServiceConfig
+	IPSetConfig
+	PolicyConfig
+	HelperConfig
+}
+
+var _ Config = (*ConfigClient)(nil)
+
+// ZoneRuntime inspects and changes zones in the runtime configuration.
+type ZoneRuntime interface {
+	GetZones(ctx context.Context) ([]string, error)
+	GetZoneSettings(ctx context.Context, zoneName string) (ZoneSettings, error)
+	ApplyZoneChanges(ctx context.Context, zoneName string, changes []ZoneChange) error
+}
+
+// ServiceRuntime inspects services in the runtime configuration.
+type ServiceRuntime interface {
+	ListServices(ctx context.Context) ([]string, error)
+	GetServiceSettings(ctx context.Context, serviceName string) (ServiceSettings, error)
+}
+
+// IPSetRuntime inspects ipsets in the runtime configuration.
+type IPSetRuntime interface {
+	GetIPSets(ctx context.Context) ([]string, error)
+	GetIPSetSettings(ctx context.Context, ipsetName string) (IPSetSettings, error)
+}
+
+// PolicyRuntime inspects policies in the runtime configuration.
+type PolicyRuntime interface {
+	GetPolicies(ctx context.Context) ([]string, error)
+	GetPolicySettings(ctx context.Context, policyName string) (PolicySettings, error)
+}
+
+// Runtime is the runtime configuration of a running firewalld, implemented by Client.
+type Runtime interface {
+	ZoneRuntime
+	ServiceRuntime
+	IPSetRuntime
+	PolicyRuntime
+
+	GetDefaultZone(ctx context.Context) (string, error)
+	SetDefaultZone(ctx context.Context, zone string) error
+	Reload(ctx context.Context) error
+	RuntimeToPermanent(ctx context.Context) error
+}
+
+var _ Runtime = (*Client)(nil)
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+)
+
+// staticConnection answers every call with the same values,
+// showing that transports can be implemented outside of the package.
+type staticConnection struct {
+	calls   []firewalld.Call
+	returns []interface{}
+}
+
+func (c *staticConnection) Close() error { return nil }
+
+func (c *staticConnection) Object(dest, path string) firewalld.Caller {
+	return c
+}
+
+func (c *staticConnection) Call(ctx context.Context, call firewalld.Call) error {
+	c.calls = append(c.calls, call)
+	return dbus.Store(c.returns, call.Returns...)
+}
+
+func TestNewClient_ExternalConnection(t *testing.T) {
+	conn := &staticConnection{returns: []interface{}{"public"}}
+
+	var runtime firewalld.Runtime = firewalld.NewClient(conn)
+	zone, err := runtime.GetDefaultZone(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "public", zone)
+
+	require.Len(t, conn.calls, 1)
+	assert.Equal(t, "org.fedoraproject.FirewallD1.getDefaultZone", conn.calls[0].Method)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"routerd.net/go-firewalld"
+)
+
+type applyOptions struct {
+	file   string
+	dryRun bool
+	json   bool
+}
+
+func parseApplyOptions(args []string, stderr io.Writer) (*applyOptions, error) {
+	o := &applyOptions{}
+	fs := flag.NewFlagSet("gofwctl apply", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&o.file, "f", "", "YAML or JSON file with the desired state")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "only print the plan")
+	fs.BoolVar(&o.json, "json", false, "print the plan and errors as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if len(o.file) == 0 {
+		return nil, errors.New("missing state file, use -f")
+	}
+	return o, nil
+}
+
+type applyOutput struct {
+	Plan    *firewalld.Plan `json:"plan"`
+	Applied bool            `json:"applied"`
+}
+
+// runApply brings the permanent configuration in line with a state file.
+// The plan is printed before it is applied.
+func runApply(
+	ctx context.Context, args []string, stdout, stderr io.Writer,
+	open func() (*firewalld.Client, error),
+) int {
+	opts, err := parseApplyOptions(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitUsage
+	}
+	out := &output{json: opts.json, stdout: stdout, stderr: stderr}
+
+	state, err := firewalld.ReadStateFile(opts.file)
+	if err != nil {
+		return out.error(err, exitUsage)
+	}
+
+	client, err := open()
+	if err != nil {
+		return out.error(err, exitNotRunning)
+	}
+	defer client.Close()
+
+	plan, err := client.Plan(ctx, state)
+	if err != nil {
+		return out.error(err, exitCode(err))
+	}
+	if !opts.json {
+		fmt.Fprintln(stdout, strings.TrimSuffix(plan.String(), "\n"))
+	}
+	if opts.dryRun || plan.Empty() {
+		out.print(applyOutput{Plan: plan}, "")
+		return exitOK
+	}
+
+	if _, err := client.Apply(ctx, plan); err != nil {
+		return out.error(err, exitCode(err))
+	}
+	out.print(applyOutput{Plan: plan, Applied: true}, "success")
+	return exitOK
+}
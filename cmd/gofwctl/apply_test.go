@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld/firewalldtest"
+)
+
+func TestRunApply(t *testing.T) {
+	fake := firewalldtest.New()
+
+	file := filepath.Join(t.TempDir(), "state.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+zones:
+  public:
+    name: Public
+    services: [ssh, http]
+  internal:
+    interfaces: [eth1]
+`), 0644))
+
+	plan := "+ create zone internal\n" +
+		"~ update zone public\n" +
+		"    removeService(dhcpv6-client)\n" +
+		"    addService(http)\n"
+
+	r := runWith(fake, "apply", "-f", file, "--dry-run")
+	assert.Equal(t, testRun{code: 0, stdout: plan}, r)
+
+	r = runWith(fake, "apply", "-f", file)
+	assert.Equal(t, testRun{code: 0, stdout: plan + "success\n"}, r)
+	assert.ElementsMatch(t, []string{"internal", "public"}, zoneNames(fake))
+
+	r = runWith(fake, "apply", "-f", file)
+	assert.Equal(t, testRun{code: 0, stdout: "no changes\n"}, r)
+
+	r = runWith(fake, "apply", "-f", file, "--json")
+	require.Equal(t, 0, r.code)
+	var out applyOutput
+	require.NoError(t, json.Unmarshal([]byte(r.stdout), &out))
+	assert.True(t, out.Plan.Empty())
+	assert.False(t, out.Applied)
+}
+
+func TestRunApply_Errors(t *testing.T) {
+	fake := firewalldtest.New()
+	dir := t.TempDir()
+
+	r := runWith(fake, "apply")
+	assert.Equal(t, testRun{code: 2, stderr: "Error: missing state file, use -f\n"}, r)
+
+	typo := filepath.Join(dir, "typo.yaml")
+	require.NoError(t, ioutil.WriteFile(typo, []byte("zone: {}\n"), 0644))
+	r = runWith(fake, "apply", "-f", typo)
+	assert.Equal(t, 2, r.code)
+	assert.Contains(t, r.stderr, "field zone not found")
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte("defaultZone: foo\n"), 0644))
+	r = runWith(fake, "apply", "-f", invalid, "--json")
+	assert.Equal(t, 112, r.code)
+	assert.Contains(t, r.stderr, `"code": "INVALID_ZONE"`)
+}
+
+func zoneNames(fake *firewalldtest.Fake) []string {
+	var names []string
+	for name := range fake.Permanent().Zones {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"routerd.net/go-firewalld"
+)
+
+type cli struct {
+	client *firewalld.Client
+	opts   *options
+	out    *output
+}
+
+// zoneBackend is implemented by the runtime and the permanent configuration.
+type zoneBackend interface {
+	GetZoneSettings(ctx context.Context, zone string) (firewalld.ZoneSettings, error)
+	ApplyZoneChanges(ctx context.Context, zone string, changes []firewalld.ZoneChange) error
+}
+
+func (c *cli) zones() zoneBackend {
+	if c.opts.permanent {
+		return c.client.Config()
+	}
+	return c.client
+}
+
+func (c *cli) zoneNames(ctx context.Context) ([]string, error) {
+	if c.opts.permanent {
+		return c.client.Config().GetZoneNames(ctx)
+	}
+	return c.client.GetZones(ctx)
+}
+
+// zone returns the zone given by --zone or the default zone.
+func (c *cli) zone(ctx context.Context) (string, error) {
+	if len(c.opts.zone) > 0 {
+		return c.opts.zone, nil
+	}
+	return c.client.GetDefaultZone(ctx)
+}
+
+// success reports a successful change with its warnings.
+func (c *cli) success(warnings []error) int {
+	for _, w := range warnings {
+		c.out.warning(w)
+	}
+	c.out.print(result{Status: "success", Warnings: errorStrings(warnings)}, "success")
+	return exitOK
+}
+
+// state asks the daemon for its version, a reachable bus alone does not mean it is running.
+func (c *cli) state(ctx context.Context) int {
+	if _, err := c.client.Version(ctx); err != nil {
+		code := exitCode(err)
+		if code != exitNotRunning {
+			return c.out.error(err, code)
+		}
+		c.out.print("not running", "not running")
+		return exitNotRunning
+	}
+	c.out.print("running", "running")
+	return exitOK
+}
+
+func (c *cli) version(ctx context.Context) int {
+	version, err := c.client.Version(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	c.out.print(version, version)
+	return exitOK
+}
+
+func (c *cli) reload(ctx context.Context) int {
+	if err := c.client.Reload(ctx); err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	return c.success(nil)
+}
+
+func (c *cli) runtimeToPermanent(ctx context.Context) int {
+	if err := c.client.RuntimeToPermanent(ctx); err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	return c.success(nil)
+}
+
+func (c *cli) getDefaultZone(ctx context.Context) int {
+	zone, err := c.client.GetDefaultZone(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	c.out.print(zone, zone)
+	return exitOK
+}
+
+func (c *cli) setDefaultZone(ctx context.Context) int {
+	err := c.client.SetDefaultZone(ctx, c.opts.setDefaultZone)
+	if warningCodes[firewalld.ErrorCode(err)] {
+		return c.success([]error{err})
+	}
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	return c.success(nil)
+}
+
+func (c *cli) getZones(ctx context.Context) int {
+	zones, err := c.zoneNames(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	c.out.print(nonNil(zones), strings.Join(zones, " "))
+	return exitOK
+}
+
+func (c *cli) getServices(ctx context.Context) int {
+	var services []string
+	var err error
+	if c.opts.permanent {
+		services, err = c.client.Config().GetServiceNames(ctx)
+	} else {
+		services, err = c.client.ListServices(ctx)
+	}
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	c.out.print(nonNil(services), strings.Join(services, " "))
+	return exitOK
+}
+
+// allZones returns the settings of all zones, ordered by name.
+func (c *cli) allZones(ctx context.Context) ([]zoneOutput, error) {
+	names, err := c.zoneNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultZone, err := c.client.GetDefaultZone(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []zoneOutput
+	for _, name := range names {
+		settings, err := c.zones().GetZoneSettings(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, newZoneOutput(name, name == defaultZone, settings))
+	}
+	return zones, nil
+}
+
+func (c *cli) getActiveZones(ctx context.Context) int {
+	zones, err := c.allZones(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+
+	active := map[string]activeZoneOutput{}
+	var text []string
+	for _, z := range zones {
+		if !z.Active {
+			continue
+		}
+		active[z.Name] = activeZoneOutput{Interfaces: z.Interfaces, Sources: z.Sources}
+		text = append(text, z.Name)
+		if len(z.Interfaces) > 0 {
+			text = append(text, "  interfaces: "+strings.Join(z.Interfaces, " "))
+		}
+		if len(z.Sources) > 0 {
+			text = append(text, "  sources: "+strings.Join(z.Sources, " "))
+		}
+	}
+	c.out.print(active, strings.Join(text, "\n"))
+	return exitOK
+}
+
+func (c *cli) listAll(ctx context.Context) int {
+	zone, err := c.zone(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	settings, err := c.zones().GetZoneSettings(ctx, zone)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	defaultZone, err := c.client.GetDefaultZone(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	z := newZoneOutput(zone, zone == defaultZone, settings)
+	c.out.print(z, z.text())
+	return exitOK
+}
+
+func (c *cli) listAllZones(ctx context.Context) int {
+	zones, err := c.allZones(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	byName := map[string]zoneOutput{}
+	var text []string
+	for _, z := range zones {
+		byName[z.Name] = z
+		text = append(text, z.text())
+	}
+	c.out.print(byName, strings.Join(text, "\n\n"))
+	return exitOK
+}
+
+func (c *cli) zoneSettings(ctx context.Context) (firewalld.ZoneSettings, error) {
+	zone, err := c.zone(ctx)
+	if err != nil {
+		return firewalld.ZoneSettings{}, err
+	}
+	return c.zones().GetZoneSettings(ctx, zone)
+}
+
+func (c *cli) listServices(ctx context.Context) int {
+	settings, err := c.zoneSettings(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	c.out.print(nonNil(settings.Services), strings.Join(settings.Services, " "))
+	return exitOK
+}
+
+func (c *cli) listPorts(ctx context.Context) int {
+	settings, err := c.zoneSettings(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	ports := portStrings(settings.Ports)
+	c.out.print(ports, strings.Join(ports, " "))
+	return exitOK
+}
+
+// changeZone adds and removes services and ports.
+// Changes that are already in effect are reported as warnings.
+func (c *cli) changeZone(ctx context.Context) int {
+	var changes []firewalld.ZoneChange
+	for _, s := range c.opts.addServices {
+		changes = append(changes, firewalld.ZoneChange{Method: "addService", Args: []string{s}})
+	}
+	for _, s := range c.opts.removeServices {
+		changes = append(changes, firewalld.ZoneChange{Method: "removeService", Args: []string{s}})
+	}
+	for _, method := range []struct {
+		name  string
+		ports []string
+	}{
+		{"addPort", c.opts.addPorts},
+		{"removePort", c.opts.removePorts},
+	} {
+		for _, s := range method.ports {
+			p, err := parsePort(s)
+			if err != nil {
+				return c.out.error(err, exitCode(err))
+			}
+			changes = append(changes, firewalld.ZoneChange{
+				Method: method.name, Args: []string{p.Port, p.Protocol}})
+		}
+	}
+
+	zone, err := c.zone(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+	var warnings []error
+	for _, change := range changes {
+		err := c.zones().ApplyZoneChanges(ctx, zone, []firewalld.ZoneChange{change})
+		var changeErr *firewalld.ZoneChangeError
+		if warningCodes[firewalld.ErrorCode(err)] && errors.As(err, &changeErr) {
+			warnings = append(warnings, changeErr.Err)
+			continue
+		}
+		if err != nil {
+			return c.out.error(err, exitCode(err))
+		}
+	}
+	return c.success(warnings)
+}
+
+// queryZone checks services and ports, the exit code is 0 if all are enabled.
+func (c *cli) queryZone(ctx context.Context) int {
+	settings, err := c.zoneSettings(ctx)
+	if err != nil {
+		return c.out.error(err, exitCode(err))
+	}
+
+	var queries []queryOutput
+	for _, s := range c.opts.queryServices {
+		queries = append(queries, queryOutput{
+			Query: "service " + s, Enabled: containsString(settings.Services, s)})
+	}
+	for _, s := range c.opts.queryPorts {
+		p, err := parsePort(s)
+		if err != nil {
+			return c.out.error(err, exitCode(err))
+		}
+		queries = append(queries, queryOutput{
+			Query: "port " + p.String(), Enabled: containsString(portStrings(settings.Ports), p.String())})
+	}
+
+	code := exitOK
+	var text []string
+	for _, q := range queries {
+		answer := "yes"
+		if !q.Enabled {
+			answer = "no"
+			code = exitNo
+		}
+		text = append(text, answer)
+	}
+	if len(queries) == 1 {
+		c.out.print(queries[0].Enabled, text[0])
+	} else {
+		c.out.print(queries, strings.Join(text, "\n"))
+	}
+	return code
+}
+
+// parsePort parses a port in firewall-cmd notation, e.g. "8080/tcp".
+func parsePort(s string) (firewalld.Port, error) {
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return firewalld.Port{}, firewalld.Error{Code: "INVALID_PORT", Message: fmt.Sprintf("%q: missing protocol", s)}
+	}
+	p := firewalld.Port{Port: s[:i], Protocol: s[i+1:]}
+	if err := p.Validate(); err != nil {
+		return firewalld.Port{}, firewalld.Error{Code: "INVALID_PORT", Message: err.Error()}
+	}
+	return p, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command gofwctl is a firewall-cmd compatible command line client for firewalld.
+//
+// It implements the common firewall-cmd options, e.g.
+//
+//	gofwctl --get-zones
+//	gofwctl --permanent --zone=public --add-service=http --add-port=8080/tcp
+//	gofwctl --list-all --json
+//
+// The apply subcommand brings the permanent configuration in line with
+// a YAML or JSON state file, see firewalld.ParseState for the format:
+//
+//	gofwctl apply -f state.yaml --dry-run
+//	gofwctl apply -f state.yaml
+//
+// With --json, results and errors are printed as JSON for use in scripts.
+// Exit codes follow firewall-cmd: firewalld error codes are returned
+// as their numeric value, e.g. 112 for INVALID_ZONE.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr, firewalld.Open))
+}
+
+// Exit codes not related to a firewalld error.
+const (
+	exitOK         = 0
+	exitNo         = 1
+	exitUsage      = 2
+	exitNotRunning = 252
+	exitUnknown    = 254
+)
+
+// firewalld error codes as numbers, used as exit code by firewall-cmd.
+var errorCodes = map[string]int{
+	"ALREADY_ENABLED":   11,
+	"NOT_ENABLED":       12,
+	"COMMAND_FAILED":    13,
+	"ZONE_ALREADY_SET":  16,
+	"UNKNOWN_INTERFACE": 17,
+	"ZONE_CONFLICT":     18,
+	"NO_DEFAULTS":       22,
+	"BUILTIN_ZONE":      23,
+	"BUILTIN_SERVICE":   24,
+	"NAME_CONFLICT":     26,
+	"ACCESS_DENIED":     29,
+	"INVALID_SERVICE":   101,
+	"INVALID_PORT":      102,
+	"INVALID_PROTOCOL":  103,
+	"INVALID_INTERFACE": 104,
+	"INVALID_ADDR":      105,
+	"INVALID_TARGET":    110,
+	"INVALID_ZONE":      112,
+	"INVALID_VALUE":     114,
+	"INVALID_NAME":      116,
+	"INVALID_TYPE":      119,
+	"INVALID_COMMAND":   129,
+	"INVALID_IPSET":     135,
+	"INVALID_POLICY":    140,
+	"NOT_RUNNING":       exitNotRunning,
+	"NOT_AUTHORIZED":    253,
+}
+
+// Errors reported as warning, the command still succeeds.
+var warningCodes = map[string]bool{
+	"ALREADY_ENABLED":  true,
+	"NOT_ENABLED":      true,
+	"ZONE_ALREADY_SET": true,
+}
+
+// stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+type options struct {
+	permanent bool
+	zone      string
+	json      bool
+
+	state              bool
+	version            bool
+	reload             bool
+	runtimeToPermanent bool
+	getDefaultZone     bool
+	setDefaultZone     string
+	getZones           bool
+	getActiveZones     bool
+	getServices        bool
+	listAll            bool
+	listAllZones       bool
+	listServices       bool
+	listPorts          bool
+
+	addServices    stringList
+	removeServices stringList
+	queryServices  stringList
+	addPorts       stringList
+	removePorts    stringList
+	queryPorts     stringList
+}
+
+func parseOptions(args []string, stderr io.Writer) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("gofwctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.BoolVar(&o.permanent, "permanent", false, "work on the permanent configuration")
+	fs.StringVar(&o.zone, "zone", "", "zone to work on, defaults to the default zone")
+	fs.BoolVar(&o.json, "json", false, "print results and errors as JSON")
+
+	fs.BoolVar(&o.state, "state", false, "print whether firewalld is running")
+	fs.BoolVar(&o.version, "version", false, "print the firewalld version")
+	fs.BoolVar(&o.reload, "reload", false, "reload the permanent configuration")
+	fs.BoolVar(&o.runtimeToPermanent, "runtime-to-permanent", false, "make the runtime configuration permanent")
+	fs.BoolVar(&o.getDefaultZone, "get-default-zone", false, "print the default zone")
+	fs.StringVar(&o.setDefaultZone, "set-default-zone", "", "set the default zone")
+	fs.BoolVar(&o.getZones, "get-zones", false, "print the zone names")
+	fs.BoolVar(&o.getActiveZones, "get-active-zones", false, "print zones with interfaces or sources")
+	fs.BoolVar(&o.getServices, "get-services", false, "print the service names")
+	fs.BoolVar(&o.listAll, "list-all", false, "print the settings of the zone")
+	fs.BoolVar(&o.listAllZones, "list-all-zones", false, "print the settings of all zones")
+	fs.BoolVar(&o.listServices, "list-services", false, "print the services of the zone")
+	fs.BoolVar(&o.listPorts, "list-ports", false, "print the ports of the zone")
+
+	fs.Var(&o.addServices, "add-service", "add a service to the zone")
+	fs.Var(&o.removeServices, "remove-service", "remove a service from the zone")
+	fs.Var(&o.queryServices, "query-service", "check whether a service is enabled in the zone")
+	fs.Var(&o.addPorts, "add-port", "add a port to the zone, e.g. 8080/tcp or 8000-8010/udp")
+	fs.Var(&o.removePorts, "remove-port", "remove a port from the zone")
+	fs.Var(&o.queryPorts, "query-port", "check whether a port is enabled in the zone")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return o, nil
+}
+
+// run executes the command line and returns the exit code.
+// open connects to firewalld.
+func run(
+	ctx context.Context, args []string, stdout, stderr io.Writer,
+	open func() (*firewalld.Client, error),
+) int {
+	if len(args) > 0 && args[0] == "apply" {
+		return runApply(ctx, args[1:], stdout, stderr, open)
+	}
+
+	opts, err := parseOptions(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitUsage
+	}
+	out := &output{json: opts.json, stdout: stdout, stderr: stderr}
+
+	action, err := selectAction(opts)
+	if err != nil {
+		return out.error(err, exitUsage)
+	}
+
+	client, err := open()
+	if err != nil {
+		if opts.state {
+			out.print("not running", "not running")
+			return exitNotRunning
+		}
+		return out.error(err, exitNotRunning)
+	}
+	defer client.Close()
+
+	c := &cli{client: client, opts: opts, out: out}
+	return action(c, ctx)
+}
+
+// selectAction returns the single action requested by the options.
+// All zone changes together count as one action.
+func selectAction(o *options) (func(c *cli, ctx context.Context) int, error) {
+	actions := []struct {
+		selected bool
+		run      func(c *cli, ctx context.Context) int
+	}{
+		{o.state, (*cli).state},
+		{o.version, (*cli).version},
+		{o.reload, (*cli).reload},
+		{o.runtimeToPermanent, (*cli).runtimeToPermanent},
+		{o.getDefaultZone, (*cli).getDefaultZone},
+		{len(o.setDefaultZone) > 0, (*cli).setDefaultZone},
+		{o.getZones, (*cli).getZones},
+		{o.getActiveZones, (*cli).getActiveZones},
+		{o.getServices, (*cli).getServices},
+		{o.listAll, (*cli).listAll},
+		{o.listAllZones, (*cli).listAllZones},
+		{o.listServices, (*cli).listServices},
+		{o.listPorts, (*cli).listPorts},
+		{len(o.addServices)+len(o.removeServices)+
+			len(o.addPorts)+len(o.removePorts) > 0, (*cli).changeZone},
+		{len(o.queryServices)+len(o.queryPorts) > 0, (*cli).queryZone},
+	}
+
+	var selected func(c *cli, ctx context.Context) int
+	for _, a := range actions {
+		if !a.selected {
+			continue
+		}
+		if selected != nil {
+			return nil, errors.New("more than one action given")
+		}
+		selected = a.run
+	}
+	if selected == nil {
+		return nil, errors.New("no action given, see --help")
+	}
+	// both only exist at runtime, like in firewall-cmd
+	if o.permanent && (o.reload || len(o.setDefaultZone) > 0) {
+		return nil, errors.New("--permanent cannot be used with --reload or --set-default-zone")
+	}
+	return selected, nil
+}
+
+// D-Bus errors reported when firewalld does not own its bus name.
+var notRunningErrors = map[string]bool{
+	"org.freedesktop.DBus.Error.ServiceUnknown": true,
+	"org.freedesktop.DBus.Error.NameHasNoOwner": true,
+}
+
+// exitCode returns the firewall-cmd exit code for err.
+func exitCode(err error) int {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) && notRunningErrors[dbusErr.Name] {
+		return exitNotRunning
+	}
+	var dbusErrPtr *dbus.Error
+	if errors.As(err, &dbusErrPtr) && dbusErrPtr != nil && notRunningErrors[dbusErrPtr.Name] {
+		return exitNotRunning
+	}
+	if code, ok := errorCodes[firewalld.ErrorCode(err)]; ok {
+		return code
+	}
+	return exitUnknown
+}
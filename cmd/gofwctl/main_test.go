@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+	"routerd.net/go-firewalld/firewalldtest"
+)
+
+type testRun struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func runWith(fake *firewalldtest.Fake, args ...string) testRun {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr,
+		func() (*firewalld.Client, error) { return fake.Client(), nil })
+	return testRun{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func TestRun(t *testing.T) {
+	fake := firewalldtest.New()
+
+	r := runWith(fake, "--get-zones")
+	assert.Equal(t, testRun{code: 0, stdout: "public\n"}, r)
+
+	r = runWith(fake, "--permanent", "--add-service=http", "--add-port=8080/tcp")
+	assert.Equal(t, testRun{code: 0, stdout: "success\n"}, r)
+
+	// runtime configuration is unchanged
+	r = runWith(fake, "--list-services")
+	assert.Equal(t, "ssh dhcpv6-client\n", r.stdout)
+
+	r = runWith(fake, "--permanent", "--zone=public", "--list-all")
+	assert.Equal(t, 0, r.code)
+	assert.Equal(t, strings.Join([]string{
+		"public (default)",
+		"  target: default",
+		"  icmp-block-inversion: no",
+		"  interfaces:",
+		"  sources:",
+		"  services: ssh dhcpv6-client http",
+		"  ports: 8080/tcp",
+		"  protocols:",
+		"  masquerade: no",
+		"  forward-ports:",
+		"  source-ports:",
+		"  icmp-blocks:",
+		"  rich rules:",
+		"",
+	}, "\n"), r.stdout)
+
+	r = runWith(fake, "--reload")
+	assert.Equal(t, testRun{code: 0, stdout: "success\n"}, r)
+	r = runWith(fake, "--query-port=8080/tcp")
+	assert.Equal(t, testRun{code: 0, stdout: "yes\n"}, r)
+	r = runWith(fake, "--query-service=https")
+	assert.Equal(t, testRun{code: 1, stdout: "no\n"}, r)
+
+	// changes already in effect are warnings
+	r = runWith(fake, "--add-service=ssh", "--add-service=mdns")
+	assert.Equal(t, testRun{
+		code:   0,
+		stdout: "success\n",
+		stderr: "Warning: ALREADY_ENABLED: ssh\n",
+	}, r)
+
+	r = runWith(fake, "--zone=foo", "--list-all")
+	assert.Equal(t, 112, r.code)
+	assert.Equal(t, "Error: INVALID_ZONE: foo\n", r.stderr)
+}
+
+func TestRun_JSON(t *testing.T) {
+	fake := firewalldtest.New()
+
+	r := runWith(fake, "--json", "--add-port=8080/tcp", "--add-service=ssh")
+	assert.Equal(t, 0, r.code)
+	assert.JSONEq(t, `{"status": "success", "warnings": ["ALREADY_ENABLED: ssh"]}`, r.stdout)
+	assert.Empty(t, r.stderr)
+
+	r = runWith(fake, "--json", "--list-all")
+	require.Equal(t, 0, r.code)
+	var zone zoneOutput
+	require.NoError(t, json.Unmarshal([]byte(r.stdout), &zone))
+	assert.Equal(t, "public", zone.Name)
+	assert.True(t, zone.Default)
+	assert.Equal(t, []string{"8080/tcp"}, zone.Ports)
+	assert.Equal(t, []string{}, zone.RichRules)
+
+	r = runWith(fake, "--json", "--set-default-zone=foo")
+	assert.Equal(t, 112, r.code)
+	assert.JSONEq(t, `{"error": {"code": "INVALID_ZONE", "message": "INVALID_ZONE: foo"}}`, r.stderr)
+
+	r = runWith(fake, "--json", "--query-service=ssh")
+	assert.Equal(t, testRun{code: 0, stdout: "true\n"}, r)
+}
+
+func TestRun_Usage(t *testing.T) {
+	fake := firewalldtest.New()
+
+	r := runWith(fake)
+	assert.Equal(t, testRun{code: 2, stderr: "Error: no action given, see --help\n"}, r)
+	r = runWith(fake, "--get-zones", "--reload")
+	assert.Equal(t, testRun{code: 2, stderr: "Error: more than one action given\n"}, r)
+	r = runWith(fake, "--permanent", "--reload")
+	assert.Equal(t, testRun{code: 2, stderr: "Error: --permanent cannot be used with --reload or --set-default-zone\n"}, r)
+	r = runWith(fake, "--permanent", "--set-default-zone=public")
+	assert.Equal(t, 2, r.code)
+	r = runWith(fake, "--add-port=8080")
+	assert.Equal(t, 102, r.code)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--state"}, &stdout, &stderr,
+		func() (*firewalld.Client, error) { return nil, errors.New("no system bus") })
+	assert.Equal(t, 252, code)
+	assert.Equal(t, "not running\n", stdout.String())
+
+	// the bus is reachable, but firewalld is not running
+	fake.FailOn("org.freedesktop.DBus.Properties.Get", dbus.Error{
+		Name: "org.freedesktop.DBus.Error.ServiceUnknown",
+		Body: []interface{}{"The name org.fedoraproject.FirewallD1 was not provided by any .service files"},
+	})
+	r = runWith(fake, "--state")
+	assert.Equal(t, testRun{code: 252, stdout: "not running\n"}, r)
+	r = runWith(fake, "--version")
+	assert.Equal(t, 252, r.code)
+	fake.FailOn("org.freedesktop.DBus.Properties.Get", nil)
+	r = runWith(fake, "--state")
+	assert.Equal(t, testRun{code: 0, stdout: "running\n"}, r)
+}
+
+func TestExitCode(t *testing.T) {
+	for code, want := range map[string]int{
+		"INVALID_ZONE":    112,
+		"INVALID_POLICY":  140,
+		"ALREADY_ENABLED": 11,
+		"NOT_AUTHORIZED":  253,
+	} {
+		err := dbus.Error{
+			Name: firewalldtest.ExceptionErrorName,
+			Body: []interface{}{code + ": foo"},
+		}
+		assert.Equal(t, want, exitCode(err), code)
+	}
+	assert.Equal(t, exitUnknown, exitCode(errors.New("foo")))
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"routerd.net/go-firewalld"
+)
+
+// output prints results as text in firewall-cmd format or as JSON.
+type output struct {
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// print writes v as JSON or the text version.
+func (o *output) print(v interface{}, text string) {
+	if o.json {
+		o.writeJSON(o.stdout, v)
+		return
+	}
+	if len(text) > 0 {
+		fmt.Fprintln(o.stdout, text)
+	}
+}
+
+// error reports err and returns the exit code.
+func (o *output) error(err error, code int) int {
+	if o.json {
+		o.writeJSON(o.stderr, errorOutput{Error: newErrorDetail(err)})
+	} else {
+		fmt.Fprintln(o.stderr, "Error:", err)
+	}
+	return code
+}
+
+// warning is only printed in text mode, JSON results list the warnings.
+func (o *output) warning(err error) {
+	if !o.json {
+		fmt.Fprintln(o.stderr, "Warning:", err)
+	}
+}
+
+func (o *output) writeJSON(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(o.stderr, "Error:", err)
+	}
+}
+
+type result struct {
+	Status   string   `json:"status"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type errorOutput struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	// firewalld error code, e.g. INVALID_ZONE, empty for other errors.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func newErrorDetail(err error) errorDetail {
+	return errorDetail{Code: firewalld.ErrorCode(err), Message: err.Error()}
+}
+
+type queryOutput struct {
+	Query   string `json:"query"`
+	Enabled bool   `json:"enabled"`
+}
+
+type activeZoneOutput struct {
+	Interfaces []string `json:"interfaces"`
+	Sources    []string `json:"sources"`
+}
+
+// zoneOutput is a zone as listed by firewall-cmd --list-all.
+type zoneOutput struct {
+	Name               string   `json:"name"`
+	Default            bool     `json:"default"`
+	Active             bool     `json:"active"`
+	Target             string   `json:"target"`
+	ICMPBlockInversion bool     `json:"icmp_block_inversion"`
+	Interfaces         []string `json:"interfaces"`
+	Sources            []string `json:"sources"`
+	Services           []string `json:"services"`
+	Ports              []string `json:"ports"`
+	Protocols          []string `json:"protocols"`
+	Masquerade         bool     `json:"masquerade"`
+	ForwardPorts       []string `json:"forward_ports"`
+	SourcePorts        []string `json:"source_ports"`
+	ICMPBlocks         []string `json:"icmp_blocks"`
+	RichRules          []string `json:"rich_rules"`
+}
+
+func newZoneOutput(name string, isDefault bool, z firewalld.ZoneSettings) zoneOutput {
+	var forwardPorts []string
+	for _, fp := range z.ForwardPorts {
+		forwardPorts = append(forwardPorts, fp.String())
+	}
+	return zoneOutput{
+		Name:               name,
+		Default:            isDefault,
+		Active:             len(z.Interfaces) > 0 || len(z.SourceAddresses) > 0,
+		Target:             z.Target,
+		ICMPBlockInversion: z.ICMPBlockInversion,
+		Interfaces:         nonNil(z.Interfaces),
+		Sources:            nonNil(z.SourceAddresses),
+		Services:           nonNil(z.Services),
+		Ports:              portStrings(z.Ports),
+		Protocols:          nonNil(z.Protocols),
+		Masquerade:         z.Masquerade,
+		ForwardPorts:       nonNil(forwardPorts),
+		SourcePorts:        portStrings(z.SourcePorts),
+		ICMPBlocks:         nonNil(z.ICMPBlocks),
+		RichRules:          nonNil(z.RichRules),
+	}
+}
+
+// text formats the zone like firewall-cmd --list-all.
+func (z zoneOutput) text() string {
+	var flags []string
+	if z.Default {
+		flags = append(flags, "default")
+	}
+	if z.Active {
+		flags = append(flags, "active")
+	}
+	title := z.Name
+	if len(flags) > 0 {
+		title += " (" + strings.Join(flags, ", ") + ")"
+	}
+
+	lines := []string{
+		title,
+		"  target: " + z.Target,
+		"  icmp-block-inversion: " + yesNo(z.ICMPBlockInversion),
+		"  interfaces: " + strings.Join(z.Interfaces, " "),
+		"  sources: " + strings.Join(z.Sources, " "),
+		"  services: " + strings.Join(z.Services, " "),
+		"  ports: " + strings.Join(z.Ports, " "),
+		"  protocols: " + strings.Join(z.Protocols, " "),
+		"  masquerade: " + yesNo(z.Masquerade),
+		"  forward-ports: " + strings.Join(z.ForwardPorts, " "),
+		"  source-ports: " + strings.Join(z.SourcePorts, " "),
+		"  icmp-blocks: " + strings.Join(z.ICMPBlocks, " "),
+		"  rich rules: ",
+	}
+	for _, r := range z.RichRules {
+		lines = append(lines, "\t"+r)
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func portStrings(ports []firewalld.Port) []string {
+	out := []string{}
+	for _, p := range ports {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func errorStrings(errs []error) []string {
+	var out []string
+	for _, err := range errs {
+		out = append(out, err.Error())
+	}
+	return out
+}
+
+// nonNil makes empty lists print as [] in JSON.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FirewalldConf is the main configuration file /etc/firewalld/firewalld.conf.
+// Comments, blank lines and the order of keys are preserved,
+// so the file can be edited and written back.
+type FirewalldConf struct {
+	lines []confLine
+}
+
+// confLine is either a key=value pair or raw text (comment or blank line).
+type confLine struct {
+	key   string
+	value string
+	raw   string
+}
+
+// ReadFirewalldConf parses key=value lines. Lines starting with "#" are comments.
+func ReadFirewalldConf(r io.Reader) (*FirewalldConf, error) {
+	c := &FirewalldConf{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			c.lines = append(c.lines, confLine{raw: line})
+			continue
+		}
+
+		parts := strings.SplitN(trimmed, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || len(key) == 0 {
+			return nil, fmt.Errorf("firewalld.conf line %d: expected key=value, got %q", n, line)
+		}
+		c.lines = append(c.lines, confLine{key: key, value: strings.TrimSpace(parts[1])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the value of key and whether it is set.
+// If a key is set multiple times, the last value wins.
+func (c *FirewalldConf) Get(key string) (string, bool) {
+	for i := len(c.lines) - 1; i >= 0; i-- {
+		if c.lines[i].key == key {
+			return c.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+// Set updates the value of key in place, or appends it.
+func (c *FirewalldConf) Set(key, value string) {
+	found := false
+	for i := range c.lines {
+		if c.lines[i].key == key {
+			c.lines[i].value = value
+			found = true
+		}
+	}
+	if !found {
+		c.lines = append(c.lines, confLine{key: key, value: value})
+	}
+}
+
+// Delete removes all values of key.
+func (c *FirewalldConf) Delete(key string) {
+	lines := c.lines[:0]
+	for _, l := range c.lines {
+		if l.key != key {
+			lines = append(lines, l)
+		}
+	}
+	c.lines = lines
+}
+
+// Keys returns all keys in file order.
+func (c *FirewalldConf) Keys() []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, l := range c.lines {
+		if len(l.key) > 0 && !seen[l.key] {
+			keys = append(keys, l.key)
+			seen[l.key] = true
+		}
+	}
+	return keys
+}
+
+// Map returns all keys and values.
+func (c *FirewalldConf) Map() map[string]string {
+	m := map[string]string{}
+	for _, l := range c.lines {
+		if len(l.key) > 0 {
+			m[l.key] = l.value
+		}
+	}
+	return m
+}
+
+// WriteTo writes the file, implementing io.WriterTo.
+func (c *FirewalldConf) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, l := range c.lines {
+		line := l.raw
+		if len(l.key) > 0 {
+			line = l.key + "=" + l.value
+		}
+		n, err := io.WriteString(w, line+"\n")
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewalldConf(t *testing.T) {
+	const in = `# firewalld config file
+
+# default zone
+DefaultZone=public
+CleanupOnExit = yes
+FirewallBackend=nftables
+`
+	c, err := ReadFirewalldConf(strings.NewReader(in))
+	require.NoError(t, err)
+
+	v, ok := c.Get("CleanupOnExit")
+	assert.True(t, ok)
+	assert.Equal(t, "yes", v)
+	_, ok = c.Get("Lockdown")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"DefaultZone", "CleanupOnExit", "FirewallBackend"}, c.Keys())
+
+	c.Set("DefaultZone", "internal")
+	c.Set("Lockdown", "no")
+	c.Delete("FirewallBackend")
+	assert.Equal(t, map[string]string{
+		"DefaultZone": "internal", "CleanupOnExit": "yes", "Lockdown": "no",
+	}, c.Map())
+
+	var buf bytes.Buffer
+	_, err = c.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, `# firewalld config file
+
+# default zone
+DefaultZone=internal
+CleanupOnExit=yes
+Lockdown=no
+`, buf.String())
+
+	_, err = ReadFirewalldConf(strings.NewReader("DefaultZone\n"))
+	assert.EqualError(t, err, `firewalld.conf line 1: expected key=value, got "DefaultZone"`)
+}
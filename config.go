@@ -18,16 +18,19 @@ package firewalld
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
 )
 
 // Client for Firewalld org.fedoraproject.FirewallD1.config.
 // Methods manipulate the persistent firewalld configuration.
 type ConfigClient struct {
-	conn       connection
-	configPath caller
+	conn       Connection
+	configPath Caller
 }
 
-func NewConfigClient(conn connection) *ConfigClient {
+func NewConfigClient(conn Connection) *ConfigClient {
 	return &ConfigClient{
 		conn:       conn,
 		configPath: conn.Object(dbusDest, configPath),
@@ -41,7 +44,7 @@ func (c *ConfigClient) GetZoneNames(
 	ctx context.Context) ([]string, error) {
 	var zoneNames []string
 	return zoneNames, c.configPath.Call(ctx,
-		newCall(configGetZoneNamesMethod, 0).
+		NewCall(configGetZoneNamesMethod, 0).
 			WithReturns(&zoneNames))
 }
 
@@ -52,7 +55,7 @@ func (c *ConfigClient) GetServiceNames(
 	ctx context.Context) ([]string, error) {
 	var serviceNames []string
 	return serviceNames, c.configPath.Call(ctx,
-		newCall(configGetServiceNamesMethod, 0).
+		NewCall(configGetServiceNamesMethod, 0).
 			WithReturns(&serviceNames))
 }
 
@@ -62,7 +65,7 @@ const configListZonesMethod = "org.fedoraproject.FirewallD1.config.listZones"
 func (c *ConfigClient) ListZones(
 	ctx context.Context) (zonePaths []string, err error) {
 	return zonePaths, c.configPath.Call(ctx,
-		newCall(configListZonesMethod, 0).
+		NewCall(configListZonesMethod, 0).
 			WithReturns(&zonePaths))
 }
 
@@ -72,7 +75,7 @@ const configGetZoneByNameMethod = "org.fedoraproject.FirewallD1.config.getZoneBy
 func (c *ConfigClient) GetZoneByName(
 	ctx context.Context, zoneName string) (zonePath string, err error) {
 	return zonePath, c.configPath.Call(ctx,
-		newCall(configGetZoneByNameMethod, 0).
+		NewCall(configGetZoneByNameMethod, 0).
 			WithArguments(zoneName).
 			WithReturns(&zonePath))
 }
@@ -83,7 +86,7 @@ const configGetServiceByNameMethod = "org.fedoraproject.FirewallD1.config.getSer
 func (c *ConfigClient) GetServiceByName(
 	ctx context.Context, serviceName string) (servicePath string, err error) {
 	return servicePath, c.configPath.Call(ctx,
-		newCall(configGetServiceByNameMethod, 0).
+		NewCall(configGetServiceByNameMethod, 0).
 			WithArguments(serviceName).
 			WithReturns(&servicePath))
 }
@@ -99,18 +102,23 @@ func (c *ConfigClient) RemoveZone(
 		return err
 	}
 	return c.conn.Object(dbusDest, path).
-		Call(ctx, newCall(configZoneRemoveMethod, 0))
+		Call(ctx, NewCall(configZoneRemoveMethod, 0))
 }
 
 const addZoneMethod = "org.fedoraproject.FirewallD1.config.addZone"
 
 // Add zone with given settings into permanent configuration.
+// Settings are validated before they are sent to the daemon.
 func (c *ConfigClient) AddZone(
 	ctx context.Context, zoneName string, settings ZoneSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
 	var z interface{}
 	return c.configPath.Call(ctx,
-		newCall(addZoneMethod, 0).
-			WithArguments(zoneName, settings.ToSlice()).
+		NewCall(addZoneMethod, 0).
+			WithArguments(zoneName, settings.toStruct()).
 			WithReturns(&z))
 }
 
@@ -127,11 +135,531 @@ func (c *ConfigClient) GetZoneSettings(
 	var zoneSettings []interface{}
 	err = c.conn.Object(dbusDest, path).
 		Call(ctx,
-			newCall(configZoneGetSettingsMethod, 0).
+			NewCall(configZoneGetSettingsMethod, 0).
 				WithReturns(&zoneSettings))
 	if err != nil {
 		return ZoneSettings{}, err
 	}
 
-	return ZoneSettingsFromSlice(zoneSettings), nil
+	settings, err := ZoneSettingsFromSlice(zoneSettings)
+	if err != nil {
+		return ZoneSettings{}, fmt.Errorf("zone %q: %w", zoneName, err)
+	}
+	return settings, nil
+}
+
+const configZoneUpdateMethod = "org.fedoraproject.FirewallD1.config.zone.update"
+
+// Update permanent settings of given zone.
+func (c *ConfigClient) UpdateZone(
+	ctx context.Context, zoneName string, settings ZoneSettings) error {
+	path, err := c.GetZoneByName(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configZoneUpdateMethod, 0).
+				WithArguments(settings.toStruct()))
+}
+
+const configServiceGetSettingsMethod = "org.fedoraproject.FirewallD1.config.service.getSettings"
+
+// Return permanent settings of given service.
+func (c *ConfigClient) GetServiceSettings(
+	ctx context.Context, serviceName string) (ServiceSettings, error) {
+	path, err := c.GetServiceByName(ctx, serviceName)
+	if err != nil {
+		return ServiceSettings{}, err
+	}
+
+	var serviceSettings []interface{}
+	err = c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configServiceGetSettingsMethod, 0).
+				WithReturns(&serviceSettings))
+	if err != nil {
+		return ServiceSettings{}, err
+	}
+
+	settings, err := ServiceSettingsFromSlice(serviceSettings)
+	if err != nil {
+		return ServiceSettings{}, fmt.Errorf("service %q: %w", serviceName, err)
+	}
+	return settings, nil
+}
+
+const configGetIPSetNamesMethod = "org.fedoraproject.FirewallD1.config.getIPSetNames"
+
+// Return list of ipset names (permanent configuration).
+func (c *ConfigClient) GetIPSetNames(
+	ctx context.Context) ([]string, error) {
+	var ipsetNames []string
+	return ipsetNames, c.configPath.Call(ctx,
+		NewCall(configGetIPSetNamesMethod, 0).
+			WithReturns(&ipsetNames))
+}
+
+const configGetIPSetByNameMethod = "org.fedoraproject.FirewallD1.config.getIPSetByName"
+
+// Return object path (permanent configuration) of ipset with given name.
+func (c *ConfigClient) GetIPSetByName(
+	ctx context.Context, ipsetName string) (ipsetPath string, err error) {
+	return ipsetPath, c.configPath.Call(ctx,
+		NewCall(configGetIPSetByNameMethod, 0).
+			WithArguments(ipsetName).
+			WithReturns(&ipsetPath))
+}
+
+const configIPSetGetSettingsMethod = "org.fedoraproject.FirewallD1.config.ipset.getSettings"
+
+// Return permanent settings of given ipset.
+func (c *ConfigClient) GetIPSetSettings(
+	ctx context.Context, ipsetName string) (IPSetSettings, error) {
+	path, err := c.GetIPSetByName(ctx, ipsetName)
+	if err != nil {
+		return IPSetSettings{}, err
+	}
+
+	var ipsetSettings []interface{}
+	err = c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configIPSetGetSettingsMethod, 0).
+				WithReturns(&ipsetSettings))
+	if err != nil {
+		return IPSetSettings{}, err
+	}
+
+	settings, err := IPSetSettingsFromSlice(ipsetSettings)
+	if err != nil {
+		return IPSetSettings{}, fmt.Errorf("ipset %q: %w", ipsetName, err)
+	}
+	return settings, nil
+}
+
+const configGetPolicyNamesMethod = "org.fedoraproject.FirewallD1.config.getPolicyNames"
+
+// Return list of policy names (permanent configuration).
+func (c *ConfigClient) GetPolicyNames(
+	ctx context.Context) ([]string, error) {
+	var policyNames []string
+	return policyNames, c.configPath.Call(ctx,
+		NewCall(configGetPolicyNamesMethod, 0).
+			WithReturns(&policyNames))
+}
+
+const configGetPolicyByNameMethod = "org.fedoraproject.FirewallD1.config.getPolicyByName"
+
+// Return object path (permanent configuration) of policy with given name.
+func (c *ConfigClient) GetPolicyByName(
+	ctx context.Context, policyName string) (policyPath string, err error) {
+	return policyPath, c.configPath.Call(ctx,
+		NewCall(configGetPolicyByNameMethod, 0).
+			WithArguments(policyName).
+			WithReturns(&policyPath))
+}
+
+const configPolicyGetSettingsMethod = "org.fedoraproject.FirewallD1.config.policy.getSettings"
+
+// Return permanent settings of given policy.
+func (c *ConfigClient) GetPolicySettings(
+	ctx context.Context, policyName string) (PolicySettings, error) {
+	path, err := c.GetPolicyByName(ctx, policyName)
+	if err != nil {
+		return PolicySettings{}, err
+	}
+
+	var policySettings map[string]dbus.Variant
+	err = c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configPolicyGetSettingsMethod, 0).
+				WithReturns(&policySettings))
+	if err != nil {
+		return PolicySettings{}, err
+	}
+
+	settings, err := PolicySettingsFromMap(policySettings)
+	if err != nil {
+		return PolicySettings{}, fmt.Errorf("policy %q: %w", policyName, err)
+	}
+	return settings, nil
+}
+
+const addServiceMethod = "org.fedoraproject.FirewallD1.config.addService"
+
+// Add service with given settings into permanent configuration.
+func (c *ConfigClient) AddService(
+	ctx context.Context, serviceName string, settings ServiceSettings) error {
+	var s interface{}
+	return c.configPath.Call(ctx,
+		NewCall(addServiceMethod, 0).
+			WithArguments(serviceName, settings.toStruct()).
+			WithReturns(&s))
+}
+
+const configServiceUpdateMethod = "org.fedoraproject.FirewallD1.config.service.update"
+
+// Update permanent settings of given service.
+func (c *ConfigClient) UpdateService(
+	ctx context.Context, serviceName string, settings ServiceSettings) error {
+	path, err := c.GetServiceByName(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configServiceUpdateMethod, 0).
+				WithArguments(settings.toStruct()))
+}
+
+const configServiceRemoveMethod = "org.fedoraproject.FirewallD1.config.service.remove"
+
+// Remove service from permanent configuration.
+func (c *ConfigClient) RemoveService(
+	ctx context.Context, serviceName string) error {
+	path, err := c.GetServiceByName(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx, NewCall(configServiceRemoveMethod, 0))
+}
+
+const addIPSetMethod = "org.fedoraproject.FirewallD1.config.addIPSet"
+
+// Add ipset with given settings into permanent configuration.
+func (c *ConfigClient) AddIPSet(
+	ctx context.Context, ipsetName string, settings IPSetSettings) error {
+	var s interface{}
+	return c.configPath.Call(ctx,
+		NewCall(addIPSetMethod, 0).
+			WithArguments(ipsetName, settings.toStruct()).
+			WithReturns(&s))
+}
+
+const configIPSetUpdateMethod = "org.fedoraproject.FirewallD1.config.ipset.update"
+
+// Update permanent settings of given ipset.
+func (c *ConfigClient) UpdateIPSet(
+	ctx context.Context, ipsetName string, settings IPSetSettings) error {
+	path, err := c.GetIPSetByName(ctx, ipsetName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configIPSetUpdateMethod, 0).
+				WithArguments(settings.toStruct()))
+}
+
+const configIPSetRemoveMethod = "org.fedoraproject.FirewallD1.config.ipset.remove"
+
+// Remove ipset from permanent configuration.
+func (c *ConfigClient) RemoveIPSet(
+	ctx context.Context, ipsetName string) error {
+	path, err := c.GetIPSetByName(ctx, ipsetName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx, NewCall(configIPSetRemoveMethod, 0))
+}
+
+const addPolicyMethod = "org.fedoraproject.FirewallD1.config.addPolicy"
+
+// Add policy with given settings into permanent configuration.
+func (c *ConfigClient) AddPolicy(
+	ctx context.Context, policyName string, settings PolicySettings) error {
+	var s interface{}
+	return c.configPath.Call(ctx,
+		NewCall(addPolicyMethod, 0).
+			WithArguments(policyName, settings.ToMap()).
+			WithReturns(&s))
+}
+
+const configPolicyUpdateMethod = "org.fedoraproject.FirewallD1.config.policy.update"
+
+// Update permanent settings of given policy.
+func (c *ConfigClient) UpdatePolicy(
+	ctx context.Context, policyName string, settings PolicySettings) error {
+	path, err := c.GetPolicyByName(ctx, policyName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configPolicyUpdateMethod, 0).
+				WithArguments(settings.ToMap()))
+}
+
+const configPolicyRemoveMethod = "org.fedoraproject.FirewallD1.config.policy.remove"
+
+// Remove policy from permanent configuration.
+func (c *ConfigClient) RemovePolicy(
+	ctx context.Context, policyName string) error {
+	path, err := c.GetPolicyByName(ctx, policyName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx, NewCall(configPolicyRemoveMethod, 0))
+}
+
+const configGetHelperNamesMethod = "org.fedoraproject.FirewallD1.config.getHelperNames"
+
+// Return list of helper names (permanent configuration).
+func (c *ConfigClient) GetHelperNames(
+	ctx context.Context) ([]string, error) {
+	var helperNames []string
+	return helperNames, c.configPath.Call(ctx,
+		NewCall(configGetHelperNamesMethod, 0).
+			WithReturns(&helperNames))
+}
+
+const configGetHelperByNameMethod = "org.fedoraproject.FirewallD1.config.getHelperByName"
+
+// Return object path (permanent configuration) of helper with given name.
+func (c *ConfigClient) GetHelperByName(
+	ctx context.Context, helperName string) (helperPath string, err error) {
+	return helperPath, c.configPath.Call(ctx,
+		NewCall(configGetHelperByNameMethod, 0).
+			WithArguments(helperName).
+			WithReturns(&helperPath))
+}
+
+const configHelperGetSettingsMethod = "org.fedoraproject.FirewallD1.config.helper.getSettings"
+
+// Return permanent settings of given helper.
+func (c *ConfigClient) GetHelperSettings(
+	ctx context.Context, helperName string) (HelperSettings, error) {
+	path, err := c.GetHelperByName(ctx, helperName)
+	if err != nil {
+		return HelperSettings{}, err
+	}
+
+	var helperSettings []interface{}
+	err = c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configHelperGetSettingsMethod, 0).
+				WithReturns(&helperSettings))
+	if err != nil {
+		return HelperSettings{}, err
+	}
+
+	settings, err := HelperSettingsFromSlice(helperSettings)
+	if err != nil {
+		return HelperSettings{}, fmt.Errorf("helper %q: %w", helperName, err)
+	}
+	return settings, nil
+}
+
+const addHelperMethod = "org.fedoraproject.FirewallD1.config.addHelper"
+
+// Add helper with given settings into permanent configuration.
+func (c *ConfigClient) AddHelper(
+	ctx context.Context, helperName string, settings HelperSettings) error {
+	var s interface{}
+	return c.configPath.Call(ctx,
+		NewCall(addHelperMethod, 0).
+			WithArguments(helperName, settings.toStruct()).
+			WithReturns(&s))
+}
+
+const configHelperUpdateMethod = "org.fedoraproject.FirewallD1.config.helper.update"
+
+// Update permanent settings of given helper.
+func (c *ConfigClient) UpdateHelper(
+	ctx context.Context, helperName string, settings HelperSettings) error {
+	path, err := c.GetHelperByName(ctx, helperName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configHelperUpdateMethod, 0).
+				WithArguments(settings.toStruct()))
+}
+
+const configHelperRemoveMethod = "org.fedoraproject.FirewallD1.config.helper.remove"
+
+// Remove helper from permanent configuration.
+func (c *ConfigClient) RemoveHelper(
+	ctx context.Context, helperName string) error {
+	path, err := c.GetHelperByName(ctx, helperName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx, NewCall(configHelperRemoveMethod, 0))
+}
+
+const configGetICMPTypeNamesMethod = "org.fedoraproject.FirewallD1.config.getIcmpTypeNames"
+
+// Return list of icmptype names (permanent configuration).
+func (c *ConfigClient) GetICMPTypeNames(
+	ctx context.Context) ([]string, error) {
+	var icmptypeNames []string
+	return icmptypeNames, c.configPath.Call(ctx,
+		NewCall(configGetICMPTypeNamesMethod, 0).
+			WithReturns(&icmptypeNames))
+}
+
+const configGetICMPTypeByNameMethod = "org.fedoraproject.FirewallD1.config.getIcmpTypeByName"
+
+// Return object path (permanent configuration) of icmptype with given name.
+func (c *ConfigClient) GetICMPTypeByName(
+	ctx context.Context, icmptypeName string) (icmptypePath string, err error) {
+	return icmptypePath, c.configPath.Call(ctx,
+		NewCall(configGetICMPTypeByNameMethod, 0).
+			WithArguments(icmptypeName).
+			WithReturns(&icmptypePath))
+}
+
+const configICMPTypeGetSettingsMethod = "org.fedoraproject.FirewallD1.config.icmptype.getSettings"
+
+// Return permanent settings of given icmptype.
+func (c *ConfigClient) GetICMPTypeSettings(
+	ctx context.Context, icmptypeName string) (ICMPTypeSettings, error) {
+	path, err := c.GetICMPTypeByName(ctx, icmptypeName)
+	if err != nil {
+		return ICMPTypeSettings{}, err
+	}
+
+	var icmptypeSettings []interface{}
+	err = c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configICMPTypeGetSettingsMethod, 0).
+				WithReturns(&icmptypeSettings))
+	if err != nil {
+		return ICMPTypeSettings{}, err
+	}
+
+	settings, err := ICMPTypeSettingsFromSlice(icmptypeSettings)
+	if err != nil {
+		return ICMPTypeSettings{}, fmt.Errorf("icmptype %q: %w", icmptypeName, err)
+	}
+	return settings, nil
+}
+
+const addICMPTypeMethod = "org.fedoraproject.FirewallD1.config.addIcmpType"
+
+// Add icmptype with given settings into permanent configuration.
+func (c *ConfigClient) AddICMPType(
+	ctx context.Context, icmptypeName string, settings ICMPTypeSettings) error {
+	var s interface{}
+	return c.configPath.Call(ctx,
+		NewCall(addICMPTypeMethod, 0).
+			WithArguments(icmptypeName, settings.toStruct()).
+			WithReturns(&s))
+}
+
+const configICMPTypeUpdateMethod = "org.fedoraproject.FirewallD1.config.icmptype.update"
+
+// Update permanent settings of given icmptype.
+func (c *ConfigClient) UpdateICMPType(
+	ctx context.Context, icmptypeName string, settings ICMPTypeSettings) error {
+	path, err := c.GetICMPTypeByName(ctx, icmptypeName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(configICMPTypeUpdateMethod, 0).
+				WithArguments(settings.toStruct()))
+}
+
+const configICMPTypeRemoveMethod = "org.fedoraproject.FirewallD1.config.icmptype.remove"
+
+// Remove icmptype from permanent configuration.
+func (c *ConfigClient) RemoveICMPType(
+	ctx context.Context, icmptypeName string) error {
+	path, err := c.GetICMPTypeByName(ctx, icmptypeName)
+	if err != nil {
+		return err
+	}
+	return c.conn.Object(dbusDest, path).
+		Call(ctx, NewCall(configICMPTypeRemoveMethod, 0))
+}
+
+const configDirectGetSettingsMethod = "org.fedoraproject.FirewallD1.config.direct.getSettings"
+
+// Return permanent direct chains, rules and passthroughs.
+func (c *ConfigClient) GetDirectSettings(
+	ctx context.Context) (DirectSettings, error) {
+	var directSettings []interface{}
+	err := c.configPath.Call(ctx,
+		NewCall(configDirectGetSettingsMethod, 0).
+			WithReturns(&directSettings))
+	if err != nil {
+		return DirectSettings{}, err
+	}
+	return DirectSettingsFromSlice(directSettings)
+}
+
+const configDirectUpdateMethod = "org.fedoraproject.FirewallD1.config.direct.update"
+
+// Replace permanent direct chains, rules and passthroughs.
+func (c *ConfigClient) UpdateDirectSettings(
+	ctx context.Context, settings DirectSettings) error {
+	return c.configPath.Call(ctx,
+		NewCall(configDirectUpdateMethod, 0).
+			WithArguments(settings.toStruct()))
+}
+
+const configGetLockdownWhitelistMethod = "org.fedoraproject.FirewallD1.config.policies.getLockdownWhitelist"
+
+// Return permanent lockdown whitelist.
+func (c *ConfigClient) GetLockdownWhitelist(
+	ctx context.Context) (LockdownWhitelist, error) {
+	var whitelist []interface{}
+	err := c.configPath.Call(ctx,
+		NewCall(configGetLockdownWhitelistMethod, 0).
+			WithReturns(&whitelist))
+	if err != nil {
+		return LockdownWhitelist{}, err
+	}
+	return LockdownWhitelistFromSlice(whitelist)
+}
+
+const configSetLockdownWhitelistMethod = "org.fedoraproject.FirewallD1.config.policies.setLockdownWhitelist"
+
+// Replace permanent lockdown whitelist.
+func (c *ConfigClient) SetLockdownWhitelist(
+	ctx context.Context, whitelist LockdownWhitelist) error {
+	return c.configPath.Call(ctx,
+		NewCall(configSetLockdownWhitelistMethod, 0).
+			WithArguments(whitelist.toStruct()))
+}
+
+const getAllPropertiesMethod = propertiesInterface + ".GetAll"
+
+// Return properties of the permanent configuration, which mirror firewalld.conf,
+// e.g. "FirewallBackend" or "LogDenied".
+func (c *ConfigClient) GetProperties(
+	ctx context.Context) (map[string]dbus.Variant, error) {
+	var properties map[string]dbus.Variant
+	return properties, c.configPath.Call(ctx,
+		NewCall(getAllPropertiesMethod, 0).
+			WithArguments(configInterface).
+			WithReturns(&properties))
+}
+
+// Change a property of the permanent configuration.
+// The value must have the type of the property, e.g. string for "LogDenied".
+func (c *ConfigClient) SetProperty(
+	ctx context.Context, name string, value interface{}) error {
+	return c.configPath.Call(ctx,
+		NewCall(setPropertyMethod, 0).
+			WithArguments(configInterface, name, dbus.MakeVariant(value)))
+}
+
+// isBuiltin returns true if the config object at path is shipped with firewalld
+// and can not be removed.
+func (c *ConfigClient) isBuiltin(
+	ctx context.Context, path, iface string) (builtin bool, err error) {
+	return builtin, c.conn.Object(dbusDest, path).
+		Call(ctx,
+			NewCall(getPropertyMethod, 0).
+				WithArguments(iface, "builtin").
+				WithReturns(&builtin))
 }
@@ -18,8 +18,10 @@ package firewalld
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -46,7 +48,7 @@ func TestConfigClient_GetZoneNames(t *testing.T) {
 	configPathCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*[]string)
 			*s = response
 		}).
@@ -67,7 +69,7 @@ func TestConfigClient_GetServiceNames(t *testing.T) {
 	configPathCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*[]string)
 			*s = response
 		}).
@@ -92,7 +94,7 @@ func TestConfigClient_ListZones(t *testing.T) {
 	configPathCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*[]string)
 			*s = response
 		}).
@@ -113,7 +115,7 @@ func TestConfigClient_GetZoneByName(t *testing.T) {
 	configPathCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*string)
 			*s = response
 		}).
@@ -134,7 +136,7 @@ func TestConfigClient_GetServiceByName(t *testing.T) {
 	configPathCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*string)
 			*s = response
 		}).
@@ -154,11 +156,11 @@ func TestConfigClient_RemoveZone(t *testing.T) {
 	configPathCaller, conn, c := configClientSetup()
 	configPathCaller.
 		On("Call", mock.Anything, mock.MatchedBy(func(o interface{}) bool {
-			c := o.(call)
+			c := o.(Call)
 			return c.Method == configGetZoneByNameMethod
 		})).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*string)
 			*s = path
 		}).
@@ -186,10 +188,27 @@ func TestConfigClient_AddZone(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := c.AddZone(ctx, "ssh", ZoneSettings{})
+	err := c.AddZone(ctx, "ssh", ZoneSettings{Target: "default"})
 	require.NoError(t, err)
 }
 
+func TestConfigClient_AddZone_Invalid(t *testing.T) {
+	configPathCaller, _, c := configClientSetup()
+
+	ctx := context.Background()
+
+	err := c.AddZone(ctx, "ssh", ZoneSettings{
+		Target: "REJECT",
+		Ports:  []Port{{Port: "22", Protocol: "tcpp"}},
+	})
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Errors, 2)
+	configPathCaller.AssertNotCalled(t, "Call", mock.Anything, mock.Anything)
+}
+
 func TestClient_GetZoneSettings(t *testing.T) {
 	expected := ZoneSettings{
 		Version:     "",
@@ -248,11 +267,11 @@ func TestClient_GetZoneSettings(t *testing.T) {
 	configPathCaller, conn, c := configClientSetup()
 	configPathCaller.
 		On("Call", mock.Anything, mock.MatchedBy(func(o interface{}) bool {
-			c := o.(call)
+			c := o.(Call)
 			return c.Method == configGetZoneByNameMethod
 		})).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*string)
 			*s = path
 		}).
@@ -265,7 +284,7 @@ func TestClient_GetZoneSettings(t *testing.T) {
 	zoneObjectCaller.
 		On("Call", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			c := args.Get(1).(call)
+			c := args.Get(1).(Call)
 			s := c.Returns[0].(*[]interface{})
 			*s = response
 		}).
@@ -278,3 +297,286 @@ func TestClient_GetZoneSettings(t *testing.T) {
 
 	assert.Equal(t, expected, settings)
 }
+
+func TestConfigClient_GetZoneSettings_DecodeError(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/zone/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetZoneByNameMethod, path)
+
+	zoneObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(zoneObjectCaller)
+	onMethod(zoneObjectCaller, configZoneGetSettingsMethod, []interface{}{
+		"", "Public", "", false, "default", "ssh",
+	})
+
+	ctx := context.Background()
+
+	_, err := c.GetZoneSettings(ctx, "public")
+	require.Error(t, err)
+	assert.EqualError(t, err,
+		`zone "public": decode zone settings: expected at least 13 fields, got 6`)
+
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+}
+
+func TestConfigClient_GetServiceSettings(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/service/138"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetServiceByNameMethod, path)
+
+	serviceObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(serviceObjectCaller)
+	onMethod(serviceObjectCaller, configServiceGetSettingsMethod, []interface{}{
+		"", "SSH", "Secure Shell",
+		[][]interface{}{{"22", "tcp"}},
+		[]string{}, map[string]string{}, []string{}, [][]interface{}{},
+	})
+
+	ctx := context.Background()
+
+	settings, err := c.GetServiceSettings(ctx, "ssh")
+	require.NoError(t, err)
+
+	assert.Equal(t, ServiceSettings{
+		Name:         "SSH",
+		Description:  "Secure Shell",
+		Ports:        []Port{{Port: "22", Protocol: "tcp"}},
+		ModuleNames:  []string{},
+		Destinations: map[string]string{},
+		Protocols:    []string{},
+	}, settings)
+}
+
+func TestConfigClient_GetIPSetNames(t *testing.T) {
+	response := []string{"blocklist", "mgmt"}
+
+	configPathCaller, _, c := configClientSetup()
+	onMethod(configPathCaller, configGetIPSetNamesMethod, response)
+
+	ctx := context.Background()
+
+	ipsets, err := c.GetIPSetNames(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, response, ipsets)
+}
+
+func TestConfigClient_GetIPSetSettings(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/ipset/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetIPSetByNameMethod, path)
+
+	ipsetObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(ipsetObjectCaller)
+	onMethod(ipsetObjectCaller, configIPSetGetSettingsMethod, []interface{}{
+		"", "", "", "hash:net",
+		map[string]string{"family": "inet6"},
+		[]string{"2001:db8::/32"},
+	})
+
+	ctx := context.Background()
+
+	settings, err := c.GetIPSetSettings(ctx, "blocklist")
+	require.NoError(t, err)
+
+	assert.Equal(t, IPSetSettings{
+		Type:    "hash:net",
+		Options: map[string]string{"family": "inet6"},
+		Entries: []string{"2001:db8::/32"},
+	}, settings)
+}
+
+func TestConfigClient_GetPolicyNames(t *testing.T) {
+	response := []string{"allow-host-ipv6"}
+
+	configPathCaller, _, c := configClientSetup()
+	onMethod(configPathCaller, configGetPolicyNamesMethod, response)
+
+	ctx := context.Background()
+
+	policies, err := c.GetPolicyNames(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, response, policies)
+}
+
+func TestConfigClient_GetPolicySettings(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/policy/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetPolicyByNameMethod, path)
+
+	policyObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(policyObjectCaller)
+	onMethod(policyObjectCaller, configPolicyGetSettingsMethod, map[string]dbus.Variant{
+		"target":        dbus.MakeVariant("REJECT"),
+		"priority":      dbus.MakeVariant(int32(-15000)),
+		"ingress_zones": dbus.MakeVariant([]string{"ANY"}),
+		"egress_zones":  dbus.MakeVariant([]string{"HOST"}),
+		"masquerade":    dbus.MakeVariant(false),
+	})
+
+	ctx := context.Background()
+
+	settings, err := c.GetPolicySettings(ctx, "allow-host-ipv6")
+	require.NoError(t, err)
+
+	assert.Equal(t, PolicySettings{
+		Target:       "REJECT",
+		Priority:     -15000,
+		IngressZones: []string{"ANY"},
+		EgressZones:  []string{"HOST"},
+	}, settings)
+}
+
+func TestConfigClient_UpdateZone(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/zone/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetZoneByNameMethod, path)
+
+	zoneObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(zoneObjectCaller)
+	zoneObjectCaller.
+		On("Call", mock.Anything, mock.Anything).
+		Return(nil)
+
+	ctx := context.Background()
+
+	settings := ZoneSettings{Target: "DROP"}
+	err := c.UpdateZone(ctx, "public", settings)
+	require.NoError(t, err)
+
+	zoneObjectCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    configZoneUpdateMethod,
+		Arguments: []interface{}{settings.toStruct()},
+	})
+}
+
+func TestConfigClient_AddService(t *testing.T) {
+	configPathCaller, _, c := configClientSetup()
+	configPathCaller.
+		On("Call", mock.Anything, mock.Anything).
+		Return(nil)
+
+	ctx := context.Background()
+
+	err := c.AddService(ctx, "custom", ServiceSettings{
+		Ports: []Port{{Port: "8080", Protocol: "tcp"}},
+	})
+	require.NoError(t, err)
+}
+
+func TestConfigClient_RemoveIPSet(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/ipset/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetIPSetByNameMethod, path)
+
+	ipsetObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(ipsetObjectCaller)
+	ipsetObjectCaller.
+		On("Call", mock.Anything, mock.Anything).
+		Return(nil)
+
+	ctx := context.Background()
+
+	err := c.RemoveIPSet(ctx, "blocklist")
+	require.NoError(t, err)
+
+	ipsetObjectCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method: configIPSetRemoveMethod,
+	})
+}
+
+func TestConfigClient_AddPolicy(t *testing.T) {
+	configPathCaller, _, c := configClientSetup()
+	configPathCaller.
+		On("Call", mock.Anything, mock.Anything).
+		Return(nil)
+
+	ctx := context.Background()
+
+	settings := PolicySettings{
+		Target:       "ACCEPT",
+		IngressZones: []string{"internal"},
+		EgressZones:  []string{"external"},
+		Ports:        []Port{{Port: "53", Protocol: "udp"}},
+	}
+	err := c.AddPolicy(ctx, "internal-external", settings)
+	require.NoError(t, err)
+
+	configPathCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    addPolicyMethod,
+		Arguments: []interface{}{"internal-external", settings.ToMap()},
+		Returns:   []interface{}{new(interface{})},
+	})
+	m := settings.ToMap()
+	assert.Equal(t, "a(ss)", m["ports"].Signature().String())
+	assert.Equal(t, "as", m["ingress_zones"].Signature().String())
+}
+
+func TestConfigClient_GetHelperSettings(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/helper/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetHelperByNameMethod, path)
+
+	helperObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(helperObjectCaller)
+	onMethod(helperObjectCaller, configHelperGetSettingsMethod, []interface{}{
+		"", "", "FTP connection tracking helper", "", "nf_conntrack_ftp",
+		[][]interface{}{{"21", "tcp"}},
+	})
+
+	ctx := context.Background()
+
+	settings, err := c.GetHelperSettings(ctx, "ftp")
+	require.NoError(t, err)
+
+	assert.Equal(t, HelperSettings{
+		Description: "FTP connection tracking helper",
+		Module:      "nf_conntrack_ftp",
+		Ports:       []Port{{Port: "21", Protocol: "tcp"}},
+	}, settings)
+}
+
+func TestConfigClient_GetICMPTypeSettings(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/icmptype/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetICMPTypeByNameMethod, path)
+
+	icmptypeObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(icmptypeObjectCaller)
+	onMethod(icmptypeObjectCaller, configICMPTypeGetSettingsMethod, []interface{}{
+		"", "Echo Request (ping)", "", []string{"ipv4", "ipv6"},
+	})
+
+	settings, err := c.GetICMPTypeSettings(context.Background(), "echo-request")
+	require.NoError(t, err)
+	assert.Equal(t, ICMPTypeSettings{
+		Name:         "Echo Request (ping)",
+		Destinations: []string{"ipv4", "ipv6"},
+	}, settings)
+}
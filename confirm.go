@@ -0,0 +1,278 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConfirmSnapshot is the configuration captured before a confirmed commit.
+type ConfirmSnapshot struct {
+	// Point in time after which the snapshot should be restored.
+	Deadline time.Time `json:"deadline"`
+	Snapshot *Snapshot `json:"snapshot"`
+}
+
+// ErrCommitReverted is returned by Confirm, when the deadline has already passed.
+var ErrCommitReverted = errors.New("commit has been reverted")
+
+// PendingCommit is a change that is reverted unless confirmed before its deadline.
+type PendingCommit struct {
+	client       *Client
+	snapshot     *ConfirmSnapshot
+	snapshotPath string
+	timer        *time.Timer
+	done         chan struct{}
+
+	mu        sync.Mutex
+	confirmed bool
+	reverted  bool
+	err       error
+}
+
+// CommitConfirmed applies changes, that are automatically reverted unless confirmed within timeout.
+// Like "commit confirmed" on network equipment, this protects against changes
+// that lock out the operator applying them.
+//
+// Before apply is called, the complete permanent and runtime configuration is captured by Snapshot
+// and persisted to snapshotPath. The calling process holds a timer reverting to the snapshot.
+// To survive the death of the calling process (e.g. a dropped SSH session),
+// a helper should call RevertExpiredCommit with the same snapshotPath after the deadline.
+// Whichever of the two starts first moves the snapshot to snapshotPath+".reverting",
+// so it is reverted only once.
+//
+// If apply fails, the snapshot is restored immediately.
+func (c *Client) CommitConfirmed(
+	ctx context.Context, timeout time.Duration, snapshotPath string,
+	apply func(ctx context.Context, c *Client) error,
+) (*PendingCommit, error) {
+	captured, err := c.Snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	snapshot := &ConfirmSnapshot{Deadline: time.Now().Add(timeout), Snapshot: captured}
+	if err := writeConfirmSnapshot(snapshotPath, snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := apply(ctx, c); err != nil {
+		if rErr := c.RevertSnapshot(context.Background(), snapshot); rErr != nil {
+			return nil, fmt.Errorf("%w (revert failed: %v)", err, rErr)
+		}
+		_ = os.Remove(snapshotPath)
+		return nil, err
+	}
+
+	p := &PendingCommit{
+		client:       c,
+		snapshot:     snapshot,
+		snapshotPath: snapshotPath,
+		done:         make(chan struct{}),
+	}
+	p.timer = time.AfterFunc(time.Until(snapshot.Deadline), p.revert)
+	return p, nil
+}
+
+// Confirm keeps the applied changes.
+// Returns ErrCommitReverted if the deadline has already passed
+// or a helper has started reverting the snapshot.
+func (p *PendingCommit) Confirm() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reverted {
+		return ErrCommitReverted
+	}
+	if p.confirmed {
+		return nil
+	}
+	p.timer.Stop()
+
+	err := os.Remove(p.snapshotPath)
+	if os.IsNotExist(err) {
+		// claimed by RevertExpiredCommit, the timer will not revert it again
+		p.reverted = true
+		close(p.done)
+		return ErrCommitReverted
+	}
+	p.confirmed = true
+	close(p.done)
+	return err
+}
+
+// Deadline returns the point in time the commit is reverted at, unless confirmed.
+func (p *PendingCommit) Deadline() time.Time {
+	return p.snapshot.Deadline
+}
+
+// Done is closed when the commit has been confirmed or reverted.
+func (p *PendingCommit) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error of the automatic revert, if any.
+func (p *PendingCommit) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *PendingCommit) revert() {
+	p.mu.Lock()
+	if p.confirmed || p.reverted {
+		p.mu.Unlock()
+		return
+	}
+	p.reverted = true
+	claimed, err := claimConfirmSnapshot(p.snapshotPath)
+	p.mu.Unlock()
+
+	switch {
+	case os.IsNotExist(err):
+		// confirmed or claimed by RevertExpiredCommit
+		err = nil
+	case err != nil:
+		// the snapshot file is unusable, revert anyway
+		err = p.client.RevertSnapshot(context.Background(), p.snapshot)
+	default:
+		err = p.client.RevertSnapshot(context.Background(), p.snapshot)
+		if rErr := releaseConfirmSnapshot(p.snapshotPath, claimed, err); err == nil {
+			err = rErr
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	close(p.done)
+}
+
+// RevertExpiredCommit restores the snapshot persisted by CommitConfirmed,
+// if its deadline has passed and it has not been confirmed.
+// Meant to be called from a helper process, e.g. a systemd timer.
+// Returns true if the snapshot has been restored.
+func (c *Client) RevertExpiredCommit(
+	ctx context.Context, snapshotPath string) (bool, error) {
+	snapshot, err := ReadConfirmSnapshot(snapshotPath)
+	if os.IsNotExist(err) {
+		// confirmed or already reverted
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Now().Before(snapshot.Deadline) {
+		return false, nil
+	}
+
+	claimed, err := claimConfirmSnapshot(snapshotPath)
+	if os.IsNotExist(err) {
+		// confirmed or claimed by the timer of the committing process meanwhile
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// the file may have been replaced by a new commit before it was claimed
+	snapshot, err = ReadConfirmSnapshot(claimed)
+	if err == nil && time.Now().Before(snapshot.Deadline) {
+		return false, os.Rename(claimed, snapshotPath)
+	}
+	if err == nil {
+		err = c.RevertSnapshot(ctx, snapshot)
+	}
+	if rErr := releaseConfirmSnapshot(snapshotPath, claimed, err); err == nil {
+		err = rErr
+	}
+	return err == nil, err
+}
+
+// claimConfirmSnapshot atomically takes the snapshot file away from snapshotPath,
+// so only one of the committing process and the helper reverts it,
+// and a commit can no longer be confirmed once its revert has started.
+// Returns an os.IsNotExist error if the snapshot has been confirmed or claimed by someone else.
+func claimConfirmSnapshot(snapshotPath string) (string, error) {
+	claimed := snapshotPath + ".reverting"
+	if err := os.Rename(snapshotPath, claimed); err != nil {
+		return "", err
+	}
+	return claimed, nil
+}
+
+// releaseConfirmSnapshot removes a claimed snapshot after a successful revert.
+// After a failed revert it is put back, so the helper can retry.
+func releaseConfirmSnapshot(snapshotPath, claimed string, revertErr error) error {
+	if revertErr != nil {
+		return os.Rename(claimed, snapshotPath)
+	}
+	return os.Remove(claimed)
+}
+
+// RevertSnapshot restores the configuration captured by a confirmed commit, see Restore.
+func (c *Client) RevertSnapshot(ctx context.Context, snapshot *ConfirmSnapshot) error {
+	if snapshot.Snapshot == nil {
+		return errors.New("empty snapshot")
+	}
+	return c.Restore(ctx, snapshot.Snapshot)
+}
+
+// ReadConfirmSnapshot reads a snapshot persisted by CommitConfirmed.
+func ReadConfirmSnapshot(path string) (*ConfirmSnapshot, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &ConfirmSnapshot{}
+	if err := json.Unmarshal(b, snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// writeConfirmSnapshot atomically replaces the snapshot file,
+// so a helper never reads a partially written snapshot.
+func writeConfirmSnapshot(path string, snapshot *ConfirmSnapshot) error {
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-firewalld")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	snapshot := &ConfirmSnapshot{
+		Deadline: time.Now().Add(time.Minute).Round(0),
+		Snapshot: &Snapshot{
+			DefaultZone: "public",
+			Permanent: SnapshotConfig{
+				Zones: map[string]ZoneSettings{"public": {Target: "default", Services: []string{"ssh"}}},
+			},
+		},
+	}
+	require.NoError(t, writeConfirmSnapshot(snapshotPath, snapshot))
+	read, err := ReadConfirmSnapshot(snapshotPath)
+	require.NoError(t, err)
+	assert.True(t, snapshot.Deadline.Equal(read.Deadline))
+	assert.Equal(t, snapshot.Snapshot, read.Snapshot)
+
+	// a failed revert puts the snapshot back for a retry
+	claimed, err := claimConfirmSnapshot(snapshotPath)
+	require.NoError(t, err)
+	assert.NoFileExists(t, snapshotPath)
+	_, err = claimConfirmSnapshot(snapshotPath)
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, releaseConfirmSnapshot(snapshotPath, claimed, assert.AnError))
+	assert.FileExists(t, snapshotPath)
+
+	claimed, err = claimConfirmSnapshot(snapshotPath)
+	require.NoError(t, err)
+	require.NoError(t, releaseConfirmSnapshot(snapshotPath, claimed, nil))
+	assert.NoFileExists(t, snapshotPath)
+	assert.NoFileExists(t, claimed)
+}
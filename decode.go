@@ -0,0 +1,372 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// DecodeError is returned when settings received from firewalld
+// do not have the expected layout or types.
+type DecodeError struct {
+	// Kind of settings being decoded, e.g. "zone settings".
+	Kind string
+	// Field of the settings struct, empty if the problem is with the whole value.
+	Field   string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Field) == 0 {
+		return "decode " + e.Kind + ": " + e.Message
+	}
+	return "decode " + e.Kind + ": " + e.Field + ": " + e.Message
+}
+
+// decoder converts loosely typed D-Bus values into settings fields.
+// Only the first error is kept, so a whole struct can be decoded
+// before checking for failure.
+// Missing (nil) values decode to the zero value, so optional trailing
+// fields of older firewalld versions don't fail.
+type decoder struct {
+	kind string
+	err  error
+}
+
+func (d *decoder) fail(field string, err error) {
+	if d.err == nil && err != nil {
+		d.err = &DecodeError{Kind: d.kind, Field: field, Message: err.Error()}
+	}
+}
+
+// minLen checks that a settings tuple has at least n fields.
+func (d *decoder) minLen(s []interface{}, n int) {
+	if d.err == nil && len(s) < n {
+		d.err = &DecodeError{
+			Kind:    d.kind,
+			Message: fmt.Sprintf("expected at least %d fields, got %d", n, len(s)),
+		}
+	}
+}
+
+func (d *decoder) string(field string, v interface{}) string {
+	s, err := decodeString(v)
+	d.fail(field, err)
+	return s
+}
+
+func (d *decoder) bool(field string, v interface{}) bool {
+	b, err := decodeBool(v)
+	d.fail(field, err)
+	return b
+}
+
+func (d *decoder) int(field string, v interface{}) int {
+	i, err := decodeInt(v)
+	d.fail(field, err)
+	return i
+}
+
+func (d *decoder) strings(field string, v interface{}) []string {
+	s, err := decodeStrings(v)
+	d.fail(field, err)
+	return s
+}
+
+func (d *decoder) ints(field string, v interface{}) []int {
+	i, err := decodeInts(v)
+	d.fail(field, err)
+	return i
+}
+
+// tuples decodes a list of D-Bus structs, checking that each has n fields.
+func (d *decoder) tuples(field string, v interface{}, n int) [][]interface{} {
+	tuples, err := decodeTuples(v)
+	if err != nil {
+		d.fail(field, err)
+		return nil
+	}
+	for i, t := range tuples {
+		if len(t) != n {
+			d.fail(fmt.Sprintf("%s[%d]", field, i),
+				fmt.Errorf("expected tuple of %d fields, got %d", n, len(t)))
+			return nil
+		}
+	}
+	return tuples
+}
+
+func (d *decoder) stringMap(field string, v interface{}) map[string]string {
+	m, err := decodeStringMap(v)
+	d.fail(field, err)
+	return m
+}
+
+func (d *decoder) ports(field string, v interface{}) []Port {
+	tuples, err := decodeStringTuples(v)
+	if err != nil {
+		d.fail(field, err)
+		return nil
+	}
+	var out []Port
+	for i, t := range tuples {
+		p, err := PortFromSlice(t)
+		if err != nil {
+			d.fail(fmt.Sprintf("%s[%d]", field, i), err)
+			return nil
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func (d *decoder) forwardPorts(field string, v interface{}) []ForwardPort {
+	tuples, err := decodeStringTuples(v)
+	if err != nil {
+		d.fail(field, err)
+		return nil
+	}
+	var out []ForwardPort
+	for i, t := range tuples {
+		p, err := ForwardPortFromSlice(t)
+		if err != nil {
+			d.fail(fmt.Sprintf("%s[%d]", field, i), err)
+			return nil
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// at returns the i-th field of a settings tuple, or nil if the tuple is shorter.
+func at(s []interface{}, i int) interface{} {
+	if i < len(s) {
+		return s[i]
+	}
+	return nil
+}
+
+func unwrapVariant(in interface{}) interface{} {
+	for {
+		v, ok := in.(dbus.Variant)
+		if !ok {
+			return in
+		}
+		in = v.Value()
+	}
+}
+
+func decodeString(in interface{}) (string, error) {
+	switch v := unwrapVariant(in).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("expected string, got %T", v)
+	}
+}
+
+func decodeBool(in interface{}) (bool, error) {
+	switch v := unwrapVariant(in).(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	default:
+		return false, fmt.Errorf("expected bool, got %T", v)
+	}
+}
+
+func decodeInt(in interface{}) (int, error) {
+	switch v := unwrapVariant(in).(type) {
+	case nil:
+		return 0, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("expected integer, got %T", v)
+	}
+}
+
+// decodeStrings accepts []string and any other list whose elements are strings,
+// like the []interface{} that godbus produces for variants.
+func decodeStrings(in interface{}) ([]string, error) {
+	in = unwrapVariant(in)
+	if in == nil {
+		return nil, nil
+	}
+	if s, ok := in.([]string); ok {
+		return s, nil
+	}
+
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list of strings, got %T", in)
+	}
+	out := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		s, err := decodeString(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func decodeInts(in interface{}) ([]int, error) {
+	in = unwrapVariant(in)
+	if in == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list of integers, got %T", in)
+	}
+	out := make([]int, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		v, err := decodeInt(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// decodeTuple returns the fields of a D-Bus struct, which is received
+// as a list, or as a Go struct when passed in-process.
+func decodeTuple(in interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(unwrapVariant(in))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out = append(out, rv.Index(i).Interface())
+		}
+		return out, nil
+	case reflect.Struct:
+		out := make([]interface{}, 0, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			if !rv.Field(i).CanInterface() {
+				return nil, fmt.Errorf("%T has unexported fields", in)
+			}
+			out = append(out, rv.Field(i).Interface())
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected tuple, got %T", in)
+}
+
+func decodeTuples(in interface{}) ([][]interface{}, error) {
+	in = unwrapVariant(in)
+	if in == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list of tuples, got %T", in)
+	}
+	out := make([][]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		t, err := decodeTuple(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// decodeStringTuple decodes a D-Bus struct of strings, which is received
+// as a list, or as a Go struct when passed in-process.
+func decodeStringTuple(in interface{}) ([]string, error) {
+	in = unwrapVariant(in)
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Struct {
+		return decodeStrings(in)
+	}
+
+	out := make([]string, 0, rv.NumField())
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Field(i)
+		if f.Kind() != reflect.String {
+			return nil, fmt.Errorf("field %d: expected string, got %s", i, f.Type())
+		}
+		out = append(out, f.String())
+	}
+	return out, nil
+}
+
+func decodeStringTuples(in interface{}) ([][]string, error) {
+	in = unwrapVariant(in)
+	if in == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected list of tuples, got %T", in)
+	}
+	out := make([][]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		t, err := decodeStringTuple(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func decodeStringMap(in interface{}) (map[string]string, error) {
+	in = unwrapVariant(in)
+	if in == nil {
+		return nil, nil
+	}
+	if m, ok := in.(map[string]string); ok {
+		return m, nil
+	}
+
+	rv := reflect.ValueOf(in)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("expected string map, got %T", in)
+	}
+	out := make(map[string]string, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		k := iter.Key().String()
+		s, err := decodeString(iter.Value().Interface())
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneSettingsFromSlice(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          []interface{}
+		expected    ZoneSettings
+		expectedErr string
+	}{
+		{
+			name: "interface encoding",
+			in: []interface{}{
+				"1", "Public", "For use in public areas.", false, "default",
+				[]interface{}{"ssh", "dhcpv6-client"},
+				[]interface{}{[]interface{}{"8080", "tcp"}},
+				[]interface{}{},
+				dbus.MakeVariant(true),
+				[]interface{}{[]string{"22", "tcp", "2222", ""}},
+				[]interface{}{"eth0"},
+				[]interface{}{"192.0.2.0/24"},
+				[]interface{}{`rule service name="ftp" accept`},
+				[]interface{}{"gre"},
+				[][]string{{"1024", "udp"}},
+				false,
+			},
+			expected: ZoneSettings{
+				Version:         "1",
+				Name:            "Public",
+				Description:     "For use in public areas.",
+				Target:          "default",
+				Services:        []string{"ssh", "dhcpv6-client"},
+				Ports:           []Port{{Port: "8080", Protocol: "tcp"}},
+				ICMPBlocks:      []string{},
+				Masquerade:      true,
+				ForwardPorts:    []ForwardPort{{Port: "22", Protocol: "tcp", ToPort: "2222"}},
+				Interfaces:      []string{"eth0"},
+				SourceAddresses: []string{"192.0.2.0/24"},
+				RichRules:       []string{`rule service name="ftp" accept`},
+				Protocols:       []string{"gre"},
+				SourcePorts:     []Port{{Port: "1024", Protocol: "udp"}},
+			},
+		},
+		{
+			name: "old firewalld without protocols and source ports",
+			in: []interface{}{
+				"", "Public", "", false, "default",
+				[]string{"ssh"}, [][]interface{}{}, []string{}, false,
+				[][]interface{}{}, []string{}, []string{}, []string{},
+			},
+			expected: ZoneSettings{
+				Name:            "Public",
+				Target:          "default",
+				Services:        []string{"ssh"},
+				ICMPBlocks:      []string{},
+				Interfaces:      []string{},
+				SourceAddresses: []string{},
+				RichRules:       []string{},
+			},
+		},
+		{
+			name:        "short tuple",
+			in:          []interface{}{"", "Public"},
+			expectedErr: "decode zone settings: expected at least 13 fields, got 2",
+		},
+		{
+			name: "wrong type",
+			in: []interface{}{
+				"", "Public", "", false, "default",
+				"ssh", nil, nil, false, nil, nil, nil, nil,
+			},
+			expectedErr: "decode zone settings: Services: expected list of strings, got string",
+		},
+		{
+			name: "wrong element type",
+			in: []interface{}{
+				"", "Public", "", false, "default",
+				[]interface{}{"ssh", int32(1)}, nil, nil, false, nil, nil, nil, nil,
+			},
+			expectedErr: "decode zone settings: Services: element 1: expected string, got int32",
+		},
+		{
+			name: "short port tuple",
+			in: []interface{}{
+				"", "Public", "", false, "default",
+				nil, [][]interface{}{{"8080"}}, nil, false, nil, nil, nil, nil,
+			},
+			expectedErr: "decode zone settings: Ports[0]: expected port tuple of 2 fields, got 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings, err := ZoneSettingsFromSlice(test.in)
+			if len(test.expectedErr) > 0 {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, settings)
+		})
+	}
+}
+
+func TestServiceSettingsFromSlice(t *testing.T) {
+	settings, err := ServiceSettingsFromSlice([]interface{}{
+		"", "TFTP", "",
+		[]interface{}{[]interface{}{"69", "udp"}},
+		[]interface{}{"tftp"},
+		map[string]dbus.Variant{"ipv4": dbus.MakeVariant("224.0.0.251")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ServiceSettings{
+		Name:         "TFTP",
+		Ports:        []Port{{Port: "69", Protocol: "udp"}},
+		ModuleNames:  []string{"tftp"},
+		Destinations: map[string]string{"ipv4": "224.0.0.251"},
+	}, settings)
+
+	_, err = ServiceSettingsFromSlice([]interface{}{
+		"", "TFTP", "", nil, nil, []string{"ipv4"},
+	})
+	assert.EqualError(t, err,
+		"decode service settings: Destinations: expected string map, got []string")
+}
+
+func TestIPSetSettingsFromSlice(t *testing.T) {
+	_, err := IPSetSettingsFromSlice([]interface{}{"", "blocklist", ""})
+	assert.EqualError(t, err, "decode ipset settings: expected at least 6 fields, got 3")
+}
+
+func TestHelperSettingsFromSlice(t *testing.T) {
+	_, err := HelperSettingsFromSlice([]interface{}{
+		"", "FTP", "", "ipv4", "nf_conntrack_ftp", []interface{}{"21/tcp"},
+	})
+	assert.EqualError(t, err,
+		"decode helper settings: Ports: element 0: expected list of strings, got string")
+}
+
+func TestPolicySettingsFromMap(t *testing.T) {
+	settings, err := PolicySettingsFromMap(map[string]dbus.Variant{
+		"target":   dbus.MakeVariant("ACCEPT"),
+		"priority": dbus.MakeVariant(int32(-1)),
+		"ports":    dbus.MakeVariant(portsToStructs([]Port{{Port: "80", Protocol: "tcp"}})),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PolicySettings{
+		Target:   "ACCEPT",
+		Priority: -1,
+		Ports:    []Port{{Port: "80", Protocol: "tcp"}},
+	}, settings)
+
+	_, err = PolicySettingsFromMap(map[string]dbus.Variant{
+		"priority": dbus.MakeVariant("high"),
+	})
+	assert.EqualError(t, err,
+		"decode policy settings: Priority: expected integer, got string")
+}
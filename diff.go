@@ -0,0 +1,496 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ZoneDiff describes the changes turning one ZoneSettings into another.
+// Lists are compared as sets, ordering and duplicates are ignored.
+// Rich rules are compared in canonical form.
+type ZoneDiff struct {
+	// New values of scalar settings, nil if unchanged.
+	Name        *string
+	Description *string
+	Target      *string
+	Masquerade  *bool
+
+	ICMPBlockInversion *bool
+
+	AddedServices       []string
+	RemovedServices     []string
+	AddedPorts          []Port
+	RemovedPorts        []Port
+	AddedSourcePorts    []Port
+	RemovedSourcePorts  []Port
+	AddedProtocols      []string
+	RemovedProtocols    []string
+	AddedICMPBlocks     []string
+	RemovedICMPBlocks   []string
+	AddedForwardPorts   []ForwardPort
+	RemovedForwardPorts []ForwardPort
+	AddedInterfaces     []string
+	RemovedInterfaces   []string
+	AddedSources        []string
+	RemovedSources      []string
+	AddedRichRules      []string
+	RemovedRichRules    []string
+}
+
+// DiffZoneSettings compares two zone settings and returns the changes needed to turn from into to.
+func DiffZoneSettings(from, to ZoneSettings) ZoneDiff {
+	d := ZoneDiff{}
+	if from.Name != to.Name {
+		d.Name = &to.Name
+	}
+	if from.Description != to.Description {
+		d.Description = &to.Description
+	}
+	if from.Target != to.Target {
+		d.Target = &to.Target
+	}
+	if from.Masquerade != to.Masquerade {
+		d.Masquerade = &to.Masquerade
+	}
+	if from.ICMPBlockInversion != to.ICMPBlockInversion {
+		d.ICMPBlockInversion = &to.ICMPBlockInversion
+	}
+
+	d.AddedServices, d.RemovedServices = diffStrings(from.Services, to.Services)
+	d.AddedPorts, d.RemovedPorts = diffPorts(from.Ports, to.Ports)
+	d.AddedSourcePorts, d.RemovedSourcePorts = diffPorts(from.SourcePorts, to.SourcePorts)
+	d.AddedProtocols, d.RemovedProtocols = diffStrings(from.Protocols, to.Protocols)
+	d.AddedICMPBlocks, d.RemovedICMPBlocks = diffStrings(from.ICMPBlocks, to.ICMPBlocks)
+	d.AddedForwardPorts, d.RemovedForwardPorts = diffForwardPorts(from.ForwardPorts, to.ForwardPorts)
+	d.AddedInterfaces, d.RemovedInterfaces = diffStrings(from.Interfaces, to.Interfaces)
+	d.AddedSources, d.RemovedSources = diffStrings(from.SourceAddresses, to.SourceAddresses)
+	d.AddedRichRules, d.RemovedRichRules = diffRichRules(from.RichRules, to.RichRules)
+	return d
+}
+
+// Empty returns true if there are no changes.
+func (d ZoneDiff) Empty() bool {
+	return len(d.Changes()) == 0
+}
+
+// ZoneChange is a single granular modification of a zone,
+// mapping to a method of the org.fedoraproject.FirewallD1.config.zone interface.
+type ZoneChange struct {
+	// Method name, e.g. "addService".
+	Method string   `json:"method"`
+	Args   []string `json:"args,omitempty"`
+}
+
+func (c ZoneChange) String() string {
+	return c.Method + "(" + strings.Join(c.Args, ", ") + ")"
+}
+
+// Changes returns the minimal list of granular calls to apply this diff.
+// Removals are ordered before additions,
+// so entries are never present twice while the changes are applied.
+func (d ZoneDiff) Changes() []ZoneChange {
+	var out []ZoneChange
+	add := func(method string, args ...string) {
+		out = append(out, ZoneChange{Method: method, Args: args})
+	}
+
+	if d.Name != nil {
+		add("setShort", *d.Name)
+	}
+	if d.Description != nil {
+		add("setDescription", *d.Description)
+	}
+	if d.Target != nil {
+		add("setTarget", *d.Target)
+	}
+	if d.Masquerade != nil {
+		if *d.Masquerade {
+			add("addMasquerade")
+		} else {
+			add("removeMasquerade")
+		}
+	}
+	if d.ICMPBlockInversion != nil {
+		if *d.ICMPBlockInversion {
+			add("addIcmpBlockInversion")
+		} else {
+			add("removeIcmpBlockInversion")
+		}
+	}
+
+	for _, s := range d.RemovedServices {
+		add("removeService", s)
+	}
+	for _, p := range d.RemovedPorts {
+		add("removePort", p.Port, p.Protocol)
+	}
+	for _, p := range d.RemovedSourcePorts {
+		add("removeSourcePort", p.Port, p.Protocol)
+	}
+	for _, p := range d.RemovedProtocols {
+		add("removeProtocol", p)
+	}
+	for _, i := range d.RemovedICMPBlocks {
+		add("removeIcmpBlock", i)
+	}
+	for _, p := range d.RemovedForwardPorts {
+		add("removeForwardPort", p.Port, p.Protocol, p.ToPort, p.ToAddress)
+	}
+	for _, i := range d.RemovedInterfaces {
+		add("removeInterface", i)
+	}
+	for _, s := range d.RemovedSources {
+		add("removeSource", s)
+	}
+	for _, r := range d.RemovedRichRules {
+		add("removeRichRule", r)
+	}
+
+	for _, s := range d.AddedServices {
+		add("addService", s)
+	}
+	for _, p := range d.AddedPorts {
+		add("addPort", p.Port, p.Protocol)
+	}
+	for _, p := range d.AddedSourcePorts {
+		add("addSourcePort", p.Port, p.Protocol)
+	}
+	for _, p := range d.AddedProtocols {
+		add("addProtocol", p)
+	}
+	for _, i := range d.AddedICMPBlocks {
+		add("addIcmpBlock", i)
+	}
+	for _, p := range d.AddedForwardPorts {
+		add("addForwardPort", p.Port, p.Protocol, p.ToPort, p.ToAddress)
+	}
+	for _, i := range d.AddedInterfaces {
+		add("addInterface", i)
+	}
+	for _, s := range d.AddedSources {
+		add("addSource", s)
+	}
+	for _, r := range d.AddedRichRules {
+		add("addRichRule", r)
+	}
+	return out
+}
+
+const configZoneInterface = "org.fedoraproject.FirewallD1.config.zone"
+
+// Apply granular changes to the permanent configuration of the given zone.
+// Changes are applied in order, stopping at the first error.
+func (c *ConfigClient) ApplyZoneChanges(
+	ctx context.Context, zoneName string, changes []ZoneChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	path, err := c.GetZoneByName(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+	zone := c.conn.Object(dbusDest, path)
+	for _, change := range changes {
+		args := make([]interface{}, len(change.Args))
+		for i, a := range change.Args {
+			args[i] = a
+		}
+
+		err := zone.Call(ctx,
+			NewCall(configZoneInterface+"."+change.Method, 0).
+				WithArguments(args...))
+		if err != nil {
+			return &ZoneChangeError{Zone: zoneName, Change: change, Err: err}
+		}
+	}
+	return nil
+}
+
+// ZoneChangeError is returned when applying a ZoneChange failed.
+type ZoneChangeError struct {
+	Zone   string
+	Change ZoneChange
+	Err    error
+}
+
+func (e *ZoneChangeError) Error() string {
+	return "zone " + e.Zone + ": " + e.Change.String() + ": " + e.Err.Error()
+}
+
+func (e *ZoneChangeError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyChange modifies the settings the way the corresponding method of the
+// config zone interface does, e.g. for working on zone files without a daemon.
+// Errors carry firewalld error codes like ALREADY_ENABLED and NOT_ENABLED.
+func (z *ZoneSettings) ApplyChange(c ZoneChange) error {
+	var add bool
+	var subject string
+	switch {
+	case strings.HasPrefix(c.Method, "set"):
+		subject = c.Method
+	case strings.HasPrefix(c.Method, "add"):
+		add, subject = true, c.Method[len("add"):]
+	case strings.HasPrefix(c.Method, "remove"):
+		subject = c.Method[len("remove"):]
+	}
+
+	nargs, ok := zoneChangeArgs[subject]
+	if !ok {
+		return Error{Code: "INVALID_COMMAND", Message: c.Method}
+	}
+	if len(c.Args) != nargs {
+		return Error{
+			Code:    "INVALID_COMMAND",
+			Message: fmt.Sprintf("%s takes %d arguments, got %d", c.Method, nargs, len(c.Args)),
+		}
+	}
+	a := c.Args
+
+	switch subject {
+	case "setShort":
+		z.Name = a[0]
+	case "setDescription":
+		z.Description = a[0]
+	case "setTarget":
+		z.Target = a[0]
+	case "Masquerade":
+		return applyFlagChange(&z.Masquerade, add, "masquerade")
+	case "IcmpBlockInversion":
+		return applyFlagChange(&z.ICMPBlockInversion, add, "icmp-block-inversion")
+	case "Service":
+		return applyStringChange(&z.Services, add, a[0], nil)
+	case "Protocol":
+		return applyStringChange(&z.Protocols, add, a[0], nil)
+	case "IcmpBlock":
+		return applyStringChange(&z.ICMPBlocks, add, a[0], nil)
+	case "Interface":
+		return applyStringChange(&z.Interfaces, add, a[0], nil)
+	case "Source":
+		return applyStringChange(&z.SourceAddresses, add, a[0], nil)
+	case "RichRule":
+		return applyStringChange(&z.RichRules, add, a[0], CanonicalRichRule)
+	case "Port":
+		return applyPortChange(&z.Ports, add, Port{Port: a[0], Protocol: a[1]})
+	case "SourcePort":
+		return applyPortChange(&z.SourcePorts, add, Port{Port: a[0], Protocol: a[1]})
+	case "ForwardPort":
+		return applyForwardPortChange(&z.ForwardPorts, add,
+			ForwardPort{Port: a[0], Protocol: a[1], ToPort: a[2], ToAddress: a[3]})
+	}
+	return nil
+}
+
+// Number of arguments of the zone changes supported by ApplyChange,
+// by method name for set* and by subject for add*/remove*.
+var zoneChangeArgs = map[string]int{
+	"setShort":           1,
+	"setDescription":     1,
+	"setTarget":          1,
+	"Masquerade":         0,
+	"IcmpBlockInversion": 0,
+	"Service":            1,
+	"Protocol":           1,
+	"IcmpBlock":          1,
+	"Interface":          1,
+	"Source":             1,
+	"RichRule":           1,
+	"Port":               2,
+	"SourcePort":         2,
+	"ForwardPort":        4,
+}
+
+func checkListChange(present, add bool, v string) error {
+	switch {
+	case add && present:
+		return Error{Code: "ALREADY_ENABLED", Message: v}
+	case !add && !present:
+		return Error{Code: "NOT_ENABLED", Message: v}
+	}
+	return nil
+}
+
+func applyFlagChange(flag *bool, add bool, name string) error {
+	if err := checkListChange(*flag, add, name); err != nil {
+		return err
+	}
+	*flag = add
+	return nil
+}
+
+// applyStringChange adds or removes v, comparing values by key if not nil.
+func applyStringChange(list *[]string, add bool, v string, key func(string) string) error {
+	if key == nil {
+		key = func(s string) string { return s }
+	}
+	i := -1
+	for j, s := range *list {
+		if key(s) == key(v) {
+			i = j
+		}
+	}
+	if err := checkListChange(i >= 0, add, v); err != nil {
+		return err
+	}
+	if add {
+		*list = append(*list, v)
+	} else {
+		*list = append((*list)[:i:i], (*list)[i+1:]...)
+	}
+	return nil
+}
+
+func applyPortChange(list *[]Port, add bool, p Port) error {
+	i := -1
+	for j, o := range *list {
+		if o == p {
+			i = j
+		}
+	}
+	if err := checkListChange(i >= 0, add, p.String()); err != nil {
+		return err
+	}
+	if add {
+		*list = append(*list, p)
+	} else {
+		*list = append((*list)[:i:i], (*list)[i+1:]...)
+	}
+	return nil
+}
+
+func applyForwardPortChange(list *[]ForwardPort, add bool, p ForwardPort) error {
+	i := -1
+	for j, o := range *list {
+		if o == p {
+			i = j
+		}
+	}
+	if err := checkListChange(i >= 0, add, p.String()); err != nil {
+		return err
+	}
+	if add {
+		*list = append(*list, p)
+	} else {
+		*list = append((*list)[:i:i], (*list)[i+1:]...)
+	}
+	return nil
+}
+
+// diffStrings returns values only in b (added) and values only in a (removed).
+func diffStrings(a, b []string) (added, removed []string) {
+	return setDifference(b, a), setDifference(a, b)
+}
+
+// setDifference returns distinct values of a that are not in b, keeping the order of a.
+func setDifference(a, b []string) []string {
+	exclude := stringSet(b)
+	var out []string
+	for _, v := range a {
+		if exclude[v] {
+			continue
+		}
+		exclude[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// diffByKey compares elements by key, given as the keys of a and b.
+// It returns the indexes of the elements only in b and only in a, keeping their order.
+// Of elements with the same key, only the first one is returned.
+func diffByKey(aKeys, bKeys []string) (added, removed []int) {
+	index := func(keys []string) map[string]int {
+		m := map[string]int{}
+		for i := len(keys) - 1; i >= 0; i-- {
+			m[keys[i]] = i
+		}
+		return m
+	}
+
+	ai, bi := index(aKeys), index(bKeys)
+	for _, k := range setDifference(bKeys, aKeys) {
+		added = append(added, bi[k])
+	}
+	for _, k := range setDifference(aKeys, bKeys) {
+		removed = append(removed, ai[k])
+	}
+	return
+}
+
+func diffPorts(a, b []Port) (added, removed []Port) {
+	keys := func(ports []Port) []string {
+		var keys []string
+		for _, p := range ports {
+			keys = append(keys, p.String())
+		}
+		return keys
+	}
+
+	addedIdx, removedIdx := diffByKey(keys(a), keys(b))
+	for _, i := range addedIdx {
+		added = append(added, b[i])
+	}
+	for _, i := range removedIdx {
+		removed = append(removed, a[i])
+	}
+	return
+}
+
+func diffForwardPorts(a, b []ForwardPort) (added, removed []ForwardPort) {
+	keys := func(ports []ForwardPort) []string {
+		var keys []string
+		for _, p := range ports {
+			keys = append(keys, p.String())
+		}
+		return keys
+	}
+
+	addedIdx, removedIdx := diffByKey(keys(a), keys(b))
+	for _, i := range addedIdx {
+		added = append(added, b[i])
+	}
+	for _, i := range removedIdx {
+		removed = append(removed, a[i])
+	}
+	return
+}
+
+// diffRichRules compares rules in canonical form,
+// returning them as written in a and b respectively.
+func diffRichRules(a, b []string) (added, removed []string) {
+	keys := func(rules []string) []string {
+		var keys []string
+		for _, r := range rules {
+			keys = append(keys, CanonicalRichRule(r))
+		}
+		return keys
+	}
+
+	addedIdx, removedIdx := diffByKey(keys(a), keys(b))
+	for _, i := range addedIdx {
+		added = append(added, b[i])
+	}
+	for _, i := range removedIdx {
+		removed = append(removed, a[i])
+	}
+	return
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffZoneSettings(t *testing.T) {
+	from := ZoneSettings{
+		Description: "old",
+		Target:      "default",
+		Services:    []string{"ssh", "dhcpv6-client", "mdns"},
+		Ports: []Port{
+			{Port: "80", Protocol: "tcp"},
+			{Port: "443", Protocol: "tcp"},
+		},
+		ForwardPorts: []ForwardPort{
+			{Port: "22", Protocol: "tcp", ToPort: "2222", ToAddress: "192.0.2.1"},
+		},
+		Interfaces:         []string{"eth0"},
+		RichRules:          []string{`rule family="ipv4" source address="192.0.2.0/24" accept`},
+		ICMPBlockInversion: true,
+	}
+	to := ZoneSettings{
+		Description: "old",
+		Target:      "DROP",
+		Masquerade:  true,
+		// reordered and duplicated
+		Services: []string{"mdns", "ssh", "ssh"},
+		Ports: []Port{
+			{Port: "443", Protocol: "tcp"},
+			{Port: "443", Protocol: "udp"},
+		},
+		ForwardPorts: []ForwardPort{
+			{Port: "22", Protocol: "tcp", ToPort: "2222", ToAddress: "192.0.2.2"},
+		},
+		Interfaces: []string{"eth0"},
+		RichRules:  []string{`rule family="ipv4" source address="192.0.2.0/24" accept`},
+	}
+
+	d := DiffZoneSettings(from, to)
+	assert.False(t, d.Empty())
+	assert.Nil(t, d.Description)
+	assert.Equal(t, []string{"dhcpv6-client"}, d.RemovedServices)
+	assert.Empty(t, d.AddedServices)
+
+	assert.Equal(t, []ZoneChange{
+		{Method: "setTarget", Args: []string{"DROP"}},
+		{Method: "addMasquerade"},
+		{Method: "removeIcmpBlockInversion"},
+		{Method: "removeService", Args: []string{"dhcpv6-client"}},
+		{Method: "removePort", Args: []string{"80", "tcp"}},
+		{Method: "removeForwardPort", Args: []string{"22", "tcp", "2222", "192.0.2.1"}},
+		{Method: "addPort", Args: []string{"443", "udp"}},
+		{Method: "addForwardPort", Args: []string{"22", "tcp", "2222", "192.0.2.2"}},
+	}, d.Changes())
+
+	assert.True(t, DiffZoneSettings(to, to).Empty())
+}
+
+func TestZoneSettings_ApplyChange(t *testing.T) {
+	from := ZoneSettings{
+		Target:       "default",
+		Services:     []string{"ssh", "mdns"},
+		Ports:        []Port{{Port: "80", Protocol: "tcp"}},
+		ForwardPorts: []ForwardPort{{Port: "22", Protocol: "tcp", ToPort: "2222"}},
+		RichRules:    []string{`rule family="ipv4" source address="192.0.2.0/24" accept`},
+	}
+	to := ZoneSettings{
+		Name:        "Public",
+		Target:      "DROP",
+		Masquerade:  true,
+		Services:    []string{"mdns", "http"},
+		Ports:       []Port{{Port: "443", Protocol: "tcp"}},
+		SourcePorts: []Port{{Port: "53", Protocol: "udp"}},
+		Interfaces:  []string{"eth0"},
+	}
+
+	z := from
+	for _, c := range DiffZoneSettings(from, to).Changes() {
+		require.NoError(t, z.ApplyChange(c), c.String())
+	}
+	assert.True(t, DiffZoneSettings(z, to).Empty())
+
+	tests := []struct {
+		change ZoneChange
+		code   string
+	}{
+		{ZoneChange{Method: "addService", Args: []string{"http"}}, "ALREADY_ENABLED"},
+		{ZoneChange{Method: "removeService", Args: []string{"ssh"}}, "NOT_ENABLED"},
+		{ZoneChange{Method: "addMasquerade"}, "ALREADY_ENABLED"},
+		{ZoneChange{Method: "removeRichRule", Args: []string{"rule accept"}}, "NOT_ENABLED"},
+		{ZoneChange{Method: "addPort", Args: []string{"80"}}, "INVALID_COMMAND"},
+		{ZoneChange{Method: "addFoo", Args: []string{"bar"}}, "INVALID_COMMAND"},
+	}
+	for _, test := range tests {
+		err := z.ApplyChange(test.change)
+		assert.Equal(t, test.code, ErrorCode(err), test.change.String())
+	}
+
+	// rich rules are compared in canonical form
+	require.NoError(t, z.ApplyChange(ZoneChange{
+		Method: "addRichRule", Args: []string{`rule  family=ipv4 accept`},
+	}))
+	require.NoError(t, z.ApplyChange(ZoneChange{
+		Method: "removeRichRule", Args: []string{`rule family="ipv4" accept`},
+	}))
+	assert.Empty(t, z.RichRules)
+}
+
+func TestConfigClient_ApplyZoneChanges(t *testing.T) {
+	const path = "/org/fedoraproject/FirewallD1/config/zone/0"
+
+	configPathCaller, conn, c := configClientSetup()
+	onMethod(configPathCaller, configGetZoneByNameMethod, path)
+
+	zoneObjectCaller := &callerMock{}
+	conn.
+		On("Object", dbusDest, path).
+		Return(zoneObjectCaller)
+	zoneObjectCaller.
+		On("Call", mock.Anything, mock.MatchedBy(func(c Call) bool {
+			return c.Method == configZoneInterface+".addPort"
+		})).
+		Return(nil)
+	zoneObjectCaller.
+		On("Call", mock.Anything, mock.MatchedBy(func(c Call) bool {
+			return c.Method == configZoneInterface+".addService"
+		})).
+		Return(errors.New("INVALID_SERVICE: foo"))
+
+	ctx := context.Background()
+
+	err := c.ApplyZoneChanges(ctx, "public", []ZoneChange{
+		{Method: "addPort", Args: []string{"443", "tcp"}},
+		{Method: "addService", Args: []string{"foo"}},
+	})
+	require.Error(t, err)
+	assert.Equal(t, "zone public: addService(foo): INVALID_SERVICE: foo", err.Error())
+
+	zoneObjectCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    configZoneInterface + ".addPort",
+		Arguments: []interface{}{"443", "tcp"},
+	})
+}
+
+func TestDiffZoneSettings_RichRules(t *testing.T) {
+	from := ZoneSettings{RichRules: []string{
+		`rule family="ipv4" source address="192.0.2.0/24" service name="ssh" accept`,
+		`rule family="ipv4" source address="198.51.100.0/24" drop`,
+	}}
+	to := ZoneSettings{RichRules: []string{
+		`rule family=ipv4 source address='192.0.2.0/24' service name=ssh accept`,
+	}}
+
+	d := DiffZoneSettings(from, to)
+	assert.Empty(t, d.AddedRichRules)
+	assert.Equal(t, []string{
+		`rule family="ipv4" source address="198.51.100.0/24" drop`,
+	}, d.RemovedRichRules)
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DirectSettings is the permanent direct configuration of firewalld,
+// passing rules to iptables, ip6tables or ebtables.
+// The direct interface is deprecated in favor of policies and rich rules.
+type DirectSettings struct {
+	Chains       []DirectChain       `json:"chains,omitempty" yaml:"chains,omitempty"`
+	Rules        []DirectRule        `json:"rules,omitempty" yaml:"rules,omitempty"`
+	Passthroughs []DirectPassthrough `json:"passthroughs,omitempty" yaml:"passthroughs,omitempty"`
+}
+
+// DirectChain is an additional chain in a table.
+type DirectChain struct {
+	// ipv4, ipv6 or eb.
+	IPV   string `json:"ipv" yaml:"ipv"`
+	Table string `json:"table" yaml:"table"`
+	Chain string `json:"chain" yaml:"chain"`
+}
+
+// DirectRule is a rule added to a chain.
+type DirectRule struct {
+	IPV   string `json:"ipv" yaml:"ipv"`
+	Table string `json:"table" yaml:"table"`
+	Chain string `json:"chain" yaml:"chain"`
+	// Rules with lower priority are added first.
+	Priority int      `json:"priority" yaml:"priority"`
+	Args     []string `json:"args" yaml:"args"`
+}
+
+// DirectPassthrough is a command passed through to iptables, ip6tables or ebtables.
+type DirectPassthrough struct {
+	IPV  string   `json:"ipv" yaml:"ipv"`
+	Args []string `json:"args" yaml:"args"`
+}
+
+// DirectSettingsFromSlice decodes the direct settings tuple returned by firewalld.
+func DirectSettingsFromSlice(s []interface{}) (DirectSettings, error) {
+	d := &decoder{kind: "direct settings"}
+	d.minLen(s, 3)
+	if d.err != nil {
+		return DirectSettings{}, d.err
+	}
+
+	var settings DirectSettings
+	for i, t := range d.tuples("Chains", s[0], 3) {
+		field := fmt.Sprintf("Chains[%d]", i)
+		settings.Chains = append(settings.Chains, DirectChain{
+			IPV:   d.string(field+".IPV", t[0]),
+			Table: d.string(field+".Table", t[1]),
+			Chain: d.string(field+".Chain", t[2]),
+		})
+	}
+	for i, t := range d.tuples("Rules", s[1], 5) {
+		field := fmt.Sprintf("Rules[%d]", i)
+		settings.Rules = append(settings.Rules, DirectRule{
+			IPV:      d.string(field+".IPV", t[0]),
+			Table:    d.string(field+".Table", t[1]),
+			Chain:    d.string(field+".Chain", t[2]),
+			Priority: d.int(field+".Priority", t[3]),
+			Args:     d.strings(field+".Args", t[4]),
+		})
+	}
+	for i, t := range d.tuples("Passthroughs", s[2], 2) {
+		field := fmt.Sprintf("Passthroughs[%d]", i)
+		settings.Passthroughs = append(settings.Passthroughs, DirectPassthrough{
+			IPV:  d.string(field+".IPV", t[0]),
+			Args: d.strings(field+".Args", t[1]),
+		})
+	}
+	if d.err != nil {
+		return DirectSettings{}, d.err
+	}
+	return settings, nil
+}
+
+// directChainStruct is encoded as D-Bus struct (sss).
+type directChainStruct struct {
+	IPV   string
+	Table string
+	Chain string
+}
+
+// directRuleStruct is encoded as D-Bus struct (sssias).
+type directRuleStruct struct {
+	IPV      string
+	Table    string
+	Chain    string
+	Priority int32
+	Args     []string
+}
+
+// directPassthroughStruct is encoded as D-Bus struct (sas).
+type directPassthroughStruct struct {
+	IPV  string
+	Args []string
+}
+
+func (s *DirectSettings) ToSlice() []interface{} {
+	d := s.toStruct()
+	return []interface{}{d.Chains, d.Rules, d.Passthroughs}
+}
+
+// directSettingsStruct is encoded as D-Bus struct (a(sss)a(sssias)a(sas)).
+type directSettingsStruct struct {
+	Chains       []directChainStruct
+	Rules        []directRuleStruct
+	Passthroughs []directPassthroughStruct
+}
+
+func (s *DirectSettings) toStruct() directSettingsStruct {
+	d := directSettingsStruct{
+		Chains:       []directChainStruct{},
+		Rules:        []directRuleStruct{},
+		Passthroughs: []directPassthroughStruct{},
+	}
+	for _, c := range s.Chains {
+		d.Chains = append(d.Chains, directChainStruct(c))
+	}
+	for _, r := range s.Rules {
+		d.Rules = append(d.Rules, directRuleStruct{
+			IPV: r.IPV, Table: r.Table, Chain: r.Chain,
+			Priority: int32(r.Priority), Args: nonNilStrings(r.Args),
+		})
+	}
+	for _, p := range s.Passthroughs {
+		d.Passthroughs = append(d.Passthroughs, directPassthroughStruct{
+			IPV: p.IPV, Args: nonNilStrings(p.Args),
+		})
+	}
+	return d
+}
+
+// nonNilStrings returns an empty slice instead of nil,
+// so the value can be encoded by godbus.
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// xmlDirect is the layout of direct.xml, see firewalld.direct(5).
+type xmlDirect struct {
+	Chains       []xmlDirectChain       `xml:"chain"`
+	Rules        []xmlDirectRule        `xml:"rule"`
+	Passthroughs []xmlDirectPassthrough `xml:"passthrough"`
+}
+
+type xmlDirectChain struct {
+	IPV   string `xml:"ipv,attr"`
+	Table string `xml:"table,attr"`
+	Chain string `xml:"chain,attr"`
+}
+
+type xmlDirectRule struct {
+	IPV      string `xml:"ipv,attr"`
+	Table    string `xml:"table,attr"`
+	Chain    string `xml:"chain,attr"`
+	Priority int    `xml:"priority,attr"`
+	Args     string `xml:",chardata"`
+}
+
+type xmlDirectPassthrough struct {
+	IPV  string `xml:"ipv,attr"`
+	Args string `xml:",chardata"`
+}
+
+// MarshalXML encodes the direct configuration in direct.xml format.
+func (s DirectSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	var x xmlDirect
+	for _, c := range s.Chains {
+		x.Chains = append(x.Chains, xmlDirectChain(c))
+	}
+	for _, r := range s.Rules {
+		x.Rules = append(x.Rules, xmlDirectRule{
+			IPV: r.IPV, Table: r.Table, Chain: r.Chain,
+			Priority: r.Priority, Args: joinArgs(r.Args),
+		})
+	}
+	for _, p := range s.Passthroughs {
+		x.Passthroughs = append(x.Passthroughs, xmlDirectPassthrough{
+			IPV: p.IPV, Args: joinArgs(p.Args),
+		})
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "direct"}})
+}
+
+// UnmarshalXML decodes the direct configuration from direct.xml format.
+func (s *DirectSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "direct"); err != nil {
+		return err
+	}
+	var x xmlDirect
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = DirectSettings{}
+	for _, c := range x.Chains {
+		s.Chains = append(s.Chains, DirectChain(c))
+	}
+	for i, r := range x.Rules {
+		args, err := splitArgs(r.Args)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		s.Rules = append(s.Rules, DirectRule{
+			IPV: r.IPV, Table: r.Table, Chain: r.Chain,
+			Priority: r.Priority, Args: args,
+		})
+	}
+	for i, p := range x.Passthroughs {
+		args, err := splitArgs(p.Args)
+		if err != nil {
+			return fmt.Errorf("passthrough %d: %w", i, err)
+		}
+		s.Passthroughs = append(s.Passthroughs, DirectPassthrough{IPV: p.IPV, Args: args})
+	}
+	return nil
+}
+
+// ReadDirectXML reads the direct configuration from /etc/firewalld/direct.xml.
+func ReadDirectXML(r io.Reader) (DirectSettings, error) {
+	var s DirectSettings
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return DirectSettings{}, err
+	}
+	return s, nil
+}
+
+// WriteDirectXML writes the direct configuration in direct.xml format.
+func WriteDirectXML(w io.Writer, s DirectSettings) error {
+	return writeXML(w, s)
+}
+
+var unsafeArgChars = regexp.MustCompile(`[^\w@%+=:,./-]`)
+
+// joinArgs joins arguments with shell quoting, like firewalld does for direct.xml.
+func joinArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		switch {
+		case len(a) == 0:
+			quoted = append(quoted, "''")
+		case unsafeArgChars.MatchString(a):
+			quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'"'"'`)+"'")
+		default:
+			quoted = append(quoted, a)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// splitArgs splits a command line into arguments using POSIX shell quoting rules.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\\\"$`\n", r) {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
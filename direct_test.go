@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<direct>
+  <chain ipv="ipv4" table="filter" chain="blacklist"/>
+  <rule ipv="ipv4" table="filter" chain="blacklist" priority="1">-m limit --limit 1/min -j LOG --log-prefix 'blacklisted: '</rule>
+  <passthrough ipv="ipv4">-t nat -A POSTROUTING -j MASQUERADE</passthrough>
+</direct>
+`
+	s, err := ReadDirectXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, DirectSettings{
+		Chains: []DirectChain{{IPV: "ipv4", Table: "filter", Chain: "blacklist"}},
+		Rules: []DirectRule{{
+			IPV: "ipv4", Table: "filter", Chain: "blacklist", Priority: 1,
+			Args: []string{"-m", "limit", "--limit", "1/min", "-j", "LOG", "--log-prefix", "blacklisted: "},
+		}},
+		Passthroughs: []DirectPassthrough{{
+			IPV:  "ipv4",
+			Args: []string{"-t", "nat", "-A", "POSTROUTING", "-j", "MASQUERADE"},
+		}},
+	}, s)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDirectXML(&buf, s))
+	roundTrip, err := ReadDirectXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, roundTrip)
+
+	decoded, err := DirectSettingsFromSlice(s.ToSlice())
+	require.NoError(t, err)
+	assert.Equal(t, s, decoded)
+}
+
+func TestDirectSettingsFromSlice(t *testing.T) {
+	s, err := DirectSettingsFromSlice([]interface{}{
+		[][]interface{}{},
+		[][]interface{}{{"ipv6", "filter", "INPUT", int32(0), []interface{}{"-j", "ACCEPT"}}},
+		[][]interface{}{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, DirectSettings{
+		Rules: []DirectRule{{IPV: "ipv6", Table: "filter", Chain: "INPUT", Args: []string{"-j", "ACCEPT"}}},
+	}, s)
+
+	_, err = DirectSettingsFromSlice([]interface{}{
+		[][]interface{}{{"ipv4", "filter"}}, nil, nil,
+	})
+	assert.EqualError(t, err, "decode direct settings: Chains[0]: expected tuple of 3 fields, got 2")
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected []string
+	}{
+		{in: "", expected: nil},
+		{in: "  -j   ACCEPT ", expected: []string{"-j", "ACCEPT"}},
+		{in: `--comment "a \"b\" c"`, expected: []string{"--comment", `a "b" c`}},
+		{in: `--comment 'it'"'"'s'`, expected: []string{"--comment", "it's"}},
+		{in: `a\ b ''`, expected: []string{"a b", ""}},
+	}
+	for _, test := range tests {
+		args, err := splitArgs(test.in)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.expected, args, test.in)
+	}
+
+	_, err := splitArgs(`"unterminated`)
+	assert.Error(t, err)
+
+	args := []string{"--log-prefix", "it's here", "", "-j"}
+	split, err := splitArgs(joinArgs(args))
+	require.NoError(t, err)
+	assert.Equal(t, args, split)
+}
@@ -0,0 +1,388 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DriftType classifies a difference between runtime and permanent configuration.
+type DriftType string
+
+const (
+	// Object or value only exists in the runtime configuration.
+	DriftRuntimeOnly DriftType = "RuntimeOnly"
+	// Object or value only exists in the permanent configuration.
+	DriftPermanentOnly DriftType = "PermanentOnly"
+	// Setting has a different value in runtime and permanent configuration.
+	DriftChanged DriftType = "Changed"
+)
+
+// Drift is a single difference between runtime and permanent configuration.
+type Drift struct {
+	Type DriftType
+	// Object kind: zone, service, ipset or policy.
+	Kind string
+	// Object name.
+	Name string
+	// Setting that differs, empty if the whole object is missing on one side.
+	Field string
+	// Value in the runtime configuration.
+	Runtime string
+	// Value in the permanent configuration.
+	Permanent string
+}
+
+func (d Drift) String() string {
+	prefix := d.Kind + " " + d.Name + ": "
+	switch {
+	case len(d.Field) == 0 && d.Type == DriftRuntimeOnly:
+		return prefix + "exists in runtime but not in permanent"
+	case len(d.Field) == 0 && d.Type == DriftPermanentOnly:
+		return prefix + "exists in permanent but not in runtime"
+	case d.Type == DriftRuntimeOnly:
+		return prefix + "runtime has " + d.Field + " " + d.Runtime + " not in permanent"
+	case d.Type == DriftPermanentOnly:
+		return prefix + "permanent has " + d.Field + " " + d.Permanent + " not in runtime"
+	}
+	return fmt.Sprintf("%s%s is %q in runtime but %q in permanent",
+		prefix, d.Field, d.Runtime, d.Permanent)
+}
+
+// DriftReport lists all differences between runtime and permanent configuration.
+type DriftReport struct {
+	Differences []Drift
+}
+
+// HasDrift returns true if runtime and permanent configuration differ.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Differences) > 0
+}
+
+func (r *DriftReport) String() string {
+	var lines []string
+	for _, d := range r.Differences {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Drift compares the runtime and permanent settings of all zones, services, ipsets and policies.
+// A non-empty report means that runtime changes have not been made permanent (or permanent changes not been loaded).
+// Policies are skipped on firewalld versions without policy support.
+func (c *Client) Drift(ctx context.Context) (*DriftReport, error) {
+	report := &DriftReport{}
+	for _, source := range c.driftSources() {
+		differences, err := source.drift(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s drift: %w", source.kind, err)
+		}
+		report.Differences = append(report.Differences, differences...)
+	}
+	return report, nil
+}
+
+// driftField is a setting of an object flattened for comparison.
+type driftField struct {
+	name string
+	// scalar fields have exactly one value,
+	// otherwise values are compared as a set.
+	scalar bool
+	values []string
+}
+
+func scalarField(name, value string) driftField {
+	return driftField{name: name, scalar: true, values: []string{value}}
+}
+
+func setField(name string, values []string) driftField {
+	return driftField{name: name, values: values}
+}
+
+type driftSource struct {
+	kind           string
+	runtimeNames   func(ctx context.Context) ([]string, error)
+	permanentNames func(ctx context.Context) ([]string, error)
+	runtime        func(ctx context.Context, name string) ([]driftField, error)
+	permanent      func(ctx context.Context, name string) ([]driftField, error)
+	// optional objects are skipped if the daemon does not support them.
+	optional bool
+}
+
+func (c *Client) driftSources() []driftSource {
+	return []driftSource{
+		{
+			kind:           "zone",
+			runtimeNames:   c.GetZones,
+			permanentNames: c.config.GetZoneNames,
+			runtime: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.GetZoneSettings(ctx, name)
+				return s.driftFields(), err
+			},
+			permanent: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.config.GetZoneSettings(ctx, name)
+				return s.driftFields(), err
+			},
+		},
+		{
+			kind:           "service",
+			runtimeNames:   c.ListServices,
+			permanentNames: c.config.GetServiceNames,
+			runtime: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.GetServiceSettings(ctx, name)
+				return s.driftFields(), err
+			},
+			permanent: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.config.GetServiceSettings(ctx, name)
+				return s.driftFields(), err
+			},
+		},
+		{
+			kind:           "ipset",
+			runtimeNames:   c.GetIPSets,
+			permanentNames: c.config.GetIPSetNames,
+			runtime: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.GetIPSetSettings(ctx, name)
+				return s.driftFields(), err
+			},
+			permanent: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.config.GetIPSetSettings(ctx, name)
+				return s.driftFields(), err
+			},
+		},
+		{
+			kind:           "policy",
+			optional:       true,
+			runtimeNames:   c.GetPolicies,
+			permanentNames: c.config.GetPolicyNames,
+			runtime: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.GetPolicySettings(ctx, name)
+				return s.driftFields(), err
+			},
+			permanent: func(ctx context.Context, name string) ([]driftField, error) {
+				s, err := c.config.GetPolicySettings(ctx, name)
+				return s.driftFields(), err
+			},
+		},
+	}
+}
+
+func (s driftSource) drift(ctx context.Context) ([]Drift, error) {
+	runtimeNames, err := s.runtimeNames(ctx)
+	if s.optional && isUnknownMethod(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	permanentNames, err := s.permanentNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inRuntime := stringSet(runtimeNames)
+	inPermanent := stringSet(permanentNames)
+	var out []Drift
+	for _, name := range sortedUnion(runtimeNames, permanentNames) {
+		switch {
+		case !inPermanent[name]:
+			out = append(out, Drift{
+				Type: DriftRuntimeOnly, Kind: s.kind, Name: name})
+			continue
+		case !inRuntime[name]:
+			out = append(out, Drift{
+				Type: DriftPermanentOnly, Kind: s.kind, Name: name})
+			continue
+		}
+
+		runtime, err := s.runtime(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("runtime %s: %w", name, err)
+		}
+		permanent, err := s.permanent(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("permanent %s: %w", name, err)
+		}
+		out = append(out, compareDriftFields(s.kind, name, runtime, permanent)...)
+	}
+	return out, nil
+}
+
+// compareDriftFields expects both field lists to be generated by the same driftFields method.
+func compareDriftFields(kind, name string, runtime, permanent []driftField) []Drift {
+	var out []Drift
+	for i := range runtime {
+		r, p := runtime[i], permanent[i]
+		if r.scalar {
+			if r.values[0] != p.values[0] {
+				out = append(out, Drift{
+					Type: DriftChanged, Kind: kind, Name: name, Field: r.name,
+					Runtime: r.values[0], Permanent: p.values[0],
+				})
+			}
+			continue
+		}
+
+		inRuntime := stringSet(r.values)
+		inPermanent := stringSet(p.values)
+		for _, v := range sortedUnion(r.values, p.values) {
+			switch {
+			case !inPermanent[v]:
+				out = append(out, Drift{
+					Type: DriftRuntimeOnly, Kind: kind, Name: name, Field: r.name,
+					Runtime: v,
+				})
+			case !inRuntime[v]:
+				out = append(out, Drift{
+					Type: DriftPermanentOnly, Kind: kind, Name: name, Field: r.name,
+					Permanent: v,
+				})
+			}
+		}
+	}
+	return out
+}
+
+func (z ZoneSettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", z.Name),
+		scalarField("description", z.Description),
+		scalarField("target", z.Target),
+		scalarField("masquerade", strconv.FormatBool(z.Masquerade)),
+		scalarField("icmp-block-inversion", strconv.FormatBool(z.ICMPBlockInversion)),
+		setField("service", z.Services),
+		setField("port", portStrings(z.Ports)),
+		setField("protocol", z.Protocols),
+		setField("source-port", portStrings(z.SourcePorts)),
+		setField("icmp-block", z.ICMPBlocks),
+		setField("forward-port", forwardPortStrings(z.ForwardPorts)),
+		setField("interface", z.Interfaces),
+		setField("source", z.SourceAddresses),
+		setField("rich rule", canonicalRichRules(z.RichRules)),
+	}
+}
+
+func (s ServiceSettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", s.Name),
+		scalarField("description", s.Description),
+		setField("port", portStrings(s.Ports)),
+		setField("protocol", s.Protocols),
+		setField("source-port", portStrings(s.SourcePorts)),
+		setField("module", s.ModuleNames),
+		setField("destination", mapStrings(s.Destinations)),
+	}
+}
+
+func (s IPSetSettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", s.Name),
+		scalarField("description", s.Description),
+		scalarField("type", s.Type),
+		setField("option", mapStrings(s.Options)),
+		setField("entry", s.Entries),
+	}
+}
+
+func (p PolicySettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", p.Name),
+		scalarField("description", p.Description),
+		scalarField("target", p.Target),
+		scalarField("priority", strconv.Itoa(p.Priority)),
+		scalarField("masquerade", strconv.FormatBool(p.Masquerade)),
+		setField("ingress-zone", p.IngressZones),
+		setField("egress-zone", p.EgressZones),
+		setField("service", p.Services),
+		setField("port", portStrings(p.Ports)),
+		setField("protocol", p.Protocols),
+		setField("source-port", portStrings(p.SourcePorts)),
+		setField("icmp-block", p.ICMPBlocks),
+		setField("forward-port", forwardPortStrings(p.ForwardPorts)),
+		setField("rich rule", canonicalRichRules(p.RichRules)),
+	}
+}
+
+func portStrings(ports []Port) []string {
+	var out []string
+	for _, p := range ports {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func forwardPortStrings(ports []ForwardPort) []string {
+	var out []string
+	for _, p := range ports {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+// mapStrings returns "key=value" pairs.
+func mapStrings(m map[string]string) []string {
+	var out []string
+	for k, v := range m {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func stringSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// sortedUnion returns all distinct values of a and b in sorted order.
+func sortedUnion(a, b []string) []string {
+	set := stringSet(a)
+	for _, v := range b {
+		set[v] = true
+	}
+	out := make([]string, 0, len(set))
+	for v := range set {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s HelperSettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", s.Name),
+		scalarField("description", s.Description),
+		scalarField("family", s.Family),
+		scalarField("module", s.Module),
+		setField("port", portStrings(s.Ports)),
+	}
+}
+
+func (s ICMPTypeSettings) driftFields() []driftField {
+	return []driftField{
+		scalarField("short", s.Name),
+		scalarField("description", s.Description),
+		setField("destination", s.Destinations),
+	}
+}
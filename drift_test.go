@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Drift(t *testing.T) {
+	const publicPath = "/org/fedoraproject/FirewallD1/config/zone/0"
+
+	zoneSettings := func(ports [][]interface{}, target string) []interface{} {
+		return []interface{}{
+			"", "Public", "", false, target,
+			[]string{"ssh"}, ports, []string{}, false, [][]interface{}{},
+			[]string{}, []string{}, []string{}, []string{}, [][]interface{}{},
+		}
+	}
+
+	mainCaller := &callerMock{}
+	onMethod(mainCaller, getZonesMethod, []string{"public"})
+	onMethod(mainCaller, getZoneSettingsMethod, zoneSettings(
+		[][]interface{}{{"22", "tcp"}, {"8080", "tcp"}}, "ACCEPT"))
+	onMethod(mainCaller, listServicesMethod, []string{})
+	onMethod(mainCaller, getIPSetsMethod, []string{"blocklist"})
+	mainCaller.
+		On("Call", mock.Anything, mock.MatchedBy(func(c Call) bool {
+			return c.Method == getPoliciesMethod
+		})).
+		Return(dbus.Error{Name: unknownMethodErrorName})
+
+	configPathCaller := &callerMock{}
+	onMethod(configPathCaller, configGetZoneNamesMethod, []string{"internal", "public"})
+	onMethod(configPathCaller, configGetZoneByNameMethod, publicPath)
+	onMethod(configPathCaller, configGetServiceNamesMethod, []string{})
+	onMethod(configPathCaller, configGetIPSetNamesMethod, []string{})
+
+	zoneCaller := &callerMock{}
+	onMethod(zoneCaller, configZoneGetSettingsMethod, zoneSettings(
+		[][]interface{}{{"22", "tcp"}}, "default"))
+
+	conn := &connectionMock{}
+	conn.On("Object", dbusDest, mainPath).Return(mainCaller)
+	conn.On("Object", dbusDest, configPath).Return(configPathCaller)
+	conn.On("Object", dbusDest, publicPath).Return(zoneCaller)
+	c := NewClient(conn)
+
+	report, err := c.Drift(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []Drift{
+		{Type: DriftPermanentOnly, Kind: "zone", Name: "internal"},
+		{
+			Type: DriftChanged, Kind: "zone", Name: "public", Field: "target",
+			Runtime: "ACCEPT", Permanent: "default",
+		},
+		{
+			Type: DriftRuntimeOnly, Kind: "zone", Name: "public", Field: "port",
+			Runtime: "8080/tcp",
+		},
+		{Type: DriftRuntimeOnly, Kind: "ipset", Name: "blocklist"},
+	}, report.Differences)
+	assert.True(t, report.HasDrift())
+	assert.Equal(t, `zone internal: exists in permanent but not in runtime
+zone public: target is "ACCEPT" in runtime but "default" in permanent
+zone public: runtime has port 8080/tcp not in permanent
+ipset blocklist: exists in runtime but not in permanent`, report.String())
+}
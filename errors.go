@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// D-Bus error name used by firewalld for all of its exceptions.
+const exceptionErrorName = "org.fedoraproject.FirewallD1.Exception"
+
+// Error is an error reported by the firewalld daemon.
+type Error struct {
+	// firewalld error code, e.g. INVALID_ZONE.
+	Code string
+	// Human readable details.
+	Message string
+}
+
+func (e Error) Error() string {
+	if len(e.Message) == 0 {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+// parseErrors extracts firewalld errors from a D-Bus error.
+// firewalld formats exceptions as "CODE: message",
+// multiple problems are reported on separate lines.
+// Returns false if err is not a firewalld exception.
+func parseErrors(err error) ([]Error, bool) {
+	dbusErr, ok := asDBusError(err)
+	if !ok || dbusErr.Name != exceptionErrorName {
+		return nil, false
+	}
+
+	var errs []Error
+	for _, line := range strings.Split(dbusErr.Error(), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		errs = append(errs, parseError(line))
+	}
+	return errs, true
+}
+
+// ErrorCode returns the firewalld error code of err, e.g. "INVALID_ZONE",
+// or an empty string if err was not reported by firewalld.
+func ErrorCode(err error) string {
+	var e Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if errs, ok := parseErrors(err); ok && len(errs) > 0 {
+		return errs[0].Code
+	}
+	return ""
+}
+
+func parseError(s string) Error {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		if isErrorCode(s) {
+			return Error{Code: s}
+		}
+		return Error{Message: s}
+	}
+	code := s[:i]
+	if !isErrorCode(code) {
+		return Error{Message: s}
+	}
+	return Error{
+		Code:    code,
+		Message: strings.TrimSpace(s[i+1:]),
+	}
+}
+
+// firewalld error codes are upper case words separated by underscores.
+func isErrorCode(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// asDBusError finds a D-Bus error in the chain of err,
+// godbus returns both dbus.Error and *dbus.Error values.
+func asDBusError(err error) (dbus.Error, bool) {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr, true
+	}
+	var dbusErrPtr *dbus.Error
+	if errors.As(err, &dbusErrPtr) && dbusErrPtr != nil {
+		return *dbusErrPtr, true
+	}
+	return dbus.Error{}, false
+}
+
+// isUnknownMethod returns true if the daemon does not implement the called method,
+// e.g. policy methods on firewalld versions prior to 0.9.
+func isUnknownMethod(err error) bool {
+	dbusErr, ok := asDBusError(err)
+	return ok && dbusErr.Name == unknownMethodErrorName
+}
+
+const unknownMethodErrorName = "org.freedesktop.DBus.Error.UnknownMethod"
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	exception := dbus.Error{
+		Name: exceptionErrorName,
+		Body: []interface{}{"INVALID_ZONE: foo"},
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "nil"},
+		{name: "other", err: errors.New("INVALID_ZONE: foo")},
+		{name: "Error", err: Error{Code: "NAME_CONFLICT"}, expected: "NAME_CONFLICT"},
+		{name: "dbus.Error", err: exception, expected: "INVALID_ZONE"},
+		{name: "*dbus.Error", err: &exception, expected: "INVALID_ZONE"},
+		{name: "wrapped", err: fmt.Errorf("get zone: %w", exception), expected: "INVALID_ZONE"},
+		{
+			name: "not an exception",
+			err:  dbus.Error{Name: unknownMethodErrorName, Body: []interface{}{"NOPE"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ErrorCode(test.err))
+		})
+	}
+}
+
+func TestIsUnknownMethod(t *testing.T) {
+	unknown := dbus.Error{Name: unknownMethodErrorName, Body: []interface{}{"No such method"}}
+
+	assert.False(t, isUnknownMethod(nil))
+	assert.False(t, isUnknownMethod(errors.New(unknownMethodErrorName)))
+	assert.False(t, isUnknownMethod(dbus.Error{Name: exceptionErrorName}))
+	assert.True(t, isUnknownMethod(unknown))
+	assert.True(t, isUnknownMethod(&unknown))
+	assert.True(t, isUnknownMethod(fmt.Errorf("get policies: %w", unknown)))
+	assert.True(t, isUnknownMethod(fmt.Errorf("get policies: %w", &unknown)))
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ExposureQuery selects what State.Exposures looks for.
+// Exactly one of Port and Service must be set.
+type ExposureQuery struct {
+	// Port or port range with protocol, e.g. 3306/tcp.
+	Port Port
+	// Service name, resolved to the ports and protocols of its definition.
+	Service string
+}
+
+func (q ExposureQuery) String() string {
+	if len(q.Service) > 0 {
+		return "service " + q.Service
+	}
+	return "port " + q.Port.String()
+}
+
+// Exposure is a single setting of a zone that opens the queried port.
+type Exposure struct {
+	Zone string
+	// The zone is the default zone, which also receives traffic
+	// from interfaces that are not bound to any zone.
+	Default bool
+	// Interfaces and sources bound to the zone.
+	Interfaces []string
+	Sources    []string
+	// Setting that opens the port: "service mysql", "port 3306/tcp", "protocol tcp",
+	// "forward-port port=3306:proto=tcp:toport=:toaddr=192.0.2.1",
+	// an accepting or forwarding rich rule or "target ACCEPT".
+	Rule string
+}
+
+func (e Exposure) String() string {
+	zone := e.Zone
+	if e.Default {
+		zone += " (default)"
+	}
+	return fmt.Sprintf("zone %s interfaces %v sources %v: %s", zone, e.Interfaces, e.Sources, e.Rule)
+}
+
+// Exposures reports every zone setting that opens the queried port or service,
+// sorted by zone. Services referenced by the zones must be part of the state.
+// A port is opened by overlapping ports, services and forward ports,
+// by allowing its whole protocol, by accepting rich rules and by the ACCEPT target.
+// Policies and rules that reject or drop are not taken into account.
+func (s State) Exposures(q ExposureQuery) ([]Exposure, error) {
+	e := &exposures{state: s, service: q.Service}
+	switch {
+	case len(q.Service) > 0 && len(q.Port.Port) > 0:
+		return nil, fmt.Errorf("query must have either port or service, not both")
+	case len(q.Service) > 0:
+		service, ok := s.Services[q.Service]
+		if !ok {
+			return nil, fmt.Errorf("unknown service %q", q.Service)
+		}
+		e.ports, e.protocols = service.Ports, service.Protocols
+	case len(q.Port.Port) > 0:
+		if err := q.Port.Validate(); err != nil {
+			return nil, err
+		}
+		e.ports = []Port{q.Port}
+	default:
+		return nil, fmt.Errorf("query must have a port or service")
+	}
+
+	var out []Exposure
+	for _, name := range sortedKeys(s.Zones) {
+		rules, err := e.zone(s.Zones[name])
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", name, err)
+		}
+		for _, rule := range rules {
+			out = append(out, Exposure{
+				Zone:       name,
+				Default:    name == s.DefaultZone,
+				Interfaces: s.Zones[name].Interfaces,
+				Sources:    s.Zones[name].SourceAddresses,
+				Rule:       rule,
+			})
+		}
+	}
+	return out, nil
+}
+
+type exposures struct {
+	state State
+	// Queried service, empty for port queries.
+	service   string
+	ports     []Port
+	protocols []string
+}
+
+// zone returns the settings of the zone that open the queried port.
+func (e *exposures) zone(z ZoneSettings) ([]string, error) {
+	var rules []string
+	if z.Target == "ACCEPT" {
+		rules = append(rules, "target ACCEPT")
+	}
+	for _, service := range z.Services {
+		ok, err := e.serviceMatches(service)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rules = append(rules, "service "+service)
+		}
+	}
+	for _, port := range z.Ports {
+		if e.portMatches(port) {
+			rules = append(rules, "port "+port.String())
+		}
+	}
+	for _, protocol := range z.Protocols {
+		if e.protocolMatches(protocol) {
+			rules = append(rules, "protocol "+protocol)
+		}
+	}
+	for _, port := range z.ForwardPorts {
+		if e.portMatches(Port{Port: port.Port, Protocol: port.Protocol}) {
+			rules = append(rules, "forward-port "+port.String())
+		}
+	}
+	for i, s := range z.RichRules {
+		rule, err := ParseRichRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("RichRules[%d]: %w", i, err)
+		}
+		ok, err := e.richRuleMatches(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule, err)
+		}
+		if ok {
+			rules = append(rules, rule.String())
+		}
+	}
+	return rules, nil
+}
+
+func (e *exposures) richRuleMatches(r RichRule) (bool, error) {
+	if r.ForwardPort != nil {
+		return e.portMatches(Port{Port: r.ForwardPort.Port, Protocol: r.ForwardPort.Protocol}), nil
+	}
+	if r.Action == nil || r.Action.Type != RichRuleAccept {
+		return false, nil
+	}
+	switch {
+	case len(r.Service) > 0:
+		return e.serviceMatches(r.Service)
+	case r.Port != nil:
+		return e.portMatches(*r.Port), nil
+	case len(r.Protocol) > 0:
+		return e.protocolMatches(r.Protocol), nil
+	case len(r.ICMPType) > 0 || r.SourcePort != nil || r.Masquerade:
+		return false, nil
+	}
+	// Accepts everything from the rule's source.
+	return true, nil
+}
+
+func (e *exposures) serviceMatches(name string) (bool, error) {
+	if name == e.service {
+		return true, nil
+	}
+	service, ok := e.state.Services[name]
+	if !ok {
+		return false, fmt.Errorf("unknown service %q", name)
+	}
+	for _, port := range service.Ports {
+		if e.portMatches(port) {
+			return true, nil
+		}
+	}
+	for _, protocol := range service.Protocols {
+		if containsString(e.protocols, protocol) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (e *exposures) portMatches(port Port) bool {
+	for _, p := range e.ports {
+		if p.Overlaps(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// protocolMatches returns true if allowing protocol opens the queried port.
+func (e *exposures) protocolMatches(protocol string) bool {
+	if containsString(e.protocols, protocol) {
+		return true
+	}
+	for _, p := range e.ports {
+		if p.Protocol == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Exposures reports every zone setting of the permanent configuration
+// that opens the queried port or service, see State.Exposures.
+func (c *ConfigClient) Exposures(
+	ctx context.Context, q ExposureQuery) ([]Exposure, error) {
+	properties, err := c.GetProperties(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get properties: %w", err)
+	}
+	defaultZone, _ := properties["DefaultZone"].Value().(string)
+	return ConfigExposures(ctx, c, defaultZone, q)
+}
+
+// ConfigExposures reports every zone setting of the permanent configuration c
+// that opens the queried port or service, see State.Exposures.
+// It reads all zones and the services they reference.
+func ConfigExposures(
+	ctx context.Context, c Config, defaultZone string, q ExposureQuery) ([]Exposure, error) {
+	state := State{
+		DefaultZone: defaultZone,
+		Zones:       map[string]ZoneSettings{},
+		Services:    map[string]ServiceSettings{},
+	}
+
+	names, err := c.GetZoneNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list zones: %w", err)
+	}
+	services := map[string]bool{}
+	if len(q.Service) > 0 {
+		services[q.Service] = true
+	}
+	for _, name := range names {
+		settings, err := c.GetZoneSettings(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", name, err)
+		}
+		state.Zones[name] = settings
+		for _, service := range settings.Services {
+			services[service] = true
+		}
+		for _, s := range settings.RichRules {
+			if rule, err := ParseRichRule(s); err == nil && len(rule.Service) > 0 {
+				services[rule.Service] = true
+			}
+		}
+	}
+
+	serviceNames := make([]string, 0, len(services))
+	for name := range services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		settings, err := c.GetServiceSettings(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		state.Services[name] = settings
+	}
+	return state.Exposures(q)
+}
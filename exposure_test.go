@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exposureState() State {
+	return State{
+		DefaultZone: "public",
+		Zones: map[string]ZoneSettings{
+			"public": {
+				Services:   []string{"ssh"},
+				Interfaces: []string{"eth0"},
+				RichRules: []string{
+					`rule family="ipv4" source address="192.0.2.0/24" service name="mysql" accept`,
+					`rule family="ipv4" source address="198.51.100.0/24" port port="3306" protocol="tcp" drop`,
+				},
+			},
+			"internal": {
+				Ports:           []Port{{Port: "3300-3400", Protocol: "tcp"}},
+				SourceAddresses: []string{"10.0.0.0/8"},
+			},
+			"dmz": {
+				ForwardPorts: []ForwardPort{{Port: "3306", Protocol: "tcp", ToAddress: "10.0.0.5"}},
+				Interfaces:   []string{"eth1"},
+			},
+			"trusted": {
+				Target:     "ACCEPT",
+				Interfaces: []string{"lo"},
+			},
+			"lab": {
+				Protocols:  []string{"udp"},
+				Interfaces: []string{"eth2"},
+			},
+		},
+		Services: map[string]ServiceSettings{
+			"ssh":   {Ports: []Port{{Port: "22", Protocol: "tcp"}}},
+			"mysql": {Ports: []Port{{Port: "3306", Protocol: "tcp"}}},
+		},
+	}
+}
+
+func TestState_Exposures(t *testing.T) {
+	state := exposureState()
+	expected := []Exposure{
+		{
+			Zone:       "dmz",
+			Interfaces: []string{"eth1"},
+			Rule:       "forward-port port=3306:proto=tcp:toport=:toaddr=10.0.0.5",
+		},
+		{
+			Zone:    "internal",
+			Sources: []string{"10.0.0.0/8"},
+			Rule:    "port 3300-3400/tcp",
+		},
+		{
+			Zone:       "public",
+			Default:    true,
+			Interfaces: []string{"eth0"},
+			Rule:       `rule family="ipv4" source address="192.0.2.0/24" service name="mysql" accept`,
+		},
+		{
+			Zone:       "trusted",
+			Interfaces: []string{"lo"},
+			Rule:       "target ACCEPT",
+		},
+	}
+
+	exposures, err := state.Exposures(ExposureQuery{Port: Port{Port: "3306", Protocol: "tcp"}})
+	require.NoError(t, err)
+	assert.Equal(t, expected, exposures)
+
+	exposures, err = state.Exposures(ExposureQuery{Service: "mysql"})
+	require.NoError(t, err)
+	assert.Equal(t, expected, exposures)
+
+	exposures, err = state.Exposures(ExposureQuery{Port: Port{Port: "53", Protocol: "udp"}})
+	require.NoError(t, err)
+	assert.Equal(t, []Exposure{
+		{Zone: "lab", Interfaces: []string{"eth2"}, Rule: "protocol udp"},
+		{Zone: "trusted", Interfaces: []string{"lo"}, Rule: "target ACCEPT"},
+	}, exposures)
+
+	exposures, err = state.Exposures(ExposureQuery{Service: "ssh"})
+	require.NoError(t, err)
+	assert.Equal(t, []Exposure{
+		{Zone: "public", Default: true, Interfaces: []string{"eth0"}, Rule: "service ssh"},
+		{Zone: "trusted", Interfaces: []string{"lo"}, Rule: "target ACCEPT"},
+	}, exposures)
+}
+
+func TestState_Exposures_Errors(t *testing.T) {
+	state := exposureState()
+	for _, q := range []ExposureQuery{
+		{},
+		{Service: "ftp"},
+		{Port: Port{Port: "3306"}},
+		{Port: Port{Port: "3306", Protocol: "tcp"}, Service: "mysql"},
+	} {
+		t.Run(q.String(), func(t *testing.T) {
+			_, err := state.Exposures(q)
+			assert.Error(t, err)
+		})
+	}
+
+	state.Zones["public"] = ZoneSettings{Services: []string{"ftp"}}
+	_, err := state.Exposures(ExposureQuery{Service: "mysql"})
+	assert.Error(t, err)
+}
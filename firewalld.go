@@ -23,13 +23,18 @@ import (
 	"github.com/godbus/dbus/v5"
 )
 
-type caller interface {
-	Call(ctx context.Context, c call) error
+// Caller performs method calls on a single D-Bus object.
+// Implementations store the results into c.Returns, like dbus.Call.Store does.
+type Caller interface {
+	Call(ctx context.Context, c Call) error
 }
 
-type connection interface {
+// Connection is the transport used by Client and ConfigClient.
+// The default implementation wraps a godbus connection,
+// other implementations can record, replay or fake firewalld.
+type Connection interface {
 	io.Closer
-	Object(dest, path string) caller
+	Object(dest, path string) Caller
 }
 
 // Opens a new connection to the system dbus and returns a connected Client for firewalld.
@@ -39,14 +44,13 @@ func Open() (*Client, error) {
 		return nil, err
 	}
 
-	c := &dbusConnectionWrapper{conn: conn}
-	return NewClient(c), nil
+	return NewClient(NewConnection(conn)), nil
 }
 
 // Client for the Firewalld D-Bus API
 type Client struct {
-	conn   connection
-	main   caller
+	conn   Connection
+	main   Caller
 	config *ConfigClient
 }
 
@@ -58,7 +62,8 @@ const (
 	configPath = "/org/fedoraproject/FirewallD1/config"
 )
 
-func NewClient(conn connection) *Client {
+// NewClient returns a Client using the given connection.
+func NewClient(conn Connection) *Client {
 	return &Client{
 		conn: conn,
 		main: conn.Object(dbusDest, mainPath),
@@ -78,7 +83,7 @@ const getPropertyMethod = "org.freedesktop.DBus.Properties.Get"
 func (c *Client) Version(ctx context.Context) (string, error) {
 	var version string
 	return version, c.main.Call(ctx,
-		newCall(getPropertyMethod, 0).
+		NewCall(getPropertyMethod, 0).
 			WithArguments("org.fedoraproject.FirewallD1", "version").
 			WithReturns(&version))
 }
@@ -87,7 +92,52 @@ const reloadMethod = "org.fedoraproject.FirewallD1.reload"
 
 func (c *Client) Reload(ctx context.Context) error {
 	return c.main.Call(ctx,
-		newCall(reloadMethod, 0))
+		NewCall(reloadMethod, 0))
+}
+
+const getDefaultZoneMethod = "org.fedoraproject.FirewallD1.getDefaultZone"
+
+// Return default zone.
+func (c *Client) GetDefaultZone(ctx context.Context) (zone string, err error) {
+	return zone, c.main.Call(ctx,
+		NewCall(getDefaultZoneMethod, 0).
+			WithReturns(&zone))
+}
+
+const setDefaultZoneMethod = "org.fedoraproject.FirewallD1.setDefaultZone"
+
+// Set default zone for connections and interfaces where no zone has been selected.
+// Changes runtime and permanent configuration.
+func (c *Client) SetDefaultZone(ctx context.Context, zone string) error {
+	return c.main.Call(ctx,
+		NewCall(setDefaultZoneMethod, 0).
+			WithArguments(zone))
+}
+
+const runtimeToPermanentMethod = "org.fedoraproject.FirewallD1.runtimeToPermanent"
+
+// Make runtime settings permanent.
+// Replaces the permanent configuration with the current runtime configuration.
+func (c *Client) RuntimeToPermanent(ctx context.Context) error {
+	return c.main.Call(ctx,
+		NewCall(runtimeToPermanentMethod, 0))
+}
+
+const checkPermanentConfigMethod = "org.fedoraproject.FirewallD1.checkPermanentConfig"
+
+// Run checks on the permanent configuration.
+// Problems found by the daemon are returned as a list,
+// the error is reserved for failures to perform the check itself.
+func (c *Client) CheckPermanentConfig(ctx context.Context) ([]Error, error) {
+	err := c.main.Call(ctx,
+		NewCall(checkPermanentConfigMethod, 0))
+	if err == nil {
+		return nil, nil
+	}
+	if problems, ok := parseErrors(err); ok {
+		return problems, nil
+	}
+	return nil, err
 }
 
 // Close disconnects from dbus
@@ -95,55 +145,66 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
+// NewConnection wraps an established D-Bus connection,
+// e.g. to a private bus, for use with NewClient.
+func NewConnection(conn *dbus.Conn) Connection {
+	return &dbusConnectionWrapper{conn: conn}
+}
+
 type dbusConnectionWrapper struct {
 	conn *dbus.Conn
 }
 
-var _ connection = (*dbusConnectionWrapper)(nil)
+var _ Connection = (*dbusConnectionWrapper)(nil)
 
 func (w *dbusConnectionWrapper) Close() error {
 	return w.conn.Close()
 }
 
-func (w *dbusConnectionWrapper) Object(dest, path string) caller {
+func (w *dbusConnectionWrapper) Object(dest, path string) Caller {
 	return &dbusObjectWrapper{
 		obj: w.conn.Object(dest, dbus.ObjectPath(path))}
 }
 
-// dbusObjectWrapper implements the caller interface via dbus.BusObject
+// dbusObjectWrapper implements the Caller interface via dbus.BusObject
 type dbusObjectWrapper struct {
 	obj dbus.BusObject
 }
 
-var _ caller = (*dbusObjectWrapper)(nil)
+var _ Caller = (*dbusObjectWrapper)(nil)
 
-func (w *dbusObjectWrapper) Call(ctx context.Context, c call) error {
-	return w.obj.
-		CallWithContext(ctx, c.Method, c.Flags, c.Arguments...).
-		Store(c.Returns...)
+// Call discards the reply if no returns are given,
+// e.g. the zone name returned by runtime zone changes.
+func (w *dbusObjectWrapper) Call(ctx context.Context, c Call) error {
+	call := w.obj.CallWithContext(ctx, c.Method, c.Flags, c.Arguments...)
+	if call.Err != nil || len(c.Returns) == 0 {
+		return call.Err
+	}
+	return call.Store(c.Returns...)
 }
 
-// call is a container for all DBUS call parameters
-type call struct {
+// Call is a container for all DBUS call parameters
+type Call struct {
 	Method    string
 	Flags     dbus.Flags
 	Arguments []interface{}
 	Returns   []interface{}
 }
 
-func newCall(method string, flags dbus.Flags) call {
-	return call{
+// NewCall returns a call of the given method, e.g. "org.fedoraproject.FirewallD1.getZones".
+func NewCall(method string, flags dbus.Flags) Call {
+	return Call{
 		Method: method,
 		Flags:  flags,
 	}
 }
 
-func (c call) WithArguments(args ...interface{}) call {
+func (c Call) WithArguments(args ...interface{}) Call {
 	c.Arguments = args
 	return c
 }
 
-func (c call) WithReturns(returns ...interface{}) call {
+func (c Call) WithReturns(returns ...interface{}) Call {
 	c.Returns = returns
 	return c
 }
@@ -21,6 +21,7 @@ import (
 	"io"
 	"testing"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -46,11 +47,11 @@ func TestClient(t *testing.T) {
 		caller.
 			On("Call",
 				mock.Anything,
-				mock.MatchedBy(func(c call) bool {
+				mock.MatchedBy(func(c Call) bool {
 					return c.Method == getPropertyMethod
 				})).
 			Run(func(args mock.Arguments) {
-				c := args.Get(1).(call)
+				c := args.Get(1).(Call)
 				s := c.Returns[0].(*string)
 				*s = response
 			}).
@@ -66,15 +67,120 @@ func TestClient(t *testing.T) {
 
 		assert.Equal(t, response, zone)
 	})
+
+	t.Run("DefaultZone", func(t *testing.T) {
+		caller := &callerMock{}
+		onMethod(caller, getDefaultZoneMethod, "public")
+		caller.
+			On("Call",
+				mock.Anything,
+				mock.MatchedBy(func(c Call) bool {
+					return c.Method == setDefaultZoneMethod
+				})).
+			Return(nil)
+
+		c := &Client{
+			main: caller,
+		}
+
+		ctx := context.Background()
+		zone, err := c.GetDefaultZone(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "public", zone)
+
+		require.NoError(t, c.SetDefaultZone(ctx, "internal"))
+		caller.AssertCalled(t, "Call", mock.Anything, Call{
+			Method:    setDefaultZoneMethod,
+			Arguments: []interface{}{"internal"},
+		})
+	})
+
+	t.Run("RuntimeToPermanent", func(t *testing.T) {
+		caller := &callerMock{}
+		caller.
+			On("Call",
+				mock.Anything,
+				mock.MatchedBy(func(c Call) bool {
+					return c.Method == runtimeToPermanentMethod
+				})).
+			Return(nil)
+
+		c := &Client{
+			main: caller,
+		}
+
+		ctx := context.Background()
+		require.NoError(t, c.RuntimeToPermanent(ctx))
+		caller.AssertExpectations(t)
+	})
+
+	t.Run("CheckPermanentConfig", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			err         error
+			expected    []Error
+			expectedErr error
+		}{
+			{
+				name: "valid",
+			},
+			{
+				name: "invalid",
+				err: dbus.Error{
+					Name: exceptionErrorName,
+					Body: []interface{}{
+						"INVALID_ZONE: public.xml: unknown service 'foo'\nINVALID_PORT: 'abc'",
+					},
+				},
+				expected: []Error{
+					{Code: "INVALID_ZONE", Message: "public.xml: unknown service 'foo'"},
+					{Code: "INVALID_PORT", Message: "'abc'"},
+				},
+			},
+			{
+				name: "transport error",
+				err: dbus.Error{
+					Name: "org.freedesktop.DBus.Error.NoReply",
+					Body: []interface{}{"timeout"},
+				},
+				expectedErr: dbus.Error{
+					Name: "org.freedesktop.DBus.Error.NoReply",
+					Body: []interface{}{"timeout"},
+				},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				caller := &callerMock{}
+				caller.
+					On("Call",
+						mock.Anything,
+						mock.MatchedBy(func(c Call) bool {
+							return c.Method == checkPermanentConfigMethod
+						})).
+					Return(test.err)
+
+				c := &Client{
+					main: caller,
+				}
+
+				ctx := context.Background()
+				problems, err := c.CheckPermanentConfig(ctx)
+				assert.Equal(t, test.expectedErr, err)
+				assert.Equal(t, test.expected, problems)
+			})
+		}
+	})
 }
 
 type callerMock struct {
 	mock.Mock
 }
 
-var _ caller = (*callerMock)(nil)
+var _ Caller = (*callerMock)(nil)
 
-func (m *callerMock) Call(ctx context.Context, c call) error {
+func (m *callerMock) Call(ctx context.Context, c Call) error {
 	args := m.Called(ctx, c)
 	err, _ := args.Error(0).(error)
 	return err
@@ -92,8 +198,40 @@ func (m *connectionMock) Close() error {
 	return err
 }
 
-func (m *connectionMock) Object(dest, path string) caller {
+func (m *connectionMock) Object(dest, path string) Caller {
 	args := m.Called(dest, path)
-	c, _ := args.Get(0).(caller)
+	c, _ := args.Get(0).(Caller)
 	return c
 }
+
+// onMethod sets up the caller mock to answer calls to method with the given return values.
+func onMethod(m *callerMock, method string, returns ...interface{}) *mock.Call {
+	return m.
+		On("Call", mock.Anything, mock.MatchedBy(func(c Call) bool {
+			return c.Method == method
+		})).
+		Run(func(args mock.Arguments) {
+			c := args.Get(1).(Call)
+			if err := dbus.Store(returns, c.Returns...); err != nil {
+				panic(err)
+			}
+		}).
+		Return(nil)
+}
+
+// onMethodWithArgs is like onMethod, but only matches calls with the given arguments.
+func onMethodWithArgs(
+	m *callerMock, method string, args []interface{}, returns ...interface{},
+) *mock.Call {
+	return m.
+		On("Call", mock.Anything, mock.MatchedBy(func(c Call) bool {
+			return c.Method == method && assert.ObjectsAreEqual(args, c.Arguments)
+		})).
+		Run(func(args mock.Arguments) {
+			c := args.Get(1).(Call)
+			if err := dbus.Store(returns, c.Returns...); err != nil {
+				panic(err)
+			}
+		}).
+		Return(nil)
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+// Bus is a private dbus-daemon on which a Fake is served
+// as org.fedoraproject.FirewallD1, including the signals firewalld emits.
+// It needs the dbus-daemon binary, but neither root nor a system bus.
+type Bus struct {
+	// Address of the bus, e.g. to subscribe to signals.
+	Address string
+
+	fake   *Fake
+	dir    string
+	cmd    *exec.Cmd
+	server *dbus.Conn
+}
+
+// NewBusClient starts a Bus serving fake and returns a Client connected to it.
+// The test is skipped if dbus-daemon is not installed.
+// The bus is stopped when the test finishes.
+func NewBusClient(tb testing.TB, fake *Fake) *firewalld.Client {
+	tb.Helper()
+
+	bus, err := StartBus(fake)
+	if errors.Is(err, exec.ErrNotFound) {
+		tb.Skipf("dbus-daemon not available: %v", err)
+	}
+	if err != nil {
+		tb.Fatalf("starting dbus-daemon: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := bus.Close(); err != nil {
+			tb.Errorf("stopping dbus-daemon: %v", err)
+		}
+	})
+
+	client, err := bus.Client()
+	if err != nil {
+		tb.Fatalf("connecting to dbus-daemon: %v", err)
+	}
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// StartBus starts a private dbus-daemon and serves fake on it.
+// Returns an error wrapping exec.ErrNotFound if dbus-daemon is not installed.
+func StartBus(fake *Fake) (*Bus, error) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "firewalldtest")
+	if err != nil {
+		return nil, err
+	}
+	b := &Bus{fake: fake, dir: dir}
+
+	config := filepath.Join(dir, "bus.conf")
+	err = ioutil.WriteFile(config,
+		[]byte(fmt.Sprintf(busConfig, filepath.Join(dir, "bus.sock"))), 0600)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	b.cmd = exec.Command(daemon, "--nofork", "--print-address", "--config-file="+config)
+	stdout, err := b.cmd.StdoutPipe()
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	if err := b.cmd.Start(); err != nil {
+		b.cmd = nil
+		b.Close()
+		return nil, err
+	}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("reading bus address: %w", err)
+	}
+	b.Address = strings.TrimSpace(address)
+
+	handler := &busHandler{fake: fake}
+	b.server, err = connect(b.Address, dbus.WithHandler(handler))
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	handler.conn = b.server
+
+	reply, err := b.server.RequestName(dbusDest, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		b.Close()
+		return nil, fmt.Errorf("name %s already taken", dbusDest)
+	}
+	return b, nil
+}
+
+// Client returns a new Client connected to the bus.
+func (b *Bus) Client() (*firewalld.Client, error) {
+	conn, err := connect(b.Address)
+	if err != nil {
+		return nil, err
+	}
+	return firewalld.NewClient(firewalld.NewConnection(conn)), nil
+}
+
+// Close stops the daemon and removes its socket.
+func (b *Bus) Close() error {
+	if b.server != nil {
+		b.server.Close()
+	}
+	if b.cmd != nil {
+		if err := b.cmd.Process.Kill(); err != nil {
+			return err
+		}
+		// killed, the exit status is of no interest
+		_ = b.cmd.Wait()
+	}
+	return os.RemoveAll(b.dir)
+}
+
+func connect(address string, opts ...dbus.ConnOption) (*dbus.Conn, error) {
+	conn, err := dbus.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// busHandler dispatches all method calls received on the bus to the Fake.
+type busHandler struct {
+	fake *Fake
+	conn *dbus.Conn
+}
+
+var _ dbus.Handler = (*busHandler)(nil)
+
+func (h *busHandler) LookupObject(path dbus.ObjectPath) (dbus.ServerObject, bool) {
+	return &busObject{handler: h, path: string(path)}, true
+}
+
+type busObject struct {
+	handler *busHandler
+	path    string
+}
+
+func (o *busObject) LookupInterface(name string) (dbus.Interface, bool) {
+	return &busInterface{object: o, name: name}, true
+}
+
+type busInterface struct {
+	object *busObject
+	name   string
+}
+
+func (i *busInterface) LookupMethod(name string) (dbus.Method, bool) {
+	return &busMethod{
+		handler: i.object.handler,
+		path:    i.object.path,
+		method:  i.name + "." + name,
+	}, true
+}
+
+// busMethod passes the arguments on as decoded by godbus,
+// after checking their signature against the one declared by firewalld.
+type busMethod struct {
+	handler *busHandler
+	path    string
+	method  string
+}
+
+var (
+	_ dbus.Method          = (*busMethod)(nil)
+	_ dbus.ArgumentDecoder = (*busMethod)(nil)
+)
+
+func (m *busMethod) DecodeArguments(
+	conn *dbus.Conn, sender string, msg *dbus.Message, args []interface{}) ([]interface{}, error) {
+	sig, _ := msg.Headers[dbus.FieldSignature].Value().(dbus.Signature)
+	if err := checkSignature(m.method, sig); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func (m *busMethod) Call(args ...interface{}) ([]interface{}, error) {
+	values, signals, err := m.handler.fake.call(m.path, m.method, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range signals {
+		if err := m.handler.conn.Emit(dbus.ObjectPath(s.path), s.name, s.body...); err != nil {
+			return nil, err
+		}
+	}
+	for i, v := range values {
+		if sv, ok := v.(settingsValue); ok {
+			values[i] = wireSettings(sv)
+		}
+	}
+	return values, nil
+}
+
+func (m *busMethod) NumArguments() int                      { return 0 }
+func (m *busMethod) NumReturns() int                        { return 0 }
+func (m *busMethod) ArgumentValue(position int) interface{} { return nil }
+func (m *busMethod) ReturnValue(position int) interface{}   { return nil }
+
+// Settings tuples with the D-Bus signatures used by firewalld,
+// e.g. (sssbsasa(ss)asba(ssss)asasasasa(ss)b) for zones.
+type (
+	wirePort struct {
+		Port, Protocol string
+	}
+	wireForwardPort struct {
+		Port, Protocol, ToPort, ToAddress string
+	}
+	wireZone struct {
+		Version, Short, Description string
+		Unused                      bool
+		Target                      string
+		Services                    []string
+		Ports                       []wirePort
+		ICMPBlocks                  []string
+		Masquerade                  bool
+		ForwardPorts                []wireForwardPort
+		Interfaces                  []string
+		Sources                     []string
+		RichRules                   []string
+		Protocols                   []string
+		SourcePorts                 []wirePort
+		ICMPBlockInversion          bool
+	}
+	wireService struct {
+		Version, Short, Description string
+		Ports                       []wirePort
+		Modules                     []string
+		Destinations                map[string]string
+		Protocols                   []string
+		SourcePorts                 []wirePort
+	}
+	wireIPSet struct {
+		Version, Short, Description, Type string
+		Options                           map[string]string
+		Entries                           []string
+	}
+	wireICMPType struct {
+		Version, Short, Description string
+		Destinations                []string
+	}
+	wireDirect struct {
+		Chains       []directChain
+		Rules        []directRule
+		Passthroughs []directPassthrough
+	}
+	wireLockdownWhitelist struct {
+		Commands, Contexts, Users []string
+		UIDs                      []int32
+	}
+	wireHelper struct {
+		Version, Short, Description, Family, Module string
+		Ports                                       []wirePort
+	}
+)
+
+// wireSettings converts settings to the struct firewalld sends,
+// policies are sent as dictionary.
+func wireSettings(sv settingsValue) interface{} {
+	if sv.kind == tuplesKind {
+		return sv.settings
+	}
+	switch s := sv.settings.(type) {
+	case firewalld.ZoneSettings:
+		return wireZone{
+			Version: s.Version, Short: s.Name, Description: s.Description,
+			Target:             s.Target,
+			Services:           nonNil(s.Services),
+			Ports:              wirePorts(s.Ports),
+			ICMPBlocks:         nonNil(s.ICMPBlocks),
+			Masquerade:         s.Masquerade,
+			ForwardPorts:       wireForwardPorts(s.ForwardPorts),
+			Interfaces:         nonNil(s.Interfaces),
+			Sources:            nonNil(s.SourceAddresses),
+			RichRules:          nonNil(s.RichRules),
+			Protocols:          nonNil(s.Protocols),
+			SourcePorts:        wirePorts(s.SourcePorts),
+			ICMPBlockInversion: s.ICMPBlockInversion,
+		}
+	case firewalld.ServiceSettings:
+		destinations := s.Destinations
+		if destinations == nil {
+			destinations = map[string]string{}
+		}
+		return wireService{
+			Version: s.Version, Short: s.Name, Description: s.Description,
+			Ports:        wirePorts(s.Ports),
+			Modules:      nonNil(s.ModuleNames),
+			Destinations: destinations,
+			Protocols:    nonNil(s.Protocols),
+			SourcePorts:  wirePorts(s.SourcePorts),
+		}
+	case firewalld.IPSetSettings:
+		options := s.Options
+		if options == nil {
+			options = map[string]string{}
+		}
+		return wireIPSet{
+			Version: s.Version, Short: s.Name, Description: s.Description,
+			Type:    s.Type,
+			Options: options,
+			Entries: nonNil(s.Entries),
+		}
+	case firewalld.HelperSettings:
+		return wireHelper{
+			Version: s.Version, Short: s.Name, Description: s.Description,
+			Family: s.Family, Module: s.Module,
+			Ports: wirePorts(s.Ports),
+		}
+	case firewalld.ICMPTypeSettings:
+		return wireICMPType{
+			Version: s.Version, Short: s.Name, Description: s.Description,
+			Destinations: nonNil(s.Destinations),
+		}
+	case firewalld.DirectSettings:
+		w := wireDirect{
+			Chains:       []directChain{},
+			Rules:        []directRule{},
+			Passthroughs: []directPassthrough{},
+		}
+		for _, c := range s.Chains {
+			w.Chains = append(w.Chains, directChain{IPV: c.IPV, Table: c.Table, Chain: c.Chain})
+		}
+		for _, r := range s.Rules {
+			w.Rules = append(w.Rules, directRule{
+				IPV: r.IPV, Table: r.Table, Chain: r.Chain,
+				Priority: int32(r.Priority), Args: nonNil(r.Args)})
+		}
+		for _, p := range s.Passthroughs {
+			w.Passthroughs = append(w.Passthroughs, directPassthrough{IPV: p.IPV, Args: nonNil(p.Args)})
+		}
+		return w
+	case firewalld.PolicySettings:
+		return s.ToMap()
+	case firewalld.LockdownWhitelist:
+		w := wireLockdownWhitelist{
+			Commands: nonNil(s.Commands),
+			Contexts: nonNil(s.Contexts),
+			Users:    nonNil(s.Users),
+			UIDs:     []int32{},
+		}
+		for _, uid := range s.UIDs {
+			w.UIDs = append(w.UIDs, int32(uid))
+		}
+		return w
+	}
+	return sv.kind.encode(sv.settings)
+}
+
+func wirePorts(ports []firewalld.Port) []wirePort {
+	out := []wirePort{}
+	for _, p := range ports {
+		out = append(out, wirePort{Port: p.Port, Protocol: p.Protocol})
+	}
+	return out
+}
+
+func wireForwardPorts(ports []firewalld.ForwardPort) []wireForwardPort {
+	out := []wireForwardPort{}
+	for _, p := range ports {
+		out = append(out, wireForwardPort{
+			Port: p.Port, Protocol: p.Protocol, ToPort: p.ToPort, ToAddress: p.ToAddress})
+	}
+	return out
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
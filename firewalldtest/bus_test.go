@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+)
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	c := NewBusClient(t, fake)
+
+	version, err := c.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Version, version)
+
+	dmz := firewalld.ZoneSettings{
+		Name:     "DMZ",
+		Target:   "default",
+		Services: []string{"http"},
+		Ports:    []firewalld.Port{{Port: "8443", Protocol: "tcp"}},
+		ForwardPorts: []firewalld.ForwardPort{
+			{Port: "22", Protocol: "tcp", ToPort: "2222", ToAddress: "192.0.2.1"},
+		},
+		ICMPBlockInversion: true,
+	}
+	require.NoError(t, c.Config().AddZone(ctx, "dmz", dmz))
+	settings, err := c.Config().GetZoneSettings(ctx, "dmz")
+	require.NoError(t, err)
+	// empty lists are received as empty slices
+	assert.Empty(t, cmp.Diff(dmz, settings, cmpopts.EquateEmpty()))
+
+	require.NoError(t, c.Reload(ctx))
+	require.NoError(t, c.ApplyZoneChanges(ctx, "dmz", []firewalld.ZoneChange{
+		{Method: "addService", Args: []string{"https"}},
+		{Method: "addInterface", Args: []string{"eth1"}},
+	}))
+	settings, err = c.GetZoneSettings(ctx, "dmz")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http", "https"}, settings.Services)
+	assert.Equal(t, []string{"eth1"}, settings.Interfaces)
+
+	policy := firewalld.PolicySettings{
+		Target:       "ACCEPT",
+		Priority:     -1,
+		IngressZones: []string{"dmz"},
+		EgressZones:  []string{"public"},
+		Ports:        []firewalld.Port{{Port: "53", Protocol: "udp"}},
+	}
+	require.NoError(t, c.Config().AddPolicy(ctx, "dmz-out", policy))
+	gotPolicy, err := c.Config().GetPolicySettings(ctx, "dmz-out")
+	require.NoError(t, err)
+	assert.Equal(t, policy, gotPolicy)
+
+	ipset := firewalld.IPSetSettings{
+		Type:    "hash:net",
+		Options: map[string]string{"family": "inet"},
+		Entries: []string{"192.0.2.0/24"},
+	}
+	require.NoError(t, c.Config().AddIPSet(ctx, "blocked", ipset))
+	gotIPSet, err := c.Config().GetIPSetSettings(ctx, "blocked")
+	require.NoError(t, err)
+	assert.Empty(t, cmp.Diff(ipset, gotIPSet, cmpopts.EquateEmpty()))
+
+	err = c.SetDefaultZone(ctx, "foo")
+	assert.Equal(t, "INVALID_ZONE", firewalld.ErrorCode(err))
+	err = c.Config().RemoveZone(ctx, "public")
+	assert.Equal(t, "BUILTIN_ZONE", firewalld.ErrorCode(err))
+}
+
+// Settings must be sent as struct, a list of values is encoded as array of variants.
+func TestBus_Signature(t *testing.T) {
+	ctx := context.Background()
+	bus, err := StartBus(New())
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not available")
+	}
+	require.NoError(t, err)
+	defer bus.Close()
+	conn, err := connect(bus.Address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	settings := firewalld.ZoneSettings{Target: "default"}
+	call := firewalld.NewCall(configInterface+".addZone", 0).
+		WithArguments("dmz", settings.ToSlice())
+	for name, object := range map[string]firewalld.Caller{
+		"bus":        firewalld.NewConnection(conn).Object(dbusDest, configPath),
+		"in-process": New().Object(dbusDest, configPath),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := object.Call(ctx, call)
+			var dbusErr dbus.Error
+			require.True(t, errors.As(err, &dbusErr), "got %v", err)
+			assert.Equal(t, InvalidArgsErrorName, dbusErr.Name)
+			assert.Contains(t, dbusErr.Error(), "expected s"+zoneSignature)
+		})
+	}
+}
+
+func TestBus_Signals(t *testing.T) {
+	ctx := context.Background()
+	bus, err := StartBus(New())
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skip("dbus-daemon not available")
+	}
+	require.NoError(t, err)
+	defer bus.Close()
+
+	listener, err := connect(bus.Address)
+	require.NoError(t, err)
+	defer listener.Close()
+	require.NoError(t, listener.AddMatchSignal(dbus.WithMatchSender(dbusDest)))
+	signals := make(chan *dbus.Signal, 10)
+	listener.Signal(signals)
+
+	c, err := bus.Client()
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+		{Method: "addPort", Args: []string{"80", "tcp"}},
+	}))
+	require.NoError(t, c.Reload(ctx))
+
+	for _, expected := range []struct {
+		name string
+		body []interface{}
+	}{
+		{zoneInterface + ".PortAdded", []interface{}{"public", "80", "tcp", int32(0)}},
+		{mainInterface + ".Reloaded", nil},
+	} {
+		select {
+		case s := <-signals:
+			assert.Equal(t, dbus.ObjectPath(mainPath), s.Path)
+			assert.Equal(t, expected.name, s.Name)
+			assert.Equal(t, expected.body, s.Body)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", expected.name)
+		}
+	}
+}
+
+func TestBus_SnapshotRestore(t *testing.T) {
+	fake := New()
+	testSnapshotRestore(t, fake, NewBusClient(t, fake))
+}
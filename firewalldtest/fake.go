@@ -0,0 +1,1180 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package firewalldtest provides an in-memory firewalld for tests.
+//
+// The Fake implements firewalld.Connection and keeps state between calls,
+// so code using firewalld.Client can be tested with real call sequences
+// instead of stubbing every D-Bus call:
+//
+//	fake := firewalldtest.New()
+//	client := firewalld.NewClient(fake)
+//
+// Arguments are checked against the signatures firewalld declares
+// and passed through the D-Bus wire format, like on the bus.
+// For end to end tests of the D-Bus transport, NewBusClient serves
+// the Fake on a private dbus-daemon instead.
+package firewalldtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+const (
+	dbusDest   = "org.fedoraproject.FirewallD1"
+	mainPath   = "/org/fedoraproject/FirewallD1"
+	configPath = "/org/fedoraproject/FirewallD1/config"
+
+	mainInterface       = "org.fedoraproject.FirewallD1"
+	configInterface     = "org.fedoraproject.FirewallD1.config"
+	zoneInterface       = "org.fedoraproject.FirewallD1.zone"
+	ipsetInterface      = "org.fedoraproject.FirewallD1.ipset"
+	policyInterface     = "org.fedoraproject.FirewallD1.policy"
+	directInterface     = "org.fedoraproject.FirewallD1.direct"
+	lockdownInterface   = "org.fedoraproject.FirewallD1.policies"
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+)
+
+// D-Bus error names returned by the Fake.
+const (
+	ExceptionErrorName     = "org.fedoraproject.FirewallD1.Exception"
+	UnknownMethodErrorName = "org.freedesktop.DBus.Error.UnknownMethod"
+	UnknownObjectErrorName = "org.freedesktop.DBus.Error.UnknownObject"
+	InvalidArgsErrorName   = "org.freedesktop.DBus.Error.InvalidArgs"
+	ServiceUnknownName     = "org.freedesktop.DBus.Error.ServiceUnknown"
+)
+
+// Version reported by a new Fake.
+const Version = "1.0.0"
+
+// Fake is an in-memory firewalld daemon implementing firewalld.Connection.
+//
+// Runtime and permanent configuration are kept separately, like in firewalld:
+// methods of the config object only change the permanent configuration,
+// reload replaces the runtime configuration with the permanent one
+// and runtimeToPermanent copies the runtime configuration back.
+// Setting the default zone changes both.
+//
+// Failures are returned as D-Bus errors carrying firewalld error codes,
+// e.g. "INVALID_ZONE: foo", so firewalld.ErrorCode works on them.
+type Fake struct {
+	mu sync.Mutex
+
+	version     string
+	defaultZone string
+	permanent   store
+	runtime     store
+	// Next object path index by kind.
+	nextID map[*kind]int
+	// Configuration that is not made of named objects, see global.go.
+	permanentGlobal global
+	runtimeGlobal   global
+	properties      map[string]interface{}
+	// Runtime lockdown, permanently set by the Lockdown property.
+	lockdown bool
+
+	calls    []firewalld.Call
+	failures map[string]error
+	// Signals emitted by the current call.
+	signals []signal
+}
+
+var _ firewalld.Connection = (*Fake)(nil)
+
+// New returns a Fake with the builtin zone "public" as default zone
+// and the builtin services "ssh" and "dhcpv6-client" enabled in it.
+func New() *Fake {
+	f := &Fake{
+		version:   Version,
+		permanent: newStore(),
+		runtime:   newStore(),
+		nextID:    map[*kind]int{},
+		failures:  map[string]error{},
+		properties: map[string]interface{}{
+			"CleanupOnExit":     "yes",
+			"FirewallBackend":   "nftables",
+			"FlushAllOnReload":  "yes",
+			"IPv6_rpfilter":     "yes",
+			"IndividualCalls":   "no",
+			"Lockdown":          "no",
+			"LogDenied":         "off",
+			"MinimalMark":       int32(100),
+			"AutomaticHelpers":  "no",
+			"RFC3964_IPv4":      "yes",
+			"AllowZoneDrifting": "no",
+		},
+	}
+	f.LoadBuiltin(firewalld.State{
+		DefaultZone: "public",
+		Zones: map[string]firewalld.ZoneSettings{
+			"public": {
+				Name:     "Public",
+				Target:   "default",
+				Services: []string{"ssh", "dhcpv6-client"},
+			},
+		},
+		Services: map[string]firewalld.ServiceSettings{
+			"ssh": {
+				Name:  "SSH",
+				Ports: []firewalld.Port{{Port: "22", Protocol: "tcp"}},
+			},
+			"dhcpv6-client": {
+				Name:         "DHCPv6 Client",
+				Ports:        []firewalld.Port{{Port: "546", Protocol: "udp"}},
+				Destinations: map[string]string{"ipv6": "fe80::/64"},
+			},
+		},
+	})
+	return f
+}
+
+// Client returns a firewalld.Client using the Fake.
+func (f *Fake) Client() *firewalld.Client {
+	return firewalld.NewClient(f)
+}
+
+// Close does nothing, the state is kept.
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Object returns the object at path, calls to unknown objects fail.
+func (f *Fake) Object(dest, path string) firewalld.Caller {
+	return &fakeObject{fake: f, dest: dest, path: path}
+}
+
+// SetVersion changes the reported firewalld version.
+func (f *Fake) SetVersion(version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+}
+
+// Load adds or replaces the objects of state in both the runtime and
+// permanent configuration, as if they were created by the user.
+// A non-empty DefaultZone replaces the default zone.
+func (f *Fake) Load(state firewalld.State) {
+	f.load(state, false)
+}
+
+// LoadBuiltin is like Load, but the objects are shipped with firewalld:
+// they can be reset to the loaded settings but not removed.
+func (f *Fake) LoadBuiltin(state firewalld.State) {
+	f.load(state, true)
+}
+
+func (f *Fake) load(state firewalld.State, builtin bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, s := range state.Zones {
+		f.put(zoneKind, name, s, builtin)
+	}
+	for name, s := range state.Services {
+		f.put(serviceKind, name, s, builtin)
+	}
+	for name, s := range state.IPSets {
+		f.put(ipsetKind, name, s, builtin)
+	}
+	for name, s := range state.Policies {
+		f.put(policyKind, name, s, builtin)
+	}
+	for name, s := range state.Helpers {
+		f.put(helperKind, name, s, builtin)
+	}
+	for name, s := range state.ICMPTypes {
+		f.put(icmptypeKind, name, s, builtin)
+	}
+	if len(state.DefaultZone) > 0 {
+		f.defaultZone = state.DefaultZone
+	}
+}
+
+func (f *Fake) put(k *kind, name string, settings interface{}, builtin bool) {
+	o, ok := f.permanent[k][name]
+	if !ok {
+		o = &object{id: f.newID(k)}
+		f.permanent[k][name] = o
+	}
+	o.builtin = builtin
+	o.defaults = nil
+	if builtin {
+		o.defaults = clone(settings)
+	}
+	o.settings = clone(settings)
+	f.runtime[k][name] = o.clone()
+}
+
+func (f *Fake) newID(k *kind) int {
+	id := f.nextID[k]
+	f.nextID[k]++
+	return id
+}
+
+// Permanent returns a copy of the permanent configuration.
+func (f *Fake) Permanent() firewalld.State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state(f.permanent)
+}
+
+// Runtime returns a copy of the runtime configuration.
+// Helpers are only part of the permanent configuration.
+func (f *Fake) Runtime() firewalld.State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state := f.state(f.runtime)
+	state.Helpers = nil
+	return state
+}
+
+func (f *Fake) state(s store) firewalld.State {
+	state := firewalld.State{
+		DefaultZone: f.defaultZone,
+		Zones:       map[string]firewalld.ZoneSettings{},
+		Services:    map[string]firewalld.ServiceSettings{},
+		IPSets:      map[string]firewalld.IPSetSettings{},
+		Policies:    map[string]firewalld.PolicySettings{},
+		Helpers:     map[string]firewalld.HelperSettings{},
+		ICMPTypes:   map[string]firewalld.ICMPTypeSettings{},
+	}
+	for name, o := range s[zoneKind] {
+		state.Zones[name] = clone(o.settings).(firewalld.ZoneSettings)
+	}
+	for name, o := range s[serviceKind] {
+		state.Services[name] = clone(o.settings).(firewalld.ServiceSettings)
+	}
+	for name, o := range s[ipsetKind] {
+		state.IPSets[name] = clone(o.settings).(firewalld.IPSetSettings)
+	}
+	for name, o := range s[policyKind] {
+		state.Policies[name] = clone(o.settings).(firewalld.PolicySettings)
+	}
+	for name, o := range s[helperKind] {
+		state.Helpers[name] = clone(o.settings).(firewalld.HelperSettings)
+	}
+	for name, o := range s[icmptypeKind] {
+		state.ICMPTypes[name] = clone(o.settings).(firewalld.ICMPTypeSettings)
+	}
+	return state
+}
+
+// FailOn makes all calls of method, e.g. "org.fedoraproject.FirewallD1.reload",
+// fail with err without changing any state. A nil error removes the failure.
+func (f *Fake) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.failures, method)
+		return
+	}
+	f.failures[method] = err
+}
+
+// Calls returns all calls received so far, without their return values.
+func (f *Fake) Calls() []firewalld.Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]firewalld.Call(nil), f.calls...)
+}
+
+type fakeObject struct {
+	fake *Fake
+	dest string
+	path string
+}
+
+func (o *fakeObject) Call(ctx context.Context, c firewalld.Call) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if o.dest != dbusDest {
+		return dbus.Error{
+			Name: ServiceUnknownName,
+			Body: []interface{}{fmt.Sprintf("The name %s is not known", o.dest)},
+		}
+	}
+
+	args, err := marshal(o.path, c.Method, c.Arguments)
+	if err != nil {
+		return err
+	}
+	values, _, err := o.fake.call(o.path, c.Method, args)
+	if err != nil {
+		return err
+	}
+	if len(c.Returns) == 0 {
+		return nil
+	}
+	for i, v := range values {
+		if sv, ok := v.(settingsValue); ok {
+			values[i] = sv.kind.encode(sv.settings)
+		}
+	}
+	return dbus.Store(values, c.Returns...)
+}
+
+// settingsValue is returned in place of encoded settings,
+// which are represented differently in-process and on the bus.
+type settingsValue struct {
+	kind     *kind
+	settings interface{}
+}
+
+// signal is a D-Bus signal emitted by a successful call.
+type signal struct {
+	path string
+	// Name including the interface, e.g. "org.fedoraproject.FirewallD1.Reloaded".
+	name string
+	body []interface{}
+}
+
+func (f *Fake) emit(path, name string, body ...interface{}) {
+	f.signals = append(f.signals, signal{path: path, name: name, body: body})
+}
+
+// call dispatches a method call to the object at path
+// and returns the reply values and the signals to emit.
+func (f *Fake) call(path, method string, args []interface{}) ([]interface{}, []signal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, firewalld.Call{Method: method, Arguments: args})
+	if err, ok := f.failures[method]; ok {
+		return nil, nil, err
+	}
+
+	f.signals = nil
+	values, err := f.dispatch(path, method, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, f.signals, nil
+}
+
+func (f *Fake) dispatch(path, method string, args []interface{}) ([]interface{}, error) {
+	switch path {
+	case mainPath:
+		return f.callMain(method, args)
+	case configPath:
+		return f.callConfig(method, args)
+	}
+	if k, name, ok := f.lookupPath(path); ok {
+		return f.callConfigObject(k, name, method, args)
+	}
+	return nil, dbus.Error{
+		Name: UnknownObjectErrorName,
+		Body: []interface{}{fmt.Sprintf("No such object path %q", path)},
+	}
+}
+
+func (f *Fake) callMain(method string, args []interface{}) ([]interface{}, error) {
+	iface, member := splitMethod(method)
+	switch iface {
+	case propertiesInterface:
+		return getProperty(method, member, args, func(iface, prop string) interface{} {
+			if iface != mainInterface {
+				return nil
+			}
+			switch prop {
+			case "version":
+				return f.version
+			case "interface_version":
+				return "1.0"
+			case "state":
+				return "RUNNING"
+			}
+			return nil
+		})
+
+	case mainInterface:
+		switch member {
+		case "getDefaultZone":
+			return values(f.defaultZone)
+		case "setDefaultZone":
+			a, err := stringArgs(method, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := f.runtime[zoneKind][a[0]]; !ok {
+				return nil, exception("INVALID_ZONE", a[0])
+			}
+			if a[0] == f.defaultZone {
+				return nil, exception("ZONE_ALREADY_SET", a[0])
+			}
+			f.defaultZone = a[0]
+			f.emit(mainPath, mainInterface+".DefaultZoneChanged", a[0])
+			return nil, nil
+		case "reload", "completeReload":
+			f.runtime = f.permanent.clone()
+			f.runtimeGlobal = f.permanentGlobal.clone()
+			f.lockdown = f.properties["Lockdown"] == "yes"
+			f.emit(mainPath, mainInterface+".Reloaded")
+			return nil, nil
+		case "runtimeToPermanent":
+			f.runtimeToPermanent()
+			return nil, nil
+		case "checkPermanentConfig":
+			return nil, f.checkPermanentConfig()
+		case "getZoneSettings":
+			return f.getSettings(f.runtime, zoneKind, method, args)
+		case "listServices":
+			return values(f.runtime.names(serviceKind))
+		case "getServiceSettings":
+			return f.getSettings(f.runtime, serviceKind, method, args)
+		case "listIcmpTypes":
+			return values(f.runtime.names(icmptypeKind))
+		case "getIcmpTypeSettings":
+			return f.getSettings(f.runtime, icmptypeKind, method, args)
+		}
+
+	case zoneInterface:
+		if member == "getZones" {
+			return values(f.runtime.names(zoneKind))
+		}
+		if len(args) > 0 && !strings.HasPrefix(member, "set") {
+			return f.changeRuntimeZone(method, member, args)
+		}
+
+	case ipsetInterface:
+		switch member {
+		case "getIPSets":
+			return values(f.runtime.names(ipsetKind))
+		case "getIPSetSettings":
+			return f.getSettings(f.runtime, ipsetKind, method, args)
+		case "addEntry", "removeEntry", "queryEntry", "getEntries":
+			return f.ipsetEntries(method, member, args)
+		}
+
+	case policyInterface:
+		switch member {
+		case "getPolicies":
+			return values(f.runtime.names(policyKind))
+		case "getPolicySettings":
+			return f.getSettings(f.runtime, policyKind, method, args)
+		case "setPolicySettings":
+			return f.setRuntimePolicy(method, args)
+		}
+
+	case directInterface:
+		return f.callRuntimeDirect(method, member, args)
+
+	case lockdownInterface:
+		return f.callRuntimeLockdown(method, member, args)
+	}
+	return nil, unknownMethod(method)
+}
+
+// setRuntimePolicy updates the runtime settings of a policy with the keys given.
+func (f *Fake) setRuntimePolicy(method string, args []interface{}) ([]interface{}, error) {
+	if len(args) != 2 {
+		return nil, invalidArgs(method)
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, invalidArgs(method)
+	}
+	o, ok := f.runtime[policyKind][name]
+	if !ok {
+		return nil, exception("INVALID_POLICY", name)
+	}
+	settings, err := policyKind.updated(o.settings, args[1])
+	if err != nil {
+		return nil, exception("INVALID_TYPE", err.Error())
+	}
+	o.settings = settings
+	return nil, nil
+}
+
+// getSettings returns the settings of the object named by the only argument.
+func (f *Fake) getSettings(s store, k *kind, method string, args []interface{}) ([]interface{}, error) {
+	a, err := stringArgs(method, args, 1)
+	if err != nil {
+		return nil, err
+	}
+	name := a[0]
+	if k == zoneKind && len(name) == 0 {
+		name = f.defaultZone
+	}
+	o, ok := s[k][name]
+	if !ok {
+		return nil, exception(k.invalidCode, name)
+	}
+	return values(settingsValue{kind: k, settings: clone(o.settings)})
+}
+
+// ipsetEntries handles the entry methods of the runtime ipset interface,
+// e.g. addEntry(ipset, entry).
+func (f *Fake) ipsetEntries(method, member string, args []interface{}) ([]interface{}, error) {
+	n := 2
+	if member == "getEntries" {
+		n = 1
+	}
+	a, err := stringArgs(method, args, n)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := f.runtime[ipsetKind][a[0]]
+	if !ok {
+		return nil, exception("INVALID_IPSET", a[0])
+	}
+	settings := clone(o.settings).(firewalld.IPSetSettings)
+	if member == "getEntries" {
+		return values(settings.Entries)
+	}
+
+	entry := a[1]
+	enabled := containsString(settings.Entries, entry)
+	switch member {
+	case "queryEntry":
+		return values(enabled)
+	case "addEntry":
+		if enabled {
+			return nil, exception("ALREADY_ENABLED", entry)
+		}
+		settings.Entries = append(settings.Entries, entry)
+		f.emit(mainPath, ipsetInterface+".EntryAdded", a[0], entry)
+	case "removeEntry":
+		if !enabled {
+			return nil, exception("NOT_ENABLED", entry)
+		}
+		var entries []string
+		for _, e := range settings.Entries {
+			if e != entry {
+				entries = append(entries, e)
+			}
+		}
+		settings.Entries = entries
+		f.emit(mainPath, ipsetInterface+".EntryRemoved", a[0], entry)
+	}
+	o.settings = settings
+	return nil, nil
+}
+
+// changeRuntimeZone handles add, remove and query methods of the runtime zone interface,
+// e.g. addService(zone, service, timeout). An empty zone selects the default zone.
+func (f *Fake) changeRuntimeZone(method, member string, args []interface{}) ([]interface{}, error) {
+	zone, ok := args[0].(string)
+	if !ok {
+		return nil, invalidArgs(method)
+	}
+	if len(zone) == 0 {
+		zone = f.defaultZone
+	}
+
+	// the optional timeout is the only non-string argument
+	rest := args[1:]
+	if n := len(rest); n > 0 && isInteger(rest[n-1]) {
+		rest = rest[:n-1]
+	}
+	a, err := stringArgs(method, rest, len(rest))
+	if err != nil {
+		return nil, err
+	}
+
+	o, ok := f.runtime[zoneKind][zone]
+	if !ok {
+		return nil, exception("INVALID_ZONE", zone)
+	}
+	query, err := f.changeZone(f.runtime, zone, o, member, a)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(member, "query"):
+		return values(query)
+	case strings.HasPrefix(member, "add"):
+		// e.g. ServiceAdded(zone, service, timeout)
+		f.emit(mainPath, zoneInterface+"."+member[len("add"):]+"Added",
+			append([]interface{}{zone}, args[1:]...)...)
+	case strings.HasPrefix(member, "remove"):
+		f.emit(mainPath, zoneInterface+"."+member[len("remove"):]+"Removed",
+			append([]interface{}{zone}, args[1:]...)...)
+	}
+	return values(zone)
+}
+
+// changeZone applies a granular add, remove, query or set method to a zone.
+// Queries return whether the subject is enabled and leave the zone unchanged.
+func (f *Fake) changeZone(s store, zone string, o *object, member string, args []string) (bool, error) {
+	// ApplyChange may reuse the backing arrays of the stored lists
+	settings := clone(o.settings).(firewalld.ZoneSettings)
+
+	if strings.HasPrefix(member, "query") {
+		member = "remove" + member[len("query"):]
+		err := settings.ApplyChange(firewalld.ZoneChange{Method: member, Args: args})
+		switch {
+		case firewalld.ErrorCode(err) == "NOT_ENABLED":
+			return false, nil
+		case err != nil:
+			return false, toException(err)
+		}
+		return true, nil
+	}
+
+	// interfaces and sources can only be bound to a single zone
+	if (member == "addInterface" || member == "addSource") && len(args) == 1 {
+		for _, name := range s.names(zoneKind) {
+			other := s[zoneKind][name].settings.(firewalld.ZoneSettings)
+			if name != zone && (containsString(other.Interfaces, args[0]) ||
+				containsString(other.SourceAddresses, args[0])) {
+				return false, exception("ZONE_CONFLICT", args[0])
+			}
+		}
+	}
+
+	if err := settings.ApplyChange(firewalld.ZoneChange{Method: member, Args: args}); err != nil {
+		return false, toException(err)
+	}
+	o.settings = settings
+	return false, nil
+}
+
+func (f *Fake) runtimeToPermanent() {
+	for _, k := range kinds {
+		for name, o := range f.runtime[k] {
+			p, ok := f.permanent[k][name]
+			if !ok {
+				p = &object{id: f.newID(k)}
+				f.permanent[k][name] = p
+			}
+			p.settings = clone(o.settings)
+		}
+	}
+	f.permanentGlobal = f.runtimeGlobal.clone()
+}
+
+// checkPermanentConfig reports invalid zones, one problem per line.
+func (f *Fake) checkPermanentConfig() error {
+	var problems []string
+	for _, name := range f.permanent.names(zoneKind) {
+		z := f.permanent[zoneKind][name].settings.(firewalld.ZoneSettings)
+		if err := z.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("INVALID_ZONE: %s: %v", name, err))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return dbus.Error{
+		Name: ExceptionErrorName,
+		Body: []interface{}{strings.Join(problems, "\n")},
+	}
+}
+
+func (f *Fake) callConfig(method string, args []interface{}) ([]interface{}, error) {
+	iface, member := splitMethod(method)
+	switch iface {
+	case propertiesInterface:
+		return f.callConfigProperties(method, member, args)
+	case configInterface + ".direct", configInterface + ".policies":
+		return f.callConfigGlobal(method, iface, member, args)
+	case configInterface:
+	default:
+		return nil, unknownMethod(method)
+	}
+
+	for _, k := range kinds {
+		switch member {
+		case "get" + k.method + "Names":
+			return values(f.permanent.names(k))
+
+		case k.list:
+			var paths []dbus.ObjectPath
+			for _, name := range f.permanent.names(k) {
+				paths = append(paths, k.path(f.permanent[k][name].id))
+			}
+			return values(paths)
+
+		case "get" + k.method + "ByName":
+			a, err := stringArgs(method, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			o, ok := f.permanent[k][a[0]]
+			if !ok {
+				return nil, exception(k.invalidCode, a[0])
+			}
+			return values(k.path(o.id))
+
+		case "add" + k.method:
+			if len(args) != 2 {
+				return nil, invalidArgs(method)
+			}
+			name, ok := args[0].(string)
+			if !ok {
+				return nil, invalidArgs(method)
+			}
+			if len(name) == 0 {
+				return nil, exception("INVALID_NAME", name)
+			}
+			if _, ok := f.permanent[k][name]; ok {
+				return nil, exception("NAME_CONFLICT", name)
+			}
+			settings, err := k.decode(args[1])
+			if err != nil {
+				return nil, exception("INVALID_TYPE", err.Error())
+			}
+			o := &object{id: f.newID(k), settings: settings}
+			f.permanent[k][name] = o
+			f.emit(configPath, configInterface+"."+k.method+"Added", name)
+			return values(k.path(o.id))
+		}
+	}
+	return nil, unknownMethod(method)
+}
+
+// callConfigObject handles calls to a single object of the permanent configuration,
+// e.g. /org/fedoraproject/FirewallD1/config/zone/0.
+func (f *Fake) callConfigObject(k *kind, name, method string, args []interface{}) ([]interface{}, error) {
+	o := f.permanent[k][name]
+	objectInterface := configInterface + "." + k.name
+	path := string(k.path(o.id))
+
+	iface, member := splitMethod(method)
+	switch iface {
+	case propertiesInterface:
+		return getProperty(method, member, args, func(iface, prop string) interface{} {
+			if iface != objectInterface {
+				return nil
+			}
+			switch prop {
+			case "name":
+				return name
+			case "builtin", "default":
+				return o.builtin
+			}
+			return nil
+		})
+
+	case objectInterface:
+		switch member {
+		case "getSettings":
+			return values(settingsValue{kind: k, settings: clone(o.settings)})
+		case "update":
+			if len(args) != 1 {
+				return nil, invalidArgs(method)
+			}
+			settings, err := k.updated(o.settings, args[0])
+			if err != nil {
+				return nil, exception("INVALID_TYPE", err.Error())
+			}
+			o.settings = settings
+			f.emit(path, objectInterface+".Updated", name)
+			return nil, nil
+		case "loadDefaults":
+			if !o.builtin {
+				return nil, exception("NO_DEFAULTS", name)
+			}
+			o.settings = clone(o.defaults)
+			f.emit(path, objectInterface+".Updated", name)
+			return nil, nil
+		case "remove":
+			if o.builtin {
+				return nil, exception(k.builtinCode, name)
+			}
+			delete(f.permanent[k], name)
+			f.emit(path, objectInterface+".Removed", name)
+			return nil, nil
+		}
+
+		if k == zoneKind {
+			a, err := stringArgs(method, args, len(args))
+			if err != nil {
+				return nil, err
+			}
+			query, err := f.changeZone(f.permanent, name, o, member, a)
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(member, "query") {
+				return values(query)
+			}
+			f.emit(path, objectInterface+".Updated", name)
+			return nil, nil
+		}
+	}
+	return nil, unknownMethod(method)
+}
+
+// lookupPath returns the permanent object at path, e.g. .../config/zone/0.
+func (f *Fake) lookupPath(path string) (*kind, string, bool) {
+	rel := strings.TrimPrefix(path, configPath+"/")
+	i := strings.Index(rel, "/")
+	if rel == path || i < 0 {
+		return nil, "", false
+	}
+	id, err := strconv.Atoi(rel[i+1:])
+	if err != nil {
+		return nil, "", false
+	}
+	for _, k := range kinds {
+		if k.name != rel[:i] {
+			continue
+		}
+		for name, o := range f.permanent[k] {
+			if o.id == id {
+				return k, name, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+// getProperty implements org.freedesktop.DBus.Properties.Get,
+// lookup returns nil for unknown properties.
+func getProperty(
+	method, member string, args []interface{},
+	lookup func(iface, prop string) interface{},
+) ([]interface{}, error) {
+	if member != "Get" {
+		return nil, unknownMethod(method)
+	}
+	a, err := stringArgs(method, args, 2)
+	if err != nil {
+		return nil, err
+	}
+	v := lookup(a[0], a[1])
+	if v == nil {
+		return nil, dbus.Error{
+			Name: InvalidArgsErrorName,
+			Body: []interface{}{fmt.Sprintf("Property %q does not exist", a[1])},
+		}
+	}
+	return values(dbus.MakeVariant(v))
+}
+
+// object is a zone, service or other configuration object.
+type object struct {
+	// Index in the object path, only used in the permanent configuration.
+	id int
+	// Shipped with firewalld, defaults holds the shipped settings.
+	builtin  bool
+	defaults interface{}
+	// Typed settings, e.g. firewalld.ZoneSettings.
+	settings interface{}
+}
+
+func (o *object) clone() *object {
+	c := *o
+	c.settings = clone(o.settings)
+	return &c
+}
+
+// store holds the objects of one configuration by kind and name.
+type store map[*kind]map[string]*object
+
+func newStore() store {
+	s := store{}
+	for _, k := range kinds {
+		s[k] = map[string]*object{}
+	}
+	return s
+}
+
+func (s store) clone() store {
+	c := newStore()
+	for k, objects := range s {
+		for name, o := range objects {
+			c[k][name] = o.clone()
+		}
+	}
+	return c
+}
+
+func (s store) names(k *kind) []string {
+	names := []string{}
+	for name := range s[k] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// kind describes the D-Bus representation of a configuration object type.
+type kind struct {
+	// Name in interfaces and object paths, e.g. "zone".
+	name string
+	// Name in config method names, e.g. "IPSet" in getIPSetByName.
+	method string
+	// Config method listing object paths.
+	list        string
+	invalidCode string
+	builtinCode string
+	// D-Bus signature of the settings.
+	signature string
+
+	decode func(v interface{}) (interface{}, error)
+	encode func(settings interface{}) interface{}
+	// merge applies a partial update to the current settings.
+	// If nil, an update replaces all settings.
+	merge func(current, v interface{}) (interface{}, error)
+}
+
+// updated returns the settings of an object after an update with v.
+func (k *kind) updated(current, v interface{}) (interface{}, error) {
+	if k.merge != nil {
+		return k.merge(current, v)
+	}
+	return k.decode(v)
+}
+
+func (k *kind) path(id int) dbus.ObjectPath {
+	return dbus.ObjectPath(fmt.Sprintf("%s/%s/%d", configPath, k.name, id))
+}
+
+var (
+	zoneKind = &kind{
+		name: "zone", method: "Zone", list: "listZones",
+		invalidCode: "INVALID_ZONE", builtinCode: "BUILTIN_ZONE",
+		signature: zoneSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.ZoneSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.ZoneSettings)
+			return s.ToSlice()
+		},
+	}
+	serviceKind = &kind{
+		name: "service", method: "Service", list: "listServices",
+		invalidCode: "INVALID_SERVICE", builtinCode: "BUILTIN_SERVICE",
+		signature: serviceSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.ServiceSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.ServiceSettings)
+			return s.ToSlice()
+		},
+	}
+	ipsetKind = &kind{
+		name: "ipset", method: "IPSet", list: "listIPSets",
+		invalidCode: "INVALID_IPSET", builtinCode: "BUILTIN_IPSET",
+		signature: ipsetSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.IPSetSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.IPSetSettings)
+			return s.ToSlice()
+		},
+	}
+	policyKind = &kind{
+		name: "policy", method: "Policy", list: "listPolicies",
+		invalidCode: "INVALID_POLICY", builtinCode: "BUILTIN_POLICY",
+		signature: policySignature,
+		decode: func(v interface{}) (interface{}, error) {
+			m, ok := v.(map[string]dbus.Variant)
+			if !ok {
+				return nil, fmt.Errorf("expected settings dictionary, got %T", v)
+			}
+			return firewalld.PolicySettingsFromMap(m)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.PolicySettings)
+			m := s.ToMap()
+			// structs are received as lists over D-Bus
+			for _, key := range []string{"ports", "source_ports", "forward_ports"} {
+				m[key] = dbus.MakeVariant(structLists(m[key].Value()))
+			}
+			return m
+		},
+		// firewalld only changes the keys present in the dictionary.
+		merge: func(current, v interface{}) (interface{}, error) {
+			m, ok := v.(map[string]dbus.Variant)
+			if !ok {
+				return nil, fmt.Errorf("expected settings dictionary, got %T", v)
+			}
+			s := current.(firewalld.PolicySettings)
+			merged := s.ToMap()
+			for key, value := range m {
+				merged[key] = value
+			}
+			return firewalld.PolicySettingsFromMap(merged)
+		},
+	}
+	helperKind = &kind{
+		name: "helper", method: "Helper", list: "listHelpers",
+		invalidCode: "INVALID_HELPER", builtinCode: "BUILTIN_HELPER",
+		signature: helperSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.HelperSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.HelperSettings)
+			return s.ToSlice()
+		},
+	}
+
+	icmptypeKind = &kind{
+		name: "icmptype", method: "IcmpType", list: "listIcmpTypes",
+		invalidCode: "INVALID_ICMPTYPE", builtinCode: "BUILTIN_ICMPTYPE",
+		signature: icmptypeSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.ICMPTypeSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.ICMPTypeSettings)
+			return s.ToSlice()
+		},
+	}
+
+	kinds = []*kind{zoneKind, serviceKind, ipsetKind, policyKind, helperKind, icmptypeKind}
+)
+
+// tuple accepts settings sent as D-Bus struct, which godbus decodes to []interface{}.
+func tuple(v interface{}) ([]interface{}, error) {
+	s, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected settings tuple, got %T", v)
+	}
+	return s, nil
+}
+
+// clone deep copies typed settings, so callers can't modify the stored state.
+func clone(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	c := reflect.New(reflect.TypeOf(v))
+	if err := json.Unmarshal(b, c.Interface()); err != nil {
+		panic(err)
+	}
+	return c.Elem().Interface()
+}
+
+func values(v ...interface{}) ([]interface{}, error) {
+	return v, nil
+}
+
+// stringArgs checks for n string arguments.
+func stringArgs(method string, args []interface{}, n int) ([]string, error) {
+	if len(args) != n {
+		return nil, invalidArgs(method)
+	}
+	s := make([]string, n)
+	for i, a := range args {
+		v, ok := a.(string)
+		if !ok {
+			return nil, invalidArgs(method)
+		}
+		s[i] = v
+	}
+	return s, nil
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, uint32:
+		return true
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func splitMethod(method string) (iface, member string) {
+	i := strings.LastIndex(method, ".")
+	if i < 0 {
+		return "", method
+	}
+	return method[:i], method[i+1:]
+}
+
+// exception returns a firewalld error as sent by the daemon.
+func exception(code, msg string) error {
+	return dbus.Error{
+		Name: ExceptionErrorName,
+		Body: []interface{}{firewalld.Error{Code: code, Message: msg}.Error()},
+	}
+}
+
+func toException(err error) error {
+	var e firewalld.Error
+	if errors.As(err, &e) {
+		return exception(e.Code, e.Message)
+	}
+	return err
+}
+
+func unknownMethod(method string) error {
+	return dbus.Error{
+		Name: UnknownMethodErrorName,
+		Body: []interface{}{fmt.Sprintf("No such method %q", method)},
+	}
+}
+
+func invalidArgs(method string) error {
+	return dbus.Error{
+		Name: InvalidArgsErrorName,
+		Body: []interface{}{fmt.Sprintf("Invalid arguments for %q", method)},
+	}
+}
+
+// structLists converts a slice of structs to lists of their fields.
+func structLists(v interface{}) [][]interface{} {
+	rv := reflect.ValueOf(v)
+	out := [][]interface{}{}
+	for i := 0; rv.IsValid() && i < rv.Len(); i++ {
+		var fields []interface{}
+		for j := 0; j < rv.Index(i).NumField(); j++ {
+			fields = append(fields, rv.Index(i).Field(j).Interface())
+		}
+		out = append(out, fields)
+	}
+	return out
+}
@@ -0,0 +1,723 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+)
+
+func TestFake_RuntimeAndPermanent(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	c := fake.Client()
+
+	version, err := c.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Version, version)
+
+	// permanent changes need a reload
+	internal := firewalld.ZoneSettings{Target: "default", Services: []string{"ssh"}}
+	require.NoError(t, c.Config().AddZone(ctx, "internal", internal))
+	zones, err := c.GetZones(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"public"}, zones)
+
+	require.NoError(t, c.Reload(ctx))
+	zones, err = c.GetZones(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"internal", "public"}, zones)
+
+	// runtime changes are lost on reload, unless made permanent
+	require.NoError(t, c.ApplyZoneChanges(ctx, "internal", []firewalld.ZoneChange{
+		{Method: "addService", Args: []string{"http"}},
+		{Method: "addPort", Args: []string{"8080", "tcp"}},
+	}))
+	settings, err := c.GetZoneSettings(ctx, "internal")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ssh", "http"}, settings.Services)
+	assert.Equal(t, []string{"ssh"}, fake.Permanent().Zones["internal"].Services)
+
+	require.NoError(t, c.RuntimeToPermanent(ctx))
+	settings, err = c.Config().GetZoneSettings(ctx, "internal")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ssh", "http"}, settings.Services)
+	assert.Equal(t, []firewalld.Port{{Port: "8080", Protocol: "tcp"}}, settings.Ports)
+
+	// the default zone is changed in both
+	require.NoError(t, c.SetDefaultZone(ctx, "internal"))
+	zone, err := c.GetDefaultZone(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "internal", zone)
+	assert.Equal(t, "internal", fake.Permanent().DefaultZone)
+}
+
+func TestFake_Errors(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	c := fake.Client()
+
+	tests := []struct {
+		name string
+		call func() error
+		code string
+	}{
+		{"unknown zone", func() error {
+			_, err := c.GetZoneSettings(ctx, "foo")
+			return err
+		}, "INVALID_ZONE"},
+		{"unknown default zone", func() error {
+			return c.SetDefaultZone(ctx, "foo")
+		}, "INVALID_ZONE"},
+		{"same default zone", func() error {
+			return c.SetDefaultZone(ctx, "public")
+		}, "ZONE_ALREADY_SET"},
+		{"existing zone", func() error {
+			return c.Config().AddZone(ctx, "public", firewalld.ZoneSettings{Target: "default"})
+		}, "NAME_CONFLICT"},
+		{"builtin zone", func() error {
+			return c.Config().RemoveZone(ctx, "public")
+		}, "BUILTIN_ZONE"},
+		{"enabled service", func() error {
+			return c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+				{Method: "addService", Args: []string{"ssh"}},
+			})
+		}, "ALREADY_ENABLED"},
+		{"disabled port", func() error {
+			return c.Config().ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+				{Method: "removePort", Args: []string{"80", "tcp"}},
+			})
+		}, "NOT_ENABLED"},
+		{"unknown service", func() error {
+			_, err := c.Config().GetServiceSettings(ctx, "foo")
+			return err
+		}, "INVALID_SERVICE"},
+		{"unknown ipset", func() error {
+			_, err := c.GetIPSetSettings(ctx, "foo")
+			return err
+		}, "INVALID_IPSET"},
+		{"unknown policy", func() error {
+			_, err := c.Config().GetPolicySettings(ctx, "foo")
+			return err
+		}, "INVALID_POLICY"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			require.Error(t, err)
+			assert.Equal(t, test.code, firewalld.ErrorCode(err))
+		})
+	}
+}
+
+func TestFake_ZoneConflict(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"internal": {Target: "default", Interfaces: []string{"eth1"}},
+		},
+	})
+	c := fake.Client()
+
+	err := c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+		{Method: "addInterface", Args: []string{"eth1"}},
+	})
+	assert.Equal(t, "ZONE_CONFLICT", firewalld.ErrorCode(err))
+	assert.Empty(t, fake.Runtime().Zones["public"].Interfaces)
+}
+
+// confirmSetup returns a fake with a zone and a policy,
+// and a change to both for CommitConfirmed.
+func confirmSetup() (*Fake, func(ctx context.Context, c *firewalld.Client) error) {
+	fake := New()
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"public": {Target: "default", Services: []string{"ssh"}},
+		},
+		Policies: map[string]firewalld.PolicySettings{
+			"public-out": {
+				Target:       "CONTINUE",
+				Priority:     -1,
+				IngressZones: []string{"public"},
+				EgressZones:  []string{"ANY"},
+				Services:     []string{"ssh"},
+			},
+		},
+	})
+	apply := func(ctx context.Context, c *firewalld.Client) error {
+		if err := c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+			{Method: "removeService", Args: []string{"ssh"}},
+		}); err != nil {
+			return err
+		}
+		return c.Config().UpdatePolicy(ctx, "public-out", firewalld.PolicySettings{
+			Target:       "REJECT",
+			Priority:     -1,
+			IngressZones: []string{"public"},
+			EgressZones:  []string{"ANY"},
+		})
+	}
+	return fake, apply
+}
+
+// reloaded returns whether the fake has received a reload.
+func reloaded(fake *Fake) bool {
+	for _, call := range fake.Calls() {
+		if call.Method == mainInterface+".reload" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFake_CommitConfirmed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-firewalld")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	ctx := context.Background()
+
+	t.Run("confirmed", func(t *testing.T) {
+		fake, apply := confirmSetup()
+
+		pending, err := fake.Client().CommitConfirmed(ctx, time.Minute, snapshotPath, apply)
+		require.NoError(t, err)
+
+		snapshot, err := firewalld.ReadConfirmSnapshot(snapshotPath)
+		require.NoError(t, err)
+		assert.Equal(t, "public", snapshot.Snapshot.DefaultZone)
+		assert.Equal(t, []string{"ssh"}, snapshot.Snapshot.Permanent.Zones["public"].Services)
+		assert.Equal(t, []string{"ssh"}, snapshot.Snapshot.Permanent.Policies["public-out"].Services)
+
+		require.NoError(t, pending.Confirm())
+		<-pending.Done()
+		assert.NoFileExists(t, snapshotPath)
+		assert.False(t, reloaded(fake))
+		assert.Equal(t, "REJECT", fake.Permanent().Policies["public-out"].Target)
+	})
+
+	t.Run("reverted", func(t *testing.T) {
+		fake, apply := confirmSetup()
+
+		pending, err := fake.Client().CommitConfirmed(ctx, 10*time.Millisecond, snapshotPath, apply)
+		require.NoError(t, err)
+
+		<-pending.Done()
+		require.NoError(t, pending.Err())
+		assert.Equal(t, firewalld.ErrCommitReverted, pending.Confirm())
+		assert.NoFileExists(t, snapshotPath)
+		// changes beyond zones are reverted as well
+		assert.Equal(t, []string{"ssh"}, fake.Runtime().Zones["public"].Services)
+		policy := fake.Permanent().Policies["public-out"]
+		assert.Equal(t, "CONTINUE", policy.Target)
+		assert.Equal(t, []string{"ssh"}, policy.Services)
+		assert.Equal(t, policy, fake.Runtime().Policies["public-out"])
+	})
+
+	t.Run("failed apply", func(t *testing.T) {
+		fake, apply := confirmSetup()
+
+		_, err := fake.Client().CommitConfirmed(ctx, time.Minute, snapshotPath,
+			func(ctx context.Context, c *firewalld.Client) error {
+				if err := apply(ctx, c); err != nil {
+					return err
+				}
+				return assert.AnError
+			})
+		assert.Equal(t, assert.AnError, err)
+		assert.NoFileExists(t, snapshotPath)
+		assert.Equal(t, []string{"ssh"}, fake.Permanent().Policies["public-out"].Services)
+	})
+
+	t.Run("claimed by helper", func(t *testing.T) {
+		fake, apply := confirmSetup()
+
+		pending, err := fake.Client().CommitConfirmed(ctx, 10*time.Millisecond, snapshotPath, apply)
+		require.NoError(t, err)
+
+		// RevertExpiredCommit of a helper has started reverting
+		claimed := snapshotPath + ".reverting"
+		require.NoError(t, os.Rename(snapshotPath, claimed))
+		defer os.Remove(claimed)
+
+		assert.Equal(t, firewalld.ErrCommitReverted, pending.Confirm())
+		<-pending.Done()
+		// the timer does not revert the snapshot a second time
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, pending.Err())
+		assert.False(t, reloaded(fake))
+	})
+}
+
+func TestFake_RevertExpiredCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-firewalld")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, "snapshot.json")
+	ctx := context.Background()
+	fake, apply := confirmSetup()
+	c := fake.Client()
+
+	// nothing pending
+	reverted, err := c.RevertExpiredCommit(ctx, snapshotPath)
+	require.NoError(t, err)
+	assert.False(t, reverted)
+
+	// deadline not reached, the committing process is gone without a revert
+	_, err = c.CommitConfirmed(ctx, time.Hour, snapshotPath, apply)
+	require.NoError(t, err)
+	reverted, err = c.RevertExpiredCommit(ctx, snapshotPath)
+	require.NoError(t, err)
+	assert.False(t, reverted)
+	assert.False(t, reloaded(fake))
+
+	snapshot, err := firewalld.ReadConfirmSnapshot(snapshotPath)
+	require.NoError(t, err)
+	snapshot.Deadline = time.Now().Add(-time.Second)
+	writeSnapshot := func(path string) {
+		b, err := json.Marshal(snapshot)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path, b, 0600))
+	}
+
+	// claimed by the timer of the committing process
+	require.NoError(t, os.Rename(snapshotPath, snapshotPath+".reverting"))
+	writeSnapshot(snapshotPath + ".reverting")
+	reverted, err = c.RevertExpiredCommit(ctx, snapshotPath)
+	require.NoError(t, err)
+	assert.False(t, reverted)
+	assert.False(t, reloaded(fake))
+	require.NoError(t, os.Remove(snapshotPath+".reverting"))
+
+	// deadline passed
+	writeSnapshot(snapshotPath)
+	reverted, err = c.RevertExpiredCommit(ctx, snapshotPath)
+	require.NoError(t, err)
+	assert.True(t, reverted)
+	assert.NoFileExists(t, snapshotPath)
+	assert.NoFileExists(t, snapshotPath+".reverting")
+	assert.True(t, reloaded(fake))
+	assert.Equal(t, []string{"ssh"}, fake.Permanent().Policies["public-out"].Services)
+	assert.Equal(t, []string{"ssh"}, fake.Runtime().Zones["public"].Services)
+}
+
+func TestFake_CommitConfirmed_MovedInterface(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-firewalld")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"alpha": {Target: "default"},
+			"beta":  {Target: "default", Interfaces: []string{"eth9"}},
+		},
+	})
+	c := fake.Client()
+
+	// move eth9 at runtime only, a reload binds it to beta again
+	require.NoError(t, c.ApplyZoneChanges(ctx, "beta", []firewalld.ZoneChange{
+		{Method: "removeInterface", Args: []string{"eth9"}},
+	}))
+	require.NoError(t, c.ApplyZoneChanges(ctx, "alpha", []firewalld.ZoneChange{
+		{Method: "addInterface", Args: []string{"eth9"}},
+	}))
+
+	pending, err := c.CommitConfirmed(ctx, 10*time.Millisecond, filepath.Join(dir, "snapshot.json"),
+		func(ctx context.Context, c *firewalld.Client) error { return nil })
+	require.NoError(t, err)
+	<-pending.Done()
+	require.NoError(t, pending.Err())
+
+	assert.Equal(t, []string{"eth9"}, fake.Runtime().Zones["alpha"].Interfaces)
+	assert.Empty(t, fake.Runtime().Zones["beta"].Interfaces)
+	assert.Equal(t, []string{"eth9"}, fake.Permanent().Zones["beta"].Interfaces)
+}
+
+func TestFake_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"stale": {Target: "DROP"},
+		},
+	})
+	c := fake.Client()
+
+	desired := firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"public": {Target: "default", Services: []string{"ssh"}},
+			"dmz": {
+				Target:          "default",
+				Services:        []string{"http", "https"},
+				SourceAddresses: []string{"ipset:blocked"},
+			},
+		},
+		Services: map[string]firewalld.ServiceSettings{
+			"https": {Ports: []firewalld.Port{{Port: "443", Protocol: "tcp"}}},
+		},
+		IPSets: map[string]firewalld.IPSetSettings{
+			"blocked": {Type: "hash:net", Entries: []string{"192.0.2.0/24"}},
+		},
+		Policies: map[string]firewalld.PolicySettings{
+			"dmz-out": {
+				Target:       "ACCEPT",
+				Priority:     -1,
+				IngressZones: []string{"dmz"},
+				EgressZones:  []string{"public"},
+			},
+		},
+	}
+
+	_, err := c.Reconcile(ctx, desired)
+	require.NoError(t, err)
+
+	permanent := fake.Permanent()
+	assert.NotContains(t, permanent.Zones, "stale")
+	assert.Equal(t, []string{"ssh"}, permanent.Zones["public"].Services)
+	assert.Equal(t, desired.Policies["dmz-out"], permanent.Policies["dmz-out"])
+	// builtin services are kept
+	assert.Contains(t, permanent.Services, "dhcpv6-client")
+
+	plan, err := c.Plan(ctx, desired)
+	require.NoError(t, err)
+	assert.True(t, plan.Empty(), plan.String())
+
+	// new zones are only known to the runtime configuration after a reload
+	desired.DefaultZone = "dmz"
+	_, err = c.Reconcile(ctx, desired)
+	assert.Equal(t, "INVALID_ZONE", firewalld.ErrorCode(err))
+	require.NoError(t, c.Reload(ctx))
+	_, err = c.Reconcile(ctx, desired)
+	require.NoError(t, err)
+	assert.Equal(t, "dmz", fake.Runtime().DefaultZone)
+}
+
+func TestFake_Reconcile_ClearPolicy(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Policies: map[string]firewalld.PolicySettings{
+			"dmz-out": {
+				Target:       "ACCEPT",
+				Priority:     -1,
+				IngressZones: []string{"public"},
+				EgressZones:  []string{"public"},
+				Services:     []string{"ssh"},
+			},
+		},
+	})
+	c := fake.Client()
+
+	desired := firewalld.State{
+		Zones: fake.Permanent().Zones,
+		Policies: map[string]firewalld.PolicySettings{
+			"dmz-out": {
+				Target:       "ACCEPT",
+				Priority:     -1,
+				IngressZones: []string{"public"},
+				EgressZones:  []string{"public"},
+			},
+		},
+	}
+	_, err := c.Reconcile(ctx, desired)
+	require.NoError(t, err)
+	assert.Empty(t, fake.Permanent().Policies["dmz-out"].Services)
+
+	plan, err := c.Plan(ctx, desired)
+	require.NoError(t, err)
+	assert.True(t, plan.Empty(), plan.String())
+}
+
+func TestFake_Transaction(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	c := fake.Client()
+	before := fake.Permanent()
+
+	fake.FailOn("org.fedoraproject.FirewallD1.config.addService", exception("INVALID_SERVICE", "http"))
+	err := c.Transaction(ctx, func(ctx context.Context, tx *firewalld.Tx) error {
+		if err := tx.Config().AddZone(ctx, "internal", firewalld.ZoneSettings{Target: "default"}); err != nil {
+			return err
+		}
+		return tx.Config().AddService(ctx, "http", firewalld.ServiceSettings{})
+	})
+	assert.Equal(t, "INVALID_SERVICE", firewalld.ErrorCode(err))
+	assert.Equal(t, before, fake.Permanent())
+}
+
+func TestFake_Transaction_UpdateRemove(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"internal": {Target: "default", Services: []string{"ssh"}},
+		},
+		Services: map[string]firewalld.ServiceSettings{
+			"http": {Ports: []firewalld.Port{{Port: "80", Protocol: "tcp"}}},
+		},
+	})
+	c := fake.Client()
+	before := fake.Permanent()
+
+	tx := c.Begin()
+	require.NoError(t, tx.Config().UpdateZone(ctx, "internal", firewalld.ZoneSettings{Target: "DROP"}))
+	require.NoError(t, tx.Config().RemoveService(ctx, "http"))
+	require.NoError(t, tx.Rollback(ctx))
+	assert.Equal(t, before, fake.Permanent())
+}
+
+func TestFake_Transaction_PolicyRollback(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Load(firewalld.State{
+		Policies: map[string]firewalld.PolicySettings{
+			"public-out": {
+				Target:       "CONTINUE",
+				Priority:     -1,
+				IngressZones: []string{"public"},
+				EgressZones:  []string{"public"},
+			},
+		},
+	})
+	c := fake.Client()
+	before := fake.Permanent()
+
+	tx := c.Begin()
+	policy := before.Policies["public-out"]
+	policy.Services = []string{"ssh"}
+	policy.RichRules = []string{`rule service name="http" accept`}
+	require.NoError(t, tx.Config().UpdatePolicy(ctx, "public-out", policy))
+	require.NoError(t, tx.Rollback(ctx))
+	assert.Equal(t, before, fake.Permanent())
+}
+
+func TestFake_ConfigObjects(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	obj := fake.Object(dbusDest, configPath)
+
+	var path string
+	require.NoError(t, obj.Call(ctx,
+		firewalld.NewCall(configInterface+".getZoneByName", 0).
+			WithArguments("public").
+			WithReturns(&path)))
+
+	zone := fake.Object(dbusDest, path)
+	var builtin bool
+	require.NoError(t, zone.Call(ctx,
+		firewalld.NewCall(propertiesInterface+".Get", 0).
+			WithArguments(configInterface+".zone", "builtin").
+			WithReturns(&builtin)))
+	assert.True(t, builtin)
+
+	require.NoError(t, zone.Call(ctx,
+		firewalld.NewCall(configInterface+".zone.setTarget", 0).
+			WithArguments("DROP")))
+	var enabled bool
+	require.NoError(t, zone.Call(ctx,
+		firewalld.NewCall(configInterface+".zone.queryService", 0).
+			WithArguments("ssh").
+			WithReturns(&enabled)))
+	assert.True(t, enabled)
+	assert.Equal(t, "DROP", fake.Permanent().Zones["public"].Target)
+
+	require.NoError(t, zone.Call(ctx,
+		firewalld.NewCall(configInterface+".zone.loadDefaults", 0)))
+	assert.Equal(t, "default", fake.Permanent().Zones["public"].Target)
+
+	err := fake.Object(dbusDest, configPath+"/zone/42").Call(ctx,
+		firewalld.NewCall(configInterface+".zone.getSettings", 0))
+	assert.EqualError(t, err, `No such object path "/org/fedoraproject/FirewallD1/config/zone/42"`)
+}
+
+func TestFake_SnapshotRestore(t *testing.T) {
+	fake := New()
+	testSnapshotRestore(t, fake, fake.Client())
+}
+
+// testSnapshotRestore changes every part of the configuration after a snapshot
+// and checks that Restore reverts all changes.
+func testSnapshotRestore(t *testing.T, fake *Fake, c *firewalld.Client) {
+	ctx := context.Background()
+	cc := c.Config()
+	fake.LoadBuiltin(firewalld.State{
+		ICMPTypes: map[string]firewalld.ICMPTypeSettings{
+			"echo-request": {Name: "Echo Request (ping)"},
+		},
+	})
+	fake.Load(firewalld.State{
+		Zones: map[string]firewalld.ZoneSettings{
+			"external": {Target: "default"},
+			"internal": {Target: "default", Interfaces: []string{"eth1"}},
+		},
+		Services: map[string]firewalld.ServiceSettings{
+			"custom": {Ports: []firewalld.Port{{Port: "8080", Protocol: "tcp"}}},
+		},
+		IPSets: map[string]firewalld.IPSetSettings{
+			"blocklist": {Type: "hash:net", Entries: []string{"192.0.2.0/24"}},
+		},
+		Policies: map[string]firewalld.PolicySettings{
+			"internal-out": {
+				Target:       "CONTINUE",
+				Priority:     -1,
+				IngressZones: []string{"internal"},
+				EgressZones:  []string{"external"},
+				Services:     []string{"ssh"},
+			},
+		},
+	})
+	require.NoError(t, cc.UpdateDirectSettings(ctx, firewalld.DirectSettings{
+		Chains: []firewalld.DirectChain{{IPV: "ipv4", Table: "filter", Chain: "blocklist"}},
+	}))
+	require.NoError(t, cc.SetLockdownWhitelist(ctx, firewalld.LockdownWhitelist{
+		Commands: []string{"/usr/bin/firewall-cmd*"},
+		UIDs:     []int{0},
+	}))
+	require.NoError(t, c.Reload(ctx))
+
+	ipset := func(member string, args ...interface{}) {
+		require.NoError(t, fake.Object(dbusDest, mainPath).Call(ctx,
+			firewalld.NewCall(ipsetInterface+"."+member, 0).WithArguments(args...)))
+	}
+
+	// runtime-only changes are part of the snapshot
+	require.NoError(t, c.ApplyZoneChanges(ctx, "internal", []firewalld.ZoneChange{
+		{Method: "addService", Args: []string{"http"}},
+	}))
+	ipset("addEntry", "blocklist", "198.51.100.0/24")
+	require.NoError(t, fake.Object(dbusDest, mainPath).Call(ctx,
+		firewalld.NewCall(policyInterface+".setPolicySettings", 0).
+			WithArguments("internal-out", (&firewalld.PolicySettings{
+				Target:       "CONTINUE",
+				Priority:     -1,
+				IngressZones: []string{"internal"},
+				EgressZones:  []string{"external"},
+			}).ToMap())))
+	// interfaces moved between zones are bound to the permanent zone by reload
+	require.NoError(t, c.ApplyZoneChanges(ctx, "internal", []firewalld.ZoneChange{
+		{Method: "removeInterface", Args: []string{"eth1"}},
+	}))
+	require.NoError(t, c.ApplyZoneChanges(ctx, "external", []firewalld.ZoneChange{
+		{Method: "addInterface", Args: []string{"eth1"}},
+	}))
+
+	snapshot, err := c.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Version, snapshot.Version)
+	assert.Equal(t, "public", snapshot.DefaultZone)
+	assert.Equal(t, "nftables", snapshot.Properties["FirewallBackend"])
+	assert.Equal(t, []string{"http"}, snapshot.Runtime.Zones["internal"].Services)
+	assert.Equal(t, []string{"192.0.2.0/24", "198.51.100.0/24"},
+		snapshot.Runtime.IPSets["blocklist"].Entries)
+	assert.Equal(t, []int{0}, snapshot.Permanent.LockdownWhitelist.UIDs)
+	assert.Contains(t, snapshot.Permanent.ICMPTypes, "echo-request")
+	assert.Equal(t, []string{"eth1"}, snapshot.Runtime.Zones["external"].Interfaces)
+	assert.Equal(t, []string{"eth1"}, snapshot.Permanent.Zones["internal"].Interfaces)
+	assert.Empty(t, snapshot.Runtime.Policies["internal-out"].Services)
+
+	// restore from the serialized form
+	b, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var decoded firewalld.Snapshot
+	require.NoError(t, json.Unmarshal(b, &decoded))
+
+	require.NoError(t, cc.AddZone(ctx, "dmz", firewalld.ZoneSettings{Target: "DROP"}))
+	require.NoError(t, cc.RemoveService(ctx, "custom"))
+	require.NoError(t, cc.AddICMPType(ctx, "custom", firewalld.ICMPTypeSettings{
+		Destinations: []string{"ipv4"},
+	}))
+	require.NoError(t, cc.UpdateDirectSettings(ctx, firewalld.DirectSettings{}))
+	require.NoError(t, cc.SetLockdownWhitelist(ctx, firewalld.LockdownWhitelist{
+		Users: []string{"admin"},
+	}))
+	require.NoError(t, cc.SetProperty(ctx, "LogDenied", "all"))
+	require.NoError(t, c.SetDefaultZone(ctx, "internal"))
+	require.NoError(t, c.ApplyZoneChanges(ctx, "internal", []firewalld.ZoneChange{
+		{Method: "removeService", Args: []string{"http"}},
+		{Method: "addPort", Args: []string{"443", "tcp"}},
+	}))
+	ipset("removeEntry", "blocklist", "192.0.2.0/24")
+	require.NoError(t, fake.Object(dbusDest, mainPath).Call(ctx,
+		firewalld.NewCall(directInterface+".addPassthrough", 0).
+			WithArguments("ipv4", []string{"-A", "INPUT", "-j", "DROP"})))
+	// additions to a policy without services, ports or rich rules
+	policy := decoded.Runtime.Policies["internal-out"]
+	policy.Services = []string{"ssh"}
+	policy.Ports = []firewalld.Port{{Port: "8443", Protocol: "tcp"}}
+	policy.RichRules = []string{`rule service name="http" accept`}
+	require.NoError(t, fake.Object(dbusDest, mainPath).Call(ctx,
+		firewalld.NewCall(policyInterface+".setPolicySettings", 0).
+			WithArguments("internal-out", policy.ToMap())))
+	require.NoError(t, c.EnableLockdown(ctx))
+
+	require.NoError(t, c.Restore(ctx, &decoded))
+	policy, err = c.GetPolicySettings(ctx, "internal-out")
+	require.NoError(t, err)
+	assert.Empty(t, policy.Services)
+	assert.Empty(t, policy.Ports)
+	assert.Empty(t, policy.RichRules)
+
+	restored, err := c.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, cmp.Diff(snapshot, restored, cmpopts.EquateEmpty()))
+}
+
+func TestFake_Exposures(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	cc := fake.Client().Config()
+
+	require.NoError(t, cc.AddService(ctx, "mysql", firewalld.ServiceSettings{
+		Ports: []firewalld.Port{{Port: "3306", Protocol: "tcp"}},
+	}))
+	require.NoError(t, cc.AddZone(ctx, "internal", firewalld.ZoneSettings{
+		Target:          "default",
+		Services:        []string{"mysql"},
+		SourceAddresses: []string{"10.0.0.0/8"},
+	}))
+
+	exposures, err := cc.Exposures(ctx, firewalld.ExposureQuery{
+		Port: firewalld.Port{Port: "3306", Protocol: "tcp"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []firewalld.Exposure{
+		{Zone: "internal", Sources: []string{"10.0.0.0/8"}, Rule: "service mysql"},
+	}, exposures)
+
+	exposures, err = cc.Exposures(ctx, firewalld.ExposureQuery{Service: "ssh"})
+	require.NoError(t, err)
+	assert.Equal(t, []firewalld.Exposure{
+		{Zone: "public", Default: true, Rule: "service ssh"},
+	}, exposures)
+}
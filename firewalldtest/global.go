@@ -0,0 +1,446 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+// global is the part of a configuration that is not made of named objects.
+type global struct {
+	direct    firewalld.DirectSettings
+	whitelist firewalld.LockdownWhitelist
+}
+
+func (g global) clone() global {
+	return global{
+		direct:    clone(g.direct).(firewalld.DirectSettings),
+		whitelist: clone(g.whitelist).(firewalld.LockdownWhitelist),
+	}
+}
+
+var (
+	directKind = &kind{
+		name:      "direct",
+		signature: directSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.DirectSettingsFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.DirectSettings)
+			return s.ToSlice()
+		},
+	}
+	lockdownKind = &kind{
+		name:      "lockdown whitelist",
+		signature: lockdownWhitelistSignature,
+		decode: func(v interface{}) (interface{}, error) {
+			s, err := tuple(v)
+			if err != nil {
+				return nil, err
+			}
+			return firewalld.LockdownWhitelistFromSlice(s)
+		},
+		encode: func(settings interface{}) interface{} {
+			s := settings.(firewalld.LockdownWhitelist)
+			return s.ToSlice()
+		},
+	}
+)
+
+// tuplesKind wraps lists of structs, e.g. []directChain, which godbus
+// only stores as lists of tuples in-process. On the bus they are sent as is.
+var tuplesKind = &kind{
+	name: "tuples",
+	encode: func(v interface{}) interface{} {
+		rv := reflect.ValueOf(v)
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = structFields(rv.Index(i))
+		}
+		return out
+	},
+}
+
+func structFields(rv reflect.Value) []interface{} {
+	out := make([]interface{}, rv.NumField())
+	for i := range out {
+		out[i] = rv.Field(i).Interface()
+	}
+	return out
+}
+
+// Direct configuration entries with the D-Bus signatures used by firewalld,
+// (sss) for chains, (sssias) for rules and (sas) for passthroughs.
+type (
+	directChain struct {
+		IPV, Table, Chain string
+	}
+	directRule struct {
+		IPV, Table, Chain string
+		Priority          int32
+		Args              []string
+	}
+	directPassthrough struct {
+		IPV  string
+		Args []string
+	}
+)
+
+// callConfigGlobal handles the direct and lockdown whitelist methods of the config object.
+func (f *Fake) callConfigGlobal(method, iface, member string, args []interface{}) ([]interface{}, error) {
+	k, settings := directKind, interface{}(f.permanentGlobal.direct)
+	if iface == configInterface+".policies" {
+		k, settings = lockdownKind, f.permanentGlobal.whitelist
+	}
+
+	switch member {
+	case "getSettings", "getLockdownWhitelist":
+		return values(settingsValue{kind: k, settings: clone(settings)})
+	case "update", "setLockdownWhitelist":
+		if len(args) != 1 {
+			return nil, invalidArgs(method)
+		}
+		settings, err := k.decode(args[0])
+		if err != nil {
+			return nil, exception("INVALID_TYPE", err.Error())
+		}
+		if k == directKind {
+			f.permanentGlobal.direct = settings.(firewalld.DirectSettings)
+			f.emit(configPath, iface+".Updated")
+		} else {
+			f.permanentGlobal.whitelist = settings.(firewalld.LockdownWhitelist)
+			f.emit(configPath, iface+".LockdownWhitelistUpdated")
+		}
+		return nil, nil
+	}
+	return nil, unknownMethod(method)
+}
+
+// callConfigProperties implements org.freedesktop.DBus.Properties on the config object.
+func (f *Fake) callConfigProperties(method, member string, args []interface{}) ([]interface{}, error) {
+	properties := map[string]dbus.Variant{
+		"DefaultZone": dbus.MakeVariant(f.defaultZone),
+	}
+	for name, v := range f.properties {
+		properties[name] = dbus.MakeVariant(v)
+	}
+
+	switch member {
+	case "Get":
+		return getProperty(method, member, args, func(iface, prop string) interface{} {
+			if v, ok := properties[prop]; ok && iface == configInterface {
+				return v.Value()
+			}
+			return nil
+		})
+	case "GetAll":
+		a, err := stringArgs(method, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if a[0] != configInterface {
+			return values(map[string]dbus.Variant{})
+		}
+		return values(properties)
+	case "Set":
+		if len(args) != 3 {
+			return nil, invalidArgs(method)
+		}
+		iface, _ := args[0].(string)
+		name, _ := args[1].(string)
+		value, ok := args[2].(dbus.Variant)
+		if !ok || iface != configInterface {
+			return nil, invalidArgs(method)
+		}
+		current, ok := properties[name]
+		if !ok {
+			return nil, dbus.Error{
+				Name: InvalidArgsErrorName,
+				Body: []interface{}{fmt.Sprintf("Property %q does not exist", name)},
+			}
+		}
+		if current.Signature() != value.Signature() {
+			return nil, exception("INVALID_VALUE", fmt.Sprintf("%s: %v", name, value.Value()))
+		}
+		if name == "DefaultZone" {
+			zone := value.Value().(string)
+			if _, ok := f.permanent[zoneKind][zone]; !ok {
+				return nil, exception("INVALID_ZONE", zone)
+			}
+			f.defaultZone = zone
+		} else {
+			f.properties[name] = value.Value()
+		}
+		f.emit(configPath, propertiesInterface+".PropertiesChanged",
+			configInterface, map[string]dbus.Variant{name: value}, []string{})
+		return nil, nil
+	}
+	return nil, unknownMethod(method)
+}
+
+// callRuntimeDirect handles the runtime direct interface,
+// e.g. addRule(ipv, table, chain, priority, args).
+func (f *Fake) callRuntimeDirect(method, member string, args []interface{}) ([]interface{}, error) {
+	d := &f.runtimeGlobal.direct
+	switch member {
+	case "getAllChains":
+		chains := []directChain{}
+		for _, c := range d.Chains {
+			chains = append(chains, directChain{IPV: c.IPV, Table: c.Table, Chain: c.Chain})
+		}
+		return values(settingsValue{kind: tuplesKind, settings: chains})
+	case "getAllRules":
+		rules := []directRule{}
+		for _, r := range d.Rules {
+			rules = append(rules, directRule{
+				IPV: r.IPV, Table: r.Table, Chain: r.Chain,
+				Priority: int32(r.Priority), Args: nonNil(r.Args)})
+		}
+		return values(settingsValue{kind: tuplesKind, settings: rules})
+	case "getAllPassthroughs":
+		passthroughs := []directPassthrough{}
+		for _, p := range d.Passthroughs {
+			passthroughs = append(passthroughs, directPassthrough{IPV: p.IPV, Args: nonNil(p.Args)})
+		}
+		return values(settingsValue{kind: tuplesKind, settings: passthroughs})
+	}
+
+	var add bool
+	var subject string
+	switch {
+	case strings.HasPrefix(member, "add"):
+		add, subject = true, member[len("add"):]
+	case strings.HasPrefix(member, "remove"):
+		subject = member[len("remove"):]
+	default:
+		return nil, unknownMethod(method)
+	}
+
+	// entries are compared by their D-Bus arguments
+	var (
+		key     string
+		entries []string
+	)
+	switch subject {
+	case "Chain":
+		a, err := stringArgs(method, args, 3)
+		if err != nil {
+			return nil, err
+		}
+		key = fmt.Sprint(a)
+		for _, c := range d.Chains {
+			entries = append(entries, fmt.Sprint([]string{c.IPV, c.Table, c.Chain}))
+		}
+	case "Rule":
+		if len(args) != 5 || !isInteger(args[3]) {
+			return nil, invalidArgs(method)
+		}
+		a, err := stringArgs(method, args[:3], 3)
+		if err != nil {
+			return nil, err
+		}
+		ruleArgs, ok := args[4].([]string)
+		if !ok {
+			return nil, invalidArgs(method)
+		}
+		key = fmt.Sprint(a, args[3], ruleArgs)
+		for _, r := range d.Rules {
+			entries = append(entries, fmt.Sprint(
+				[]string{r.IPV, r.Table, r.Chain}, int32(r.Priority), nonNil(r.Args)))
+		}
+	case "Passthrough":
+		if len(args) != 2 {
+			return nil, invalidArgs(method)
+		}
+		ipv, ok := args[0].(string)
+		passArgs, ok2 := args[1].([]string)
+		if !ok || !ok2 {
+			return nil, invalidArgs(method)
+		}
+		key = fmt.Sprint(ipv, passArgs)
+		for _, p := range d.Passthroughs {
+			entries = append(entries, fmt.Sprint(p.IPV, nonNil(p.Args)))
+		}
+	default:
+		return nil, unknownMethod(method)
+	}
+
+	i := indexString(entries, key)
+	switch {
+	case add && i >= 0:
+		return nil, exception("ALREADY_ENABLED", key)
+	case !add && i < 0:
+		return nil, exception("NOT_ENABLED", key)
+	}
+
+	switch subject {
+	case "Chain":
+		if add {
+			d.Chains = append(d.Chains, firewalld.DirectChain{
+				IPV: args[0].(string), Table: args[1].(string), Chain: args[2].(string)})
+		} else {
+			d.Chains = append(d.Chains[:i:i], d.Chains[i+1:]...)
+		}
+	case "Rule":
+		if add {
+			d.Rules = append(d.Rules, firewalld.DirectRule{
+				IPV: args[0].(string), Table: args[1].(string), Chain: args[2].(string),
+				Priority: toInt(args[3]), Args: args[4].([]string)})
+		} else {
+			d.Rules = append(d.Rules[:i:i], d.Rules[i+1:]...)
+		}
+	case "Passthrough":
+		if add {
+			d.Passthroughs = append(d.Passthroughs, firewalld.DirectPassthrough{
+				IPV: args[0].(string), Args: args[1].([]string)})
+		} else {
+			d.Passthroughs = append(d.Passthroughs[:i:i], d.Passthroughs[i+1:]...)
+		}
+	}
+	return nil, nil
+}
+
+// callRuntimeLockdown handles lockdown and the runtime lockdown whitelist,
+// e.g. addLockdownWhitelistUser(user).
+func (f *Fake) callRuntimeLockdown(method, member string, args []interface{}) ([]interface{}, error) {
+	w := &f.runtimeGlobal.whitelist
+	switch member {
+	case "queryLockdown":
+		return values(f.lockdown)
+	case "enableLockdown", "disableLockdown":
+		enable := member == "enableLockdown"
+		if enable == f.lockdown {
+			if enable {
+				return nil, exception("ALREADY_ENABLED", "lockdown")
+			}
+			return nil, exception("NOT_ENABLED", "lockdown")
+		}
+		f.lockdown = enable
+		return nil, nil
+	case "getLockdownWhitelistCommands":
+		return values(nonNil(w.Commands))
+	case "getLockdownWhitelistContexts":
+		return values(nonNil(w.Contexts))
+	case "getLockdownWhitelistUsers":
+		return values(nonNil(w.Users))
+	case "getLockdownWhitelistUids":
+		uids := []int32{}
+		for _, uid := range w.UIDs {
+			uids = append(uids, int32(uid))
+		}
+		return values(uids)
+	}
+
+	var op, subject string
+	for _, prefix := range []string{"add", "remove", "query"} {
+		if strings.HasPrefix(member, prefix+"LockdownWhitelist") {
+			op, subject = prefix, member[len(prefix+"LockdownWhitelist"):]
+		}
+	}
+	if len(args) != 1 {
+		return nil, invalidArgs(method)
+	}
+
+	var list *[]string
+	switch subject {
+	case "Command":
+		list = &w.Commands
+	case "Context":
+		list = &w.Contexts
+	case "User":
+		list = &w.Users
+	case "Uid":
+		if !isInteger(args[0]) {
+			return nil, invalidArgs(method)
+		}
+		uid := toInt(args[0])
+		i := -1
+		for j, v := range w.UIDs {
+			if v == uid {
+				i = j
+			}
+		}
+		switch {
+		case op == "query":
+			return values(i >= 0)
+		case op == "add" && i >= 0:
+			return nil, exception("ALREADY_ENABLED", fmt.Sprint(uid))
+		case op == "add":
+			w.UIDs = append(w.UIDs, uid)
+		case i < 0:
+			return nil, exception("NOT_ENABLED", fmt.Sprint(uid))
+		default:
+			w.UIDs = append(w.UIDs[:i:i], w.UIDs[i+1:]...)
+		}
+		return nil, nil
+	default:
+		return nil, unknownMethod(method)
+	}
+
+	v, ok := args[0].(string)
+	if !ok {
+		return nil, invalidArgs(method)
+	}
+	i := indexString(*list, v)
+	switch {
+	case op == "query":
+		return values(i >= 0)
+	case op == "add" && i >= 0:
+		return nil, exception("ALREADY_ENABLED", v)
+	case op == "add":
+		*list = append(*list, v)
+	case i < 0:
+		return nil, exception("NOT_ENABLED", v)
+	default:
+		*list = append((*list)[:i:i], (*list)[i+1:]...)
+	}
+	return nil, nil
+}
+
+func indexString(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func toInt(v interface{}) int {
+	switch i := v.(type) {
+	case int:
+		return i
+	case int32:
+		return int(i)
+	case int64:
+		return int(i)
+	case uint32:
+		return int(i)
+	}
+	return 0
+}
@@ -0,0 +1,580 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+// Recording is a single call captured by a Recorder.
+type Recording struct {
+	Path      string  `json:"path"`
+	Method    string  `json:"method"`
+	Arguments []Value `json:"arguments,omitempty"`
+	// Values stored into the returns of the call.
+	Returns []Value        `json:"returns,omitempty"`
+	Error   *RecordedError `json:"error,omitempty"`
+}
+
+// RecordedError is the error returned by a recorded call.
+// D-Bus errors keep their name and body, other errors only their message.
+type RecordedError struct {
+	Name    string  `json:"name,omitempty"`
+	Body    []Value `json:"body,omitempty"`
+	Message string  `json:"message,omitempty"`
+}
+
+func recordError(err error) (*RecordedError, error) {
+	var dbusErr dbus.Error
+	var dbusErrPtr *dbus.Error
+	switch {
+	case errors.As(err, &dbusErr):
+	case errors.As(err, &dbusErrPtr) && dbusErrPtr != nil:
+		dbusErr = *dbusErrPtr
+	default:
+		return &RecordedError{Message: err.Error()}, nil
+	}
+	body, err := encodeValues(dbusErr.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordedError{Name: dbusErr.Name, Body: body}, nil
+}
+
+func (e *RecordedError) err() (error, error) {
+	if len(e.Name) == 0 {
+		return errors.New(e.Message), nil
+	}
+	body, err := decodeValues(e.Body)
+	if err != nil {
+		return nil, err
+	}
+	return dbus.Error{Name: e.Name, Body: body}, nil
+}
+
+// Recorder is a firewalld.Connection recording all calls made through it.
+type Recorder struct {
+	conn firewalld.Connection
+
+	mu         sync.Mutex
+	recordings []Recording
+	// First failure to encode a call.
+	err error
+}
+
+var _ firewalld.Connection = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder passing calls on to conn,
+// e.g. a connection to a real firewalld from firewalld.NewConnection.
+func NewRecorder(conn firewalld.Connection) *Recorder {
+	return &Recorder{conn: conn}
+}
+
+// Close closes the underlying connection.
+func (r *Recorder) Close() error {
+	return r.conn.Close()
+}
+
+func (r *Recorder) Object(dest, path string) firewalld.Caller {
+	return &recordingCaller{recorder: r, path: path, caller: r.conn.Object(dest, path)}
+}
+
+// Recordings returns the calls recorded so far.
+// Returns an error if a call could not be encoded.
+func (r *Recorder) Recordings() ([]Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Recording(nil), r.recordings...), r.err
+}
+
+// WriteFile writes the recordings as JSON to path.
+func (r *Recorder) WriteFile(path string) error {
+	recordings, err := r.Recordings()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(recordings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+type recordingCaller struct {
+	recorder *Recorder
+	path     string
+	caller   firewalld.Caller
+}
+
+func (c *recordingCaller) Call(ctx context.Context, call firewalld.Call) error {
+	callErr := c.caller.Call(ctx, call)
+
+	rec, err := newRecording(c.path, call, callErr)
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	if err != nil {
+		if c.recorder.err == nil {
+			c.recorder.err = fmt.Errorf("record %s: %w", call.Method, err)
+		}
+		return callErr
+	}
+	c.recorder.recordings = append(c.recorder.recordings, rec)
+	return callErr
+}
+
+func newRecording(path string, call firewalld.Call, callErr error) (Recording, error) {
+	rec := Recording{Path: path, Method: call.Method}
+	var err error
+	if rec.Arguments, err = encodeValues(call.Arguments); err != nil {
+		return Recording{}, err
+	}
+	if callErr != nil {
+		rec.Error, err = recordError(callErr)
+		return rec, err
+	}
+	for _, ret := range call.Returns {
+		v, err := encodeValue(reflect.ValueOf(ret).Elem().Interface())
+		if err != nil {
+			return Recording{}, err
+		}
+		rec.Returns = append(rec.Returns, v)
+	}
+	return rec, nil
+}
+
+// Replayer is a firewalld.Connection serving recorded calls.
+// Each call is answered by the first unused recording
+// with the same object path, method and arguments.
+type Replayer struct {
+	mu         sync.Mutex
+	recordings []Recording
+	used       []bool
+}
+
+var _ firewalld.Connection = (*Replayer)(nil)
+
+// NewReplayer returns a Replayer serving the given recordings.
+func NewReplayer(recordings []Recording) *Replayer {
+	return &Replayer{
+		recordings: recordings,
+		used:       make([]bool, len(recordings)),
+	}
+}
+
+// ReadReplayer returns a Replayer serving the recordings of a file
+// written by Recorder.WriteFile.
+func ReadReplayer(path string) (*Replayer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recordings []Recording
+	if err := json.Unmarshal(b, &recordings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewReplayer(recordings), nil
+}
+
+// Close does nothing.
+func (r *Replayer) Close() error {
+	return nil
+}
+
+func (r *Replayer) Object(dest, path string) firewalld.Caller {
+	return &replayingCaller{replayer: r, path: path}
+}
+
+// Unused returns the recordings that were not replayed.
+func (r *Replayer) Unused() []Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Recording
+	for i, rec := range r.recordings {
+		if !r.used[i] {
+			unused = append(unused, rec)
+		}
+	}
+	return unused
+}
+
+func (r *Replayer) next(path string, call firewalld.Call) (Recording, error) {
+	args, err := encodeValues(call.Arguments)
+	if err != nil {
+		return Recording{}, err
+	}
+	key, err := json.Marshal(args)
+	if err != nil {
+		return Recording{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rec := range r.recordings {
+		if r.used[i] || rec.Path != path || rec.Method != call.Method {
+			continue
+		}
+		recKey, err := json.Marshal(rec.Arguments)
+		if err != nil {
+			return Recording{}, err
+		}
+		if bytes.Equal(key, recKey) {
+			r.used[i] = true
+			return rec, nil
+		}
+	}
+	if len(args) == 0 {
+		return Recording{}, fmt.Errorf("no recording of %s on %s", call.Method, path)
+	}
+	return Recording{}, fmt.Errorf("no recording of %s on %s with arguments %s", call.Method, path, key)
+}
+
+type replayingCaller struct {
+	replayer *Replayer
+	path     string
+}
+
+func (c *replayingCaller) Call(ctx context.Context, call firewalld.Call) error {
+	rec, err := c.replayer.next(c.path, call)
+	if err != nil {
+		return err
+	}
+	if rec.Error != nil {
+		replayErr, err := rec.Error.err()
+		if err != nil {
+			return err
+		}
+		return replayErr
+	}
+	if len(call.Returns) == 0 {
+		return nil
+	}
+	values, err := decodeValues(rec.Returns)
+	if err != nil {
+		return err
+	}
+	return dbus.Store(values, call.Returns...)
+}
+
+// Value is a D-Bus value tagged with its type, so it can be restored exactly.
+//
+// The type is a D-Bus signature, e.g. "s", "a{ss}" or "v".
+// Lists of differently typed values, which godbus uses for structs,
+// have the type "r" and every element is tagged. Go structs are recorded
+// the same way, since they are received as such lists over D-Bus.
+type Value struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+var (
+	variantType    = reflect.TypeOf(dbus.Variant{})
+	interfacesType = reflect.TypeOf([]interface{}{})
+	objectPathType = reflect.TypeOf(dbus.ObjectPath(""))
+)
+
+func encodeValues(values []interface{}) ([]Value, error) {
+	var out []Value
+	for _, v := range values {
+		ev, err := encodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func decodeValues(values []Value) ([]interface{}, error) {
+	var out []interface{}
+	for _, v := range values {
+		dv, err := decodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dv)
+	}
+	return out, nil
+}
+
+func encodeValue(v interface{}) (Value, error) {
+	if v == nil {
+		return Value{}, errors.New("can't record nil value")
+	}
+	rv := reflect.ValueOf(v)
+	sig, err := typeSignature(rv.Type())
+	if err != nil {
+		return Value{}, err
+	}
+	raw, err := encodeRaw(rv, sig)
+	if err != nil {
+		return Value{}, err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: sig, Value: b}, nil
+}
+
+func decodeValue(v Value) (interface{}, error) {
+	rv, err := decodeRaw(v.Value, v.Type)
+	if err != nil {
+		return nil, err
+	}
+	return rv.Interface(), nil
+}
+
+// typeSignature returns the type of values of t.
+func typeSignature(t reflect.Type) (string, error) {
+	switch {
+	case t == variantType:
+		return "v", nil
+	case t == interfacesType, t.Kind() == reflect.Struct:
+		return "r", nil
+	case t.Kind() == reflect.Slice, t.Kind() == reflect.Array:
+		elem, err := typeSignature(t.Elem())
+		return "a" + elem, err
+	case t.Kind() == reflect.Map:
+		key, err := typeSignature(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := typeSignature(t.Elem())
+		return "a{" + key + elem + "}", err
+	case t == objectPathType:
+		return "o", nil
+	}
+	if sig, ok := basicSignatures[t.Kind()]; ok {
+		return sig, nil
+	}
+	return "", fmt.Errorf("can't record %s", t)
+}
+
+var basicSignatures = map[reflect.Kind]string{
+	reflect.Uint8:   "y",
+	reflect.Bool:    "b",
+	reflect.Int16:   "n",
+	reflect.Uint16:  "q",
+	reflect.Int32:   "i",
+	reflect.Uint32:  "u",
+	reflect.Int:     "x",
+	reflect.Int64:   "x",
+	reflect.Uint64:  "t",
+	reflect.Float64: "d",
+	reflect.String:  "s",
+}
+
+// encodeRaw converts v of type sig to a value that can be marshalled to JSON.
+func encodeRaw(v reflect.Value, sig string) (interface{}, error) {
+	switch {
+	case sig == "v":
+		return encodeValue(v.Interface().(dbus.Variant).Value())
+
+	case sig == "r":
+		var fields []interface{}
+		if v.Kind() == reflect.Struct {
+			for i := 0; i < v.NumField(); i++ {
+				if !v.Field(i).CanInterface() {
+					return nil, fmt.Errorf("%s has unexported fields", v.Type())
+				}
+				fields = append(fields, v.Field(i).Interface())
+			}
+		} else {
+			fields = v.Interface().([]interface{})
+		}
+		return encodeValues(fields)
+
+	case strings.HasPrefix(sig, "a{"):
+		keySig, elemSig := sig[2:3], sig[3:len(sig)-1]
+		if v.IsNil() {
+			return nil, nil
+		}
+		m := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := json.Marshal(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if keySig == "s" || keySig == "o" {
+				key = []byte(iter.Key().String())
+			}
+			elem, err := encodeRaw(iter.Value(), elemSig)
+			if err != nil {
+				return nil, err
+			}
+			m[string(key)] = elem
+		}
+		return m, nil
+
+	case strings.HasPrefix(sig, "a"):
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		list := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := encodeRaw(v.Index(i), sig[1:])
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	}
+	return v.Interface(), nil
+}
+
+// decodeRaw restores a value of type sig,
+// using the Go types godbus decodes D-Bus values to.
+func decodeRaw(raw json.RawMessage, sig string) (reflect.Value, error) {
+	t, err := goType(sig)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	switch {
+	case sig == "v":
+		var v Value
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return reflect.Value{}, err
+		}
+		inner, err := decodeValue(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(dbus.MakeVariant(inner)), nil
+
+	case sig == "r":
+		var fields []Value
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return reflect.Value{}, err
+		}
+		values, err := decodeValues(fields)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if values == nil {
+			values = []interface{}{}
+		}
+		return reflect.ValueOf(values), nil
+
+	case strings.HasPrefix(sig, "a{"):
+		keySig, elemSig := sig[2:3], sig[3:len(sig)-1]
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return reflect.Value{}, err
+		}
+		if m == nil {
+			return reflect.Zero(t), nil
+		}
+		out := reflect.MakeMapWithSize(t, len(m))
+		for k, rawElem := range m {
+			key := reflect.New(t.Key())
+			if keySig == "s" || keySig == "o" {
+				key.Elem().SetString(k)
+			} else if err := json.Unmarshal([]byte(k), key.Interface()); err != nil {
+				return reflect.Value{}, err
+			}
+			elem, err := decodeRaw(rawElem, elemSig)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.SetMapIndex(key.Elem(), elem)
+		}
+		return out, nil
+
+	case strings.HasPrefix(sig, "a"):
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return reflect.Value{}, err
+		}
+		if list == nil {
+			return reflect.Zero(t), nil
+		}
+		out := reflect.MakeSlice(t, 0, len(list))
+		for _, rawElem := range list {
+			elem, err := decodeRaw(rawElem, sig[1:])
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out = reflect.Append(out, elem)
+		}
+		return out, nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+var basicTypes = map[string]reflect.Type{
+	"y": reflect.TypeOf(byte(0)),
+	"b": reflect.TypeOf(false),
+	"n": reflect.TypeOf(int16(0)),
+	"q": reflect.TypeOf(uint16(0)),
+	"i": reflect.TypeOf(int32(0)),
+	"u": reflect.TypeOf(uint32(0)),
+	"x": reflect.TypeOf(int64(0)),
+	"t": reflect.TypeOf(uint64(0)),
+	"d": reflect.TypeOf(float64(0)),
+	"s": reflect.TypeOf(""),
+	"o": objectPathType,
+}
+
+// goType returns the Go type for values of type sig.
+func goType(sig string) (reflect.Type, error) {
+	switch {
+	case sig == "v":
+		return variantType, nil
+	case sig == "r":
+		return interfacesType, nil
+	case strings.HasPrefix(sig, "a{") && strings.HasSuffix(sig, "}") && len(sig) > 4:
+		key, ok := basicTypes[sig[2:3]]
+		if !ok {
+			return nil, fmt.Errorf("invalid dictionary key in %q", sig)
+		}
+		elem, err := goType(sig[3 : len(sig)-1])
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case strings.HasPrefix(sig, "a"):
+		elem, err := goType(sig[1:])
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	}
+	if t, ok := basicTypes[sig]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", sig)
+}
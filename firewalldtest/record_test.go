@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+)
+
+var (
+	update       = flag.Bool("update", false, "re-record testdata/fake.json using a private dbus-daemon")
+	recordSystem = flag.Bool("record-system", false, "record testdata from the firewalld on the system bus")
+)
+
+func TestValue_RoundTrip(t *testing.T) {
+	type port struct{ Port, Protocol string }
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"string", "public", nil},
+		{"int32", int32(-1), nil},
+		{"object path", dbus.ObjectPath("/org/fedoraproject/FirewallD1/config/zone/0"), nil},
+		{"strings", []string{"ssh", "http"}, nil},
+		{"nil strings", []string(nil), nil},
+		{"empty strings", []string{}, nil},
+		{"string map", map[string]string{"family": "inet"}, nil},
+		{"tuple", []interface{}{"1", false, []string{"ssh"}, [][]interface{}{{"22", "tcp"}}}, nil},
+		{"variant map", map[string]dbus.Variant{
+			"priority": dbus.MakeVariant(int32(-1)),
+			"services": dbus.MakeVariant([]string{"ssh"}),
+		}, nil},
+		{"variants", []dbus.Variant{dbus.MakeVariant("a"), dbus.MakeVariant(true)}, nil},
+		// structs are received as lists over D-Bus
+		{"structs", []port{{"22", "tcp"}}, [][]interface{}{{"22", "tcp"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := encodeValue(test.value)
+			require.NoError(t, err)
+			decoded, err := decodeValue(v)
+			require.NoError(t, err)
+
+			expected := test.expected
+			if expected == nil {
+				expected = test.value
+			}
+			assert.Equal(t, expected, decoded)
+		})
+	}
+
+	_, err := encodeValue(map[string]interface{}{"a": 1})
+	assert.EqualError(t, err, "can't record interface {}")
+}
+
+// goldenState is loaded into the Fake to record testdata.
+var goldenState = firewalld.State{
+	Zones: map[string]firewalld.ZoneSettings{
+		"dmz": {
+			Name:         "DMZ",
+			Target:       "default",
+			Services:     []string{"ssh"},
+			Ports:        []firewalld.Port{{Port: "8443", Protocol: "tcp"}},
+			ForwardPorts: []firewalld.ForwardPort{{Port: "22", Protocol: "tcp", ToPort: "2222"}},
+			Interfaces:   []string{"eth1"},
+			RichRules:    []string{`rule family="ipv4" source address="192.0.2.0/24" accept`},
+		},
+	},
+	IPSets: map[string]firewalld.IPSetSettings{
+		"blocked": {
+			Type:    "hash:net",
+			Options: map[string]string{"family": "inet"},
+			Entries: []string{"198.51.100.0/24"},
+		},
+	},
+	Policies: map[string]firewalld.PolicySettings{
+		"dmz-out": {
+			Target:       "ACCEPT",
+			Priority:     -1,
+			IngressZones: []string{"dmz"},
+			EgressZones:  []string{"public"},
+		},
+	},
+}
+
+// goldenResult holds what the client decoded in goldenCalls.
+// It is stored beside each recording, errors are kept as their firewalld code or message.
+type goldenResult struct {
+	Version          string                    `json:"version"`
+	Zones            []string                  `json:"zones"`
+	Zone             firewalld.ZoneSettings    `json:"zone"`
+	Service          firewalld.ServiceSettings `json:"service"`
+	IPSet            firewalld.IPSetSettings   `json:"ipset"`
+	Policy           firewalld.PolicySettings  `json:"policy"`
+	PolicyError      string                    `json:"policyError,omitempty"`
+	ApplyError       string                    `json:"applyError,omitempty"`
+	UnknownZoneError string                    `json:"unknownZoneError,omitempty"`
+}
+
+// goldenCalls is run against the recorded testdata.
+// The host must have goldenState in its configuration, it adds the https service to zone dmz.
+// Unexpected errors fail the test, errors that depend on the firewalld version are returned.
+func goldenCalls(t *testing.T, c *firewalld.Client) goldenResult {
+	ctx := context.Background()
+	var result goldenResult
+	var err error
+
+	result.Version, err = c.Version(ctx)
+	require.NoError(t, err)
+	result.Zones, err = c.GetZones(ctx)
+	require.NoError(t, err)
+	result.Zone, err = c.GetZoneSettings(ctx, "dmz")
+	require.NoError(t, err)
+	result.Service, err = c.Config().GetServiceSettings(ctx, "ssh")
+	require.NoError(t, err)
+	result.IPSet, err = c.Config().GetIPSetSettings(ctx, "blocked")
+	require.NoError(t, err)
+
+	// policies are not available before firewalld 0.9
+	result.Policy, err = c.Config().GetPolicySettings(ctx, "dmz-out")
+	result.PolicyError = errorString(err)
+
+	result.ApplyError = errorString(c.ApplyZoneChanges(ctx, "dmz", []firewalld.ZoneChange{
+		{Method: "addService", Args: []string{"https"}},
+	}))
+
+	_, err = c.GetZoneSettings(ctx, "foo")
+	result.UnknownZoneError = errorString(err)
+	return result
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	if code := firewalld.ErrorCode(err); len(code) > 0 {
+		return code
+	}
+	return err.Error()
+}
+
+// checkFakeGolden checks the result of goldenCalls against the Fake loaded with goldenState.
+func checkFakeGolden(t *testing.T, result goldenResult) {
+	assert.Equal(t, Version, result.Version)
+	assert.Equal(t, []string{"dmz", "public"}, result.Zones)
+
+	expectedZone := goldenState.Zones["dmz"]
+	assert.Equal(t, expectedZone.Services, result.Zone.Services)
+	assert.Equal(t, expectedZone.Ports, result.Zone.Ports)
+	assert.Equal(t, expectedZone.ForwardPorts, result.Zone.ForwardPorts)
+	assert.Equal(t, expectedZone.Interfaces, result.Zone.Interfaces)
+	assert.Equal(t, expectedZone.RichRules, result.Zone.RichRules)
+	assert.Empty(t, result.Zone.SourcePorts)
+
+	assert.Equal(t, []firewalld.Port{{Port: "22", Protocol: "tcp"}}, result.Service.Ports)
+	assert.Equal(t, goldenState.IPSets["blocked"], result.IPSet)
+	assert.Equal(t, goldenState.Policies["dmz-out"], result.Policy)
+	assert.Empty(t, result.PolicyError)
+	assert.Empty(t, result.ApplyError)
+	assert.Equal(t, "INVALID_ZONE", result.UnknownZoneError)
+}
+
+// record runs goldenCalls on conn and writes the recording and its result to testdata.
+func record(t *testing.T, conn firewalld.Connection, name string) goldenResult {
+	recorder := NewRecorder(conn)
+	result := goldenCalls(t, firewalld.NewClient(recorder))
+	require.NoError(t, recorder.WriteFile(filepath.Join("testdata", name+".json")))
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join("testdata", name+expectedSuffix), append(b, '\n'), 0644))
+	return result
+}
+
+// Suffix of the files holding the goldenResult of a recording.
+const expectedSuffix = ".expected.json"
+
+// TestReplay replays every recording in testdata and compares what the client decodes
+// with the result stored beside it, e.g. testdata/fake.expected.json for testdata/fake.json.
+//
+// testdata/fake.json is recorded from the Fake loaded with goldenState with -update.
+// Recordings of real firewalld hosts (0.8, 0.9, 1.x) are made with -record-system
+// on a host configured with goldenState, they are written as testdata/firewalld-<version>.json.
+func TestReplay(t *testing.T) {
+	if *update {
+		fake := New()
+		fake.Load(goldenState)
+		bus, err := StartBus(fake)
+		if errors.Is(err, exec.ErrNotFound) {
+			t.Skip("dbus-daemon not available")
+		}
+		require.NoError(t, err)
+		defer bus.Close()
+
+		conn, err := connect(bus.Address)
+		require.NoError(t, err)
+		defer conn.Close()
+		checkFakeGolden(t, record(t, firewalld.NewConnection(conn), "fake"))
+	}
+	if *recordSystem {
+		conn, err := dbus.SystemBus()
+		require.NoError(t, err)
+		version, err := firewalld.NewClient(firewalld.NewConnection(conn)).Version(context.Background())
+		require.NoError(t, err)
+		record(t, firewalld.NewConnection(conn), "firewalld-"+version)
+	}
+
+	recordings, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.NoError(t, err)
+	for _, path := range recordings {
+		if strings.HasSuffix(path, expectedSuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			expected, err := ioutil.ReadFile(filepath.Join("testdata", name+expectedSuffix))
+			require.NoError(t, err)
+
+			replayer, err := ReadReplayer(path)
+			require.NoError(t, err)
+			result := goldenCalls(t, firewalld.NewClient(replayer))
+			assert.Empty(t, replayer.Unused())
+			if name == "fake" {
+				checkFakeGolden(t, result)
+			}
+
+			actual, err := json.Marshal(result)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(actual))
+
+			// calls that were not recorded fail
+			err = replayer.Object(dbusDest, mainPath).Call(context.Background(),
+				firewalld.NewCall(zoneInterface+".getZones", 0))
+			assert.EqualError(t, err, `no recording of org.fedoraproject.FirewallD1.zone.getZones on /org/fedoraproject/FirewallD1`)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalldtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Argument signatures of the methods implemented by the Fake, as declared by firewalld.
+var signatures = map[string]string{
+	propertiesInterface + ".Get":    "ss",
+	propertiesInterface + ".GetAll": "s",
+	propertiesInterface + ".Set":    "ssv",
+
+	mainInterface + ".getDefaultZone":       "",
+	mainInterface + ".setDefaultZone":       "s",
+	mainInterface + ".reload":               "",
+	mainInterface + ".completeReload":       "",
+	mainInterface + ".runtimeToPermanent":   "",
+	mainInterface + ".checkPermanentConfig": "",
+	mainInterface + ".getZoneSettings":      "s",
+	mainInterface + ".listServices":         "",
+	mainInterface + ".getServiceSettings":   "s",
+	mainInterface + ".listIcmpTypes":        "",
+	mainInterface + ".getIcmpTypeSettings":  "s",
+
+	zoneInterface + ".getZones": "",
+
+	ipsetInterface + ".getIPSets":        "",
+	ipsetInterface + ".getIPSetSettings": "s",
+	ipsetInterface + ".addEntry":         "ss",
+	ipsetInterface + ".removeEntry":      "ss",
+	ipsetInterface + ".queryEntry":       "ss",
+	ipsetInterface + ".getEntries":       "s",
+
+	policyInterface + ".getPolicies":       "",
+	policyInterface + ".getPolicySettings": "s",
+	policyInterface + ".setPolicySettings": "s" + policySignature,
+
+	directInterface + ".getAllChains":       "",
+	directInterface + ".getAllRules":        "",
+	directInterface + ".getAllPassthroughs": "",
+	directInterface + ".addChain":           "sss",
+	directInterface + ".removeChain":        "sss",
+	directInterface + ".addRule":            "sssias",
+	directInterface + ".removeRule":         "sssias",
+	directInterface + ".addPassthrough":     "sas",
+	directInterface + ".removePassthrough":  "sas",
+
+	lockdownInterface + ".queryLockdown":                "",
+	lockdownInterface + ".enableLockdown":               "",
+	lockdownInterface + ".disableLockdown":              "",
+	lockdownInterface + ".getLockdownWhitelistCommands": "",
+	lockdownInterface + ".getLockdownWhitelistContexts": "",
+	lockdownInterface + ".getLockdownWhitelistUsers":    "",
+	lockdownInterface + ".getLockdownWhitelistUids":     "",
+
+	configInterface + ".direct.getSettings":            "",
+	configInterface + ".direct.update":                 directSignature,
+	configInterface + ".policies.getLockdownWhitelist": "",
+	configInterface + ".policies.setLockdownWhitelist": lockdownWhitelistSignature,
+}
+
+// Struct signatures of the settings exchanged with firewalld.
+const (
+	zoneSignature              = "(sssbsasa(ss)asba(ssss)asasasasa(ss)b)"
+	serviceSignature           = "(sssa(ss)asa{ss}asa(ss))"
+	ipsetSignature             = "(ssssa{ss}as)"
+	policySignature            = "a{sv}"
+	helperSignature            = "(sssssa(ss))"
+	icmptypeSignature          = "(sssas)"
+	directSignature            = "(a(sss)a(sssias)a(sas))"
+	lockdownWhitelistSignature = "(asasasai)"
+)
+
+// zoneSubjects maps the subjects of granular zone methods, e.g. "Port" in addPort,
+// to their number of string arguments.
+var zoneSubjects = map[string]int{
+	"Service":            1,
+	"Port":               2,
+	"SourcePort":         2,
+	"Protocol":           1,
+	"IcmpBlock":          1,
+	"ForwardPort":        4,
+	"Interface":          1,
+	"Source":             1,
+	"RichRule":           1,
+	"Masquerade":         0,
+	"IcmpBlockInversion": 0,
+}
+
+func init() {
+	for _, k := range kinds {
+		signatures[configInterface+"."+k.list] = ""
+		signatures[configInterface+".get"+k.method+"Names"] = ""
+		signatures[configInterface+".get"+k.method+"ByName"] = "s"
+		signatures[configInterface+".add"+k.method] = "s" + k.signature
+
+		objectInterface := configInterface + "." + k.name
+		signatures[objectInterface+".getSettings"] = ""
+		signatures[objectInterface+".update"] = k.signature
+		signatures[objectInterface+".loadDefaults"] = ""
+		signatures[objectInterface+".remove"] = ""
+	}
+
+	for subject, n := range zoneSubjects {
+		args := strings.Repeat("s", n)
+		// runtime methods take the zone and additions a timeout
+		timeout := "i"
+		switch subject {
+		case "Interface", "Source", "IcmpBlockInversion":
+			timeout = ""
+		}
+		signatures[zoneInterface+".add"+subject] = "s" + args + timeout
+		signatures[zoneInterface+".remove"+subject] = "s" + args
+		signatures[zoneInterface+".query"+subject] = "s" + args
+
+		for _, op := range []string{"add", "remove", "query"} {
+			signatures[configInterface+".zone."+op+subject] = args
+		}
+	}
+	for _, subject := range []string{"Short", "Description", "Target"} {
+		signatures[configInterface+".zone.set"+subject] = "s"
+	}
+
+	for _, subject := range []string{"Command", "Context", "User", "Uid"} {
+		sig := "s"
+		if subject == "Uid" {
+			sig = "i"
+		}
+		for _, op := range []string{"add", "remove", "query"} {
+			signatures[lockdownInterface+"."+op+"LockdownWhitelist"+subject] = sig
+		}
+	}
+}
+
+// checkSignature returns an InvalidArgs error, if firewalld expects
+// different arguments for method. Methods not implemented by the Fake are not checked.
+func checkSignature(method string, sig dbus.Signature) error {
+	expected, ok := signatures[method]
+	if !ok || sig.String() == expected {
+		return nil
+	}
+	return dbus.Error{
+		Name: InvalidArgsErrorName,
+		Body: []interface{}{fmt.Sprintf("Call to %s has wrong args (%s, expected %s)",
+			method, sig, expected)},
+	}
+}
+
+// marshal passes the arguments of an in-process call through the D-Bus wire format,
+// so the Fake receives the same values as on the bus, e.g. structs as []interface{}.
+func marshal(path, method string, args []interface{}) ([]interface{}, error) {
+	sig := dbus.SignatureOf(args...)
+	if err := checkSignature(method, sig); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	iface, member := splitMethod(method)
+	msg := &dbus.Message{
+		Type: dbus.TypeMethodCall,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldPath:      dbus.MakeVariant(dbus.ObjectPath(path)),
+			dbus.FieldInterface: dbus.MakeVariant(iface),
+			dbus.FieldMember:    dbus.MakeVariant(member),
+			dbus.FieldSignature: dbus.MakeVariant(sig),
+		},
+		Body: args,
+	}
+	var b bytes.Buffer
+	if err := msg.EncodeTo(&b, binary.LittleEndian); err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", method, err)
+	}
+	decoded, err := dbus.DecodeMessage(&b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", method, err)
+	}
+	return decoded.Body, nil
+}
@@ -6,4 +6,5 @@ require (
 	github.com/godbus/dbus/v5 v5.0.3
 	github.com/google/go-cmp v0.5.4
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
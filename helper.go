@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+type HelperSettings struct {
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Family      string `json:"family,omitempty" yaml:"family,omitempty"`
+	Module      string `json:"module,omitempty" yaml:"module,omitempty"`
+	Ports       []Port `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// HelperSettingsFromSlice decodes the helper settings tuple returned by firewalld.
+func HelperSettingsFromSlice(s []interface{}) (HelperSettings, error) {
+	d := &decoder{kind: "helper settings"}
+	d.minLen(s, 6)
+	if d.err != nil {
+		return HelperSettings{}, d.err
+	}
+
+	settings := HelperSettings{
+		Version:     d.string("Version", s[0]),
+		Name:        d.string("Name", s[1]),
+		Description: d.string("Description", s[2]),
+		Family:      d.string("Family", s[3]),
+		Module:      d.string("Module", s[4]),
+		Ports:       d.ports("Ports", s[5]),
+	}
+	if d.err != nil {
+		return HelperSettings{}, d.err
+	}
+	return settings, nil
+}
+
+func (s *HelperSettings) ToSlice() []interface{} {
+	return []interface{}{
+		s.Version,
+		s.Name,
+		s.Description,
+		s.Family,
+		s.Module,
+		portsToInterfaceSlice(s.Ports),
+	}
+}
+
+// helperStruct is encoded as D-Bus struct (sssssa(ss)).
+type helperStruct struct {
+	Version     string
+	Short       string
+	Description string
+	Family      string
+	Module      string
+	Ports       []portStruct
+}
+
+func (s *HelperSettings) toStruct() helperStruct {
+	return helperStruct{
+		Version:     s.Version,
+		Short:       s.Name,
+		Description: s.Description,
+		Family:      s.Family,
+		Module:      s.Module,
+		Ports:       portsToStructs(s.Ports),
+	}
+}
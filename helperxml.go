@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xmlHelper is the layout of a firewalld helper file, see firewalld.helper(5).
+type xmlHelper struct {
+	Version     string    `xml:"version,attr,omitempty"`
+	Family      string    `xml:"family,attr,omitempty"`
+	Module      string    `xml:"module,attr"`
+	Short       string    `xml:"short,omitempty"`
+	Description string    `xml:"description,omitempty"`
+	Ports       []xmlPort `xml:"port"`
+}
+
+// MarshalXML encodes the helper in firewalld helper file format.
+func (s HelperSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlHelper{
+		Version:     s.Version,
+		Family:      s.Family,
+		Module:      s.Module,
+		Short:       s.Name,
+		Description: s.Description,
+		Ports:       xmlPorts(s.Ports),
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "helper"}})
+}
+
+// UnmarshalXML decodes a helper from firewalld helper file format.
+func (s *HelperSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "helper"); err != nil {
+		return err
+	}
+	var x xmlHelper
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = HelperSettings{
+		Version:     x.Version,
+		Name:        x.Short,
+		Description: x.Description,
+		Family:      x.Family,
+		Module:      x.Module,
+		Ports:       portsFromXML(x.Ports),
+	}
+	return nil
+}
+
+// ReadHelperXML reads a helper from a firewalld helper file, e.g. /usr/lib/firewalld/helpers/ftp.xml.
+func ReadHelperXML(r io.Reader) (HelperSettings, error) {
+	var s HelperSettings
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return HelperSettings{}, err
+	}
+	return s, nil
+}
+
+// WriteHelperXML writes the helper in firewalld helper file format.
+func WriteHelperXML(w io.Writer, s HelperSettings) error {
+	return writeXML(w, s)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelperXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<helper module="nf_conntrack_ftp">
+  <short>FTP</short>
+  <port protocol="tcp" port="21"/>
+</helper>
+`
+	s, err := ReadHelperXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, HelperSettings{
+		Name:   "FTP",
+		Module: "nf_conntrack_ftp",
+		Ports:  []Port{{Port: "21", Protocol: "tcp"}},
+	}, s)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHelperXML(&buf, s))
+	roundTrip, err := ReadHelperXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, roundTrip)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+// ICMPTypeSettings of a firewalld icmptype.
+type ICMPTypeSettings struct {
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Address families the type is valid for, "ipv4" and/or "ipv6".
+	// Empty means both.
+	Destinations []string `json:"destinations,omitempty" yaml:"destinations,omitempty"`
+}
+
+// ICMPTypeSettingsFromSlice decodes the icmptype settings tuple returned by firewalld.
+func ICMPTypeSettingsFromSlice(s []interface{}) (ICMPTypeSettings, error) {
+	d := &decoder{kind: "icmptype settings"}
+	d.minLen(s, 4)
+	if d.err != nil {
+		return ICMPTypeSettings{}, d.err
+	}
+
+	settings := ICMPTypeSettings{
+		Version:      d.string("Version", s[0]),
+		Name:         d.string("Name", s[1]),
+		Description:  d.string("Description", s[2]),
+		Destinations: d.strings("Destinations", s[3]),
+	}
+	if d.err != nil {
+		return ICMPTypeSettings{}, d.err
+	}
+	return settings, nil
+}
+
+func (s *ICMPTypeSettings) ToSlice() []interface{} {
+	destinations := s.Destinations
+	if destinations == nil {
+		destinations = []string{}
+	}
+	return []interface{}{
+		s.Version,
+		s.Name,
+		s.Description,
+		destinations,
+	}
+}
+
+// icmptypeStruct is encoded as D-Bus struct (sssas).
+type icmptypeStruct struct {
+	Version      string
+	Short        string
+	Description  string
+	Destinations []string
+}
+
+func (s *ICMPTypeSettings) toStruct() icmptypeStruct {
+	return icmptypeStruct{
+		Version:      s.Version,
+		Short:        s.Name,
+		Description:  s.Description,
+		Destinations: s.Destinations,
+	}
+}
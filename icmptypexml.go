@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xmlICMPType is the layout of a firewalld icmptype file, see firewalld.icmptype(5).
+type xmlICMPType struct {
+	Version     string                  `xml:"version,attr,omitempty"`
+	Short       string                  `xml:"short,omitempty"`
+	Description string                  `xml:"description,omitempty"`
+	Destination *xmlICMPTypeDestination `xml:"destination"`
+}
+
+type xmlICMPTypeDestination struct {
+	IPv4 string `xml:"ipv4,attr,omitempty"`
+	IPv6 string `xml:"ipv6,attr,omitempty"`
+}
+
+// MarshalXML encodes the icmptype in firewalld icmptype file format.
+func (s ICMPTypeSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlICMPType{
+		Version:     s.Version,
+		Short:       s.Name,
+		Description: s.Description,
+	}
+	if len(s.Destinations) > 0 {
+		x.Destination = &xmlICMPTypeDestination{}
+		for _, family := range s.Destinations {
+			switch family {
+			case "ipv4":
+				x.Destination.IPv4 = "yes"
+			case "ipv6":
+				x.Destination.IPv6 = "yes"
+			}
+		}
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "icmptype"}})
+}
+
+// UnmarshalXML decodes an icmptype from firewalld icmptype file format.
+func (s *ICMPTypeSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "icmptype"); err != nil {
+		return err
+	}
+	var x xmlICMPType
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = ICMPTypeSettings{
+		Version:     x.Version,
+		Name:        x.Short,
+		Description: x.Description,
+	}
+	if x.Destination != nil {
+		if xmlBool(x.Destination.IPv4) {
+			s.Destinations = append(s.Destinations, "ipv4")
+		}
+		if xmlBool(x.Destination.IPv6) {
+			s.Destinations = append(s.Destinations, "ipv6")
+		}
+	}
+	return nil
+}
+
+// ReadICMPTypeXML reads an icmptype from a firewalld icmptype file,
+// e.g. /usr/lib/firewalld/icmptypes/echo-request.xml.
+func ReadICMPTypeXML(r io.Reader) (ICMPTypeSettings, error) {
+	var s ICMPTypeSettings
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return ICMPTypeSettings{}, err
+	}
+	return s, nil
+}
+
+// WriteICMPTypeXML writes the icmptype in firewalld icmptype file format.
+func WriteICMPTypeXML(w io.Writer, s ICMPTypeSettings) error {
+	return writeXML(w, s)
+}
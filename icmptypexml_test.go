@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICMPTypeXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<icmptype>
+  <short>Echo Request (ping)</short>
+  <description>This message is used to test if a host is reachable.</description>
+  <destination ipv4="yes" ipv6="yes"/>
+</icmptype>
+`
+	s, err := ReadICMPTypeXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, ICMPTypeSettings{
+		Name:         "Echo Request (ping)",
+		Description:  "This message is used to test if a host is reachable.",
+		Destinations: []string{"ipv4", "ipv6"},
+	}, s)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteICMPTypeXML(&buf, s))
+	roundTrip, err := ReadICMPTypeXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, roundTrip)
+
+	decoded, err := ICMPTypeSettingsFromSlice(s.ToSlice())
+	require.NoError(t, err)
+	assert.Equal(t, s, decoded)
+}
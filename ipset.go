@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+type IPSetSettings struct {
+	Version     string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Type        string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Options     map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+	Entries     []string          `json:"entries,omitempty" yaml:"entries,omitempty"`
+}
+
+// IPSetSettingsFromSlice decodes the ipset settings tuple returned by firewalld.
+func IPSetSettingsFromSlice(s []interface{}) (IPSetSettings, error) {
+	d := &decoder{kind: "ipset settings"}
+	d.minLen(s, 6)
+	if d.err != nil {
+		return IPSetSettings{}, d.err
+	}
+
+	settings := IPSetSettings{
+		Version:     d.string("Version", s[0]),
+		Name:        d.string("Name", s[1]),
+		Description: d.string("Description", s[2]),
+		Type:        d.string("Type", s[3]),
+		Options:     d.stringMap("Options", s[4]),
+		Entries:     d.strings("Entries", s[5]),
+	}
+	if d.err != nil {
+		return IPSetSettings{}, d.err
+	}
+	return settings, nil
+}
+
+func (s *IPSetSettings) ToSlice() []interface{} {
+	options := s.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+	return []interface{}{
+		s.Version,
+		s.Name,
+		s.Description,
+		s.Type,
+		options,
+		s.Entries,
+	}
+}
+
+// ipsetStruct is encoded as D-Bus struct (ssssa{ss}as).
+type ipsetStruct struct {
+	Version     string
+	Short       string
+	Description string
+	Type        string
+	Options     map[string]string
+	Entries     []string
+}
+
+func (s *IPSetSettings) toStruct() ipsetStruct {
+	options := s.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+	return ipsetStruct{
+		Version:     s.Version,
+		Short:       s.Name,
+		Description: s.Description,
+		Type:        s.Type,
+		Options:     options,
+		Entries:     s.Entries,
+	}
+}
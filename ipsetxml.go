@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+)
+
+// xmlIPSet is the layout of a firewalld ipset file, see firewalld.ipset(5).
+type xmlIPSet struct {
+	Version     string           `xml:"version,attr,omitempty"`
+	Type        string           `xml:"type,attr"`
+	Short       string           `xml:"short,omitempty"`
+	Description string           `xml:"description,omitempty"`
+	Options     []xmlIPSetOption `xml:"option"`
+	Entries     []string         `xml:"entry"`
+}
+
+type xmlIPSetOption struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr,omitempty"`
+}
+
+// MarshalXML encodes the ipset in firewalld ipset file format.
+// Options are written sorted by name.
+func (s IPSetSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlIPSet{
+		Version:     s.Version,
+		Type:        s.Type,
+		Short:       s.Name,
+		Description: s.Description,
+		Entries:     s.Entries,
+	}
+	names := make([]string, 0, len(s.Options))
+	for name := range s.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		x.Options = append(x.Options, xmlIPSetOption{Name: name, Value: s.Options[name]})
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "ipset"}})
+}
+
+// UnmarshalXML decodes an ipset from firewalld ipset file format.
+// Options without value, e.g. "nomatch", map to an empty string.
+func (s *IPSetSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "ipset"); err != nil {
+		return err
+	}
+	var x xmlIPSet
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = IPSetSettings{
+		Version:     x.Version,
+		Name:        x.Short,
+		Description: x.Description,
+		Type:        x.Type,
+		Entries:     x.Entries,
+	}
+	if len(x.Options) > 0 {
+		s.Options = map[string]string{}
+		for _, o := range x.Options {
+			s.Options[o.Name] = o.Value
+		}
+	}
+	return nil
+}
+
+// ReadIPSetXML reads an ipset from a firewalld ipset file, e.g. /etc/firewalld/ipsets/blocklist.xml.
+func ReadIPSetXML(r io.Reader) (IPSetSettings, error) {
+	var s IPSetSettings
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return IPSetSettings{}, err
+	}
+	return s, nil
+}
+
+// WriteIPSetXML writes the ipset in firewalld ipset file format.
+func WriteIPSetXML(w io.Writer, s IPSetSettings) error {
+	return writeXML(w, s)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPSetXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<ipset type="hash:net">
+  <short>Blocklist</short>
+  <option name="family" value="inet6"/>
+  <option name="timeout" value="3600"/>
+  <option name="nomatch"/>
+  <entry>2001:db8::/32</entry>
+  <entry>2001:db8:1::/48</entry>
+</ipset>
+`
+	s, err := ReadIPSetXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, IPSetSettings{
+		Name:    "Blocklist",
+		Type:    "hash:net",
+		Options: map[string]string{"family": "inet6", "timeout": "3600", "nomatch": ""},
+		Entries: []string{"2001:db8::/32", "2001:db8:1::/48"},
+	}, s)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteIPSetXML(&buf, s))
+	assert.Contains(t, buf.String(), `<option name="family" value="inet6"></option>
+  <option name="nomatch"></option>`)
+
+	roundTrip, err := ReadIPSetXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, roundTrip)
+}
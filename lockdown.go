@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// LockdownWhitelist lists the applications allowed to change firewalld
+// while lockdown is enabled.
+type LockdownWhitelist struct {
+	// Command lines, a trailing "*" matches all commands with that prefix.
+	Commands []string `json:"commands,omitempty" yaml:"commands,omitempty"`
+	// SELinux contexts.
+	Contexts []string `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+	Users    []string `json:"users,omitempty" yaml:"users,omitempty"`
+	UIDs     []int    `json:"uids,omitempty" yaml:"uids,omitempty"`
+}
+
+// LockdownWhitelistFromSlice decodes the lockdown whitelist tuple returned by firewalld.
+func LockdownWhitelistFromSlice(s []interface{}) (LockdownWhitelist, error) {
+	d := &decoder{kind: "lockdown whitelist"}
+	d.minLen(s, 4)
+	if d.err != nil {
+		return LockdownWhitelist{}, d.err
+	}
+
+	w := LockdownWhitelist{
+		Commands: d.strings("Commands", s[0]),
+		Contexts: d.strings("Contexts", s[1]),
+		Users:    d.strings("Users", s[2]),
+		UIDs:     d.ints("UIDs", s[3]),
+	}
+	if d.err != nil {
+		return LockdownWhitelist{}, d.err
+	}
+	return w, nil
+}
+
+func (w *LockdownWhitelist) ToSlice() []interface{} {
+	s := w.toStruct()
+	return []interface{}{s.Commands, s.Contexts, s.Users, s.UIDs}
+}
+
+// lockdownWhitelistStruct is encoded as D-Bus struct (asasasai).
+type lockdownWhitelistStruct struct {
+	Commands []string
+	Contexts []string
+	Users    []string
+	UIDs     []int32
+}
+
+func (w *LockdownWhitelist) toStruct() lockdownWhitelistStruct {
+	uids := []int32{}
+	for _, uid := range w.UIDs {
+		uids = append(uids, int32(uid))
+	}
+	return lockdownWhitelistStruct{
+		Commands: nonNilStrings(w.Commands),
+		Contexts: nonNilStrings(w.Contexts),
+		Users:    nonNilStrings(w.Users),
+		UIDs:     uids,
+	}
+}
+
+// xmlLockdownWhitelist is the layout of lockdown-whitelist.xml, see firewalld.lockdown-whitelist(5).
+type xmlLockdownWhitelist struct {
+	Commands []xmlName           `xml:"command"`
+	Contexts []xmlSELinuxContext `xml:"selinux"`
+	Users    []xmlUser           `xml:"user"`
+}
+
+type xmlSELinuxContext struct {
+	Context string `xml:"context,attr"`
+}
+
+type xmlUser struct {
+	Name string `xml:"name,attr,omitempty"`
+	ID   string `xml:"id,attr,omitempty"`
+}
+
+// MarshalXML encodes the whitelist in lockdown-whitelist.xml format.
+func (w LockdownWhitelist) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlLockdownWhitelist{Commands: xmlNames(w.Commands)}
+	for _, c := range w.Contexts {
+		x.Contexts = append(x.Contexts, xmlSELinuxContext{Context: c})
+	}
+	for _, u := range w.Users {
+		x.Users = append(x.Users, xmlUser{Name: u})
+	}
+	for _, uid := range w.UIDs {
+		x.Users = append(x.Users, xmlUser{ID: strconv.Itoa(uid)})
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "whitelist"}})
+}
+
+// UnmarshalXML decodes the whitelist from lockdown-whitelist.xml format.
+func (w *LockdownWhitelist) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "whitelist"); err != nil {
+		return err
+	}
+	var x xmlLockdownWhitelist
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*w = LockdownWhitelist{Commands: namesFromXML(x.Commands)}
+	for _, c := range x.Contexts {
+		w.Contexts = append(w.Contexts, c.Context)
+	}
+	for _, u := range x.Users {
+		if len(u.ID) > 0 {
+			uid, err := strconv.Atoi(u.ID)
+			if err != nil {
+				return fmt.Errorf("invalid user id %q", u.ID)
+			}
+			w.UIDs = append(w.UIDs, uid)
+			continue
+		}
+		w.Users = append(w.Users, u.Name)
+	}
+	return nil
+}
+
+// ReadLockdownWhitelistXML reads the whitelist from /etc/firewalld/lockdown-whitelist.xml.
+func ReadLockdownWhitelistXML(r io.Reader) (LockdownWhitelist, error) {
+	var w LockdownWhitelist
+	if err := xml.NewDecoder(r).Decode(&w); err != nil {
+		return LockdownWhitelist{}, err
+	}
+	return w, nil
+}
+
+// WriteLockdownWhitelistXML writes the whitelist in lockdown-whitelist.xml format.
+func WriteLockdownWhitelistXML(w io.Writer, whitelist LockdownWhitelist) error {
+	return writeXML(w, whitelist)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockdownWhitelistXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<whitelist>
+  <command name="/usr/bin/python3 -s /usr/bin/firewall-config"/>
+  <selinux context="system_u:system_r:NetworkManager_t:s0"/>
+  <user name="root"/>
+  <user id="1000"/>
+</whitelist>
+`
+	w, err := ReadLockdownWhitelistXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, LockdownWhitelist{
+		Commands: []string{"/usr/bin/python3 -s /usr/bin/firewall-config"},
+		Contexts: []string{"system_u:system_r:NetworkManager_t:s0"},
+		Users:    []string{"root"},
+		UIDs:     []int{1000},
+	}, w)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteLockdownWhitelistXML(&buf, w))
+	roundTrip, err := ReadLockdownWhitelistXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, w, roundTrip)
+
+	decoded, err := LockdownWhitelistFromSlice(w.ToSlice())
+	require.NoError(t, err)
+	assert.Equal(t, w, decoded)
+
+	_, err = ReadLockdownWhitelistXML(strings.NewReader(`<whitelist><user id="x"/></whitelist>`))
+	assert.EqualError(t, err, `invalid user id "x"`)
+}
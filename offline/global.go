@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/godbus/dbus/v5"
+
+	"routerd.net/go-firewalld"
+)
+
+// Files of the global configuration, relative to the config dir.
+const (
+	directFile            = "direct.xml"
+	lockdownWhitelistFile = "lockdown-whitelist.xml"
+	firewalldConfFile     = "firewalld.conf"
+)
+
+// Values firewalld uses for properties missing in firewalld.conf.
+// The type of each value is the D-Bus type of the property.
+var defaultProperties = map[string]interface{}{
+	"DefaultZone":       "public",
+	"CleanupOnExit":     "yes",
+	"FirewallBackend":   "nftables",
+	"FlushAllOnReload":  "yes",
+	"IPv6_rpfilter":     "yes",
+	"IndividualCalls":   "no",
+	"Lockdown":          "no",
+	"LogDenied":         "off",
+	"MinimalMark":       int32(100),
+	"AutomaticHelpers":  "no",
+	"RFC3964_IPv4":      "yes",
+	"AllowZoneDrifting": "no",
+}
+
+// readGlobal decodes a global configuration file of the config dir.
+// Returns false if the file does not exist.
+func (c *ConfigClient) readGlobal(name string, decode func(r io.Reader) error) (bool, error) {
+	path := filepath.Join(c.ConfigDir, name)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if err := decode(f); err != nil {
+		return false, firewalld.Error{Code: "INVALID_CONFIG", Message: path + ": " + err.Error()}
+	}
+	return true, nil
+}
+
+// Return permanent direct chains, rules and passthroughs.
+func (c *ConfigClient) GetDirectSettings(
+	ctx context.Context) (settings firewalld.DirectSettings, err error) {
+	_, err = c.readGlobal(directFile, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadDirectXML(r)
+		return err
+	})
+	return settings, err
+}
+
+// Replace permanent direct chains, rules and passthroughs.
+func (c *ConfigClient) UpdateDirectSettings(
+	ctx context.Context, settings firewalld.DirectSettings) error {
+	return writeFile(filepath.Join(c.ConfigDir, directFile), func(w io.Writer) error {
+		return firewalld.WriteDirectXML(w, settings)
+	})
+}
+
+// Return permanent lockdown whitelist.
+func (c *ConfigClient) GetLockdownWhitelist(
+	ctx context.Context) (whitelist firewalld.LockdownWhitelist, err error) {
+	_, err = c.readGlobal(lockdownWhitelistFile, func(r io.Reader) (err error) {
+		whitelist, err = firewalld.ReadLockdownWhitelistXML(r)
+		return err
+	})
+	return whitelist, err
+}
+
+// Replace permanent lockdown whitelist.
+func (c *ConfigClient) SetLockdownWhitelist(
+	ctx context.Context, whitelist firewalld.LockdownWhitelist) error {
+	return writeFile(filepath.Join(c.ConfigDir, lockdownWhitelistFile), func(w io.Writer) error {
+		return firewalld.WriteLockdownWhitelistXML(w, whitelist)
+	})
+}
+
+// readConf reads firewalld.conf, an empty file if it does not exist.
+func (c *ConfigClient) readConf() (conf *firewalld.FirewalldConf, err error) {
+	found, err := c.readGlobal(firewalldConfFile, func(r io.Reader) (err error) {
+		conf, err = firewalld.ReadFirewalldConf(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &firewalld.FirewalldConf{}, nil
+	}
+	return conf, nil
+}
+
+// Return properties of the permanent configuration as read from firewalld.conf,
+// e.g. "FirewallBackend" or "LogDenied". Missing keys have the firewalld defaults.
+func (c *ConfigClient) GetProperties(
+	ctx context.Context) (map[string]dbus.Variant, error) {
+	conf, err := c.readConf()
+	if err != nil {
+		return nil, err
+	}
+
+	properties := map[string]dbus.Variant{}
+	for name, def := range defaultProperties {
+		value := def
+		if s, ok := conf.Get(name); ok {
+			value, err = parseProperty(def, s)
+			if err != nil {
+				return nil, firewalld.Error{
+					Code:    "INVALID_CONFIG",
+					Message: fmt.Sprintf("%s: %s: %v", firewalldConfFile, name, err),
+				}
+			}
+		}
+		properties[name] = dbus.MakeVariant(value)
+	}
+	return properties, nil
+}
+
+// Change a property of the permanent configuration in firewalld.conf.
+// The value must have the type of the property, e.g. string for "LogDenied".
+func (c *ConfigClient) SetProperty(
+	ctx context.Context, name string, value interface{}) error {
+	def, ok := defaultProperties[name]
+	if !ok {
+		return firewalld.Error{Code: "INVALID_VALUE", Message: "unknown property " + name}
+	}
+	if fmt.Sprintf("%T", def) != fmt.Sprintf("%T", value) {
+		return firewalld.Error{Code: "INVALID_VALUE", Message: fmt.Sprintf("%s: %v", name, value)}
+	}
+	if name == "DefaultZone" {
+		if _, err := c.path(zoneKind, value.(string)); err != nil {
+			return err
+		}
+	}
+
+	conf, err := c.readConf()
+	if err != nil {
+		return err
+	}
+	conf.Set(name, fmt.Sprint(value))
+	return writeFile(filepath.Join(c.ConfigDir, firewalldConfFile), func(w io.Writer) error {
+		_, err := conf.WriteTo(w)
+		return err
+	})
+}
+
+// parseProperty converts a firewalld.conf value to the type of def.
+func parseProperty(def interface{}, s string) (interface{}, error) {
+	if _, ok := def.(int32); ok {
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	}
+	return s, nil
+}
+
+// Exposures reports every zone setting of the permanent configuration
+// that opens the queried port or service, see firewalld.State.Exposures.
+func (c *ConfigClient) Exposures(
+	ctx context.Context, q firewalld.ExposureQuery) ([]firewalld.Exposure, error) {
+	properties, err := c.GetProperties(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultZone, _ := properties["DefaultZone"].Value().(string)
+	return firewalld.ConfigExposures(ctx, c, defaultZone, q)
+}
@@ -0,0 +1,502 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package offline edits the firewalld configuration files directly,
+// like firewall-offline-cmd, for use when firewalld is not running.
+//
+// Objects are read from the config dir (/etc/firewalld) if present there,
+// otherwise from the defaults dir (/usr/lib/firewalld).
+// Changes are always written to the config dir.
+// The direct rules, the lockdown whitelist and firewalld.conf
+// only exist in the config dir.
+package offline
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"routerd.net/go-firewalld"
+)
+
+const (
+	DefaultConfigDir   = "/etc/firewalld"
+	DefaultDefaultsDir = "/usr/lib/firewalld"
+)
+
+// ConfigClient works on the permanent firewalld configuration files.
+// It has the same methods as firewalld.ConfigClient.
+// Methods returning D-Bus object paths return file paths instead.
+type ConfigClient struct {
+	// Directory for user configuration, usually /etc/firewalld.
+	ConfigDir string
+	// Directory of the packaged defaults, usually /usr/lib/firewalld.
+	DefaultsDir string
+}
+
+var _ firewalld.Config = (*ConfigClient)(nil)
+
+// NewConfigClient returns a client for the configuration in the given root directory,
+// e.g. a mounted image. An empty root or "/" works on the host configuration.
+func NewConfigClient(root string) *ConfigClient {
+	return &ConfigClient{
+		ConfigDir:   filepath.Join(root, DefaultConfigDir),
+		DefaultsDir: filepath.Join(root, DefaultDefaultsDir),
+	}
+}
+
+// kind describes where objects of a type are stored and which errors firewalld reports for them.
+type kind struct {
+	dir         string
+	invalidCode string
+	builtinCode string
+}
+
+var (
+	zoneKind     = kind{dir: "zones", invalidCode: "INVALID_ZONE", builtinCode: "BUILTIN_ZONE"}
+	serviceKind  = kind{dir: "services", invalidCode: "INVALID_SERVICE", builtinCode: "BUILTIN_SERVICE"}
+	ipsetKind    = kind{dir: "ipsets", invalidCode: "INVALID_IPSET", builtinCode: "BUILTIN_IPSET"}
+	policyKind   = kind{dir: "policies", invalidCode: "INVALID_POLICY", builtinCode: "BUILTIN_POLICY"}
+	helperKind   = kind{dir: "helpers", invalidCode: "INVALID_HELPER", builtinCode: "BUILTIN_HELPER"}
+	icmptypeKind = kind{dir: "icmptypes", invalidCode: "INVALID_ICMPTYPE", builtinCode: "BUILTIN_ICMPTYPE"}
+)
+
+const xmlExt = ".xml"
+
+func (c *ConfigClient) configFile(k kind, name string) string {
+	return filepath.Join(c.ConfigDir, k.dir, name+xmlExt)
+}
+
+func (c *ConfigClient) defaultsFile(k kind, name string) string {
+	return filepath.Join(c.DefaultsDir, k.dir, name+xmlExt)
+}
+
+// names lists the objects of both directories.
+func (c *ConfigClient) names(k kind) ([]string, error) {
+	seen := map[string]bool{}
+	for _, dir := range []string{c.DefaultsDir, c.ConfigDir} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, k.dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), xmlExt) {
+				continue
+			}
+			seen[strings.TrimSuffix(f.Name(), xmlExt)] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// paths returns the files of all objects.
+func (c *ConfigClient) paths(k kind) ([]string, error) {
+	names, err := c.names(k)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, name := range names {
+		path, err := c.path(k, name)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// path returns the file currently defining the named object.
+func (c *ConfigClient) path(k kind, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	for _, path := range []string{c.configFile(k, name), c.defaultsFile(k, name)} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", firewalld.Error{Code: k.invalidCode, Message: name}
+}
+
+func (c *ConfigClient) read(k kind, name string, decode func(r io.Reader) error) error {
+	path, err := c.path(k, name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := decode(f); err != nil {
+		return firewalld.Error{Code: "INVALID_CONFIG", Message: path + ": " + err.Error()}
+	}
+	return nil
+}
+
+func (c *ConfigClient) add(k kind, name string, encode func(w io.Writer) error) error {
+	if _, err := c.path(k, name); err == nil {
+		return firewalld.Error{Code: "NAME_CONFLICT", Message: name}
+	} else if firewalld.ErrorCode(err) != k.invalidCode {
+		return err
+	}
+	return writeFile(c.configFile(k, name), encode)
+}
+
+func (c *ConfigClient) update(k kind, name string, encode func(w io.Writer) error) error {
+	if _, err := c.path(k, name); err != nil {
+		return err
+	}
+	return writeFile(c.configFile(k, name), encode)
+}
+
+// remove deletes the user configuration of an object.
+// Objects that only exist in the defaults can't be removed,
+// removing a modified default object restores the default.
+func (c *ConfigClient) remove(k kind, name string) error {
+	path, err := c.path(k, name)
+	if err != nil {
+		return err
+	}
+	if path != c.configFile(k, name) {
+		return firewalld.Error{Code: k.builtinCode, Message: name}
+	}
+	return os.Remove(path)
+}
+
+// checkName rejects names that can't be used as file names.
+func checkName(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return firewalld.Error{Code: "INVALID_NAME", Message: name}
+	}
+	return nil
+}
+
+// writeFile atomically replaces path with the encoded content.
+func writeFile(path string, encode func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := encode(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Return list of zone names (permanent configuration).
+func (c *ConfigClient) GetZoneNames(ctx context.Context) ([]string, error) {
+	return c.names(zoneKind)
+}
+
+// Return list of service names (permanent configuration).
+func (c *ConfigClient) GetServiceNames(ctx context.Context) ([]string, error) {
+	return c.names(serviceKind)
+}
+
+// List files of zones known to permanent environment.
+func (c *ConfigClient) ListZones(ctx context.Context) (zonePaths []string, err error) {
+	return c.paths(zoneKind)
+}
+
+// Return file of zone with given name.
+func (c *ConfigClient) GetZoneByName(
+	ctx context.Context, zoneName string) (zonePath string, err error) {
+	return c.path(zoneKind, zoneName)
+}
+
+// Return file of service with given name.
+func (c *ConfigClient) GetServiceByName(
+	ctx context.Context, serviceName string) (servicePath string, err error) {
+	return c.path(serviceKind, serviceName)
+}
+
+// Remove zone.
+func (c *ConfigClient) RemoveZone(ctx context.Context, zoneName string) error {
+	return c.remove(zoneKind, zoneName)
+}
+
+// Add zone with given settings into permanent configuration.
+func (c *ConfigClient) AddZone(
+	ctx context.Context, zoneName string, settings firewalld.ZoneSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	return c.add(zoneKind, zoneName, func(w io.Writer) error {
+		return firewalld.WriteZoneXML(w, settings)
+	})
+}
+
+// Return permanent settings of given zone.
+func (c *ConfigClient) GetZoneSettings(
+	ctx context.Context, zoneName string) (settings firewalld.ZoneSettings, err error) {
+	return settings, c.read(zoneKind, zoneName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadZoneXML(r)
+		return err
+	})
+}
+
+// Update settings of zone.
+func (c *ConfigClient) UpdateZone(
+	ctx context.Context, zoneName string, settings firewalld.ZoneSettings) error {
+	return c.update(zoneKind, zoneName, func(w io.Writer) error {
+		return firewalld.WriteZoneXML(w, settings)
+	})
+}
+
+// Apply granular changes to the permanent configuration of the given zone.
+// All changes are applied, or none if one of them fails.
+func (c *ConfigClient) ApplyZoneChanges(
+	ctx context.Context, zoneName string, changes []firewalld.ZoneChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	settings, err := c.GetZoneSettings(ctx, zoneName)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := settings.ApplyChange(change); err != nil {
+			return &firewalld.ZoneChangeError{Zone: zoneName, Change: change, Err: err}
+		}
+	}
+	return c.UpdateZone(ctx, zoneName, settings)
+}
+
+// Return permanent settings of given service.
+func (c *ConfigClient) GetServiceSettings(
+	ctx context.Context, serviceName string) (settings firewalld.ServiceSettings, err error) {
+	return settings, c.read(serviceKind, serviceName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadServiceXML(r)
+		return err
+	})
+}
+
+// Add service with given settings into permanent configuration.
+func (c *ConfigClient) AddService(
+	ctx context.Context, serviceName string, settings firewalld.ServiceSettings) error {
+	return c.add(serviceKind, serviceName, func(w io.Writer) error {
+		return firewalld.WriteServiceXML(w, settings)
+	})
+}
+
+// Update settings of service.
+func (c *ConfigClient) UpdateService(
+	ctx context.Context, serviceName string, settings firewalld.ServiceSettings) error {
+	return c.update(serviceKind, serviceName, func(w io.Writer) error {
+		return firewalld.WriteServiceXML(w, settings)
+	})
+}
+
+// Remove service.
+func (c *ConfigClient) RemoveService(ctx context.Context, serviceName string) error {
+	return c.remove(serviceKind, serviceName)
+}
+
+// Return list of ipset names (permanent configuration).
+func (c *ConfigClient) GetIPSetNames(ctx context.Context) ([]string, error) {
+	return c.names(ipsetKind)
+}
+
+// Return file of ipset with given name.
+func (c *ConfigClient) GetIPSetByName(
+	ctx context.Context, ipsetName string) (ipsetPath string, err error) {
+	return c.path(ipsetKind, ipsetName)
+}
+
+// Return permanent settings of given ipset.
+func (c *ConfigClient) GetIPSetSettings(
+	ctx context.Context, ipsetName string) (settings firewalld.IPSetSettings, err error) {
+	return settings, c.read(ipsetKind, ipsetName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadIPSetXML(r)
+		return err
+	})
+}
+
+// Add ipset with given settings into permanent configuration.
+func (c *ConfigClient) AddIPSet(
+	ctx context.Context, ipsetName string, settings firewalld.IPSetSettings) error {
+	return c.add(ipsetKind, ipsetName, func(w io.Writer) error {
+		return firewalld.WriteIPSetXML(w, settings)
+	})
+}
+
+// Update settings of ipset.
+func (c *ConfigClient) UpdateIPSet(
+	ctx context.Context, ipsetName string, settings firewalld.IPSetSettings) error {
+	return c.update(ipsetKind, ipsetName, func(w io.Writer) error {
+		return firewalld.WriteIPSetXML(w, settings)
+	})
+}
+
+// Remove ipset.
+func (c *ConfigClient) RemoveIPSet(ctx context.Context, ipsetName string) error {
+	return c.remove(ipsetKind, ipsetName)
+}
+
+// Return list of policy names (permanent configuration).
+func (c *ConfigClient) GetPolicyNames(ctx context.Context) ([]string, error) {
+	return c.names(policyKind)
+}
+
+// Return file of policy with given name.
+func (c *ConfigClient) GetPolicyByName(
+	ctx context.Context, policyName string) (policyPath string, err error) {
+	return c.path(policyKind, policyName)
+}
+
+// Return permanent settings of given policy.
+func (c *ConfigClient) GetPolicySettings(
+	ctx context.Context, policyName string) (settings firewalld.PolicySettings, err error) {
+	return settings, c.read(policyKind, policyName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadPolicyXML(r)
+		return err
+	})
+}
+
+// Add policy with given settings into permanent configuration.
+func (c *ConfigClient) AddPolicy(
+	ctx context.Context, policyName string, settings firewalld.PolicySettings) error {
+	return c.add(policyKind, policyName, func(w io.Writer) error {
+		return firewalld.WritePolicyXML(w, settings)
+	})
+}
+
+// Update settings of policy.
+func (c *ConfigClient) UpdatePolicy(
+	ctx context.Context, policyName string, settings firewalld.PolicySettings) error {
+	return c.update(policyKind, policyName, func(w io.Writer) error {
+		return firewalld.WritePolicyXML(w, settings)
+	})
+}
+
+// Remove policy.
+func (c *ConfigClient) RemovePolicy(ctx context.Context, policyName string) error {
+	return c.remove(policyKind, policyName)
+}
+
+// Return list of helper names (permanent configuration).
+func (c *ConfigClient) GetHelperNames(ctx context.Context) ([]string, error) {
+	return c.names(helperKind)
+}
+
+// Return file of helper with given name.
+func (c *ConfigClient) GetHelperByName(
+	ctx context.Context, helperName string) (helperPath string, err error) {
+	return c.path(helperKind, helperName)
+}
+
+// Return permanent settings of given helper.
+func (c *ConfigClient) GetHelperSettings(
+	ctx context.Context, helperName string) (settings firewalld.HelperSettings, err error) {
+	return settings, c.read(helperKind, helperName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadHelperXML(r)
+		return err
+	})
+}
+
+// Add helper with given settings into permanent configuration.
+func (c *ConfigClient) AddHelper(
+	ctx context.Context, helperName string, settings firewalld.HelperSettings) error {
+	return c.add(helperKind, helperName, func(w io.Writer) error {
+		return firewalld.WriteHelperXML(w, settings)
+	})
+}
+
+// Update settings of helper.
+func (c *ConfigClient) UpdateHelper(
+	ctx context.Context, helperName string, settings firewalld.HelperSettings) error {
+	return c.update(helperKind, helperName, func(w io.Writer) error {
+		return firewalld.WriteHelperXML(w, settings)
+	})
+}
+
+// Remove helper.
+func (c *ConfigClient) RemoveHelper(ctx context.Context, helperName string) error {
+	return c.remove(helperKind, helperName)
+}
+
+// Return list of icmptype names (permanent configuration).
+func (c *ConfigClient) GetICMPTypeNames(ctx context.Context) ([]string, error) {
+	return c.names(icmptypeKind)
+}
+
+// Return file of icmptype with given name.
+func (c *ConfigClient) GetICMPTypeByName(
+	ctx context.Context, icmptypeName string) (icmptypePath string, err error) {
+	return c.path(icmptypeKind, icmptypeName)
+}
+
+// Return permanent settings of given icmptype.
+func (c *ConfigClient) GetICMPTypeSettings(
+	ctx context.Context, icmptypeName string) (settings firewalld.ICMPTypeSettings, err error) {
+	return settings, c.read(icmptypeKind, icmptypeName, func(r io.Reader) (err error) {
+		settings, err = firewalld.ReadICMPTypeXML(r)
+		return err
+	})
+}
+
+// Add icmptype with given settings into permanent configuration.
+func (c *ConfigClient) AddICMPType(
+	ctx context.Context, icmptypeName string, settings firewalld.ICMPTypeSettings) error {
+	return c.add(icmptypeKind, icmptypeName, func(w io.Writer) error {
+		return firewalld.WriteICMPTypeXML(w, settings)
+	})
+}
+
+// Update settings of icmptype.
+func (c *ConfigClient) UpdateICMPType(
+	ctx context.Context, icmptypeName string, settings firewalld.ICMPTypeSettings) error {
+	return c.update(icmptypeKind, icmptypeName, func(w io.Writer) error {
+		return firewalld.WriteICMPTypeXML(w, settings)
+	})
+}
+
+// Remove icmptype.
+func (c *ConfigClient) RemoveICMPType(ctx context.Context, icmptypeName string) error {
+	return c.remove(icmptypeKind, icmptypeName)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offline
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"routerd.net/go-firewalld"
+)
+
+const publicZoneXML = `<?xml version="1.0" encoding="utf-8"?>
+<zone>
+  <short>Public</short>
+  <service name="ssh"/>
+</zone>
+`
+
+func setup(t *testing.T) *ConfigClient {
+	root := t.TempDir()
+	c := NewConfigClient(root)
+	require.NoError(t, os.MkdirAll(filepath.Join(c.DefaultsDir, "zones"), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(c.DefaultsDir, "zones", "public.xml"), []byte(publicZoneXML), 0644))
+	return c
+}
+
+func TestConfigClient_Zones(t *testing.T) {
+	ctx := context.Background()
+	c := setup(t)
+
+	names, err := c.GetZoneNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"public"}, names)
+
+	settings, err := c.GetZoneSettings(ctx, "public")
+	require.NoError(t, err)
+	assert.Equal(t, firewalld.ZoneSettings{
+		Name:     "Public",
+		Target:   "default",
+		Services: []string{"ssh"},
+	}, settings)
+
+	_, err = c.GetZoneSettings(ctx, "internal")
+	assert.Equal(t, "INVALID_ZONE", firewalld.ErrorCode(err))
+	_, err = c.GetZoneSettings(ctx, "../zones/public")
+	assert.Equal(t, "INVALID_NAME", firewalld.ErrorCode(err))
+
+	t.Run("builtin zones are overridden in the config dir", func(t *testing.T) {
+		err := c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+			{Method: "addService", Args: []string{"http"}},
+		})
+		require.NoError(t, err)
+
+		path, err := c.GetZoneByName(ctx, "public")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(c.ConfigDir, "zones", "public.xml"), path)
+
+		settings, err := c.GetZoneSettings(ctx, "public")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ssh", "http"}, settings.Services)
+
+		err = c.ApplyZoneChanges(ctx, "public", []firewalld.ZoneChange{
+			{Method: "addPort", Args: []string{"80", "tcp"}},
+			{Method: "addService", Args: []string{"http"}},
+		})
+		var changeErr *firewalld.ZoneChangeError
+		require.True(t, errors.As(err, &changeErr))
+		assert.Equal(t, "ALREADY_ENABLED", firewalld.ErrorCode(err))
+
+		// nothing was written
+		settings, err = c.GetZoneSettings(ctx, "public")
+		require.NoError(t, err)
+		assert.Empty(t, settings.Ports)
+
+		// removing the override restores the default
+		require.NoError(t, c.RemoveZone(ctx, "public"))
+		settings, err = c.GetZoneSettings(ctx, "public")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ssh"}, settings.Services)
+
+		err = c.RemoveZone(ctx, "public")
+		assert.Equal(t, "BUILTIN_ZONE", firewalld.ErrorCode(err))
+	})
+
+	t.Run("add and remove", func(t *testing.T) {
+		err := c.AddZone(ctx, "public", firewalld.ZoneSettings{Target: "default"})
+		assert.Equal(t, "NAME_CONFLICT", firewalld.ErrorCode(err))
+
+		err = c.AddZone(ctx, "dmz", firewalld.ZoneSettings{Target: "invalid"})
+		var validationErr *firewalld.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+
+		dmz := firewalld.ZoneSettings{
+			Name:   "DMZ",
+			Target: "DROP",
+			Ports:  []firewalld.Port{{Port: "443", Protocol: "tcp"}},
+		}
+		require.NoError(t, c.AddZone(ctx, "dmz", dmz))
+
+		paths, err := c.ListZones(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(c.ConfigDir, "zones", "dmz.xml"),
+			filepath.Join(c.DefaultsDir, "zones", "public.xml"),
+		}, paths)
+
+		settings, err := c.GetZoneSettings(ctx, "dmz")
+		require.NoError(t, err)
+		assert.Equal(t, dmz, settings)
+
+		require.NoError(t, c.RemoveZone(ctx, "dmz"))
+		_, err = c.GetZoneSettings(ctx, "dmz")
+		assert.Equal(t, "INVALID_ZONE", firewalld.ErrorCode(err))
+	})
+}
+
+func TestConfigClient_Services(t *testing.T) {
+	ctx := context.Background()
+	c := setup(t)
+
+	names, err := c.GetServiceNames(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	service := firewalld.ServiceSettings{
+		Name:  "My App",
+		Ports: []firewalld.Port{{Port: "8080", Protocol: "tcp"}},
+	}
+	require.NoError(t, c.AddService(ctx, "myapp", service))
+
+	service.Ports = append(service.Ports, firewalld.Port{Port: "8443", Protocol: "tcp"})
+	require.NoError(t, c.UpdateService(ctx, "myapp", service))
+
+	settings, err := c.GetServiceSettings(ctx, "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, service, settings)
+
+	err = c.UpdateService(ctx, "other", service)
+	assert.Equal(t, "INVALID_SERVICE", firewalld.ErrorCode(err))
+
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(c.ConfigDir, "services", "broken.xml"), []byte("<service"), 0644))
+	_, err = c.GetServiceSettings(ctx, "broken")
+	assert.Equal(t, "INVALID_CONFIG", firewalld.ErrorCode(err))
+}
+
+func TestConfigClient_ICMPTypes(t *testing.T) {
+	ctx := context.Background()
+	c := setup(t)
+
+	icmptype := firewalld.ICMPTypeSettings{Name: "Echo Request", Destinations: []string{"ipv4"}}
+	require.NoError(t, c.AddICMPType(ctx, "echo-request", icmptype))
+	err := c.AddICMPType(ctx, "echo-request", icmptype)
+	assert.Equal(t, "NAME_CONFLICT", firewalld.ErrorCode(err))
+
+	icmptype.Destinations = append(icmptype.Destinations, "ipv6")
+	require.NoError(t, c.UpdateICMPType(ctx, "echo-request", icmptype))
+
+	names, err := c.GetICMPTypeNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo-request"}, names)
+	settings, err := c.GetICMPTypeSettings(ctx, "echo-request")
+	require.NoError(t, err)
+	assert.Equal(t, icmptype, settings)
+
+	require.NoError(t, c.RemoveICMPType(ctx, "echo-request"))
+	_, err = c.GetICMPTypeByName(ctx, "echo-request")
+	assert.Equal(t, "INVALID_ICMPTYPE", firewalld.ErrorCode(err))
+}
+
+func TestConfigClient_Global(t *testing.T) {
+	ctx := context.Background()
+	c := setup(t)
+
+	direct, err := c.GetDirectSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, firewalld.DirectSettings{}, direct)
+	direct.Chains = []firewalld.DirectChain{{IPV: "ipv4", Table: "filter", Chain: "custom"}}
+	require.NoError(t, c.UpdateDirectSettings(ctx, direct))
+	direct, err = c.GetDirectSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", direct.Chains[0].Chain)
+
+	whitelist := firewalld.LockdownWhitelist{Users: []string{"root"}, UIDs: []int{0}}
+	require.NoError(t, c.SetLockdownWhitelist(ctx, whitelist))
+	got, err := c.GetLockdownWhitelist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, whitelist, got)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(c.ConfigDir, "firewalld.conf"),
+		[]byte("# firewalld config file\nDefaultZone=public\nMinimalMark=200\n"), 0644))
+	properties, err := c.GetProperties(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "public", properties["DefaultZone"].Value())
+	assert.Equal(t, int32(200), properties["MinimalMark"].Value())
+	assert.Equal(t, "off", properties["LogDenied"].Value())
+
+	require.NoError(t, c.SetProperty(ctx, "LogDenied", "all"))
+	err = c.SetProperty(ctx, "MinimalMark", "300")
+	assert.Equal(t, "INVALID_VALUE", firewalld.ErrorCode(err))
+	err = c.SetProperty(ctx, "DefaultZone", "internal")
+	assert.Equal(t, "INVALID_ZONE", firewalld.ErrorCode(err))
+
+	conf, err := ioutil.ReadFile(filepath.Join(c.ConfigDir, "firewalld.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "# firewalld config file\nDefaultZone=public\nMinimalMark=200\nLogDenied=all\n", string(conf))
+}
+
+func TestConfigClient_Exposures(t *testing.T) {
+	ctx := context.Background()
+	c := setup(t)
+	require.NoError(t, c.AddService(ctx, "ssh", firewalld.ServiceSettings{
+		Ports: []firewalld.Port{{Port: "22", Protocol: "tcp"}},
+	}))
+	require.NoError(t, c.AddZone(ctx, "internal", firewalld.ZoneSettings{
+		Target:     "default",
+		Interfaces: []string{"eth1"},
+		Ports:      []firewalld.Port{{Port: "22", Protocol: "tcp"}},
+	}))
+	require.NoError(t, c.SetProperty(ctx, "DefaultZone", "internal"))
+
+	exposures, err := c.Exposures(ctx, firewalld.ExposureQuery{Service: "ssh"})
+	require.NoError(t, err)
+	assert.Equal(t, []firewalld.Exposure{
+		{Zone: "internal", Default: true, Interfaces: []string{"eth1"}, Rule: "port 22/tcp"},
+		{Zone: "public", Rule: "service ssh"},
+	}, exposures)
+}
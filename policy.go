@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// PolicySettings of a firewalld policy.
+// Policies are available since firewalld 0.9.
+type PolicySettings struct {
+	Version      string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Name         string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Description  string        `json:"description,omitempty" yaml:"description,omitempty"`
+	Target       string        `json:"target,omitempty" yaml:"target,omitempty"`
+	Priority     int           `json:"priority" yaml:"priority"`
+	IngressZones []string      `json:"ingressZones,omitempty" yaml:"ingressZones,omitempty"`
+	EgressZones  []string      `json:"egressZones,omitempty" yaml:"egressZones,omitempty"`
+	Services     []string      `json:"services,omitempty" yaml:"services,omitempty"`
+	Ports        []Port        `json:"ports,omitempty" yaml:"ports,omitempty"`
+	ICMPBlocks   []string      `json:"icmpBlocks,omitempty" yaml:"icmpBlocks,omitempty"`
+	Masquerade   bool          `json:"masquerade,omitempty" yaml:"masquerade,omitempty"`
+	ForwardPorts []ForwardPort `json:"forwardPorts,omitempty" yaml:"forwardPorts,omitempty"`
+	RichRules    []string      `json:"richRules,omitempty" yaml:"richRules,omitempty"`
+	Protocols    []string      `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	SourcePorts  []Port        `json:"sourcePorts,omitempty" yaml:"sourcePorts,omitempty"`
+}
+
+// PolicySettingsFromMap decodes the policy settings dictionary returned by firewalld.
+// Missing keys are left empty.
+func PolicySettingsFromMap(m map[string]dbus.Variant) (PolicySettings, error) {
+	value := func(key string) interface{} {
+		v, ok := m[key]
+		if !ok {
+			return nil
+		}
+		return v.Value()
+	}
+
+	d := &decoder{kind: "policy settings"}
+	// ToMap sends empty lists for unset values, they are decoded as nil again.
+	list := func(field, key string) []string {
+		if s := d.strings(field, value(key)); len(s) > 0 {
+			return s
+		}
+		return nil
+	}
+	settings := PolicySettings{
+		Version:      d.string("Version", value("version")),
+		Name:         d.string("Name", value("short")),
+		Description:  d.string("Description", value("description")),
+		Target:       d.string("Target", value("target")),
+		Priority:     d.int("Priority", value("priority")),
+		IngressZones: list("IngressZones", "ingress_zones"),
+		EgressZones:  list("EgressZones", "egress_zones"),
+		Services:     list("Services", "services"),
+		Ports:        d.ports("Ports", value("ports")),
+		ICMPBlocks:   list("ICMPBlocks", "icmp_blocks"),
+		Masquerade:   d.bool("Masquerade", value("masquerade")),
+		ForwardPorts: d.forwardPorts("ForwardPorts", value("forward_ports")),
+		RichRules:    list("RichRules", "rich_rules"),
+		Protocols:    list("Protocols", "protocols"),
+		SourcePorts:  d.ports("SourcePorts", value("source_ports")),
+	}
+	if d.err != nil {
+		return PolicySettings{}, d.err
+	}
+	return settings, nil
+}
+
+// ToMap encodes the settings as dictionary for firewalld.
+// Every key is present, with an empty value if unset, because firewalld only
+// changes the keys it receives and would otherwise keep e.g. a removed last service.
+func (p *PolicySettings) ToMap() map[string]dbus.Variant {
+	list := func(values []string) []string {
+		if values == nil {
+			return []string{}
+		}
+		return values
+	}
+	ports := func(values []Port) []portStruct {
+		if len(values) == 0 {
+			return []portStruct{}
+		}
+		return portsToStructs(values)
+	}
+	forwardPorts := forwardPortsToStructs(p.ForwardPorts)
+	if forwardPorts == nil {
+		forwardPorts = []forwardPortStruct{}
+	}
+
+	return map[string]dbus.Variant{
+		"version":       dbus.MakeVariant(p.Version),
+		"short":         dbus.MakeVariant(p.Name),
+		"description":   dbus.MakeVariant(p.Description),
+		"target":        dbus.MakeVariant(p.Target),
+		"priority":      dbus.MakeVariant(int32(p.Priority)),
+		"masquerade":    dbus.MakeVariant(p.Masquerade),
+		"ingress_zones": dbus.MakeVariant(list(p.IngressZones)),
+		"egress_zones":  dbus.MakeVariant(list(p.EgressZones)),
+		"services":      dbus.MakeVariant(list(p.Services)),
+		"icmp_blocks":   dbus.MakeVariant(list(p.ICMPBlocks)),
+		"rich_rules":    dbus.MakeVariant(list(p.RichRules)),
+		"protocols":     dbus.MakeVariant(list(p.Protocols)),
+		"ports":         dbus.MakeVariant(ports(p.Ports)),
+		"source_ports":  dbus.MakeVariant(ports(p.SourcePorts)),
+		"forward_ports": dbus.MakeVariant(forwardPorts),
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xmlPolicy is the layout of a firewalld policy file, see firewalld.policy(5).
+type xmlPolicy struct {
+	Version      string           `xml:"version,attr,omitempty"`
+	Target       string           `xml:"target,attr,omitempty"`
+	Priority     *int             `xml:"priority,attr"`
+	Short        string           `xml:"short,omitempty"`
+	Description  string           `xml:"description,omitempty"`
+	IngressZones []xmlName        `xml:"ingress-zone"`
+	EgressZones  []xmlName        `xml:"egress-zone"`
+	Services     []xmlName        `xml:"service"`
+	Ports        []xmlPort        `xml:"port"`
+	Protocols    []xmlValue       `xml:"protocol"`
+	ICMPBlocks   []xmlName        `xml:"icmp-block"`
+	Masquerade   *xmlFlag         `xml:"masquerade"`
+	ForwardPorts []xmlForwardPort `xml:"forward-port"`
+	SourcePorts  []xmlPort        `xml:"source-port"`
+	Rules        []xmlRule        `xml:"rule"`
+}
+
+// Defaults of policy files without target or priority attribute.
+const (
+	defaultPolicyTarget   = "CONTINUE"
+	defaultPolicyPriority = -1
+)
+
+// MarshalXML encodes the policy in firewalld policy file format.
+func (p PolicySettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	priority := p.Priority
+	x := xmlPolicy{
+		Version:      p.Version,
+		Target:       p.Target,
+		Priority:     &priority,
+		Short:        p.Name,
+		Description:  p.Description,
+		IngressZones: xmlNames(p.IngressZones),
+		EgressZones:  xmlNames(p.EgressZones),
+		Services:     xmlNames(p.Services),
+		Ports:        xmlPorts(p.Ports),
+		Protocols:    xmlValues(p.Protocols),
+		ICMPBlocks:   xmlNames(p.ICMPBlocks),
+		Masquerade:   newXMLFlag(p.Masquerade),
+		ForwardPorts: xmlForwardPorts(p.ForwardPorts),
+		SourcePorts:  xmlPorts(p.SourcePorts),
+	}
+	rules, err := xmlRichRules(p.RichRules)
+	if err != nil {
+		return err
+	}
+	x.Rules = rules
+
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "policy"}})
+}
+
+// UnmarshalXML decodes a policy from firewalld policy file format.
+// Rich rules are converted to canonical form.
+func (p *PolicySettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "policy"); err != nil {
+		return err
+	}
+	var x xmlPolicy
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*p = PolicySettings{
+		Version:      x.Version,
+		Name:         x.Short,
+		Description:  x.Description,
+		Target:       x.Target,
+		Priority:     defaultPolicyPriority,
+		IngressZones: namesFromXML(x.IngressZones),
+		EgressZones:  namesFromXML(x.EgressZones),
+		Services:     namesFromXML(x.Services),
+		Ports:        portsFromXML(x.Ports),
+		ICMPBlocks:   namesFromXML(x.ICMPBlocks),
+		Masquerade:   x.Masquerade != nil,
+		ForwardPorts: forwardPortsFromXML(x.ForwardPorts),
+		RichRules:    richRulesFromXML(x.Rules),
+		Protocols:    valuesFromXML(x.Protocols),
+		SourcePorts:  portsFromXML(x.SourcePorts),
+	}
+	if len(p.Target) == 0 {
+		p.Target = defaultPolicyTarget
+	}
+	if x.Priority != nil {
+		p.Priority = *x.Priority
+	}
+	return nil
+}
+
+// ReadPolicyXML reads a policy from a firewalld policy file, e.g. /etc/firewalld/policies/allow-host-ipv6.xml.
+func ReadPolicyXML(r io.Reader) (PolicySettings, error) {
+	var p PolicySettings
+	if err := xml.NewDecoder(r).Decode(&p); err != nil {
+		return PolicySettings{}, err
+	}
+	return p, nil
+}
+
+// WritePolicyXML writes the policy in firewalld policy file format.
+func WritePolicyXML(w io.Writer, p PolicySettings) error {
+	return writeXML(w, p)
+}
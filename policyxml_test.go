@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<policy target="CONTINUE">
+  <short>Allow host IPv6</short>
+  <ingress-zone name="ANY"/>
+  <egress-zone name="HOST"/>
+  <rule family="ipv6">
+    <icmp-type name="neighbour-advertisement"/>
+    <accept/>
+  </rule>
+</policy>
+`
+	p, err := ReadPolicyXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, PolicySettings{
+		Name:         "Allow host IPv6",
+		Target:       "CONTINUE",
+		Priority:     -1,
+		IngressZones: []string{"ANY"},
+		EgressZones:  []string{"HOST"},
+		RichRules: []string{
+			`rule family="ipv6" icmp-type name="neighbour-advertisement" accept`,
+		},
+	}, p)
+
+	p.Priority = 0
+	var buf bytes.Buffer
+	require.NoError(t, WritePolicyXML(&buf, p))
+	assert.Contains(t, buf.String(), `<policy target="CONTINUE" priority="0">`)
+
+	roundTrip, err := ReadPolicyXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, p, roundTrip)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortRange is a single port or an inclusive range of ports.
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+// ParsePortRange parses a port ("80") or port range ("8000-8100").
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	from, err := parsePortNumber(parts[0])
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = parsePortNumber(parts[1])
+		if err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+		}
+	}
+	if from > to {
+		return PortRange{}, fmt.Errorf("invalid port range %q: start is after end", s)
+	}
+	return PortRange{From: from, To: to}, nil
+}
+
+func parsePortNumber(s string) (uint16, error) {
+	i, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("not a number between 1 and 65535")
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("port 0 is not allowed")
+	}
+	return uint16(i), nil
+}
+
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(int(r.From))
+	}
+	return strconv.Itoa(int(r.From)) + "-" + strconv.Itoa(int(r.To))
+}
+
+// ContainsPort returns true if port is within the range.
+func (r PortRange) ContainsPort(port uint16) bool {
+	return r.From <= port && port <= r.To
+}
+
+// Contains returns true if o is completely within r.
+func (r PortRange) Contains(o PortRange) bool {
+	return r.From <= o.From && o.To <= r.To
+}
+
+// Overlaps returns true if r and o have at least one port in common.
+func (r PortRange) Overlaps(o PortRange) bool {
+	return r.From <= o.To && o.From <= r.To
+}
+
+// ValidateProtocol checks for a protocol supported by firewalld port definitions.
+func ValidateProtocol(protocol string) error {
+	switch protocol {
+	case "tcp", "udp", "sctp", "dccp":
+		return nil
+	}
+	return fmt.Errorf("invalid protocol %q, expected tcp, udp, sctp or dccp", protocol)
+}
+
+// Range returns the parsed port range.
+func (p Port) Range() (PortRange, error) {
+	return ParsePortRange(p.Port)
+}
+
+// Validate checks port range and protocol.
+func (p Port) Validate() error {
+	if _, err := p.Range(); err != nil {
+		return err
+	}
+	return ValidateProtocol(p.Protocol)
+}
+
+// Overlaps returns true if both ports share a protocol and at least one port.
+// Invalid ports never overlap.
+func (p Port) Overlaps(o Port) bool {
+	pr, or, ok := p.ranges(o)
+	return ok && pr.Overlaps(or)
+}
+
+// Contains returns true if o is completely covered by p.
+// Invalid ports are never contained.
+func (p Port) Contains(o Port) bool {
+	pr, or, ok := p.ranges(o)
+	return ok && pr.Contains(or)
+}
+
+func (p Port) ranges(o Port) (PortRange, PortRange, bool) {
+	if p.Protocol != o.Protocol {
+		return PortRange{}, PortRange{}, false
+	}
+	pr, err := p.Range()
+	if err != nil {
+		return PortRange{}, PortRange{}, false
+	}
+	or, err := o.Range()
+	if err != nil {
+		return PortRange{}, PortRange{}, false
+	}
+	return pr, or, true
+}
+
+// Validate checks ports, protocol and destination of the forward port.
+func (p ForwardPort) Validate() error {
+	if err := (Port{Port: p.Port, Protocol: p.Protocol}).Validate(); err != nil {
+		return err
+	}
+	if len(p.ToPort) == 0 && len(p.ToAddress) == 0 {
+		return fmt.Errorf("forward port %s needs to-port or to-addr", p.Port)
+	}
+	if len(p.ToPort) > 0 {
+		if _, err := ParsePortRange(p.ToPort); err != nil {
+			return fmt.Errorf("to-port: %w", err)
+		}
+	}
+	if len(p.ToAddress) > 0 && net.ParseIP(p.ToAddress) == nil {
+		return fmt.Errorf("invalid to-addr %q", p.ToAddress)
+	}
+	return nil
+}
+
+// MergePorts merges overlapping and adjacent port ranges of the same protocol.
+// The result is sorted by protocol and port, invalid ports are kept unchanged at the end.
+func MergePorts(ports []Port) []Port {
+	byProtocol := map[string][]PortRange{}
+	var invalid []Port
+	for _, p := range ports {
+		r, err := p.Range()
+		if err != nil {
+			invalid = append(invalid, p)
+			continue
+		}
+		byProtocol[p.Protocol] = append(byProtocol[p.Protocol], r)
+	}
+
+	protocols := make([]string, 0, len(byProtocol))
+	for protocol := range byProtocol {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	var out []Port
+	for _, protocol := range protocols {
+		for _, r := range mergePortRanges(byProtocol[protocol]) {
+			out = append(out, Port{Port: r.String(), Protocol: protocol})
+		}
+	}
+	return append(out, invalid...)
+}
+
+func mergePortRanges(ranges []PortRange) []PortRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From < ranges[j].From
+	})
+
+	var out []PortRange
+	for _, r := range ranges {
+		if len(out) > 0 {
+			last := &out[len(out)-1]
+			// overlapping or adjacent
+			if uint32(r.From) <= uint32(last.To)+1 {
+				if r.To > last.To {
+					last.To = r.To
+				}
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// MergePorts merges overlapping and adjacent ranges of Ports and SourcePorts.
+func (z *ZoneSettings) MergePorts() {
+	if len(z.Ports) > 0 {
+		z.Ports = MergePorts(z.Ports)
+	}
+	if len(z.SourcePorts) > 0 {
+		z.SourcePorts = MergePorts(z.SourcePorts)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected PortRange
+	}{
+		{in: "80", expected: PortRange{From: 80, To: 80}},
+		{in: "8000-8100", expected: PortRange{From: 8000, To: 8100}},
+		{in: "1-65535", expected: PortRange{From: 1, To: 65535}},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			r, err := ParsePortRange(test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, r)
+			assert.Equal(t, test.in, r.String())
+		})
+	}
+
+	for _, in := range []string{"", "0", "65536", "ssh", "100-10", "1-2-3", "-5"} {
+		t.Run(in, func(t *testing.T) {
+			_, err := ParsePortRange(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPortRange(t *testing.T) {
+	r := PortRange{From: 8000, To: 8100}
+	assert.True(t, r.ContainsPort(8000))
+	assert.False(t, r.ContainsPort(8101))
+	assert.True(t, r.Contains(PortRange{From: 8050, To: 8100}))
+	assert.False(t, r.Contains(PortRange{From: 7999, To: 8000}))
+	assert.True(t, r.Overlaps(PortRange{From: 7999, To: 8000}))
+	assert.False(t, r.Overlaps(PortRange{From: 8101, To: 8200}))
+}
+
+func TestPort(t *testing.T) {
+	assert.NoError(t, Port{Port: "8000-8100", Protocol: "sctp"}.Validate())
+	assert.Error(t, Port{Port: "8000-8100", Protocol: "icmp"}.Validate())
+	assert.Error(t, Port{Port: "http", Protocol: "tcp"}.Validate())
+
+	wide := Port{Port: "8000-8100", Protocol: "tcp"}
+	assert.True(t, wide.Contains(Port{Port: "8080", Protocol: "tcp"}))
+	assert.False(t, wide.Contains(Port{Port: "8080", Protocol: "udp"}))
+	assert.True(t, wide.Overlaps(Port{Port: "7000-8000", Protocol: "tcp"}))
+	assert.False(t, wide.Overlaps(Port{Port: "invalid", Protocol: "tcp"}))
+}
+
+func TestForwardPort_Validate(t *testing.T) {
+	assert.NoError(t, ForwardPort{
+		Port: "80", Protocol: "tcp", ToPort: "8080"}.Validate())
+	assert.NoError(t, ForwardPort{
+		Port: "80-81", Protocol: "udp", ToAddress: "2001:db8::1"}.Validate())
+	assert.Error(t, ForwardPort{
+		Port: "80", Protocol: "tcp"}.Validate())
+	assert.Error(t, ForwardPort{
+		Port: "80", Protocol: "tcp", ToPort: "0"}.Validate())
+	assert.Error(t, ForwardPort{
+		Port: "80", Protocol: "tcp", ToAddress: "example.com"}.Validate())
+}
+
+func TestMergePorts(t *testing.T) {
+	z := ZoneSettings{
+		Ports: []Port{
+			{Port: "8050-8200", Protocol: "tcp"},
+			{Port: "22", Protocol: "tcp"},
+			{Port: "8000-8100", Protocol: "tcp"},
+			{Port: "53", Protocol: "udp"},
+			{Port: "bogus", Protocol: "tcp"},
+			{Port: "8201", Protocol: "tcp"},
+			{Port: "54-60", Protocol: "udp"},
+			{Port: "8080", Protocol: "udp"},
+		},
+	}
+	z.MergePorts()
+
+	assert.Equal(t, []Port{
+		{Port: "22", Protocol: "tcp"},
+		{Port: "8000-8201", Protocol: "tcp"},
+		{Port: "53-60", Protocol: "udp"},
+		{Port: "8080", Protocol: "udp"},
+		{Port: "bogus", Protocol: "tcp"},
+	}, z.Ports)
+	assert.Nil(t, z.SourcePorts)
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// State is the desired permanent configuration of firewalld.
+// A nil map leaves objects of that kind unmanaged,
+// an empty map removes all objects of that kind that are not builtin.
+type State struct {
+	// Default zone, empty leaves the default zone unchanged.
+	DefaultZone string                      `json:"defaultZone,omitempty" yaml:"defaultZone,omitempty"`
+	Zones       map[string]ZoneSettings     `json:"zones" yaml:"zones"`
+	Services    map[string]ServiceSettings  `json:"services" yaml:"services"`
+	IPSets      map[string]IPSetSettings    `json:"ipsets" yaml:"ipsets"`
+	ICMPTypes   map[string]ICMPTypeSettings `json:"icmptypes" yaml:"icmptypes"`
+	Policies    map[string]PolicySettings   `json:"policies" yaml:"policies"`
+	Helpers     map[string]HelperSettings   `json:"helpers" yaml:"helpers"`
+}
+
+// Action performed by an Operation.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Operation is a single change to the permanent configuration.
+type Operation struct {
+	Action Action `json:"action"`
+	// Object kind: ipset, icmptype, helper, service, zone, policy or default-zone.
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Granular changes of a zone update.
+	ZoneChanges []ZoneChange `json:"zoneChanges,omitempty"`
+	// Desired settings for create and update operations.
+	Settings interface{} `json:"settings,omitempty"`
+}
+
+func (o Operation) String() string {
+	s := string(o.Action) + " " + o.Kind + " " + o.Name
+	if len(o.ZoneChanges) == 0 {
+		return s
+	}
+	var changes []string
+	for _, c := range o.ZoneChanges {
+		changes = append(changes, c.String())
+	}
+	return s + ": " + strings.Join(changes, ", ")
+}
+
+// ReconcileReport lists the operations performed by Reconcile.
+type ReconcileReport struct {
+	Operations []Operation
+}
+
+// Reconcile brings the permanent configuration in line with the desired state.
+// It is a shortcut for Plan followed by Apply.
+// On error the report contains all operations that have been applied successfully.
+func (c *Client) Reconcile(ctx context.Context, desired State) (*ReconcileReport, error) {
+	plan, err := c.Plan(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	return c.Apply(ctx, plan)
+}
+
+// Plan lists the operations needed to reach a desired state.
+type Plan struct {
+	Operations []Operation `json:"operations"`
+}
+
+// Empty returns true if the configuration already matches the desired state.
+func (p *Plan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// String formats the plan for human review.
+// Operations are listed one per line, prefixed with "+" for create, "~" for update and "-" for delete.
+// Granular zone changes are listed indented below their zone.
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "no changes"
+	}
+
+	var b strings.Builder
+	for _, op := range p.Operations {
+		switch op.Action {
+		case ActionCreate:
+			b.WriteString("+ ")
+		case ActionUpdate:
+			b.WriteString("~ ")
+		case ActionDelete:
+			b.WriteString("- ")
+		}
+		b.WriteString(string(op.Action) + " " + op.Kind + " " + op.Name + "\n")
+		for _, change := range op.ZoneChanges {
+			b.WriteString("    " + change.String() + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Apply performs the operations of a plan in order.
+// The plan should be recent, as Apply does not check whether the configuration changed since planning.
+// On error the report contains all operations that have been applied successfully.
+func (c *Client) Apply(ctx context.Context, plan *Plan) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+	for _, op := range plan.Operations {
+		if err := c.applyOperation(ctx, op); err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+		report.Operations = append(report.Operations, op)
+	}
+	return report, nil
+}
+
+// reconcileKind compares desired and current objects of one kind.
+type reconcileKind struct {
+	kind string
+	// config interface of the object, used to query the builtin property.
+	iface string
+	// nil if objects of this kind are unmanaged.
+	desired map[string]interface{}
+	names   func(ctx context.Context) ([]string, error)
+	path    func(ctx context.Context, name string) (string, error)
+	// returns an update operation or nil if the object is up to date.
+	update func(ctx context.Context, name string, desired interface{}) (*Operation, error)
+}
+
+func (c *Client) reconcileKinds(desired State) []reconcileKind {
+	return []reconcileKind{
+		{
+			kind:    "ipset",
+			iface:   "org.fedoraproject.FirewallD1.config.ipset",
+			desired: settingsMap(desired.IPSets),
+			names:   c.config.GetIPSetNames,
+			path:    c.config.GetIPSetByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetIPSetSettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				return updateIfChanged("ipset", name, desired,
+					current.driftFields(), desired.(IPSetSettings).driftFields()), nil
+			},
+		},
+		{
+			kind:    "icmptype",
+			iface:   "org.fedoraproject.FirewallD1.config.icmptype",
+			desired: settingsMap(desired.ICMPTypes),
+			names:   c.config.GetICMPTypeNames,
+			path:    c.config.GetICMPTypeByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetICMPTypeSettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				return updateIfChanged("icmptype", name, desired,
+					current.driftFields(), desired.(ICMPTypeSettings).driftFields()), nil
+			},
+		},
+		{
+			kind:    "helper",
+			iface:   "org.fedoraproject.FirewallD1.config.helper",
+			desired: settingsMap(desired.Helpers),
+			names:   c.config.GetHelperNames,
+			path:    c.config.GetHelperByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetHelperSettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				return updateIfChanged("helper", name, desired,
+					current.driftFields(), desired.(HelperSettings).driftFields()), nil
+			},
+		},
+		{
+			kind:    "service",
+			iface:   "org.fedoraproject.FirewallD1.config.service",
+			desired: settingsMap(desired.Services),
+			names:   c.config.GetServiceNames,
+			path:    c.config.GetServiceByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetServiceSettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				return updateIfChanged("service", name, desired,
+					current.driftFields(), desired.(ServiceSettings).driftFields()), nil
+			},
+		},
+		{
+			kind:    "zone",
+			iface:   configZoneInterface,
+			desired: settingsMap(desired.Zones),
+			names:   c.config.GetZoneNames,
+			path:    c.config.GetZoneByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetZoneSettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				changes := DiffZoneSettings(current, desired.(ZoneSettings)).Changes()
+				if len(changes) == 0 {
+					return nil, nil
+				}
+				return &Operation{
+					Action: ActionUpdate, Kind: "zone", Name: name,
+					ZoneChanges: changes, Settings: desired,
+				}, nil
+			},
+		},
+		{
+			kind:    "policy",
+			iface:   "org.fedoraproject.FirewallD1.config.policy",
+			desired: settingsMap(desired.Policies),
+			names:   c.config.GetPolicyNames,
+			path:    c.config.GetPolicyByName,
+			update: func(ctx context.Context, name string, desired interface{}) (*Operation, error) {
+				current, err := c.config.GetPolicySettings(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				return updateIfChanged("policy", name, desired,
+					current.driftFields(), desired.(PolicySettings).driftFields()), nil
+			},
+		},
+	}
+}
+
+// Plan returns the ordered list of operations to reach the desired state, without changing anything.
+// Objects are created and updated in dependency order (ipsets, icmptypes, helpers and services before zones, zones before policies)
+// and deleted in reverse order. Builtin objects are never deleted.
+func (c *Client) Plan(ctx context.Context, desired State) (*Plan, error) {
+	var (
+		upserts []Operation
+		deletes []Operation
+	)
+	for _, k := range c.reconcileKinds(desired) {
+		if k.desired == nil {
+			continue
+		}
+
+		names, err := k.names(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", k.kind, err)
+		}
+		existing := stringSet(names)
+
+		for _, name := range sortedKeys(k.desired) {
+			settings := k.desired[name]
+			if !existing[name] {
+				upserts = append(upserts, Operation{
+					Action: ActionCreate, Kind: k.kind, Name: name, Settings: settings})
+				continue
+			}
+
+			op, err := k.update(ctx, name, settings)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, name, err)
+			}
+			if op != nil {
+				upserts = append(upserts, *op)
+			}
+		}
+
+		var kindDeletes []Operation
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := k.desired[name]; ok {
+				continue
+			}
+			path, err := k.path(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, name, err)
+			}
+			builtin, err := c.config.isBuiltin(ctx, path, k.iface)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, name, err)
+			}
+			if builtin {
+				continue
+			}
+			kindDeletes = append(kindDeletes, Operation{
+				Action: ActionDelete, Kind: k.kind, Name: name})
+		}
+		// delete dependent kinds first
+		deletes = append(kindDeletes, deletes...)
+	}
+
+	if len(desired.DefaultZone) > 0 {
+		current, err := c.GetDefaultZone(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get default zone: %w", err)
+		}
+		if current != desired.DefaultZone {
+			upserts = append(upserts, Operation{
+				Action: ActionUpdate, Kind: "default-zone", Name: desired.DefaultZone})
+		}
+	}
+	return &Plan{Operations: append(upserts, deletes...)}, nil
+}
+
+func (c *Client) applyOperation(ctx context.Context, op Operation) error {
+	cc := c.config
+	switch op.Kind + "/" + string(op.Action) {
+	case "ipset/create":
+		return cc.AddIPSet(ctx, op.Name, op.Settings.(IPSetSettings))
+	case "ipset/update":
+		return cc.UpdateIPSet(ctx, op.Name, op.Settings.(IPSetSettings))
+	case "ipset/delete":
+		return cc.RemoveIPSet(ctx, op.Name)
+	case "icmptype/create":
+		return cc.AddICMPType(ctx, op.Name, op.Settings.(ICMPTypeSettings))
+	case "icmptype/update":
+		return cc.UpdateICMPType(ctx, op.Name, op.Settings.(ICMPTypeSettings))
+	case "icmptype/delete":
+		return cc.RemoveICMPType(ctx, op.Name)
+	case "helper/create":
+		return cc.AddHelper(ctx, op.Name, op.Settings.(HelperSettings))
+	case "helper/update":
+		return cc.UpdateHelper(ctx, op.Name, op.Settings.(HelperSettings))
+	case "helper/delete":
+		return cc.RemoveHelper(ctx, op.Name)
+	case "service/create":
+		return cc.AddService(ctx, op.Name, op.Settings.(ServiceSettings))
+	case "service/update":
+		return cc.UpdateService(ctx, op.Name, op.Settings.(ServiceSettings))
+	case "service/delete":
+		return cc.RemoveService(ctx, op.Name)
+	case "zone/create":
+		return cc.AddZone(ctx, op.Name, op.Settings.(ZoneSettings))
+	case "zone/update":
+		return cc.ApplyZoneChanges(ctx, op.Name, op.ZoneChanges)
+	case "zone/delete":
+		return cc.RemoveZone(ctx, op.Name)
+	case "policy/create":
+		return cc.AddPolicy(ctx, op.Name, op.Settings.(PolicySettings))
+	case "policy/update":
+		return cc.UpdatePolicy(ctx, op.Name, op.Settings.(PolicySettings))
+	case "policy/delete":
+		return cc.RemovePolicy(ctx, op.Name)
+	case "default-zone/update":
+		return c.SetDefaultZone(ctx, op.Name)
+	}
+	return fmt.Errorf("unsupported operation %q", op)
+}
+
+func updateIfChanged(
+	kind, name string, desired interface{}, current, wanted []driftField,
+) *Operation {
+	if len(compareDriftFields(kind, name, current, wanted)) == 0 {
+		return nil
+	}
+	return &Operation{
+		Action: ActionUpdate, Kind: kind, Name: name, Settings: desired}
+}
+
+// sortedKeys returns the sorted keys of a map with string keys, e.g. State.Zones.
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settingsMap converts a map of settings by name, e.g. State.Zones, to a map of interface values.
+// A nil map stays nil.
+func settingsMap(m interface{}) map[string]interface{} {
+	v := reflect.ValueOf(m)
+	if v.IsNil() {
+		return nil
+	}
+	out := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		out[iter.Key().String()] = iter.Value().Interface()
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// reconcileSetup returns a client for a firewalld with the zone "public",
+// the builtin service "ssh" and the custom service "custom".
+// Only read-only methods are set up, so mutating calls make the mocks panic.
+func reconcileSetup() (
+	c *Client, configPathCaller, zoneCaller, customCaller *callerMock,
+) {
+	const (
+		publicPath        = "/org/fedoraproject/FirewallD1/config/zone/0"
+		sshServicePath    = "/org/fedoraproject/FirewallD1/config/service/0"
+		customServicePath = "/org/fedoraproject/FirewallD1/config/service/1"
+	)
+
+	mainCaller := &callerMock{}
+	onMethod(mainCaller, getDefaultZoneMethod, "public")
+
+	configPathCaller = &callerMock{}
+	onMethod(configPathCaller, configGetIPSetNamesMethod, []string{})
+	onMethod(configPathCaller, configGetServiceNamesMethod, []string{"custom", "ssh"})
+	onMethod(configPathCaller, configGetZoneNamesMethod, []string{"public"})
+	onMethodWithArgs(configPathCaller, configGetZoneByNameMethod,
+		[]interface{}{"public"}, publicPath)
+	onMethodWithArgs(configPathCaller, configGetServiceByNameMethod,
+		[]interface{}{"ssh"}, sshServicePath)
+	onMethodWithArgs(configPathCaller, configGetServiceByNameMethod,
+		[]interface{}{"custom"}, customServicePath)
+
+	publicZone := ZoneSettings{
+		Target:   "default",
+		Services: []string{"ssh"},
+	}
+	zoneCaller = &callerMock{}
+	onMethod(zoneCaller, configZoneGetSettingsMethod, publicZone.ToSlice())
+
+	sshCaller := &callerMock{}
+	onMethod(sshCaller, getPropertyMethod, true)
+	customCaller = &callerMock{}
+	onMethod(customCaller, getPropertyMethod, false)
+
+	conn := &connectionMock{}
+	conn.On("Object", dbusDest, mainPath).Return(mainCaller)
+	conn.On("Object", dbusDest, configPath).Return(configPathCaller)
+	conn.On("Object", dbusDest, publicPath).Return(zoneCaller)
+	conn.On("Object", dbusDest, sshServicePath).Return(sshCaller)
+	conn.On("Object", dbusDest, customServicePath).Return(customCaller)
+	c = NewClient(conn)
+	return
+}
+
+var (
+	reconcileDesiredPublic = ZoneSettings{
+		Target:   "default",
+		Services: []string{"ssh"},
+		Ports:    []Port{{Port: "8080", Protocol: "tcp"}},
+	}
+	reconcileDesiredBlocklist = IPSetSettings{Type: "hash:ip"}
+	reconcileDesiredState     = State{
+		DefaultZone: "public",
+		Zones:       map[string]ZoneSettings{"public": reconcileDesiredPublic},
+		Services:    map[string]ServiceSettings{},
+		IPSets:      map[string]IPSetSettings{"blocklist": reconcileDesiredBlocklist},
+	}
+	reconcileExpectedOperations = []Operation{
+		{
+			Action: ActionCreate, Kind: "ipset", Name: "blocklist",
+			Settings: reconcileDesiredBlocklist,
+		},
+		{
+			Action: ActionUpdate, Kind: "zone", Name: "public",
+			ZoneChanges: []ZoneChange{
+				{Method: "addPort", Args: []string{"8080", "tcp"}},
+			},
+			Settings: reconcileDesiredPublic,
+		},
+		{Action: ActionDelete, Kind: "service", Name: "custom"},
+	}
+)
+
+func TestClient_Plan(t *testing.T) {
+	c, _, _, _ := reconcileSetup()
+
+	plan, err := c.Plan(context.Background(), reconcileDesiredState)
+	require.NoError(t, err)
+
+	assert.Equal(t, reconcileExpectedOperations, plan.Operations)
+	assert.Equal(t, `+ create ipset blocklist
+~ update zone public
+    addPort(8080, tcp)
+- delete service custom
+`, plan.String())
+
+	j, err := json.Marshal(plan)
+	require.NoError(t, err)
+	var decoded struct {
+		Operations []struct {
+			Action      string
+			Kind        string
+			Name        string
+			ZoneChanges []ZoneChange
+		}
+	}
+	require.NoError(t, json.Unmarshal(j, &decoded))
+	require.Len(t, decoded.Operations, 3)
+	assert.Equal(t, "update", decoded.Operations[1].Action)
+	assert.Equal(t, reconcileExpectedOperations[1].ZoneChanges,
+		decoded.Operations[1].ZoneChanges)
+
+	assert.Equal(t, "no changes", (&Plan{}).String())
+}
+
+func TestClient_Reconcile(t *testing.T) {
+	c, configPathCaller, zoneCaller, customCaller := reconcileSetup()
+	for _, m := range []*callerMock{configPathCaller, zoneCaller, customCaller} {
+		m.On("Call", mock.Anything, mock.Anything).Return(nil)
+	}
+
+	report, err := c.Reconcile(context.Background(), reconcileDesiredState)
+	require.NoError(t, err)
+
+	assert.Equal(t, reconcileExpectedOperations, report.Operations)
+
+	configPathCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method: addIPSetMethod,
+		Arguments: []interface{}{
+			"blocklist", reconcileDesiredBlocklist.toStruct()},
+		Returns: []interface{}{new(interface{})},
+	})
+	zoneCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    configZoneInterface + ".addPort",
+		Arguments: []interface{}{"8080", "tcp"},
+	})
+	customCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method: configServiceRemoveMethod,
+	})
+}
+
+func TestSortedKeys(t *testing.T) {
+	zones := map[string]ZoneSettings{"public": {}, "dmz": {}, "internal": {}}
+	assert.Equal(t, []string{"dmz", "internal", "public"}, sortedKeys(zones))
+	assert.Empty(t, sortedKeys(map[string]PolicySettings(nil)))
+
+	assert.Equal(t, map[string]interface{}{"dmz": ZoneSettings{}}, settingsMap(map[string]ZoneSettings{"dmz": {}}))
+	assert.Nil(t, settingsMap(map[string]ZoneSettings(nil)))
+	assert.NotNil(t, settingsMap(map[string]ZoneSettings{}))
+}
@@ -0,0 +1,771 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RichRule is a firewalld rich language rule.
+// See firewalld.richlanguage(5) for details.
+type RichRule struct {
+	// Address family: ipv4, ipv6 or empty for both.
+	Family string
+	// Rules with lower priority are evaluated first.
+	Priority    int
+	Source      *RichRuleAddress
+	Destination *RichRuleAddress
+
+	// Elements, a valid rule has at most one of them set.
+	Service     string
+	Port        *Port
+	Protocol    string
+	ICMPBlock   string
+	ICMPType    string
+	Masquerade  bool
+	ForwardPort *ForwardPort
+	SourcePort  *Port
+
+	Log    *RichRuleLog
+	NFLog  *RichRuleNFLog
+	Audit  *RichRuleAudit
+	Action *RichRuleAction
+}
+
+// RichRuleAddress matches the source or destination of a packet.
+// Exactly one of Address, MAC or IPSet should be set, MAC is only valid as source.
+type RichRuleAddress struct {
+	// Invert the match (NOT).
+	Invert  bool
+	Address string
+	MAC     string
+	IPSet   string
+}
+
+// RichRuleLimit rate limits logging or actions, e.g. "3/m".
+type RichRuleLimit struct {
+	// rate/duration, where duration is one of s, m, h or d.
+	Value string
+	Burst string
+}
+
+// RichRuleLog logs matching packets via kernel log.
+type RichRuleLog struct {
+	Prefix string
+	Level  string
+	Limit  *RichRuleLimit
+}
+
+// RichRuleNFLog logs matching packets via nflog.
+type RichRuleNFLog struct {
+	Group     string
+	Prefix    string
+	QueueSize string
+	Limit     *RichRuleLimit
+}
+
+// RichRuleAudit logs matching packets via auditd.
+type RichRuleAudit struct {
+	Limit *RichRuleLimit
+}
+
+// RichRuleActionType is the verdict of a rich rule.
+type RichRuleActionType string
+
+const (
+	RichRuleAccept RichRuleActionType = "accept"
+	RichRuleReject RichRuleActionType = "reject"
+	RichRuleDrop   RichRuleActionType = "drop"
+	RichRuleMark   RichRuleActionType = "mark"
+)
+
+// RichRuleAction is applied to matching packets.
+type RichRuleAction struct {
+	Type RichRuleActionType
+	// ICMP reject type, only for reject.
+	RejectType string
+	// mark[/mask], only for mark.
+	MarkSet string
+	Limit   *RichRuleLimit
+}
+
+// String returns the rule in canonical firewalld syntax.
+func (r RichRule) String() string {
+	var b strings.Builder
+	b.WriteString("rule")
+	if r.Priority != 0 {
+		writeAttr(&b, "priority", strconv.Itoa(r.Priority))
+	}
+	writeOptionalAttr(&b, "family", r.Family)
+	if r.Source != nil {
+		b.WriteString(" source")
+		r.Source.write(&b)
+	}
+	if r.Destination != nil {
+		b.WriteString(" destination")
+		r.Destination.write(&b)
+	}
+
+	if len(r.Service) > 0 {
+		b.WriteString(" service")
+		writeAttr(&b, "name", r.Service)
+	}
+	if r.Port != nil {
+		b.WriteString(" port")
+		writeAttr(&b, "port", r.Port.Port)
+		writeAttr(&b, "protocol", r.Port.Protocol)
+	}
+	if len(r.Protocol) > 0 {
+		b.WriteString(" protocol")
+		writeAttr(&b, "value", r.Protocol)
+	}
+	if len(r.ICMPBlock) > 0 {
+		b.WriteString(" icmp-block")
+		writeAttr(&b, "name", r.ICMPBlock)
+	}
+	if len(r.ICMPType) > 0 {
+		b.WriteString(" icmp-type")
+		writeAttr(&b, "name", r.ICMPType)
+	}
+	if r.Masquerade {
+		b.WriteString(" masquerade")
+	}
+	if r.ForwardPort != nil {
+		b.WriteString(" forward-port")
+		writeAttr(&b, "port", r.ForwardPort.Port)
+		writeAttr(&b, "protocol", r.ForwardPort.Protocol)
+		writeOptionalAttr(&b, "to-port", r.ForwardPort.ToPort)
+		writeOptionalAttr(&b, "to-addr", r.ForwardPort.ToAddress)
+	}
+	if r.SourcePort != nil {
+		b.WriteString(" source-port")
+		writeAttr(&b, "port", r.SourcePort.Port)
+		writeAttr(&b, "protocol", r.SourcePort.Protocol)
+	}
+
+	if r.Log != nil {
+		b.WriteString(" log")
+		writeOptionalAttr(&b, "prefix", r.Log.Prefix)
+		writeOptionalAttr(&b, "level", r.Log.Level)
+		r.Log.Limit.write(&b)
+	}
+	if r.NFLog != nil {
+		b.WriteString(" nflog")
+		writeOptionalAttr(&b, "group", r.NFLog.Group)
+		writeOptionalAttr(&b, "prefix", r.NFLog.Prefix)
+		writeOptionalAttr(&b, "queue-size", r.NFLog.QueueSize)
+		r.NFLog.Limit.write(&b)
+	}
+	if r.Audit != nil {
+		b.WriteString(" audit")
+		r.Audit.Limit.write(&b)
+	}
+	if r.Action != nil {
+		b.WriteString(" " + string(r.Action.Type))
+		switch r.Action.Type {
+		case RichRuleReject:
+			writeOptionalAttr(&b, "type", r.Action.RejectType)
+		case RichRuleMark:
+			writeAttr(&b, "set", r.Action.MarkSet)
+		}
+		r.Action.Limit.write(&b)
+	}
+	return b.String()
+}
+
+func (a *RichRuleAddress) write(b *strings.Builder) {
+	if a.Invert {
+		b.WriteString(" NOT")
+	}
+	switch {
+	case len(a.Address) > 0:
+		writeAttr(b, "address", a.Address)
+	case len(a.MAC) > 0:
+		writeAttr(b, "mac", a.MAC)
+	case len(a.IPSet) > 0:
+		writeAttr(b, "ipset", a.IPSet)
+	}
+}
+
+func (l *RichRuleLimit) write(b *strings.Builder) {
+	if l == nil {
+		return
+	}
+	b.WriteString(" limit")
+	writeAttr(b, "value", l.Value)
+	writeOptionalAttr(b, "burst", l.Burst)
+}
+
+// writeAttr quotes value with double quotes, or single quotes if it contains a double quote.
+func writeAttr(b *strings.Builder, key, value string) {
+	quote := `"`
+	if strings.Contains(value, `"`) {
+		quote = `'`
+	}
+	b.WriteString(" " + key + "=" + quote + value + quote)
+}
+
+func writeOptionalAttr(b *strings.Builder, key, value string) {
+	if len(value) > 0 {
+		writeAttr(b, key, value)
+	}
+}
+
+// ParseRichRule parses a rule in firewalld rich language syntax.
+// Only the syntax is checked, see RichRule.Validate for semantic checks.
+func ParseRichRule(s string) (RichRule, error) {
+	clauses, err := lexRichRule(s)
+	if err != nil {
+		return RichRule{}, err
+	}
+	if len(clauses) == 0 || clauses[0].word != "rule" {
+		return RichRule{}, fmt.Errorf("rich rule %q: must start with 'rule'", s)
+	}
+
+	p := &richRuleParser{}
+	for _, c := range clauses {
+		if err := p.clause(c); err != nil {
+			return RichRule{}, fmt.Errorf("rich rule %q: %w", s, err)
+		}
+	}
+	return p.rule, nil
+}
+
+// richRuleClause is a keyword with its attributes, e.g. `port port="80" protocol="tcp"`.
+type richRuleClause struct {
+	word   string
+	invert bool
+	attrs  map[string]string
+	// attribute keys in order of appearance.
+	keys []string
+}
+
+func (c richRuleClause) attr(key string) string {
+	return c.attrs[key]
+}
+
+// lexRichRule splits a rule into clauses.
+func lexRichRule(s string) ([]richRuleClause, error) {
+	var clauses []richRuleClause
+	rest := strings.TrimSpace(s)
+	for len(rest) > 0 {
+		token, tail, err := nextRichRuleToken(rest)
+		if err != nil {
+			return nil, fmt.Errorf("rich rule %q: %w", s, err)
+		}
+		rest = strings.TrimSpace(tail)
+
+		eq := strings.Index(token.raw, "=")
+		switch {
+		case eq < 0 && token.raw == "NOT":
+			if len(clauses) == 0 || len(clauses[len(clauses)-1].keys) > 0 {
+				return nil, fmt.Errorf("rich rule %q: unexpected NOT", s)
+			}
+			clauses[len(clauses)-1].invert = true
+		case eq < 0:
+			clauses = append(clauses, richRuleClause{
+				word:  token.raw,
+				attrs: map[string]string{},
+			})
+		default:
+			if len(clauses) == 0 {
+				return nil, fmt.Errorf("rich rule %q: unexpected attribute %q", s, token.raw)
+			}
+			c := &clauses[len(clauses)-1]
+			key := token.raw[:eq]
+			if _, ok := c.attrs[key]; ok {
+				return nil, fmt.Errorf("rich rule %q: duplicate attribute %q", s, key)
+			}
+			c.attrs[key] = token.value
+			c.keys = append(c.keys, key)
+		}
+	}
+	return clauses, nil
+}
+
+type richRuleToken struct {
+	// token as written, with quotes removed from attribute values.
+	raw   string
+	value string
+}
+
+// nextRichRuleToken reads a bare word or key=value attribute.
+// Values may be quoted with single or double quotes.
+func nextRichRuleToken(s string) (richRuleToken, string, error) {
+	end := strings.IndexAny(s, " \t\n=")
+	if end < 0 || s[end] != '=' {
+		if end < 0 {
+			end = len(s)
+		}
+		return richRuleToken{raw: s[:end]}, s[end:], nil
+	}
+
+	key := s[:end]
+	rest := s[end+1:]
+	if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+		closing := strings.IndexByte(rest[1:], rest[0])
+		if closing < 0 {
+			return richRuleToken{}, "", fmt.Errorf("unterminated quote in attribute %q", key)
+		}
+		value := rest[1 : closing+1]
+		return richRuleToken{raw: key + "=" + value, value: value}, rest[closing+2:], nil
+	}
+
+	valueEnd := strings.IndexAny(rest, " \t\n")
+	if valueEnd < 0 {
+		valueEnd = len(rest)
+	}
+	value := rest[:valueEnd]
+	return richRuleToken{raw: key + "=" + value, value: value}, rest[valueEnd:], nil
+}
+
+type richRuleParser struct {
+	rule RichRule
+	// limit attaches to the last log, nflog, audit or action clause.
+	limit **RichRuleLimit
+	seen  map[string]bool
+}
+
+// allowed attributes per clause.
+var richRuleAttrs = map[string][]string{
+	"rule":         {"family", "priority"},
+	"source":       {"address", "mac", "ipset"},
+	"destination":  {"address", "ipset"},
+	"service":      {"name"},
+	"port":         {"port", "protocol"},
+	"protocol":     {"value"},
+	"icmp-block":   {"name"},
+	"icmp-type":    {"name"},
+	"masquerade":   {},
+	"forward-port": {"port", "protocol", "to-port", "to-addr"},
+	"source-port":  {"port", "protocol"},
+	"log":          {"prefix", "level"},
+	"nflog":        {"group", "prefix", "queue-size"},
+	"audit":        {},
+	"accept":       {},
+	"reject":       {"type"},
+	"drop":         {},
+	"mark":         {"set"},
+	"limit":        {"value", "burst"},
+}
+
+func (p *richRuleParser) clause(c richRuleClause) error {
+	allowed, ok := richRuleAttrs[c.word]
+	if !ok {
+		return fmt.Errorf("unknown element %q", c.word)
+	}
+	for _, key := range c.keys {
+		if !containsString(allowed, key) {
+			return fmt.Errorf("unknown attribute %q of %q", key, c.word)
+		}
+	}
+	if c.invert && c.word != "source" && c.word != "destination" {
+		return fmt.Errorf("NOT is only allowed for source and destination")
+	}
+
+	if p.seen == nil {
+		p.seen = map[string]bool{}
+	}
+	if c.word != "limit" {
+		if p.seen[c.word] {
+			return fmt.Errorf("duplicate element %q", c.word)
+		}
+		p.seen[c.word] = true
+	}
+
+	if c.word == "limit" {
+		if p.limit == nil {
+			return fmt.Errorf("limit must follow log, nflog, audit or an action")
+		}
+		*p.limit = &RichRuleLimit{Value: c.attr("value"), Burst: c.attr("burst")}
+		p.limit = nil
+		return nil
+	}
+
+	r := &p.rule
+	p.limit = nil
+	switch c.word {
+	case "rule":
+		r.Family = c.attr("family")
+		if priority := c.attr("priority"); len(priority) > 0 {
+			i, err := strconv.Atoi(priority)
+			if err != nil {
+				return fmt.Errorf("invalid priority %q", priority)
+			}
+			r.Priority = i
+		}
+	case "source", "destination":
+		a := &RichRuleAddress{
+			Invert:  c.invert,
+			Address: c.attr("address"),
+			MAC:     c.attr("mac"),
+			IPSet:   c.attr("ipset"),
+		}
+		if len(c.keys) != 1 {
+			return fmt.Errorf("%s needs exactly one of address, mac or ipset", c.word)
+		}
+		if c.word == "source" {
+			r.Source = a
+		} else {
+			r.Destination = a
+		}
+	case "service":
+		r.Service = c.attr("name")
+	case "port":
+		r.Port = &Port{Port: c.attr("port"), Protocol: c.attr("protocol")}
+	case "protocol":
+		r.Protocol = c.attr("value")
+	case "icmp-block":
+		r.ICMPBlock = c.attr("name")
+	case "icmp-type":
+		r.ICMPType = c.attr("name")
+	case "masquerade":
+		r.Masquerade = true
+	case "forward-port":
+		r.ForwardPort = &ForwardPort{
+			Port:      c.attr("port"),
+			Protocol:  c.attr("protocol"),
+			ToPort:    c.attr("to-port"),
+			ToAddress: c.attr("to-addr"),
+		}
+	case "source-port":
+		r.SourcePort = &Port{Port: c.attr("port"), Protocol: c.attr("protocol")}
+	case "log":
+		r.Log = &RichRuleLog{Prefix: c.attr("prefix"), Level: c.attr("level")}
+		p.limit = &r.Log.Limit
+	case "nflog":
+		r.NFLog = &RichRuleNFLog{
+			Group:     c.attr("group"),
+			Prefix:    c.attr("prefix"),
+			QueueSize: c.attr("queue-size"),
+		}
+		p.limit = &r.NFLog.Limit
+	case "audit":
+		r.Audit = &RichRuleAudit{}
+		p.limit = &r.Audit.Limit
+	case "accept", "reject", "drop", "mark":
+		if r.Action != nil {
+			return fmt.Errorf("more than one action")
+		}
+		r.Action = &RichRuleAction{
+			Type:       RichRuleActionType(c.word),
+			RejectType: c.attr("type"),
+			MarkSet:    c.attr("set"),
+		}
+		p.limit = &r.Action.Limit
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRichRules parses all rich rules of the zone.
+func (z *ZoneSettings) ParseRichRules() ([]RichRule, error) {
+	var out []RichRule
+	for _, s := range z.RichRules {
+		r, err := ParseRichRule(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Validate checks the rule for semantic errors that firewalld would reject.
+func (r RichRule) Validate() error {
+	switch r.Family {
+	case "", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("invalid family %q", r.Family)
+	}
+	if r.Priority < -32768 || r.Priority > 32767 {
+		return fmt.Errorf("priority %d out of range [-32768, 32767]", r.Priority)
+	}
+
+	if err := r.Source.validate("source", r.Family, true); err != nil {
+		return err
+	}
+	if err := r.Destination.validate("destination", r.Family, false); err != nil {
+		return err
+	}
+
+	elements := r.elements()
+	if len(elements) > 1 {
+		return fmt.Errorf("only one element allowed, got %s", strings.Join(elements, ", "))
+	}
+	if r.Port != nil {
+		if err := validateRichRulePort("port", *r.Port); err != nil {
+			return err
+		}
+	}
+	if r.SourcePort != nil {
+		if err := validateRichRulePort("source-port", *r.SourcePort); err != nil {
+			return err
+		}
+	}
+	if r.ForwardPort != nil {
+		fp := r.ForwardPort
+		if err := validateRichRulePort("forward-port", Port{Port: fp.Port, Protocol: fp.Protocol}); err != nil {
+			return err
+		}
+		if len(fp.ToPort) == 0 && len(fp.ToAddress) == 0 {
+			return fmt.Errorf("forward-port needs to-port or to-addr")
+		}
+		if len(fp.ToAddress) > 0 {
+			if err := validateFamilyAddress("forward-port to-addr", r.Family, fp.ToAddress); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.Log != nil && r.NFLog != nil {
+		return fmt.Errorf("log and nflog are mutually exclusive")
+	}
+	if r.Log != nil {
+		if len(r.Log.Level) > 0 && !containsString(richRuleLogLevels, r.Log.Level) {
+			return fmt.Errorf("invalid log level %q", r.Log.Level)
+		}
+		if err := r.Log.Limit.validate(); err != nil {
+			return err
+		}
+	}
+	if r.NFLog != nil {
+		if err := r.NFLog.Limit.validate(); err != nil {
+			return err
+		}
+	}
+	if r.Audit != nil {
+		if err := r.Audit.Limit.validate(); err != nil {
+			return err
+		}
+	}
+
+	// elements that are actions themselves
+	terminal := len(r.ICMPBlock) > 0 || r.Masquerade || r.ForwardPort != nil
+	switch {
+	case terminal && r.Action != nil:
+		return fmt.Errorf("%s does not allow an action", elements[0])
+	case len(elements) == 0 && r.Action == nil:
+		return fmt.Errorf("rule needs an element or an action")
+	case !terminal && r.Action == nil && r.Log == nil && r.NFLog == nil && r.Audit == nil:
+		return fmt.Errorf("rule needs an action, log or audit")
+	}
+	if r.Action != nil {
+		return r.Action.validate(r.Family)
+	}
+	return nil
+}
+
+func (r RichRule) elements() []string {
+	var elements []string
+	add := func(set bool, name string) {
+		if set {
+			elements = append(elements, name)
+		}
+	}
+	add(len(r.Service) > 0, "service")
+	add(r.Port != nil, "port")
+	add(len(r.Protocol) > 0, "protocol")
+	add(len(r.ICMPBlock) > 0, "icmp-block")
+	add(len(r.ICMPType) > 0, "icmp-type")
+	add(r.Masquerade, "masquerade")
+	add(r.ForwardPort != nil, "forward-port")
+	add(r.SourcePort != nil, "source-port")
+	return elements
+}
+
+func (a *RichRuleAddress) validate(name, family string, allowMAC bool) error {
+	if a == nil {
+		return nil
+	}
+
+	set := 0
+	for _, v := range []string{a.Address, a.MAC, a.IPSet} {
+		if len(v) > 0 {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%s needs exactly one of address, mac or ipset", name)
+	}
+
+	switch {
+	case len(a.MAC) > 0:
+		if !allowMAC {
+			return fmt.Errorf("%s does not support mac", name)
+		}
+		if _, err := net.ParseMAC(a.MAC); err != nil {
+			return fmt.Errorf("%s: invalid mac %q", name, a.MAC)
+		}
+	case len(a.Address) > 0:
+		return validateFamilyAddress(name+" address", family, a.Address)
+	}
+	return nil
+}
+
+// validateFamilyAddress checks that an IP address or network matches the rule family.
+func validateFamilyAddress(name, family, address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		var err error
+		ip, _, err = net.ParseCIDR(address)
+		if err != nil {
+			return fmt.Errorf("%s: invalid address %q", name, address)
+		}
+	}
+
+	addressFamily := "ipv6"
+	if ip.To4() != nil {
+		addressFamily = "ipv4"
+	}
+	if len(family) == 0 {
+		return fmt.Errorf("%s requires family to be set", name)
+	}
+	if family != addressFamily {
+		return fmt.Errorf("%s %q does not match family %s", name, address, family)
+	}
+	return nil
+}
+
+func validateRichRulePort(name string, p Port) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+var richRuleLogLevels = []string{
+	"emerg", "alert", "crit", "error", "warning", "notice", "info", "debug",
+}
+
+func (l *RichRuleLimit) validate() error {
+	if l == nil {
+		return nil
+	}
+
+	parts := strings.Split(l.Value, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid limit %q, expected rate/duration", l.Value)
+	}
+	if rate, err := strconv.ParseUint(parts[0], 10, 32); err != nil || rate == 0 {
+		return fmt.Errorf("invalid limit rate %q", parts[0])
+	}
+	switch parts[1] {
+	case "s", "second", "m", "minute", "h", "hour", "d", "day":
+	default:
+		return fmt.Errorf("invalid limit duration %q, expected s, m, h or d", parts[1])
+	}
+
+	if len(l.Burst) > 0 {
+		if burst, err := strconv.ParseUint(l.Burst, 10, 16); err != nil || burst == 0 {
+			return fmt.Errorf("invalid limit burst %q", l.Burst)
+		}
+	}
+	return nil
+}
+
+// ICMP reject types per family.
+var richRuleRejectTypes = map[string][]string{
+	"ipv4": {
+		"icmp-host-prohibited", "host-prohib",
+		"icmp-net-unreachable", "net-unreach",
+		"icmp-host-unreachable", "host-unreach",
+		"icmp-port-unreachable", "port-unreach",
+		"icmp-proto-unreachable", "proto-unreach",
+		"icmp-net-prohibited", "net-prohib",
+		"tcp-reset", "tcp-rst",
+		"icmp-admin-prohibited", "admin-prohib",
+	},
+	"ipv6": {
+		"icmp6-adm-prohibited", "adm-prohibited",
+		"icmp6-no-route", "no-route",
+		"icmp6-addr-unreachable", "addr-unreach",
+		"icmp6-port-unreachable", "port-unreach",
+		"tcp-reset",
+	},
+}
+
+func (a *RichRuleAction) validate(family string) error {
+	switch a.Type {
+	case RichRuleAccept, RichRuleDrop:
+	case RichRuleReject:
+		if len(a.RejectType) > 0 {
+			if len(family) == 0 {
+				return fmt.Errorf("reject type %q requires family to be set", a.RejectType)
+			}
+			if !containsString(richRuleRejectTypes[family], a.RejectType) {
+				return fmt.Errorf("invalid reject type %q for family %s", a.RejectType, family)
+			}
+		}
+	case RichRuleMark:
+		if err := validateMark(a.MarkSet); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid action %q", a.Type)
+	}
+	return a.Limit.validate()
+}
+
+// validateMark checks mark[/mask] with decimal or hex numbers.
+func validateMark(s string) error {
+	parts := strings.Split(s, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid mark %q", s)
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 0, 32); err != nil {
+			return fmt.Errorf("invalid mark %q", s)
+		}
+	}
+	return nil
+}
+
+// CanonicalRichRule returns the canonical form of a rule string,
+// or the trimmed input if it can not be parsed.
+func CanonicalRichRule(s string) string {
+	r, err := ParseRichRule(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return r.String()
+}
+
+// RichRulesEqual returns true if both strings describe the same rule,
+// ignoring whitespace, quoting and attribute order.
+func RichRulesEqual(a, b string) bool {
+	return CanonicalRichRule(a) == CanonicalRichRule(b)
+}
+
+func canonicalRichRules(rules []string) []string {
+	var out []string
+	for _, r := range rules {
+		out = append(out, CanonicalRichRule(r))
+	}
+	return out
+}
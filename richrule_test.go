@@ -0,0 +1,251 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRichRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected RichRule
+		// canonical form, if different from in.
+		canonical string
+	}{
+		{
+			name: "source accept",
+			in:   `rule family="ipv4" source address="192.0.2.0/24" service name="ssh" accept`,
+			expected: RichRule{
+				Family:  "ipv4",
+				Source:  &RichRuleAddress{Address: "192.0.2.0/24"},
+				Service: "ssh",
+				Action:  &RichRuleAction{Type: RichRuleAccept},
+			},
+		},
+		{
+			name: "priority, inverted ipset, log with limit",
+			in:   `rule priority="-10" family="ipv6" source NOT ipset="mgmt" port port="22" protocol="tcp" log prefix="ssh denied" level="notice" limit value="3/m" reject type="icmp6-adm-prohibited"`,
+			expected: RichRule{
+				Family:   "ipv6",
+				Priority: -10,
+				Source:   &RichRuleAddress{Invert: true, IPSet: "mgmt"},
+				Port:     &Port{Port: "22", Protocol: "tcp"},
+				Log: &RichRuleLog{
+					Prefix: "ssh denied",
+					Level:  "notice",
+					Limit:  &RichRuleLimit{Value: "3/m"},
+				},
+				Action: &RichRuleAction{
+					Type:       RichRuleReject,
+					RejectType: "icmp6-adm-prohibited",
+				},
+			},
+		},
+		{
+			name: "unquoted and reordered attributes",
+			in:   `rule   family=ipv4 forward-port protocol='tcp' to-addr="192.0.2.5" port=80 to-port=8080`,
+			expected: RichRule{
+				Family: "ipv4",
+				ForwardPort: &ForwardPort{
+					Port: "80", Protocol: "tcp", ToPort: "8080", ToAddress: "192.0.2.5",
+				},
+			},
+			canonical: `rule family="ipv4" forward-port port="80" protocol="tcp" to-port="8080" to-addr="192.0.2.5"`,
+		},
+		{
+			name: "mac, masquerade",
+			in:   `rule source mac="00:11:22:33:44:55" masquerade`,
+			expected: RichRule{
+				Source:     &RichRuleAddress{MAC: "00:11:22:33:44:55"},
+				Masquerade: true,
+			},
+		},
+		{
+			name: "destination, audit and mark",
+			in:   `rule family="ipv4" destination NOT address="198.51.100.1" protocol value="gre" audit limit value="1/s" mark set="0x1/0xff" limit value="10/m" burst="5"`,
+			expected: RichRule{
+				Family:      "ipv4",
+				Destination: &RichRuleAddress{Invert: true, Address: "198.51.100.1"},
+				Protocol:    "gre",
+				Audit:       &RichRuleAudit{Limit: &RichRuleLimit{Value: "1/s"}},
+				Action: &RichRuleAction{
+					Type:    RichRuleMark,
+					MarkSet: "0x1/0xff",
+					Limit:   &RichRuleLimit{Value: "10/m", Burst: "5"},
+				},
+			},
+		},
+		{
+			name: "nflog, icmp-type, source-port",
+			in:   `rule icmp-type name="echo-request" nflog group="5" prefix="ping" queue-size="10" drop`,
+			expected: RichRule{
+				ICMPType: "echo-request",
+				NFLog:    &RichRuleNFLog{Group: "5", Prefix: "ping", QueueSize: "10"},
+				Action:   &RichRuleAction{Type: RichRuleDrop},
+			},
+		},
+		{
+			name: "source-port, icmp-block",
+			in:   `rule source-port port="1024-65535" protocol="udp" accept`,
+			expected: RichRule{
+				SourcePort: &Port{Port: "1024-65535", Protocol: "udp"},
+				Action:     &RichRuleAction{Type: RichRuleAccept},
+			},
+		},
+		{
+			name: "log prefix with double quotes",
+			in:   `rule service name="http" log prefix='say "hi"' accept`,
+			expected: RichRule{
+				Service: "http",
+				Log:     &RichRuleLog{Prefix: `say "hi"`},
+				Action:  &RichRuleAction{Type: RichRuleAccept},
+			},
+		},
+		{
+			name:     "icmp-block",
+			in:       `rule icmp-block name="timestamp-request"`,
+			expected: RichRule{ICMPBlock: "timestamp-request"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := ParseRichRule(test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, r)
+
+			canonical := test.canonical
+			if len(canonical) == 0 {
+				canonical = test.in
+			}
+			assert.Equal(t, canonical, r.String())
+
+			// round trip
+			again, err := ParseRichRule(r.String())
+			require.NoError(t, err)
+			assert.Equal(t, r, again)
+		})
+	}
+}
+
+func TestParseRichRule_Errors(t *testing.T) {
+	tests := []string{
+		``,
+		`source address="192.0.2.1" accept`,
+		`rule family="ipv4" source address="192.0.2.1`,
+		`rule foo accept`,
+		`rule service name="ssh" color="red" accept`,
+		`rule priority="high" accept`,
+		`rule source address="192.0.2.1" mac="00:11:22:33:44:55" accept`,
+		`rule service name="ssh" service name="http" accept`,
+		`rule accept drop`,
+		`rule limit value="1/s" accept`,
+		`rule NOT service name="ssh" accept`,
+		`rule service name="ssh" accept limit value="1/s" limit value="2/s"`,
+	}
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			_, err := ParseRichRule(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRichRule_Validate(t *testing.T) {
+	valid := []string{
+		`rule family="ipv4" source address="192.0.2.0/24" service name="ssh" accept`,
+		`rule family="ipv6" source address="2001:db8::1" port port="22" protocol="tcp" reject type="icmp6-adm-prohibited"`,
+		`rule source mac="00:11:22:33:44:55" drop`,
+		`rule source ipset="blocklist" log prefix="blocked" level="info" limit value="10/minute" drop`,
+		`rule family="ipv4" forward-port port="80" protocol="tcp" to-port="8080" to-addr="192.0.2.5"`,
+		`rule icmp-block name="echo-request"`,
+		`rule masquerade`,
+		`rule service name="http" audit limit value="1/s"`,
+		`rule protocol value="gre" mark set="0x10/0xff"`,
+		`rule priority="-32768" accept`,
+	}
+	for _, s := range valid {
+		t.Run(s, func(t *testing.T) {
+			r, err := ParseRichRule(s)
+			require.NoError(t, err)
+			assert.NoError(t, r.Validate())
+		})
+	}
+
+	invalid := []string{
+		// multiple elements
+		`rule service name="ssh" port port="22" protocol="tcp" accept`,
+		// address without family
+		`rule source address="192.0.2.1" accept`,
+		// family mismatch
+		`rule family="ipv6" source address="192.0.2.1" accept`,
+		`rule family="ipv4" destination address="2001:db8::/32" accept`,
+		`rule family="ipx" accept`,
+		`rule source mac="not-a-mac" accept`,
+		`rule service name="ssh" log level="loud" accept`,
+		`rule service name="ssh" log limit value="10/week" accept`,
+		`rule service name="ssh" log limit value="0/m" accept`,
+		// reject type of the wrong family
+		`rule family="ipv4" service name="ssh" reject type="icmp6-adm-prohibited"`,
+		`rule service name="ssh" reject type="tcp-reset"`,
+		`rule port port="22" protocol="icmp" accept`,
+		`rule icmp-block name="echo-request" accept`,
+		`rule family="ipv4" forward-port port="80" protocol="tcp"`,
+		`rule service name="ssh"`,
+		`rule source ipset="foo"`,
+		`rule service name="ssh" mark set="foo"`,
+		`rule priority="40000" accept`,
+		`rule service name="ssh" log nflog accept`,
+	}
+	for _, s := range invalid {
+		t.Run(s, func(t *testing.T) {
+			r, err := ParseRichRule(s)
+			require.NoError(t, err)
+			assert.Error(t, r.Validate())
+		})
+	}
+}
+
+func TestRichRulesEqual(t *testing.T) {
+	assert.True(t, RichRulesEqual(
+		`rule family="ipv4" source address="192.0.2.0/24" accept`,
+		`rule  family='ipv4'   source address=192.0.2.0/24 accept `,
+	))
+	assert.True(t, RichRulesEqual(
+		`rule family="ipv4" forward-port port="80" protocol="tcp" to-port="8080" to-addr="192.0.2.5"`,
+		`rule family="ipv4" forward-port to-addr="192.0.2.5" to-port="8080" protocol="tcp" port="80"`,
+	))
+	assert.False(t, RichRulesEqual(
+		`rule family="ipv4" source address="192.0.2.0/24" accept`,
+		`rule family="ipv4" source address="192.0.2.0/24" drop`,
+	))
+	// unparsable rules are compared as strings
+	assert.True(t, RichRulesEqual(`rule foo`, ` rule foo`))
+}
+
+func TestRichRule_Validate_DestinationMAC(t *testing.T) {
+	r := RichRule{
+		Destination: &RichRuleAddress{MAC: "00:11:22:33:44:55"},
+		Action:      &RichRuleAction{Type: RichRuleAccept},
+	}
+	assert.Error(t, r.Validate())
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Runtime configuration
+// Methods in this file work on the runtime configuration of firewalld,
+// which is lost on reload unless made permanent.
+
+const getZonesMethod = "org.fedoraproject.FirewallD1.zone.getZones"
+
+// Return list of zone names (runtime configuration).
+func (c *Client) GetZones(ctx context.Context) ([]string, error) {
+	var zones []string
+	return zones, c.main.Call(ctx,
+		NewCall(getZonesMethod, 0).
+			WithReturns(&zones))
+}
+
+const getZoneSettingsMethod = "org.fedoraproject.FirewallD1.getZoneSettings"
+
+// Return runtime settings of given zone.
+func (c *Client) GetZoneSettings(
+	ctx context.Context, zoneName string) (ZoneSettings, error) {
+	var zoneSettings []interface{}
+	err := c.main.Call(ctx,
+		NewCall(getZoneSettingsMethod, 0).
+			WithArguments(zoneName).
+			WithReturns(&zoneSettings))
+	if err != nil {
+		return ZoneSettings{}, err
+	}
+
+	settings, err := ZoneSettingsFromSlice(zoneSettings)
+	if err != nil {
+		return ZoneSettings{}, fmt.Errorf("zone %q: %w", zoneName, err)
+	}
+	return settings, nil
+}
+
+const listServicesMethod = "org.fedoraproject.FirewallD1.listServices"
+
+// Return list of service names (runtime configuration).
+func (c *Client) ListServices(ctx context.Context) ([]string, error) {
+	var services []string
+	return services, c.main.Call(ctx,
+		NewCall(listServicesMethod, 0).
+			WithReturns(&services))
+}
+
+const getServiceSettingsMethod = "org.fedoraproject.FirewallD1.getServiceSettings"
+
+// Return runtime settings of given service.
+func (c *Client) GetServiceSettings(
+	ctx context.Context, serviceName string) (ServiceSettings, error) {
+	var serviceSettings []interface{}
+	err := c.main.Call(ctx,
+		NewCall(getServiceSettingsMethod, 0).
+			WithArguments(serviceName).
+			WithReturns(&serviceSettings))
+	if err != nil {
+		return ServiceSettings{}, err
+	}
+
+	settings, err := ServiceSettingsFromSlice(serviceSettings)
+	if err != nil {
+		return ServiceSettings{}, fmt.Errorf("service %q: %w", serviceName, err)
+	}
+	return settings, nil
+}
+
+const getIPSetsMethod = "org.fedoraproject.FirewallD1.ipset.getIPSets"
+
+// Return list of ipset names (runtime configuration).
+func (c *Client) GetIPSets(ctx context.Context) ([]string, error) {
+	var ipsets []string
+	return ipsets, c.main.Call(ctx,
+		NewCall(getIPSetsMethod, 0).
+			WithReturns(&ipsets))
+}
+
+const getIPSetSettingsMethod = "org.fedoraproject.FirewallD1.ipset.getIPSetSettings"
+
+// Return runtime settings of given ipset.
+func (c *Client) GetIPSetSettings(
+	ctx context.Context, ipsetName string) (IPSetSettings, error) {
+	var ipsetSettings []interface{}
+	err := c.main.Call(ctx,
+		NewCall(getIPSetSettingsMethod, 0).
+			WithArguments(ipsetName).
+			WithReturns(&ipsetSettings))
+	if err != nil {
+		return IPSetSettings{}, err
+	}
+
+	settings, err := IPSetSettingsFromSlice(ipsetSettings)
+	if err != nil {
+		return IPSetSettings{}, fmt.Errorf("ipset %q: %w", ipsetName, err)
+	}
+	return settings, nil
+}
+
+const getPoliciesMethod = "org.fedoraproject.FirewallD1.policy.getPolicies"
+
+// Return list of policy names (runtime configuration).
+func (c *Client) GetPolicies(ctx context.Context) ([]string, error) {
+	var policies []string
+	return policies, c.main.Call(ctx,
+		NewCall(getPoliciesMethod, 0).
+			WithReturns(&policies))
+}
+
+const getPolicySettingsMethod = "org.fedoraproject.FirewallD1.policy.getPolicySettings"
+
+// Return runtime settings of given policy.
+func (c *Client) GetPolicySettings(
+	ctx context.Context, policyName string) (PolicySettings, error) {
+	var policySettings map[string]dbus.Variant
+	err := c.main.Call(ctx,
+		NewCall(getPolicySettingsMethod, 0).
+			WithArguments(policyName).
+			WithReturns(&policySettings))
+	if err != nil {
+		return PolicySettings{}, err
+	}
+
+	settings, err := PolicySettingsFromMap(policySettings)
+	if err != nil {
+		return PolicySettings{}, fmt.Errorf("policy %q: %w", policyName, err)
+	}
+	return settings, nil
+}
+
+const listICMPTypesMethod = "org.fedoraproject.FirewallD1.listIcmpTypes"
+
+// Return list of icmptype names (runtime configuration).
+func (c *Client) ListICMPTypes(ctx context.Context) ([]string, error) {
+	var icmptypes []string
+	return icmptypes, c.main.Call(ctx,
+		NewCall(listICMPTypesMethod, 0).
+			WithReturns(&icmptypes))
+}
+
+const getICMPTypeSettingsMethod = "org.fedoraproject.FirewallD1.getIcmpTypeSettings"
+
+// Return runtime settings of given icmptype.
+func (c *Client) GetICMPTypeSettings(
+	ctx context.Context, icmptypeName string) (ICMPTypeSettings, error) {
+	var icmptypeSettings []interface{}
+	err := c.main.Call(ctx,
+		NewCall(getICMPTypeSettingsMethod, 0).
+			WithArguments(icmptypeName).
+			WithReturns(&icmptypeSettings))
+	if err != nil {
+		return ICMPTypeSettings{}, err
+	}
+
+	settings, err := ICMPTypeSettingsFromSlice(icmptypeSettings)
+	if err != nil {
+		return ICMPTypeSettings{}, fmt.Errorf("icmptype %q: %w", icmptypeName, err)
+	}
+	return settings, nil
+}
+
+const directInterface = "org.fedoraproject.FirewallD1.direct"
+
+// Return runtime direct chains, rules and passthroughs.
+func (c *Client) GetDirectSettings(ctx context.Context) (DirectSettings, error) {
+	var chains, rules, passthroughs interface{}
+	for _, get := range []struct {
+		method string
+		v      *interface{}
+	}{
+		{"getAllChains", &chains},
+		{"getAllRules", &rules},
+		{"getAllPassthroughs", &passthroughs},
+	} {
+		err := c.main.Call(ctx,
+			NewCall(directInterface+"."+get.method, 0).
+				WithReturns(get.v))
+		if err != nil {
+			return DirectSettings{}, err
+		}
+	}
+	return DirectSettingsFromSlice([]interface{}{chains, rules, passthroughs})
+}
+
+const lockdownInterface = "org.fedoraproject.FirewallD1.policies"
+
+// Return true if lockdown is enabled (runtime configuration).
+func (c *Client) QueryLockdown(ctx context.Context) (enabled bool, err error) {
+	return enabled, c.main.Call(ctx,
+		NewCall(lockdownInterface+".queryLockdown", 0).
+			WithReturns(&enabled))
+}
+
+// Enable lockdown (runtime configuration).
+// Afterwards only whitelisted applications can change firewalld.
+func (c *Client) EnableLockdown(ctx context.Context) error {
+	return c.main.Call(ctx, NewCall(lockdownInterface+".enableLockdown", 0))
+}
+
+// Disable lockdown (runtime configuration).
+func (c *Client) DisableLockdown(ctx context.Context) error {
+	return c.main.Call(ctx, NewCall(lockdownInterface+".disableLockdown", 0))
+}
+
+// Return lockdown whitelist (runtime configuration).
+func (c *Client) GetLockdownWhitelist(ctx context.Context) (LockdownWhitelist, error) {
+	var commands, contexts, users, uids interface{}
+	for _, get := range []struct {
+		method string
+		v      *interface{}
+	}{
+		{"getLockdownWhitelistCommands", &commands},
+		{"getLockdownWhitelistContexts", &contexts},
+		{"getLockdownWhitelistUsers", &users},
+		{"getLockdownWhitelistUids", &uids},
+	} {
+		err := c.main.Call(ctx,
+			NewCall(lockdownInterface+"."+get.method, 0).
+				WithReturns(get.v))
+		if err != nil {
+			return LockdownWhitelist{}, err
+		}
+	}
+	return LockdownWhitelistFromSlice([]interface{}{commands, contexts, users, uids})
+}
+
+const zoneInterface = "org.fedoraproject.FirewallD1.zone"
+
+// runtimeAddTakesTimeout returns true if the runtime add method
+// for subject, e.g. "Service", has a timeout as last argument.
+func runtimeAddTakesTimeout(subject string) bool {
+	switch subject {
+	case "Interface", "Source", "IcmpBlockInversion":
+		return false
+	}
+	return true
+}
+
+// Apply granular changes to the runtime configuration of the given zone.
+// Changes are applied in order, stopping at the first error.
+// Additions are permanent until reload (no timeout).
+// Short name, description and target can not be changed at runtime.
+func (c *Client) ApplyZoneChanges(
+	ctx context.Context, zoneName string, changes []ZoneChange) error {
+	for _, change := range changes {
+		if strings.HasPrefix(change.Method, "set") {
+			return &ZoneChangeError{
+				Zone: zoneName, Change: change,
+				Err: errors.New("not supported in runtime configuration"),
+			}
+		}
+
+		args := []interface{}{zoneName}
+		for _, a := range change.Args {
+			args = append(args, a)
+		}
+		if strings.HasPrefix(change.Method, "add") &&
+			runtimeAddTakesTimeout(change.Method[len("add"):]) {
+			// timeout in seconds, 0 disables the timeout
+			args = append(args, int32(0))
+		}
+
+		err := c.main.Call(ctx,
+			NewCall(zoneInterface+"."+change.Method, 0).
+				WithArguments(args...))
+		if err != nil {
+			return &ZoneChangeError{Zone: zoneName, Change: change, Err: err}
+		}
+	}
+	return nil
+}
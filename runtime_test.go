@@ -0,0 +1,184 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetZones(t *testing.T) {
+	response := []string{"public", "trusted"}
+
+	caller := &callerMock{}
+	onMethod(caller, getZonesMethod, response)
+	c := &Client{main: caller}
+
+	zones, err := c.GetZones(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, response, zones)
+}
+
+func TestClient_GetZoneSettings_Runtime(t *testing.T) {
+	caller := &callerMock{}
+	onMethod(caller, getZoneSettingsMethod, []interface{}{
+		"", "Public", "For use in public areas.", false, "default",
+		[]string{"ssh"},
+		[][]interface{}{{"8080", "tcp"}},
+		[]string{}, true,
+		[][]interface{}{},
+		[]string{"eth0"}, []string{}, []string{}, []string{},
+		[][]interface{}{},
+	})
+	c := &Client{main: caller}
+
+	settings, err := c.GetZoneSettings(context.Background(), "public")
+	require.NoError(t, err)
+	assert.Equal(t, ZoneSettings{
+		Name:            "Public",
+		Description:     "For use in public areas.",
+		Target:          "default",
+		Services:        []string{"ssh"},
+		Ports:           []Port{{Port: "8080", Protocol: "tcp"}},
+		ICMPBlocks:      []string{},
+		Masquerade:      true,
+		Interfaces:      []string{"eth0"},
+		SourceAddresses: []string{},
+		RichRules:       []string{},
+		Protocols:       []string{},
+	}, settings)
+}
+
+func TestClient_GetServiceSettings_Runtime(t *testing.T) {
+	caller := &callerMock{}
+	onMethod(caller, getServiceSettingsMethod, []interface{}{
+		"", "SSH", "Secure Shell",
+		[][]interface{}{{"22", "tcp"}},
+		[]string{},
+		map[string]string{"ipv4": "224.0.0.251"},
+		[]string{}, [][]interface{}{},
+	})
+	c := &Client{main: caller}
+
+	settings, err := c.GetServiceSettings(context.Background(), "ssh")
+	require.NoError(t, err)
+	assert.Equal(t, ServiceSettings{
+		Name:         "SSH",
+		Description:  "Secure Shell",
+		Ports:        []Port{{Port: "22", Protocol: "tcp"}},
+		ModuleNames:  []string{},
+		Destinations: map[string]string{"ipv4": "224.0.0.251"},
+		Protocols:    []string{},
+	}, settings)
+}
+
+func TestClient_GetIPSetSettings_Runtime(t *testing.T) {
+	caller := &callerMock{}
+	onMethod(caller, getIPSetSettingsMethod, []interface{}{
+		"", "", "", "hash:ip",
+		map[string]string{"family": "inet"},
+		[]string{"192.0.2.1", "192.0.2.2"},
+	})
+	c := &Client{main: caller}
+
+	settings, err := c.GetIPSetSettings(context.Background(), "blocklist")
+	require.NoError(t, err)
+	assert.Equal(t, IPSetSettings{
+		Type:    "hash:ip",
+		Options: map[string]string{"family": "inet"},
+		Entries: []string{"192.0.2.1", "192.0.2.2"},
+	}, settings)
+}
+
+func TestClient_GetPolicySettings_Runtime(t *testing.T) {
+	caller := &callerMock{}
+	onMethod(caller, getPolicySettingsMethod, map[string]dbus.Variant{
+		"target":        dbus.MakeVariant("ACCEPT"),
+		"priority":      dbus.MakeVariant(int32(-1)),
+		"ingress_zones": dbus.MakeVariant([]string{"internal"}),
+		"egress_zones":  dbus.MakeVariant([]string{"HOST"}),
+		"ports":         dbus.MakeVariant([][]interface{}{{"53", "udp"}}),
+	})
+	c := &Client{main: caller}
+
+	settings, err := c.GetPolicySettings(context.Background(), "internal-host")
+	require.NoError(t, err)
+	assert.Equal(t, PolicySettings{
+		Target:       "ACCEPT",
+		Priority:     -1,
+		IngressZones: []string{"internal"},
+		EgressZones:  []string{"HOST"},
+		Ports:        []Port{{Port: "53", Protocol: "udp"}},
+	}, settings)
+}
+
+func TestClient_ApplyZoneChanges(t *testing.T) {
+	caller := &callerMock{}
+	caller.On("Call", mock.Anything, mock.Anything).Return(nil)
+	c := &Client{main: caller}
+
+	ctx := context.Background()
+	err := c.ApplyZoneChanges(ctx, "public", []ZoneChange{
+		{Method: "addPort", Args: []string{"8080", "tcp"}},
+		{Method: "addInterface", Args: []string{"eth0"}},
+		{Method: "removeService", Args: []string{"ssh"}},
+	})
+	require.NoError(t, err)
+
+	caller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".addPort",
+		Arguments: []interface{}{"public", "8080", "tcp", int32(0)},
+	})
+	caller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".addInterface",
+		Arguments: []interface{}{"public", "eth0"},
+	})
+	caller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".removeService",
+		Arguments: []interface{}{"public", "ssh"},
+	})
+
+	err = c.ApplyZoneChanges(ctx, "public", []ZoneChange{
+		{Method: "setTarget", Args: []string{"DROP"}},
+	})
+	require.Error(t, err)
+}
+
+func TestClient_GetDirectSettings_Runtime(t *testing.T) {
+	caller := &callerMock{}
+	onMethod(caller, directInterface+".getAllChains",
+		[][]interface{}{{"ipv4", "filter", "blocklist"}})
+	onMethod(caller, directInterface+".getAllRules",
+		[][]interface{}{{"ipv4", "filter", "blocklist", int32(1), []string{"-j", "DROP"}}})
+	onMethod(caller, directInterface+".getAllPassthroughs", [][]interface{}{})
+	c := &Client{main: caller}
+
+	settings, err := c.GetDirectSettings(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, DirectSettings{
+		Chains: []DirectChain{{IPV: "ipv4", Table: "filter", Chain: "blocklist"}},
+		Rules: []DirectRule{{
+			IPV: "ipv4", Table: "filter", Chain: "blocklist", Priority: 1,
+			Args: []string{"-j", "DROP"},
+		}},
+	}, settings)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+type ServiceSettings struct {
+	Version      string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Name         string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Ports        []Port            `json:"ports,omitempty" yaml:"ports,omitempty"`
+	ModuleNames  []string          `json:"moduleNames,omitempty" yaml:"moduleNames,omitempty"`
+	Destinations map[string]string `json:"destinations,omitempty" yaml:"destinations,omitempty"`
+	Protocols    []string          `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	SourcePorts  []Port            `json:"sourcePorts,omitempty" yaml:"sourcePorts,omitempty"`
+}
+
+// ServiceSettingsFromSlice decodes the service settings tuple returned by firewalld.
+// Protocols and source ports are optional for older firewalld versions.
+func ServiceSettingsFromSlice(s []interface{}) (ServiceSettings, error) {
+	d := &decoder{kind: "service settings"}
+	d.minLen(s, 6)
+	if d.err != nil {
+		return ServiceSettings{}, d.err
+	}
+
+	settings := ServiceSettings{
+		Version:      d.string("Version", s[0]),
+		Name:         d.string("Name", s[1]),
+		Description:  d.string("Description", s[2]),
+		Ports:        d.ports("Ports", s[3]),
+		ModuleNames:  d.strings("ModuleNames", s[4]),
+		Destinations: d.stringMap("Destinations", s[5]),
+		Protocols:    d.strings("Protocols", at(s, 6)),
+		SourcePorts:  d.ports("SourcePorts", at(s, 7)),
+	}
+	if d.err != nil {
+		return ServiceSettings{}, d.err
+	}
+	return settings, nil
+}
+
+func (s *ServiceSettings) ToSlice() []interface{} {
+	destinations := s.Destinations
+	if destinations == nil {
+		destinations = map[string]string{}
+	}
+	return []interface{}{
+		s.Version,
+		s.Name,
+		s.Description,
+		portsToInterfaceSlice(s.Ports),
+		s.ModuleNames,
+		destinations,
+		s.Protocols,
+		portsToInterfaceSlice(s.SourcePorts),
+	}
+}
+
+// serviceStruct is encoded as D-Bus struct (sssa(ss)asa{ss}asa(ss)).
+type serviceStruct struct {
+	Version      string
+	Short        string
+	Description  string
+	Ports        []portStruct
+	ModuleNames  []string
+	Destinations map[string]string
+	Protocols    []string
+	SourcePorts  []portStruct
+}
+
+func (s *ServiceSettings) toStruct() serviceStruct {
+	destinations := s.Destinations
+	if destinations == nil {
+		destinations = map[string]string{}
+	}
+	return serviceStruct{
+		Version:      s.Version,
+		Short:        s.Name,
+		Description:  s.Description,
+		Ports:        portsToStructs(s.Ports),
+		ModuleNames:  s.ModuleNames,
+		Destinations: destinations,
+		Protocols:    s.Protocols,
+		SourcePorts:  portsToStructs(s.SourcePorts),
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlService is the layout of a firewalld service file, see firewalld.service(5).
+type xmlService struct {
+	Version      string          `xml:"version,attr,omitempty"`
+	Short        string          `xml:"short,omitempty"`
+	Description  string          `xml:"description,omitempty"`
+	Ports        []xmlPort       `xml:"port"`
+	Protocols    []xmlValue      `xml:"protocol"`
+	SourcePorts  []xmlPort       `xml:"source-port"`
+	Modules      []xmlName       `xml:"module"`
+	Helpers      []xmlName       `xml:"helper"`
+	Destinations *xmlDestination `xml:"destination"`
+}
+
+type xmlDestination struct {
+	IPv4 string `xml:"ipv4,attr,omitempty"`
+	IPv6 string `xml:"ipv6,attr,omitempty"`
+}
+
+// Prefix of kernel modules for netfilter helpers,
+// older firewalld versions use module names instead of helper names.
+const conntrackModulePrefix = "nf_conntrack_"
+
+// MarshalXML encodes the service in firewalld service file format.
+// Modules are written as helper elements.
+func (s ServiceSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlService{
+		Version:     s.Version,
+		Short:       s.Name,
+		Description: s.Description,
+		Ports:       xmlPorts(s.Ports),
+		Protocols:   xmlValues(s.Protocols),
+		SourcePorts: xmlPorts(s.SourcePorts),
+	}
+	for _, m := range s.ModuleNames {
+		x.Helpers = append(x.Helpers, xmlName{Name: strings.TrimPrefix(m, conntrackModulePrefix)})
+	}
+	if len(s.Destinations) > 0 {
+		x.Destinations = &xmlDestination{
+			IPv4: s.Destinations["ipv4"],
+			IPv6: s.Destinations["ipv6"],
+		}
+	}
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "service"}})
+}
+
+// UnmarshalXML decodes a service from firewalld service file format.
+func (s *ServiceSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "service"); err != nil {
+		return err
+	}
+	var x xmlService
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = ServiceSettings{
+		Version:     x.Version,
+		Name:        x.Short,
+		Description: x.Description,
+		Ports:       portsFromXML(x.Ports),
+		Protocols:   valuesFromXML(x.Protocols),
+		SourcePorts: portsFromXML(x.SourcePorts),
+	}
+	for _, m := range append(x.Modules, x.Helpers...) {
+		s.ModuleNames = append(s.ModuleNames, strings.TrimPrefix(m.Name, conntrackModulePrefix))
+	}
+	if x.Destinations != nil {
+		s.Destinations = map[string]string{}
+		if len(x.Destinations.IPv4) > 0 {
+			s.Destinations["ipv4"] = x.Destinations.IPv4
+		}
+		if len(x.Destinations.IPv6) > 0 {
+			s.Destinations["ipv6"] = x.Destinations.IPv6
+		}
+	}
+	return nil
+}
+
+// ReadServiceXML reads a service from a firewalld service file, e.g. /etc/firewalld/services/ssh.xml.
+func ReadServiceXML(r io.Reader) (ServiceSettings, error) {
+	var s ServiceSettings
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return ServiceSettings{}, err
+	}
+	return s, nil
+}
+
+// WriteServiceXML writes the service in firewalld service file format.
+func WriteServiceXML(w io.Writer, s ServiceSettings) error {
+	return writeXML(w, s)
+}
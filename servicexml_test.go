@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceXML(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="utf-8"?>
+<service>
+  <short>mDNS</short>
+  <description>Multicast DNS</description>
+  <port protocol="udp" port="5353"/>
+  <module name="nf_conntrack_netbios_ns"/>
+  <destination ipv4="224.0.0.251" ipv6="ff02::fb"/>
+</service>
+`
+	s, err := ReadServiceXML(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, ServiceSettings{
+		Name:         "mDNS",
+		Description:  "Multicast DNS",
+		Ports:        []Port{{Port: "5353", Protocol: "udp"}},
+		ModuleNames:  []string{"netbios_ns"},
+		Destinations: map[string]string{"ipv4": "224.0.0.251", "ipv6": "ff02::fb"},
+	}, s)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteServiceXML(&buf, s))
+	assert.Contains(t, buf.String(), `<helper name="netbios_ns"></helper>`)
+
+	roundTrip, err := ReadServiceXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, s, roundTrip)
+}
@@ -0,0 +1,578 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Packet is a hypothetical new connection to the host, see State.Simulate.
+type Packet struct {
+	// Address family: ipv4, ipv6 or empty to derive it from Source.
+	Family string
+	Source net.IP
+	// Destination address, only needed for services with destinations
+	// and rich rules with a destination.
+	Destination net.IP
+	// Source MAC address, only needed for MAC sources.
+	SourceMAC net.HardwareAddr
+	// Ingress interface.
+	Interface string
+	// tcp, udp, sctp, dccp, icmp, ipv6-icmp or any other protocol name.
+	Protocol   string
+	Port       uint16
+	SourcePort uint16
+	// ICMP type for icmp and ipv6-icmp packets, e.g. "echo-request".
+	ICMPType string
+}
+
+// Verdict is the fate of a simulated packet.
+type Verdict string
+
+const (
+	VerdictAccept Verdict = "accept"
+	VerdictReject Verdict = "reject"
+	VerdictDrop   Verdict = "drop"
+)
+
+// Decision explains the verdict of a simulated packet.
+type Decision struct {
+	// Zone the packet was assigned to.
+	Zone string
+	// Why the zone was chosen: "source 10.0.0.0/8", "interface eth0" or "default".
+	ZoneMatch string
+	// Policy that decided the verdict, empty if the zone decided.
+	Policy string
+	// Deciding rule, e.g. "service ssh", "port 8080/tcp", a rich rule or "target DROP".
+	Rule    string
+	Verdict Verdict
+}
+
+func (d Decision) String() string {
+	by := "zone " + d.Zone
+	if len(d.Policy) > 0 {
+		by = "policy " + d.Policy
+	}
+	return fmt.Sprintf("%s by %s: %s (zone %s from %s)", d.Verdict, by, d.Rule, d.Zone, d.ZoneMatch)
+}
+
+// Simulate evaluates a packet against the state like firewalld would for
+// a new connection to the host, without talking to firewalld.
+// Services and ipsets referenced by the zones and policies must be part of the state.
+//
+// The zone is chosen by source first, then by ingress interface, then the default zone.
+// If several sources match, the longest address prefix wins, MAC and ipset
+// sources rank after addresses, and ties go to the zone that sorts first.
+//
+// Policies from the zone to HOST with a negative priority are evaluated
+// before the zone, the others after it. Within a zone or policy, rich rules
+// with a negative priority come first, then rejecting rich rules and ICMP blocks,
+// then accepting rich rules, services, ports, protocols and source ports,
+// then rich rules with a positive priority. Rules that only log or mark never decide.
+// Only address, network and MAC ipset entries are matched.
+func (s State) Simulate(p Packet) (Decision, error) {
+	sim := &simulator{state: s, packet: p}
+	if err := sim.init(); err != nil {
+		return Decision{}, err
+	}
+
+	zone, match, err := sim.zone()
+	if err != nil {
+		return Decision{}, err
+	}
+	d := Decision{Zone: zone, ZoneMatch: match}
+	settings := s.Zones[zone]
+
+	pre, post := sim.policies(zone)
+	for _, name := range pre {
+		if ok, err := sim.policy(&d, name); err != nil || ok {
+			return d, err
+		}
+	}
+
+	rule, verdict, ok, err := sim.evaluate(simRules{
+		services:           settings.Services,
+		ports:              settings.Ports,
+		protocols:          settings.Protocols,
+		sourcePorts:        settings.SourcePorts,
+		icmpBlocks:         settings.ICMPBlocks,
+		icmpBlockInversion: settings.ICMPBlockInversion,
+		richRules:          settings.RichRules,
+	})
+	if err != nil {
+		return Decision{}, fmt.Errorf("zone %s: %w", zone, err)
+	}
+	if ok {
+		d.Rule, d.Verdict = rule, verdict
+		return d, nil
+	}
+	if verdict, ok := targetVerdict(settings.Target); ok {
+		d.Rule, d.Verdict = "target "+settings.Target, verdict
+		return d, nil
+	}
+
+	for _, name := range post {
+		if ok, err := sim.policy(&d, name); err != nil || ok {
+			return d, err
+		}
+	}
+
+	// The default target allows ICMP and rejects everything else.
+	d.Rule, d.Verdict = "target default", VerdictReject
+	if sim.icmp() {
+		d.Verdict = VerdictAccept
+	}
+	return d, nil
+}
+
+type simulator struct {
+	state  State
+	packet Packet
+}
+
+// simRules are the rule settings shared by zones and policies.
+type simRules struct {
+	services           []string
+	ports              []Port
+	protocols          []string
+	sourcePorts        []Port
+	icmpBlocks         []string
+	icmpBlockInversion bool
+	richRules          []string
+}
+
+func (sim *simulator) init() error {
+	p := &sim.packet
+	if p.Source != nil {
+		family := "ipv6"
+		if p.Source.To4() != nil {
+			family = "ipv4"
+		}
+		if len(p.Family) == 0 {
+			p.Family = family
+		} else if p.Family != family {
+			return fmt.Errorf("packet family %s does not match source %s", p.Family, p.Source)
+		}
+	}
+	switch p.Family {
+	case "ipv4", "ipv6":
+		return nil
+	case "":
+		return fmt.Errorf("packet family unknown, set Family or Source")
+	}
+	return fmt.Errorf("invalid packet family %q, expected ipv4 or ipv6", p.Family)
+}
+
+func (sim *simulator) icmp() bool {
+	switch sim.packet.Protocol {
+	case "icmp", "ipv6-icmp", "icmpv6":
+		return true
+	}
+	return false
+}
+
+// zone returns the zone of the packet and why it was chosen.
+func (sim *simulator) zone() (string, string, error) {
+	p := sim.packet
+	names := sortedKeys(sim.state.Zones)
+
+	zone, match, rank := "", "", -2
+	for _, name := range names {
+		settings := sim.state.Zones[name]
+		sources, err := settings.Sources()
+		if err != nil {
+			return "", "", fmt.Errorf("zone %s: %w", name, err)
+		}
+		for _, src := range sources {
+			r := -1
+			switch src.Kind {
+			case SourceAddress:
+				if p.Source == nil || !src.Contains(p.Source) {
+					continue
+				}
+				r, _ = src.Network.Mask.Size()
+			case SourceMAC:
+				if p.SourceMAC == nil || src.MAC.String() != p.SourceMAC.String() {
+					continue
+				}
+			case SourceIPSet:
+				ok, err := sim.ipsetContains(src.IPSet)
+				if err != nil {
+					return "", "", fmt.Errorf("zone %s: %w", name, err)
+				}
+				if !ok {
+					continue
+				}
+			}
+			if r > rank {
+				zone, match, rank = name, "source "+src.String(), r
+			}
+		}
+	}
+	if len(zone) > 0 {
+		return zone, match, nil
+	}
+
+	if len(p.Interface) > 0 {
+		rank = -1
+		for _, name := range names {
+			for _, iface := range sim.state.Zones[name].Interfaces {
+				r := -1
+				switch {
+				case iface == p.Interface:
+					r = len(iface) + 1
+				case strings.HasSuffix(iface, "+") && strings.HasPrefix(p.Interface, iface[:len(iface)-1]):
+					r = len(iface) - 1
+				default:
+					continue
+				}
+				if r > rank {
+					zone, match, rank = name, "interface "+iface, r
+				}
+			}
+		}
+		if len(zone) > 0 {
+			return zone, match, nil
+		}
+	}
+
+	if len(sim.state.DefaultZone) == 0 {
+		return "", "", fmt.Errorf("no zone matches the packet and no default zone is set")
+	}
+	if _, ok := sim.state.Zones[sim.state.DefaultZone]; !ok {
+		return "", "", fmt.Errorf("default zone %s does not exist", sim.state.DefaultZone)
+	}
+	return sim.state.DefaultZone, "default", nil
+}
+
+// policies returns the policies from zone to HOST by priority,
+// split into those evaluated before and after the zone.
+func (sim *simulator) policies(zone string) ([]string, []string) {
+	var names []string
+	for name, policy := range sim.state.Policies {
+		if !containsString(policy.EgressZones, "HOST") {
+			continue
+		}
+		if containsString(policy.IngressZones, zone) || containsString(policy.IngressZones, "ANY") {
+			names = append(names, name)
+		}
+	}
+	policies := sim.state.Policies
+	sort.Slice(names, func(i, j int) bool {
+		a, b := policies[names[i]], policies[names[j]]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return names[i] < names[j]
+	})
+
+	i := sort.Search(len(names), func(i int) bool { return policies[names[i]].Priority >= 0 })
+	return names[:i], names[i:]
+}
+
+// policy evaluates a single policy and records its verdict in d.
+func (sim *simulator) policy(d *Decision, name string) (bool, error) {
+	settings := sim.state.Policies[name]
+	rule, verdict, ok, err := sim.evaluate(simRules{
+		services:    settings.Services,
+		ports:       settings.Ports,
+		protocols:   settings.Protocols,
+		sourcePorts: settings.SourcePorts,
+		icmpBlocks:  settings.ICMPBlocks,
+		richRules:   settings.RichRules,
+	})
+	if err != nil {
+		return false, fmt.Errorf("policy %s: %w", name, err)
+	}
+	if !ok {
+		verdict, ok = targetVerdict(settings.Target)
+		rule = "target " + settings.Target
+	}
+	if ok {
+		d.Policy, d.Rule, d.Verdict = name, rule, verdict
+	}
+	return ok, nil
+}
+
+// targetVerdict returns the verdict of a terminal zone or policy target.
+func targetVerdict(target string) (Verdict, bool) {
+	switch target {
+	case "ACCEPT":
+		return VerdictAccept, true
+	case "DROP":
+		return VerdictDrop, true
+	case "REJECT", "%%REJECT%%":
+		return VerdictReject, true
+	}
+	return "", false
+}
+
+// evaluate returns the first rule deciding the packet, if any.
+func (sim *simulator) evaluate(r simRules) (string, Verdict, bool, error) {
+	var rules []RichRule
+	for i, s := range r.richRules {
+		rule, err := ParseRichRule(s)
+		if err != nil {
+			return "", "", false, fmt.Errorf("RichRules[%d]: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	richRules := func(match func(RichRule, Verdict) bool) (string, Verdict, bool, error) {
+		for _, rule := range rules {
+			verdict, ok := richRuleVerdict(rule)
+			if !ok || !match(rule, verdict) {
+				continue
+			}
+			ok, err := sim.richRuleMatches(rule)
+			if err != nil {
+				return "", "", false, fmt.Errorf("rule %q: %w", rule, err)
+			}
+			if ok {
+				return rule.String(), verdict, true, nil
+			}
+		}
+		return "", "", false, nil
+	}
+
+	// Rich rules with a negative priority.
+	if rule, verdict, ok, err := richRules(func(rule RichRule, _ Verdict) bool {
+		return rule.Priority < 0
+	}); err != nil || ok {
+		return rule, verdict, ok, err
+	}
+
+	// Rich rules and ICMP blocks that deny.
+	if rule, verdict, ok, err := richRules(func(rule RichRule, v Verdict) bool {
+		return rule.Priority == 0 && v != VerdictAccept
+	}); err != nil || ok {
+		return rule, verdict, ok, err
+	}
+	if sim.icmp() && len(sim.packet.ICMPType) > 0 {
+		blocked := containsString(r.icmpBlocks, sim.packet.ICMPType)
+		if r.icmpBlockInversion && !blocked {
+			return "icmp-block-inversion", VerdictReject, true, nil
+		}
+		if !r.icmpBlockInversion && blocked {
+			return "icmp-block " + sim.packet.ICMPType, VerdictReject, true, nil
+		}
+	}
+
+	// Rich rules and settings that allow.
+	if rule, verdict, ok, err := richRules(func(rule RichRule, v Verdict) bool {
+		return rule.Priority == 0 && v == VerdictAccept
+	}); err != nil || ok {
+		return rule, verdict, ok, err
+	}
+	for _, service := range r.services {
+		ok, err := sim.serviceMatches(service)
+		if err != nil {
+			return "", "", false, err
+		}
+		if ok {
+			return "service " + service, VerdictAccept, true, nil
+		}
+	}
+	for _, port := range r.ports {
+		ok, err := portMatches(port, sim.packet.Protocol, sim.packet.Port)
+		if err != nil {
+			return "", "", false, err
+		}
+		if ok {
+			return "port " + port.Port + "/" + port.Protocol, VerdictAccept, true, nil
+		}
+	}
+	if containsString(r.protocols, sim.packet.Protocol) {
+		return "protocol " + sim.packet.Protocol, VerdictAccept, true, nil
+	}
+	for _, port := range r.sourcePorts {
+		ok, err := portMatches(port, sim.packet.Protocol, sim.packet.SourcePort)
+		if err != nil {
+			return "", "", false, err
+		}
+		if ok {
+			return "source-port " + port.Port + "/" + port.Protocol, VerdictAccept, true, nil
+		}
+	}
+
+	// Rich rules with a positive priority.
+	return richRules(func(rule RichRule, _ Verdict) bool {
+		return rule.Priority > 0
+	})
+}
+
+// richRuleVerdict returns the verdict of a rule, false if it only logs or marks.
+func richRuleVerdict(r RichRule) (Verdict, bool) {
+	if len(r.ICMPBlock) > 0 {
+		return VerdictReject, true
+	}
+	if r.Action == nil {
+		return "", false
+	}
+	switch r.Action.Type {
+	case RichRuleAccept:
+		return VerdictAccept, true
+	case RichRuleReject:
+		return VerdictReject, true
+	case RichRuleDrop:
+		return VerdictDrop, true
+	}
+	return "", false
+}
+
+func (sim *simulator) richRuleMatches(r RichRule) (bool, error) {
+	p := sim.packet
+	if len(r.Family) > 0 && r.Family != p.Family {
+		return false, nil
+	}
+	for _, a := range []struct {
+		addr *RichRuleAddress
+		ip   net.IP
+		mac  net.HardwareAddr
+	}{
+		{addr: r.Source, ip: p.Source, mac: p.SourceMAC},
+		{addr: r.Destination, ip: p.Destination},
+	} {
+		if a.addr == nil {
+			continue
+		}
+		ok, err := sim.addressMatches(a.addr, a.ip, a.mac)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	switch {
+	case len(r.Service) > 0:
+		return sim.serviceMatches(r.Service)
+	case r.Port != nil:
+		return portMatches(*r.Port, p.Protocol, p.Port)
+	case len(r.Protocol) > 0:
+		return r.Protocol == p.Protocol, nil
+	case len(r.ICMPBlock) > 0:
+		return sim.icmp() && r.ICMPBlock == p.ICMPType, nil
+	case len(r.ICMPType) > 0:
+		return sim.icmp() && r.ICMPType == p.ICMPType, nil
+	case r.SourcePort != nil:
+		return portMatches(*r.SourcePort, p.Protocol, p.SourcePort)
+	case r.Masquerade || r.ForwardPort != nil:
+		// Not part of the input filter.
+		return false, nil
+	}
+	return true, nil
+}
+
+func (sim *simulator) addressMatches(a *RichRuleAddress, ip net.IP, mac net.HardwareAddr) (bool, error) {
+	var ok bool
+	switch {
+	case len(a.Address) > 0:
+		src, err := ParseSource(a.Address)
+		if err != nil {
+			return false, err
+		}
+		ok = ip != nil && src.Contains(ip)
+	case len(a.MAC) > 0:
+		ok = mac != nil && strings.EqualFold(a.MAC, mac.String())
+	case len(a.IPSet) > 0:
+		var err error
+		ok, err = sim.ipsetContains(a.IPSet)
+		if err != nil {
+			return false, err
+		}
+	}
+	return ok != a.Invert, nil
+}
+
+// ipsetContains returns true if the ipset has an entry matching the packet source.
+func (sim *simulator) ipsetContains(name string) (bool, error) {
+	ipset, ok := sim.state.IPSets[name]
+	if !ok {
+		return false, fmt.Errorf("unknown ipset %q", name)
+	}
+	p := sim.packet
+	for _, entry := range ipset.Entries {
+		src, err := ParseSource(entry)
+		if err != nil {
+			continue
+		}
+		switch src.Kind {
+		case SourceAddress:
+			if p.Source != nil && src.Contains(p.Source) {
+				return true, nil
+			}
+		case SourceMAC:
+			if p.SourceMAC != nil && src.MAC.String() == p.SourceMAC.String() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// serviceMatches resolves a service and matches its ports, protocols,
+// source ports and destinations.
+func (sim *simulator) serviceMatches(name string) (bool, error) {
+	service, ok := sim.state.Services[name]
+	if !ok {
+		return false, fmt.Errorf("unknown service %q", name)
+	}
+	p := sim.packet
+	if len(service.Destinations) > 0 {
+		destination, ok := service.Destinations[p.Family]
+		if !ok || p.Destination == nil {
+			return false, nil
+		}
+		src, err := ParseSource(destination)
+		if err != nil {
+			return false, fmt.Errorf("service %s: %w", name, err)
+		}
+		if !src.Contains(p.Destination) {
+			return false, nil
+		}
+	}
+	for _, port := range service.Ports {
+		ok, err := portMatches(port, p.Protocol, p.Port)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	if containsString(service.Protocols, p.Protocol) {
+		return true, nil
+	}
+	for _, port := range service.SourcePorts {
+		ok, err := portMatches(port, p.Protocol, p.SourcePort)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func portMatches(port Port, protocol string, n uint16) (bool, error) {
+	if port.Protocol != protocol || n == 0 {
+		return false, nil
+	}
+	r, err := port.Range()
+	if err != nil {
+		return false, err
+	}
+	return r.ContainsPort(n), nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func simulateState() State {
+	return State{
+		DefaultZone: "public",
+		Zones: map[string]ZoneSettings{
+			"public": {
+				Target:     "default",
+				Services:   []string{"http"},
+				ICMPBlocks: []string{"timestamp-request"},
+				Interfaces: []string{"eth0"},
+				RichRules: []string{
+					`rule family="ipv4" source address="198.51.100.0/24" drop`,
+					`rule priority="-10" family="ipv4" source address="198.51.100.7" service name="http" accept`,
+				},
+			},
+			"mgmt": {
+				Target:          "DROP",
+				Services:        []string{"ssh"},
+				SourceAddresses: []string{"10.0.0.0/8", "ipset:admins"},
+			},
+			"lab": {
+				Target:          "%%REJECT%%",
+				Ports:           []Port{{Port: "8000-8100", Protocol: "tcp"}},
+				SourceAddresses: []string{"10.1.0.0/16"},
+				Interfaces:      []string{"veth+"},
+			},
+			"trusted": {
+				Target:     "ACCEPT",
+				Interfaces: []string{"veth7"},
+			},
+		},
+		Services: map[string]ServiceSettings{
+			"http": {Ports: []Port{{Port: "80", Protocol: "tcp"}}},
+			"ssh":  {Ports: []Port{{Port: "22", Protocol: "tcp"}}},
+		},
+		IPSets: map[string]IPSetSettings{
+			"admins": {Type: "hash:ip", Entries: []string{"192.0.2.10"}},
+		},
+		Policies: map[string]PolicySettings{
+			"block-smtp": {
+				Target:       "CONTINUE",
+				Priority:     -5,
+				IngressZones: []string{"ANY"},
+				EgressZones:  []string{"HOST"},
+				RichRules:    []string{`rule port port="25" protocol="tcp" reject`},
+			},
+			"allow-dns": {
+				Target:       "CONTINUE",
+				Priority:     10,
+				IngressZones: []string{"public"},
+				EgressZones:  []string{"HOST"},
+				Ports:        []Port{{Port: "53", Protocol: "udp"}},
+			},
+		},
+	}
+}
+
+func TestState_Simulate(t *testing.T) {
+	tests := []struct {
+		name     string
+		packet   Packet
+		expected Decision
+	}{
+		{
+			name:   "ssh from mgmt network",
+			packet: Packet{Source: net.ParseIP("10.2.3.4"), Interface: "eth0", Protocol: "tcp", Port: 22},
+			expected: Decision{
+				Zone: "mgmt", ZoneMatch: "source 10.0.0.0/8", Rule: "service ssh", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "ssh from internet",
+			packet: Packet{Source: net.ParseIP("203.0.113.1"), Interface: "eth0", Protocol: "tcp", Port: 22},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0", Rule: "target default", Verdict: VerdictReject,
+			},
+		},
+		{
+			name:   "http from internet",
+			packet: Packet{Source: net.ParseIP("203.0.113.1"), Interface: "eth0", Protocol: "tcp", Port: 80},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0", Rule: "service http", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "http from dropped network",
+			packet: Packet{Source: net.ParseIP("198.51.100.1"), Interface: "eth0", Protocol: "tcp", Port: 80},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0",
+				Rule: `rule family="ipv4" source address="198.51.100.0/24" drop`, Verdict: VerdictDrop,
+			},
+		},
+		{
+			name:   "negative priority rich rule before deny",
+			packet: Packet{Source: net.ParseIP("198.51.100.7"), Interface: "eth0", Protocol: "tcp", Port: 80},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0",
+				Rule:    `rule priority="-10" family="ipv4" source address="198.51.100.7" service name="http" accept`,
+				Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "longest source prefix",
+			packet: Packet{Source: net.ParseIP("10.1.2.3"), Protocol: "tcp", Port: 22},
+			expected: Decision{
+				Zone: "lab", ZoneMatch: "source 10.1.0.0/16", Rule: "target %%REJECT%%", Verdict: VerdictReject,
+			},
+		},
+		{
+			name:   "ipset source",
+			packet: Packet{Source: net.ParseIP("192.0.2.10"), Interface: "eth0", Protocol: "udp", Port: 53},
+			expected: Decision{
+				Zone: "mgmt", ZoneMatch: "source ipset:admins", Rule: "target DROP", Verdict: VerdictDrop,
+			},
+		},
+		{
+			name:   "exact interface before wildcard",
+			packet: Packet{Family: "ipv6", Interface: "veth7", Protocol: "tcp", Port: 443},
+			expected: Decision{
+				Zone: "trusted", ZoneMatch: "interface veth7", Rule: "target ACCEPT", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "wildcard interface",
+			packet: Packet{Family: "ipv6", Interface: "veth1", Protocol: "tcp", Port: 8080},
+			expected: Decision{
+				Zone: "lab", ZoneMatch: "interface veth+", Rule: "port 8000-8100/tcp", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "default zone",
+			packet: Packet{Source: net.ParseIP("2001:db8::1"), Interface: "wlan0", Protocol: "tcp", Port: 80},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "default", Rule: "service http", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "policy before zone",
+			packet: Packet{Source: net.ParseIP("10.2.3.4"), Protocol: "tcp", Port: 25},
+			expected: Decision{
+				Zone: "mgmt", ZoneMatch: "source 10.0.0.0/8", Policy: "block-smtp",
+				Rule: `rule port port="25" protocol="tcp" reject`, Verdict: VerdictReject,
+			},
+		},
+		{
+			name:   "policy after zone",
+			packet: Packet{Source: net.ParseIP("203.0.113.1"), Interface: "eth0", Protocol: "udp", Port: 53},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0", Policy: "allow-dns",
+				Rule: "port 53/udp", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "zone target before policy",
+			packet: Packet{Source: net.ParseIP("10.2.3.4"), Protocol: "udp", Port: 53},
+			expected: Decision{
+				Zone: "mgmt", ZoneMatch: "source 10.0.0.0/8", Rule: "target DROP", Verdict: VerdictDrop,
+			},
+		},
+		{
+			name:   "icmp allowed by default target",
+			packet: Packet{Source: net.ParseIP("203.0.113.1"), Interface: "eth0", Protocol: "icmp", ICMPType: "echo-request"},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0", Rule: "target default", Verdict: VerdictAccept,
+			},
+		},
+		{
+			name:   "icmp block",
+			packet: Packet{Source: net.ParseIP("203.0.113.1"), Interface: "eth0", Protocol: "icmp", ICMPType: "timestamp-request"},
+			expected: Decision{
+				Zone: "public", ZoneMatch: "interface eth0", Rule: "icmp-block timestamp-request", Verdict: VerdictReject,
+			},
+		},
+	}
+	state := simulateState()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := state.Simulate(test.packet)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, d)
+		})
+	}
+}
+
+func TestState_Simulate_ICMPBlockInversion(t *testing.T) {
+	state := State{
+		DefaultZone: "public",
+		Zones: map[string]ZoneSettings{
+			"public": {ICMPBlocks: []string{"echo-request"}, ICMPBlockInversion: true},
+		},
+	}
+
+	d, err := state.Simulate(Packet{Family: "ipv4", Protocol: "icmp", ICMPType: "echo-request"})
+	require.NoError(t, err)
+	assert.Equal(t, VerdictAccept, d.Verdict)
+
+	d, err = state.Simulate(Packet{Family: "ipv4", Protocol: "icmp", ICMPType: "timestamp-request"})
+	require.NoError(t, err)
+	assert.Equal(t, Decision{
+		Zone: "public", ZoneMatch: "default", Rule: "icmp-block-inversion", Verdict: VerdictReject,
+	}, d)
+}
+
+func TestState_Simulate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  State
+		packet Packet
+	}{
+		{
+			name:   "unknown family",
+			state:  simulateState(),
+			packet: Packet{Interface: "eth0", Protocol: "tcp", Port: 22},
+		},
+		{
+			name:   "family mismatch",
+			state:  simulateState(),
+			packet: Packet{Family: "ipv6", Source: net.ParseIP("192.0.2.1"), Protocol: "tcp", Port: 22},
+		},
+		{
+			name:   "no default zone",
+			state:  State{Zones: map[string]ZoneSettings{"public": {}}},
+			packet: Packet{Family: "ipv4", Protocol: "tcp", Port: 22},
+		},
+		{
+			name: "unknown service",
+			state: State{
+				DefaultZone: "public",
+				Zones:       map[string]ZoneSettings{"public": {Services: []string{"ssh"}}},
+			},
+			packet: Packet{Family: "ipv4", Protocol: "tcp", Port: 22},
+		},
+		{
+			name: "invalid rich rule",
+			state: State{
+				DefaultZone: "public",
+				Zones:       map[string]ZoneSettings{"public": {RichRules: []string{"rule bogus"}}},
+			},
+			packet: Packet{Family: "ipv4", Protocol: "tcp", Port: 22},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.state.Simulate(test.packet)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,637 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Snapshot is the complete permanent and runtime configuration of firewalld,
+// as captured by Client.Snapshot. It can be serialized as JSON.
+type Snapshot struct {
+	// Version of the firewalld daemon the snapshot was taken from.
+	Version     string `json:"version"`
+	DefaultZone string `json:"defaultZone"`
+	// Properties of the permanent configuration, e.g. "FirewallBackend",
+	// formatted as strings.
+	Properties map[string]string `json:"properties"`
+	Permanent  SnapshotConfig    `json:"permanent"`
+	Runtime    SnapshotConfig    `json:"runtime"`
+}
+
+// SnapshotConfig holds all objects of either the permanent or the runtime configuration.
+// Policies are nil on firewalld versions without policy support.
+type SnapshotConfig struct {
+	Zones     map[string]ZoneSettings     `json:"zones"`
+	Services  map[string]ServiceSettings  `json:"services"`
+	IPSets    map[string]IPSetSettings    `json:"ipsets"`
+	ICMPTypes map[string]ICMPTypeSettings `json:"icmptypes"`
+	Policies  map[string]PolicySettings   `json:"policies"`
+	// Only part of the permanent configuration.
+	Helpers map[string]HelperSettings `json:"helpers,omitempty"`
+	Direct  DirectSettings            `json:"direct"`
+	// Only part of the runtime configuration,
+	// lockdown is enabled permanently by the "Lockdown" property.
+	Lockdown          bool              `json:"lockdown,omitempty"`
+	LockdownWhitelist LockdownWhitelist `json:"lockdownWhitelist"`
+}
+
+// Snapshot captures the permanent and runtime configuration: all zones, services, ipsets
+// (including their entries), icmptypes, policies and helpers, the direct configuration,
+// lockdown, the default zone and the properties of the permanent configuration.
+// Restore puts firewalld back into the captured state, e.g. after a failed upgrade.
+func (c *Client) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snapshot := &Snapshot{Properties: map[string]string{}}
+
+	var err error
+	if snapshot.Version, err = c.Version(ctx); err != nil {
+		return nil, fmt.Errorf("version: %w", err)
+	}
+	if snapshot.DefaultZone, err = c.GetDefaultZone(ctx); err != nil {
+		return nil, fmt.Errorf("default zone: %w", err)
+	}
+	properties, err := c.config.GetProperties(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("properties: %w", err)
+	}
+	for name, v := range properties {
+		snapshot.Properties[name] = fmt.Sprint(v.Value())
+	}
+
+	if err := c.snapshotPermanent(ctx, &snapshot.Permanent); err != nil {
+		return nil, fmt.Errorf("permanent configuration: %w", err)
+	}
+	if err := c.snapshotRuntime(ctx, &snapshot.Runtime); err != nil {
+		return nil, fmt.Errorf("runtime configuration: %w", err)
+	}
+	return snapshot, nil
+}
+
+func (c *Client) snapshotPermanent(ctx context.Context, s *SnapshotConfig) error {
+	cc := c.config
+	s.Zones = map[string]ZoneSettings{}
+	s.Services = map[string]ServiceSettings{}
+	s.IPSets = map[string]IPSetSettings{}
+	s.ICMPTypes = map[string]ICMPTypeSettings{}
+	s.Policies = map[string]PolicySettings{}
+	s.Helpers = map[string]HelperSettings{}
+
+	err := snapshotObjects(ctx, "zone", cc.GetZoneNames, func(name string) (err error) {
+		s.Zones[name], err = cc.GetZoneSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "service", cc.GetServiceNames, func(name string) (err error) {
+		s.Services[name], err = cc.GetServiceSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "ipset", cc.GetIPSetNames, func(name string) (err error) {
+		s.IPSets[name], err = cc.GetIPSetSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "icmptype", cc.GetICMPTypeNames, func(name string) (err error) {
+		s.ICMPTypes[name], err = cc.GetICMPTypeSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "helper", cc.GetHelperNames, func(name string) (err error) {
+		s.Helpers[name], err = cc.GetHelperSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "policy", cc.GetPolicyNames, func(name string) (err error) {
+		s.Policies[name], err = cc.GetPolicySettings(ctx, name)
+		return err
+	})
+	if isUnknownMethod(err) {
+		s.Policies = nil
+	} else if err != nil {
+		return err
+	}
+
+	if s.Direct, err = cc.GetDirectSettings(ctx); err != nil {
+		return fmt.Errorf("direct: %w", err)
+	}
+	if s.LockdownWhitelist, err = cc.GetLockdownWhitelist(ctx); err != nil {
+		return fmt.Errorf("lockdown whitelist: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) snapshotRuntime(ctx context.Context, s *SnapshotConfig) error {
+	s.Zones = map[string]ZoneSettings{}
+	s.Services = map[string]ServiceSettings{}
+	s.IPSets = map[string]IPSetSettings{}
+	s.ICMPTypes = map[string]ICMPTypeSettings{}
+	s.Policies = map[string]PolicySettings{}
+
+	err := snapshotObjects(ctx, "zone", c.GetZones, func(name string) (err error) {
+		s.Zones[name], err = c.GetZoneSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "service", c.ListServices, func(name string) (err error) {
+		s.Services[name], err = c.GetServiceSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "ipset", c.GetIPSets, func(name string) (err error) {
+		s.IPSets[name], err = c.GetIPSetSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "icmptype", c.ListICMPTypes, func(name string) (err error) {
+		s.ICMPTypes[name], err = c.GetICMPTypeSettings(ctx, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = snapshotObjects(ctx, "policy", c.GetPolicies, func(name string) (err error) {
+		s.Policies[name], err = c.GetPolicySettings(ctx, name)
+		return err
+	})
+	if isUnknownMethod(err) {
+		s.Policies = nil
+	} else if err != nil {
+		return err
+	}
+
+	if s.Direct, err = c.GetDirectSettings(ctx); err != nil {
+		return fmt.Errorf("direct: %w", err)
+	}
+	if s.Lockdown, err = c.QueryLockdown(ctx); err != nil {
+		return fmt.Errorf("lockdown: %w", err)
+	}
+	if s.LockdownWhitelist, err = c.GetLockdownWhitelist(ctx); err != nil {
+		return fmt.Errorf("lockdown whitelist: %w", err)
+	}
+	return nil
+}
+
+// snapshotObjects calls get for every object listed by names.
+// Errors of names are returned unwrapped, so callers can check for unknown methods.
+func snapshotObjects(
+	ctx context.Context, kind string,
+	names func(ctx context.Context) ([]string, error),
+	get func(name string) error,
+) error {
+	list, err := names(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range list {
+		if err := get(name); err != nil {
+			return fmt.Errorf("%s %s: %w", kind, name, err)
+		}
+	}
+	return nil
+}
+
+// Restore puts firewalld back into the state of a snapshot.
+//
+// The permanent configuration is restored first: properties, objects (removing objects
+// created after the snapshot), direct configuration and lockdown whitelist.
+// After a reload, the default zone and the runtime-only changes of zones, ipset entries,
+// policies, the direct configuration and the lockdown whitelist are re-applied.
+// Lockdown is restored last, so it can't lock out the restore itself.
+//
+// Services, icmptypes and helpers can't be changed at runtime,
+// the reload restores them from the permanent configuration.
+func (c *Client) Restore(ctx context.Context, snapshot *Snapshot) error {
+	if err := c.restoreProperties(ctx, snapshot.Properties, false); err != nil {
+		return err
+	}
+	if err := c.restorePermanent(ctx, &snapshot.Permanent); err != nil {
+		return fmt.Errorf("restore permanent configuration: %w", err)
+	}
+	if err := c.Reload(ctx); err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+
+	current, err := c.GetDefaultZone(ctx)
+	if err != nil {
+		return fmt.Errorf("default zone: %w", err)
+	}
+	if current != snapshot.DefaultZone {
+		if err := c.SetDefaultZone(ctx, snapshot.DefaultZone); err != nil {
+			return fmt.Errorf("default zone: %w", err)
+		}
+	}
+
+	if err := c.restoreRuntime(ctx, &snapshot.Runtime); err != nil {
+		return fmt.Errorf("restore runtime configuration: %w", err)
+	}
+	if err := c.restoreProperties(ctx, snapshot.Properties, true); err != nil {
+		return err
+	}
+	return c.restoreLockdown(ctx, snapshot.Runtime.Lockdown)
+}
+
+// restoreProperties sets changed properties to their snapshot values,
+// either only the "Lockdown" property or all others.
+// The default zone is restored through SetDefaultZone instead.
+func (c *Client) restoreProperties(
+	ctx context.Context, properties map[string]string, lockdown bool) error {
+	current, err := c.config.GetProperties(ctx)
+	if err != nil {
+		return fmt.Errorf("properties: %w", err)
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "DefaultZone" || (name == "Lockdown") != lockdown {
+			continue
+		}
+		v, ok := current[name]
+		if !ok {
+			// not supported by this firewalld version
+			continue
+		}
+		if fmt.Sprint(v.Value()) == properties[name] {
+			continue
+		}
+		value, err := parsePropertyValue(v.Value(), properties[name])
+		if err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+		if err := c.config.SetProperty(ctx, name, value); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parsePropertyValue converts s to the type of the current property value.
+func parsePropertyValue(current interface{}, s string) (interface{}, error) {
+	switch current.(type) {
+	case string:
+		return s, nil
+	case bool:
+		return strconv.ParseBool(s)
+	case int32:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case uint32:
+		i, err := strconv.ParseUint(s, 10, 32)
+		return uint32(i), err
+	}
+	return nil, fmt.Errorf("unsupported type %T", current)
+}
+
+func (c *Client) restorePermanent(ctx context.Context, s *SnapshotConfig) error {
+	_, err := c.Reconcile(ctx, State{
+		Zones:     s.Zones,
+		Services:  s.Services,
+		IPSets:    s.IPSets,
+		ICMPTypes: s.ICMPTypes,
+		Policies:  s.Policies,
+		Helpers:   s.Helpers,
+	})
+	if err != nil {
+		return err
+	}
+
+	direct, err := c.config.GetDirectSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("direct: %w", err)
+	}
+	if !equalStringSets(directEntries(direct), directEntries(s.Direct)) {
+		if err := c.config.UpdateDirectSettings(ctx, s.Direct); err != nil {
+			return fmt.Errorf("direct: %w", err)
+		}
+	}
+
+	whitelist, err := c.config.GetLockdownWhitelist(ctx)
+	if err != nil {
+		return fmt.Errorf("lockdown whitelist: %w", err)
+	}
+	if !equalStringSets(whitelistEntries(whitelist), whitelistEntries(s.LockdownWhitelist)) {
+		if err := c.config.SetLockdownWhitelist(ctx, s.LockdownWhitelist); err != nil {
+			return fmt.Errorf("lockdown whitelist: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) restoreRuntime(ctx context.Context, s *SnapshotConfig) error {
+	if err := c.restoreRuntimeZones(ctx, s.Zones); err != nil {
+		return err
+	}
+
+	for _, name := range sortedKeys(s.IPSets) {
+		current, err := c.GetIPSetSettings(ctx, name)
+		if err != nil {
+			return fmt.Errorf("ipset %s: %w", name, err)
+		}
+		added, removed := diffStrings(current.Entries, s.IPSets[name].Entries)
+		for _, entry := range removed {
+			if err := c.ipsetCall(ctx, "removeEntry", name, entry); err != nil {
+				return fmt.Errorf("ipset %s: remove entry %s: %w", name, entry, err)
+			}
+		}
+		for _, entry := range added {
+			if err := c.ipsetCall(ctx, "addEntry", name, entry); err != nil {
+				return fmt.Errorf("ipset %s: add entry %s: %w", name, entry, err)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(s.Policies) {
+		current, err := c.GetPolicySettings(ctx, name)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", name, err)
+		}
+		desired := s.Policies[name]
+		if len(compareDriftFields("policy", name, current.driftFields(), desired.driftFields())) == 0 {
+			continue
+		}
+		err = c.main.Call(ctx,
+			NewCall(setPolicySettingsMethod, 0).
+				WithArguments(name, desired.ToMap()))
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", name, err)
+		}
+	}
+
+	if err := c.restoreRuntimeDirect(ctx, s.Direct); err != nil {
+		return fmt.Errorf("direct: %w", err)
+	}
+	if err := c.restoreRuntimeWhitelist(ctx, s.LockdownWhitelist); err != nil {
+		return fmt.Errorf("lockdown whitelist: %w", err)
+	}
+	return nil
+}
+
+// restoreRuntimeZones applies the differences between the current runtime zones and zones.
+// Settings that can only be changed through reload are skipped.
+// Removals of all zones are applied before additions, so interfaces and sources
+// moved between zones are never bound to two zones at once.
+func (c *Client) restoreRuntimeZones(ctx context.Context, zones map[string]ZoneSettings) error {
+	names := sortedKeys(zones)
+	removals := map[string][]ZoneChange{}
+	additions := map[string][]ZoneChange{}
+	for _, name := range names {
+		current, err := c.GetZoneSettings(ctx, name)
+		if err != nil {
+			return fmt.Errorf("runtime zone %s: %w", name, err)
+		}
+
+		for _, change := range DiffZoneSettings(current, zones[name]).Changes() {
+			switch {
+			case strings.HasPrefix(change.Method, "set"):
+				// only possible through reload, which already happened.
+			case strings.HasPrefix(change.Method, "remove"):
+				removals[name] = append(removals[name], change)
+			default:
+				additions[name] = append(additions[name], change)
+			}
+		}
+	}
+
+	for _, changes := range []map[string][]ZoneChange{removals, additions} {
+		for _, name := range names {
+			if err := c.ApplyZoneChanges(ctx, name, changes[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const setPolicySettingsMethod = "org.fedoraproject.FirewallD1.policy.setPolicySettings"
+
+func (c *Client) ipsetCall(ctx context.Context, member string, args ...interface{}) error {
+	return c.main.Call(ctx,
+		NewCall("org.fedoraproject.FirewallD1.ipset."+member, 0).
+			WithArguments(args...))
+}
+
+// restoreRuntimeDirect removes runtime direct entries not in s and adds the missing ones.
+// Rules are removed before their chains and added after them.
+func (c *Client) restoreRuntimeDirect(ctx context.Context, s DirectSettings) error {
+	current, err := c.GetDirectSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	// entry is a chain, rule or passthrough with the arguments of its add and remove methods.
+	type entry struct {
+		kind string
+		key  string
+		args []interface{}
+	}
+	entries := func(s DirectSettings) [][]entry {
+		var chains, rules, passthroughs []entry
+		for _, ch := range s.Chains {
+			chains = append(chains, entry{"Chain", directChainKey(ch),
+				[]interface{}{ch.IPV, ch.Table, ch.Chain}})
+		}
+		for _, r := range s.Rules {
+			rules = append(rules, entry{"Rule", directRuleKey(r),
+				[]interface{}{r.IPV, r.Table, r.Chain, int32(r.Priority), nonNilStrings(r.Args)}})
+		}
+		for _, p := range s.Passthroughs {
+			passthroughs = append(passthroughs, entry{"Passthrough", directPassthroughKey(p),
+				[]interface{}{p.IPV, nonNilStrings(p.Args)}})
+		}
+		return [][]entry{chains, rules, passthroughs}
+	}
+	// missing returns the entries of a not in b.
+	missing := func(a, b []entry) []entry {
+		keys := map[string]bool{}
+		for _, e := range b {
+			keys[e.key] = true
+		}
+		var out []entry
+		for _, e := range a {
+			if !keys[e.key] {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	call := func(method string, e entry) error {
+		err := c.main.Call(ctx,
+			NewCall(directInterface+"."+method+e.kind, 0).
+				WithArguments(e.args...))
+		if err != nil {
+			return fmt.Errorf("%s%s(%s): %w", method, e.kind, e.key, err)
+		}
+		return nil
+	}
+
+	from, to := entries(current), entries(s)
+	for i := len(from) - 1; i >= 0; i-- {
+		for _, e := range missing(from[i], to[i]) {
+			if err := call("remove", e); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range to {
+		for _, e := range missing(to[i], from[i]) {
+			if err := call("add", e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreRuntimeWhitelist adds and removes runtime lockdown whitelist entries.
+func (c *Client) restoreRuntimeWhitelist(ctx context.Context, w LockdownWhitelist) error {
+	current, err := c.GetLockdownWhitelist(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, list := range []struct {
+		kind             string
+		current, desired []string
+		convert          func(string) interface{}
+	}{
+		{"Command", current.Commands, w.Commands, nil},
+		{"Context", current.Contexts, w.Contexts, nil},
+		{"User", current.Users, w.Users, nil},
+		{"Uid", intStrings(current.UIDs), intStrings(w.UIDs), func(s string) interface{} {
+			i, _ := strconv.Atoi(s)
+			return int32(i)
+		}},
+	} {
+		added, removed := diffStrings(list.current, list.desired)
+		for _, change := range []struct {
+			method string
+			values []string
+		}{{"remove", removed}, {"add", added}} {
+			for _, v := range change.values {
+				var arg interface{} = v
+				if list.convert != nil {
+					arg = list.convert(v)
+				}
+				err := c.main.Call(ctx,
+					NewCall(lockdownInterface+"."+change.method+"LockdownWhitelist"+list.kind, 0).
+						WithArguments(arg))
+				if err != nil {
+					return fmt.Errorf("%s %s %s: %w", change.method, strings.ToLower(list.kind), v, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) restoreLockdown(ctx context.Context, enabled bool) error {
+	current, err := c.QueryLockdown(ctx)
+	if err != nil {
+		return fmt.Errorf("lockdown: %w", err)
+	}
+	switch {
+	case enabled && !current:
+		err = c.EnableLockdown(ctx)
+	case !enabled && current:
+		err = c.DisableLockdown(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("lockdown: %w", err)
+	}
+	return nil
+}
+
+func directChainKey(ch DirectChain) string {
+	return strings.Join([]string{ch.IPV, ch.Table, ch.Chain}, " ")
+}
+
+func directRuleKey(r DirectRule) string {
+	return strings.Join([]string{r.IPV, r.Table, r.Chain, strconv.Itoa(r.Priority), joinArgs(r.Args)}, " ")
+}
+
+func directPassthroughKey(p DirectPassthrough) string {
+	return p.IPV + " " + joinArgs(p.Args)
+}
+
+// directEntries flattens direct settings for comparison.
+func directEntries(s DirectSettings) []string {
+	var out []string
+	for _, ch := range s.Chains {
+		out = append(out, "chain "+directChainKey(ch))
+	}
+	for _, r := range s.Rules {
+		out = append(out, "rule "+directRuleKey(r))
+	}
+	for _, p := range s.Passthroughs {
+		out = append(out, "passthrough "+directPassthroughKey(p))
+	}
+	return out
+}
+
+// whitelistEntries flattens a lockdown whitelist for comparison.
+func whitelistEntries(w LockdownWhitelist) []string {
+	var out []string
+	for _, v := range w.Commands {
+		out = append(out, "command "+v)
+	}
+	for _, v := range w.Contexts {
+		out = append(out, "context "+v)
+	}
+	for _, v := range w.Users {
+		out = append(out, "user "+v)
+	}
+	for _, v := range intStrings(w.UIDs) {
+		out = append(out, "uid "+v)
+	}
+	return out
+}
+
+func intStrings(values []int) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, strconv.Itoa(v))
+	}
+	return out
+}
+
+func equalStringSets(a, b []string) bool {
+	added, removed := diffStrings(a, b)
+	return len(added) == 0 && len(removed) == 0
+}
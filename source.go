@@ -0,0 +1,186 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SourceKind discriminates the forms a zone source can take.
+type SourceKind string
+
+const (
+	// IPv4 or IPv6 address or network.
+	SourceAddress SourceKind = "address"
+	// Ethernet MAC address.
+	SourceMAC SourceKind = "mac"
+	// Reference to an ipset, written as "ipset:name".
+	SourceIPSet SourceKind = "ipset"
+)
+
+const ipsetSourcePrefix = "ipset:"
+
+// Source binds traffic to a zone, see ZoneSettings.SourceAddresses.
+type Source struct {
+	Kind SourceKind
+	// Network for SourceAddress. A single address has a full length mask.
+	Network *net.IPNet
+	// MAC for SourceMAC.
+	MAC net.HardwareAddr
+	// IPSet name for SourceIPSet.
+	IPSet string
+}
+
+// ParseSource parses an IP address ("192.0.2.1"), network ("2001:db8::/32"),
+// MAC address ("00:11:22:33:44:55") or ipset reference ("ipset:blocklist").
+func ParseSource(s string) (Source, error) {
+	if strings.HasPrefix(s, ipsetSourcePrefix) {
+		name := s[len(ipsetSourcePrefix):]
+		if len(name) == 0 {
+			return Source{}, fmt.Errorf("empty ipset name in %q", s)
+		}
+		return Source{Kind: SourceIPSet, IPSet: name}, nil
+	}
+
+	if ip := net.ParseIP(s); ip != nil {
+		return Source{Kind: SourceAddress, Network: hostNetwork(ip)}, nil
+	}
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		if ip4 := network.IP.To4(); ip4 != nil {
+			network.IP = ip4
+		}
+		return Source{Kind: SourceAddress, Network: network}, nil
+	}
+
+	// firewalld only accepts colon separated EUI-48 addresses.
+	if mac, err := net.ParseMAC(s); err == nil && len(mac) == 6 && strings.Count(s, ":") == 5 {
+		return Source{Kind: SourceMAC, MAC: mac}, nil
+	}
+	return Source{}, fmt.Errorf("invalid source %q, expected address, network, mac or ipset:name", s)
+}
+
+// hostNetwork returns a network containing only ip.
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// String returns the source in firewalld notation.
+// Networks are printed with host bits cleared.
+func (s Source) String() string {
+	switch s.Kind {
+	case SourceAddress:
+		if s.Network == nil {
+			return ""
+		}
+		if ones, bits := s.Network.Mask.Size(); ones == bits {
+			return s.Network.IP.String()
+		}
+		return s.Network.String()
+	case SourceMAC:
+		return strings.ToUpper(s.MAC.String())
+	case SourceIPSet:
+		return ipsetSourcePrefix + s.IPSet
+	}
+	return ""
+}
+
+// Family returns "ipv4" or "ipv6" for addresses and "" for other kinds.
+func (s Source) Family() string {
+	if s.Kind != SourceAddress || s.Network == nil {
+		return ""
+	}
+	if s.Network.IP.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// Contains returns true if the source is an address or network including ip.
+// MAC and ipset sources never contain an IP address,
+// as their members are not known to the zone.
+func (s Source) Contains(ip net.IP) bool {
+	return s.Kind == SourceAddress && s.Network != nil && s.Network.Contains(ip)
+}
+
+// Sources parses all source addresses of the zone.
+func (z *ZoneSettings) Sources() ([]Source, error) {
+	var out []Source
+	for i, s := range z.SourceAddresses {
+		src, err := ParseSource(s)
+		if err != nil {
+			return nil, fmt.Errorf("SourceAddresses[%d]: %w", i, err)
+		}
+		out = append(out, src)
+	}
+	return out, nil
+}
+
+// sourcesOfKind returns all valid sources of the given kind, skipping invalid entries.
+func (z *ZoneSettings) sourcesOfKind(kind SourceKind) []Source {
+	var out []Source
+	for _, s := range z.SourceAddresses {
+		src, err := ParseSource(s)
+		if err != nil || src.Kind != kind {
+			continue
+		}
+		out = append(out, src)
+	}
+	return out
+}
+
+// SourceNetworks returns the address and network sources of the zone.
+// Single addresses are returned as networks with a full length mask.
+func (z *ZoneSettings) SourceNetworks() []*net.IPNet {
+	var out []*net.IPNet
+	for _, s := range z.sourcesOfKind(SourceAddress) {
+		out = append(out, s.Network)
+	}
+	return out
+}
+
+// SourceMACs returns the MAC address sources of the zone.
+func (z *ZoneSettings) SourceMACs() []net.HardwareAddr {
+	var out []net.HardwareAddr
+	for _, s := range z.sourcesOfKind(SourceMAC) {
+		out = append(out, s.MAC)
+	}
+	return out
+}
+
+// SourceIPSets returns the names of ipsets referenced as sources of the zone.
+func (z *ZoneSettings) SourceIPSets() []string {
+	var out []string
+	for _, s := range z.sourcesOfKind(SourceIPSet) {
+		out = append(out, s.IPSet)
+	}
+	return out
+}
+
+// ContainsSourceAddress returns true if ip is matched by an address or network source of the zone.
+func (z *ZoneSettings) ContainsSourceAddress(ip net.IP) bool {
+	for _, s := range z.sourcesOfKind(SourceAddress) {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		in       string
+		kind     SourceKind
+		family   string
+		expected string
+	}{
+		{in: "192.0.2.1", kind: SourceAddress, family: "ipv4", expected: "192.0.2.1"},
+		{in: "192.0.2.0/24", kind: SourceAddress, family: "ipv4", expected: "192.0.2.0/24"},
+		{in: "192.0.2.7/24", kind: SourceAddress, family: "ipv4", expected: "192.0.2.0/24"},
+		{in: "2001:db8::/32", kind: SourceAddress, family: "ipv6", expected: "2001:db8::/32"},
+		{in: "2001:db8::1", kind: SourceAddress, family: "ipv6", expected: "2001:db8::1"},
+		{in: "00:11:22:aa:bb:cc", kind: SourceMAC, expected: "00:11:22:AA:BB:CC"},
+		{in: "ipset:blocklist", kind: SourceIPSet, expected: "ipset:blocklist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			s, err := ParseSource(test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.kind, s.Kind)
+			assert.Equal(t, test.family, s.Family())
+			assert.Equal(t, test.expected, s.String())
+		})
+	}
+
+	for _, invalid := range []string{
+		"", "ipset:", "192.0.2.0/33", "0011.22aa.bbcc", "eth0",
+	} {
+		_, err := ParseSource(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestZoneSettings_Sources(t *testing.T) {
+	z := ZoneSettings{
+		SourceAddresses: []string{
+			"192.0.2.0/24", "2001:db8::1", "00:11:22:33:44:55", "ipset:admins",
+		},
+	}
+
+	sources, err := z.Sources()
+	require.NoError(t, err)
+	assert.Len(t, sources, 4)
+
+	assert.Equal(t, []*net.IPNet{
+		{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(24, 32)},
+		{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(128, 128)},
+	}, z.SourceNetworks())
+	assert.Equal(t, []net.HardwareAddr{{0, 0x11, 0x22, 0x33, 0x44, 0x55}}, z.SourceMACs())
+	assert.Equal(t, []string{"admins"}, z.SourceIPSets())
+
+	assert.True(t, z.ContainsSourceAddress(net.ParseIP("192.0.2.200")))
+	assert.True(t, z.ContainsSourceAddress(net.ParseIP("2001:db8::1")))
+	assert.False(t, z.ContainsSourceAddress(net.ParseIP("198.51.100.1")))
+
+	z.SourceAddresses = append(z.SourceAddresses, "invalid")
+	_, err = z.Sources()
+	assert.EqualError(t, err,
+		`SourceAddresses[4]: invalid source "invalid", expected address, network, mac or ipset:name`)
+	assert.Len(t, z.SourceNetworks(), 2)
+}
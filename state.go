@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State files describe the desired permanent configuration in YAML or JSON,
+// using the json tags of State and the settings types as keys:
+//
+//	defaultZone: internal
+//	zones:
+//	  internal:
+//	    target: default
+//	    services: [ssh, dhcpv6-client]
+//	    ports:
+//	      - port: 8080
+//	        protocol: tcp
+//	    interfaces: [eth1]
+//	ipsets:
+//	  blocklist:
+//	    type: hash:net
+//	    entries: [192.0.2.0/24]
+//
+// Kinds missing from the file are left unmanaged, see State.
+
+// ParseState decodes a state file. JSON is accepted as it is a subset of YAML.
+// Unknown keys are rejected to catch typos.
+// Zones without target get "default", policies without target get "CONTINUE"
+// and policies without priority get -1, the defaults of firewalld.
+func ParseState(data []byte) (State, error) {
+	var s State
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return State{}, fmt.Errorf("state: %w", err)
+	}
+
+	for name, z := range s.Zones {
+		if len(z.Target) == 0 {
+			z.Target = "default"
+			s.Zones[name] = z
+		}
+	}
+	// a missing priority can only be told apart from 0 with a pointer
+	var priorities struct {
+		Policies map[string]struct {
+			Priority *int `yaml:"priority"`
+		} `yaml:"policies"`
+	}
+	if err := yaml.Unmarshal(data, &priorities); err != nil {
+		return State{}, fmt.Errorf("state: %w", err)
+	}
+	for name, p := range s.Policies {
+		if len(p.Target) == 0 {
+			p.Target = "CONTINUE"
+		}
+		if priorities.Policies[name].Priority == nil {
+			p.Priority = defaultPolicyPriority
+		}
+		s.Policies[name] = p
+	}
+	return s, nil
+}
+
+// ReadStateFile reads and decodes a state file, see ParseState.
+func ReadStateFile(path string) (State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+	s, err := ParseState(data)
+	if err != nil {
+		return State{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseState(t *testing.T) {
+	s, err := ParseState([]byte(`
+defaultZone: internal
+zones:
+  internal:
+    services: [ssh]
+    ports:
+      - port: 8080
+        protocol: tcp
+    forwardPorts:
+      - {port: 22, protocol: tcp, toPort: 2222}
+    interfaces: [eth1]
+    icmpBlockInversion: true
+services: {}
+ipsets:
+  blocklist:
+    type: hash:net
+    options: {family: inet}
+    entries: [192.0.2.0/24]
+policies:
+  allow-host:
+    ingressZones: [internal]
+    egressZones: [HOST]
+  first:
+    priority: 0
+    ingressZones: [ANY]
+    egressZones: [HOST]
+`))
+	require.NoError(t, err)
+	assert.Equal(t, State{
+		DefaultZone: "internal",
+		Zones: map[string]ZoneSettings{
+			"internal": {
+				Target:             "default",
+				Services:           []string{"ssh"},
+				Ports:              []Port{{Port: "8080", Protocol: "tcp"}},
+				ForwardPorts:       []ForwardPort{{Port: "22", Protocol: "tcp", ToPort: "2222"}},
+				Interfaces:         []string{"eth1"},
+				ICMPBlockInversion: true,
+			},
+		},
+		Services: map[string]ServiceSettings{},
+		IPSets: map[string]IPSetSettings{
+			"blocklist": {
+				Type:    "hash:net",
+				Options: map[string]string{"family": "inet"},
+				Entries: []string{"192.0.2.0/24"},
+			},
+		},
+		Policies: map[string]PolicySettings{
+			"allow-host": {
+				Target:       "CONTINUE",
+				Priority:     -1,
+				IngressZones: []string{"internal"},
+				EgressZones:  []string{"HOST"},
+			},
+			"first": {
+				Target:       "CONTINUE",
+				IngressZones: []string{"ANY"},
+				EgressZones:  []string{"HOST"},
+			},
+		},
+	}, s)
+
+	// JSON is YAML and marshalling uses the same keys
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	fromJSON, err := ParseState(data)
+	require.NoError(t, err)
+	assert.Equal(t, s, fromJSON)
+
+	empty, err := ParseState(nil)
+	require.NoError(t, err)
+	assert.Equal(t, State{}, empty)
+
+	_, err = ParseState([]byte("zones:\n  public:\n    service: [ssh]\n"))
+	assert.Error(t, err)
+}
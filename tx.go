@@ -0,0 +1,453 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Tx records the inverse of every mutating call made through its clients,
+// so a sequence of changes can be rolled back as a whole.
+//
+// Inverses are derived from the D-Bus methods called:
+// add/remove and enable/disable pairs undo each other, setters and updates
+// restore the value read before the call and removed config objects are re-added
+// with their previous settings.
+// Mutating methods without known inverse (e.g. reload) are refused.
+//
+// A Tx must not be used after Commit or Rollback.
+type Tx struct {
+	*Client
+	conn *txConnection
+}
+
+// Begin starts a new transaction.
+func (c *Client) Begin() *Tx {
+	conn := &txConnection{conn: c.conn}
+	return &Tx{
+		Client: NewClient(conn),
+		conn:   conn,
+	}
+}
+
+// Transaction runs fn within a transaction.
+// If fn returns an error or ctx is cancelled, all changes made through tx are rolled back.
+// The rollback is not bound to ctx, so it completes even if ctx was cancelled.
+func (c *Client) Transaction(
+	ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	tx := c.Begin()
+	err := fn(ctx, tx)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		tx.Commit()
+		return nil
+	}
+
+	if rbErr := tx.Rollback(context.Background()); rbErr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+	}
+	return err
+}
+
+// ErrTxDone is returned when a Tx is used after Commit or Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Commit keeps all changes made within the transaction.
+func (tx *Tx) Commit() {
+	tx.conn.finish()
+}
+
+// Rollback undoes all changes made within the transaction in reverse order.
+// All inverses are attempted, even if some of them fail.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	inverses := tx.conn.finish()
+
+	rbErr := &RollbackError{}
+	for i := len(inverses) - 1; i >= 0; i-- {
+		if err := inverses[i].undo(ctx); err != nil {
+			rbErr.Errors = append(rbErr.Errors,
+				fmt.Errorf("undo %s: %w", inverses[i].method, err))
+		}
+	}
+	if len(rbErr.Errors) > 0 {
+		return rbErr
+	}
+	return nil
+}
+
+// RollbackError lists the inverses that failed during Rollback.
+type RollbackError struct {
+	Errors []error
+}
+
+func (e *RollbackError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type txInverse struct {
+	// method that has been undone, for error messages.
+	method string
+	undo   func(ctx context.Context) error
+}
+
+// txConnection hands out callers recording inverses.
+type txConnection struct {
+	conn Connection
+
+	mu       sync.Mutex
+	inverses []txInverse
+	done     bool
+}
+
+var _ Connection = (*txConnection)(nil)
+
+// Close is a no-op, the transaction does not own the underlying connection.
+func (t *txConnection) Close() error {
+	return nil
+}
+
+func (t *txConnection) Object(dest, path string) Caller {
+	return &txCaller{
+		tx:   t,
+		dest: dest,
+		obj:  t.conn.Object(dest, path),
+	}
+}
+
+func (t *txConnection) record(inv txInverse) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return ErrTxDone
+	}
+	t.inverses = append(t.inverses, inv)
+	return nil
+}
+
+func (t *txConnection) finish() []txInverse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	inverses := t.inverses
+	t.inverses = nil
+	t.done = true
+	return inverses
+}
+
+func (t *txConnection) isDone() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.done
+}
+
+type txCaller struct {
+	tx   *txConnection
+	dest string
+	obj  Caller
+}
+
+var _ Caller = (*txCaller)(nil)
+
+func (c *txCaller) Call(ctx context.Context, cl Call) error {
+	if c.tx.isDone() {
+		return ErrTxDone
+	}
+
+	iface, member := splitMethod(cl.Method)
+	if isReadOnlyMethod(member) {
+		return c.obj.Call(ctx, cl)
+	}
+
+	undo, err := c.inverse(ctx, iface, member, cl.Arguments)
+	if err != nil {
+		return err
+	}
+	if err := c.obj.Call(ctx, cl); err != nil {
+		return err
+	}
+	return c.tx.record(txInverse{method: cl.Method, undo: undo})
+}
+
+const (
+	mainInterface       = "org.fedoraproject.FirewallD1"
+	configInterface     = "org.fedoraproject.FirewallD1.config"
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+	setPropertyMethod   = propertiesInterface + ".Set"
+)
+
+// Runtime interfaces which take a timeout as last argument of add methods.
+var txTimeoutInterfaces = map[string]bool{
+	zoneInterface:             true,
+	mainInterface + ".policy": true,
+}
+
+// txConfigKind reads and writes the settings of a config object kind
+// through the typed ConfigClient methods, so undos send the D-Bus signature firewalld expects.
+type txConfigKind struct {
+	get    func(ctx context.Context, c *ConfigClient, name string) (interface{}, error)
+	add    func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error
+	update func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error
+}
+
+// Config object kinds by the suffix of their config interface, e.g. "zone".
+var txConfigKinds = map[string]txConfigKind{
+	"zone": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetZoneSettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddZone(ctx, name, settings.(ZoneSettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdateZone(ctx, name, settings.(ZoneSettings))
+		},
+	},
+	"service": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetServiceSettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddService(ctx, name, settings.(ServiceSettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdateService(ctx, name, settings.(ServiceSettings))
+		},
+	},
+	"ipset": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetIPSetSettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddIPSet(ctx, name, settings.(IPSetSettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdateIPSet(ctx, name, settings.(IPSetSettings))
+		},
+	},
+	"policy": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetPolicySettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddPolicy(ctx, name, settings.(PolicySettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdatePolicy(ctx, name, settings.(PolicySettings))
+		},
+	},
+	"helper": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetHelperSettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddHelper(ctx, name, settings.(HelperSettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdateHelper(ctx, name, settings.(HelperSettings))
+		},
+	},
+	"icmptype": {
+		get: func(ctx context.Context, c *ConfigClient, name string) (interface{}, error) {
+			return c.GetICMPTypeSettings(ctx, name)
+		},
+		add: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.AddICMPType(ctx, name, settings.(ICMPTypeSettings))
+		},
+		update: func(ctx context.Context, c *ConfigClient, name string, settings interface{}) error {
+			return c.UpdateICMPType(ctx, name, settings.(ICMPTypeSettings))
+		},
+	},
+}
+
+// inverse prepares the undo function of a mutating call,
+// reading the current state where the inverse depends on it.
+func (c *txCaller) inverse(
+	ctx context.Context, iface, member string, args []interface{},
+) (func(ctx context.Context) error, error) {
+	// the undo runs on the underlying connection, so it is not recorded itself.
+	conn := c.tx.conn
+	config := NewConfigClient(conn)
+	obj := c.obj
+	callObj := func(method string, args ...interface{}) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return obj.Call(ctx, NewCall(method, 0).WithArguments(args...))
+		}
+	}
+
+	switch {
+	// Object creation on the config interface, e.g. addZone(name, settings).
+	case iface == configInterface && strings.HasPrefix(member, "add"):
+		kind := member[len("add"):]
+		name := args[0]
+		return func(ctx context.Context) error {
+			var path string
+			err := obj.Call(ctx,
+				NewCall(configInterface+".get"+kind+"ByName", 0).
+					WithArguments(name).
+					WithReturns(&path))
+			if err != nil {
+				return err
+			}
+			return conn.Object(c.dest, path).Call(ctx,
+				NewCall(configInterface+"."+strings.ToLower(kind)+".remove", 0))
+		}, nil
+
+	// Removal of a config object, re-added with its previous settings.
+	case strings.HasPrefix(iface, configInterface+".") && member == "remove":
+		kind, name, settings, err := c.configObject(ctx, iface, member)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return kind.add(ctx, config, name, settings)
+		}, nil
+
+	// Update of the global direct configuration.
+	case iface == configInterface+".direct" && member == "update":
+		settings, err := config.GetDirectSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return config.UpdateDirectSettings(ctx, settings)
+		}, nil
+
+	// Update of a config object, restoring its previous settings.
+	case strings.HasPrefix(iface, configInterface+".") && member == "update":
+		kind, name, settings, err := c.configObject(ctx, iface, member)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return kind.update(ctx, config, name, settings)
+		}, nil
+
+	case iface == configInterface+".policies" && member == "setLockdownWhitelist":
+		whitelist, err := config.GetLockdownWhitelist(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return config.SetLockdownWhitelist(ctx, whitelist)
+		}, nil
+
+	case iface == propertiesInterface && member == "Set" && len(args) == 3:
+		var previous interface{}
+		err := obj.Call(ctx, NewCall(getPropertyMethod, 0).
+			WithArguments(args[0], args[1]).
+			WithReturns(&previous))
+		if err != nil {
+			return nil, err
+		}
+		return callObj(setPropertyMethod, args[0], args[1], dbus.MakeVariant(previous)), nil
+
+	// Setters, e.g. setDefaultZone(zone) or setTarget(target).
+	case strings.HasPrefix(member, "set") && len(args) > 0:
+		keys := args[:len(args)-1]
+		var previous interface{}
+		err := obj.Call(ctx, NewCall(iface+".get"+member[len("set"):], 0).
+			WithArguments(keys...).
+			WithReturns(&previous))
+		if err != nil {
+			return nil, err
+		}
+		return callObj(iface+"."+member, append(append([]interface{}{}, keys...), previous)...), nil
+
+	case strings.HasPrefix(member, "add"):
+		undoArgs := args
+		if txTimeoutInterfaces[iface] && len(args) > 0 && isInteger(args[len(args)-1]) {
+			undoArgs = args[:len(args)-1]
+		}
+		return callObj(iface+".remove"+member[len("add"):], undoArgs...), nil
+
+	case strings.HasPrefix(member, "remove"):
+		subject := member[len("remove"):]
+		undoArgs := args
+		if txTimeoutInterfaces[iface] && runtimeAddTakesTimeout(subject) {
+			undoArgs = append(append([]interface{}{}, args...), int32(0))
+		}
+		return callObj(iface+".add"+subject, undoArgs...), nil
+
+	case strings.HasPrefix(member, "enable"):
+		return callObj(iface+".disable"+member[len("enable"):], args...), nil
+
+	case strings.HasPrefix(member, "disable"):
+		return callObj(iface+".enable"+member[len("disable"):], args...), nil
+	}
+
+	return nil, fmt.Errorf("tx: no inverse known for %s.%s", iface, member)
+}
+
+// configObject returns the kind, name and current settings of the config object
+// called through iface, e.g. org.fedoraproject.FirewallD1.config.zone.
+func (c *txCaller) configObject(
+	ctx context.Context, iface, member string,
+) (txConfigKind, string, interface{}, error) {
+	kind, ok := txConfigKinds[strings.TrimPrefix(iface, configInterface+".")]
+	if !ok {
+		return txConfigKind{}, "", nil, fmt.Errorf("tx: no inverse known for %s.%s", iface, member)
+	}
+	var name string
+	err := c.obj.Call(ctx, NewCall(getPropertyMethod, 0).
+		WithArguments(iface, "name").
+		WithReturns(&name))
+	if err != nil {
+		return txConfigKind{}, "", nil, err
+	}
+	settings, err := kind.get(ctx, NewConfigClient(c.tx.conn), name)
+	if err != nil {
+		return txConfigKind{}, "", nil, err
+	}
+	return kind, name, settings, nil
+}
+
+// splitMethod splits a fully qualified D-Bus method into interface and member.
+func splitMethod(method string) (iface, member string) {
+	i := strings.LastIndex(method, ".")
+	if i < 0 {
+		return "", method
+	}
+	return method[:i], method[i+1:]
+}
+
+func isReadOnlyMethod(member string) bool {
+	for _, prefix := range []string{"get", "list", "query", "Get", "check"} {
+		if strings.HasPrefix(member, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, uint32, uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTx_Rollback(t *testing.T) {
+	const (
+		publicPath = "/org/fedoraproject/FirewallD1/config/zone/0"
+		testPath   = "/org/fedoraproject/FirewallD1/config/zone/1"
+	)
+
+	previous := ZoneSettings{Target: "default", Services: []string{"ssh"}}
+
+	mainCaller := &callerMock{}
+	onMethod(mainCaller, getDefaultZoneMethod, "public")
+	configPathCaller := &callerMock{}
+	onMethodWithArgs(configPathCaller, configGetZoneByNameMethod,
+		[]interface{}{"public"}, publicPath)
+	onMethodWithArgs(configPathCaller, configGetZoneByNameMethod,
+		[]interface{}{"test"}, testPath)
+	publicCaller := &callerMock{}
+	onMethod(publicCaller, configZoneGetSettingsMethod, previous.ToSlice())
+	onMethodWithArgs(publicCaller, getPropertyMethod,
+		[]interface{}{configZoneInterface, "name"}, "public")
+	testCaller := &callerMock{}
+	for _, m := range []*callerMock{
+		mainCaller, configPathCaller, publicCaller, testCaller} {
+		m.On("Call", mock.Anything, mock.Anything).Return(nil)
+	}
+
+	conn := &connectionMock{}
+	conn.On("Object", dbusDest, mainPath).Return(mainCaller)
+	conn.On("Object", dbusDest, configPath).Return(configPathCaller)
+	conn.On("Object", dbusDest, publicPath).Return(publicCaller)
+	conn.On("Object", dbusDest, testPath).Return(testCaller)
+	c := NewClient(conn)
+
+	ctx := context.Background()
+	tx := c.Begin()
+	require.NoError(t, tx.ApplyZoneChanges(ctx, "public", []ZoneChange{
+		{Method: "addService", Args: []string{"http"}},
+	}))
+	require.NoError(t, tx.Config().UpdateZone(ctx, "public", ZoneSettings{Target: "DROP"}))
+	require.NoError(t, tx.Config().AddZone(ctx, "test", ZoneSettings{Target: "default"}))
+	require.NoError(t, tx.SetDefaultZone(ctx, "test"))
+
+	// no inverse known
+	require.Error(t, tx.Reload(ctx))
+
+	require.NoError(t, tx.Rollback(ctx))
+	assert.ErrorIs(t, tx.SetDefaultZone(ctx, "public"), ErrTxDone)
+
+	mainCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    setDefaultZoneMethod,
+		Arguments: []interface{}{"public"},
+	})
+	testCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method: configZoneRemoveMethod,
+	})
+	publicCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    configZoneUpdateMethod,
+		Arguments: []interface{}{previous.toStruct()},
+	})
+	mainCaller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".removeService",
+		Arguments: []interface{}{"public", "http"},
+	})
+
+	// inverses are replayed in reverse order
+	mainCalls := mainCaller.Calls
+	assert.Equal(t, setDefaultZoneMethod,
+		mainCalls[len(mainCalls)-2].Arguments.Get(1).(Call).Method)
+	assert.Equal(t, zoneInterface+".removeService",
+		mainCalls[len(mainCalls)-1].Arguments.Get(1).(Call).Method)
+}
+
+func TestClient_Transaction(t *testing.T) {
+	caller := &callerMock{}
+	caller.On("Call", mock.Anything, mock.Anything).Return(nil)
+	conn := &connectionMock{}
+	conn.On("Object", mock.Anything, mock.Anything).Return(caller)
+	c := NewClient(conn)
+
+	ctx := context.Background()
+	failure := errors.New("boom")
+	err := c.Transaction(ctx, func(ctx context.Context, tx *Tx) error {
+		if err := tx.ApplyZoneChanges(ctx, "public", []ZoneChange{
+			{Method: "addPort", Args: []string{"22", "tcp"}},
+		}); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	caller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".removePort",
+		Arguments: []interface{}{"public", "22", "tcp"},
+	})
+
+	// context cancelled after the last step
+	cancelCtx, cancel := context.WithCancel(ctx)
+	err = c.Transaction(cancelCtx, func(ctx context.Context, tx *Tx) error {
+		err := tx.ApplyZoneChanges(ctx, "public", []ZoneChange{
+			{Method: "removeInterface", Args: []string{"eth0"}},
+		})
+		cancel()
+		return err
+	})
+	assert.Equal(t, context.Canceled, err)
+	caller.AssertCalled(t, "Call", mock.Anything, Call{
+		Method:    zoneInterface + ".addInterface",
+		Arguments: []interface{}{"public", "eth0"},
+	})
+}
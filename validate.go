@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldError is a problem with a single setting.
+type FieldError struct {
+	// Path of the setting, e.g. "Ports[2].Protocol".
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists all problems found in a settings object.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid settings: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.add(field, "%s", err.Error())
+	}
+}
+
+// duplicates reports values of a list that are equal to an earlier entry.
+func (v *validator) duplicates(field string, keys []string) {
+	seen := map[string]bool{}
+	for i, k := range keys {
+		if seen[k] {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "duplicate entry %q", k)
+		}
+		seen[k] = true
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+// Valid zone targets.
+var ZoneTargets = []string{"default", "ACCEPT", "DROP", "%%REJECT%%"}
+
+// Validate checks the settings for problems that firewalld would reject
+// and returns all of them at once as *ValidationError.
+func (z *ZoneSettings) Validate() error {
+	v := &validator{}
+
+	if !containsString(ZoneTargets, z.Target) {
+		v.add("Target", "invalid target %q, expected one of %s",
+			z.Target, strings.Join(ZoneTargets, ", "))
+	}
+
+	for i, s := range z.Services {
+		if len(s) == 0 {
+			v.add(fmt.Sprintf("Services[%d]", i), "empty service name")
+		}
+	}
+	v.duplicates("Services", z.Services)
+
+	for i, p := range z.Ports {
+		v.check(fmt.Sprintf("Ports[%d]", i), p.Validate())
+	}
+	v.duplicates("Ports", portStrings(z.Ports))
+
+	for i, p := range z.SourcePorts {
+		v.check(fmt.Sprintf("SourcePorts[%d]", i), p.Validate())
+	}
+	v.duplicates("SourcePorts", portStrings(z.SourcePorts))
+
+	for i, p := range z.Protocols {
+		v.check(fmt.Sprintf("Protocols[%d]", i), validateProtocolName(p))
+	}
+	v.duplicates("Protocols", z.Protocols)
+
+	for i, icmp := range z.ICMPBlocks {
+		v.check(fmt.Sprintf("ICMPBlocks[%d]", i), validateICMPTypeName(icmp))
+	}
+	v.duplicates("ICMPBlocks", z.ICMPBlocks)
+
+	for i, fp := range z.ForwardPorts {
+		v.check(fmt.Sprintf("ForwardPorts[%d]", i), fp.Validate())
+	}
+	v.duplicates("ForwardPorts", forwardPortStrings(z.ForwardPorts))
+
+	for i, iface := range z.Interfaces {
+		v.check(fmt.Sprintf("Interfaces[%d]", i), validateInterfaceName(iface))
+	}
+	v.duplicates("Interfaces", z.Interfaces)
+
+	for i, s := range z.SourceAddresses {
+		v.check(fmt.Sprintf("SourceAddresses[%d]", i), validateSource(s))
+	}
+	v.duplicates("SourceAddresses", z.SourceAddresses)
+
+	for i, s := range z.RichRules {
+		field := fmt.Sprintf("RichRules[%d]", i)
+		r, err := ParseRichRule(s)
+		if err != nil {
+			v.check(field, err)
+			continue
+		}
+		v.check(field, r.Validate())
+	}
+	v.duplicates("RichRules", canonicalRichRules(z.RichRules))
+
+	return v.err()
+}
+
+// validateInterfaceName checks Linux interface name syntax.
+// A trailing "+" matches all interfaces with the given prefix.
+func validateInterfaceName(name string) error {
+	base := strings.TrimSuffix(name, "+")
+	switch {
+	case len(base) == 0:
+		return fmt.Errorf("empty interface name")
+	case len(base) > 15:
+		return fmt.Errorf("interface name %q longer than 15 characters", name)
+	case base == "." || base == "..":
+		return fmt.Errorf("invalid interface name %q", name)
+	case strings.ContainsAny(base, "/: \t\n"):
+		return fmt.Errorf("interface name %q contains invalid characters", name)
+	}
+	return nil
+}
+
+// validateSource checks for an IP address or network, MAC address or "ipset:name".
+func validateSource(s string) error {
+	_, err := ParseSource(s)
+	return err
+}
+
+// validateProtocolName checks for a protocol name or number as listed in /etc/protocols.
+func validateProtocolName(p string) error {
+	if i, err := strconv.Atoi(p); err == nil {
+		if i < 0 || i > 255 {
+			return fmt.Errorf("protocol number %d out of range [0, 255]", i)
+		}
+		return nil
+	}
+	if !isName(p, "-_.") {
+		return fmt.Errorf("invalid protocol %q", p)
+	}
+	return nil
+}
+
+// validateICMPTypeName checks the syntax of an icmptype name, e.g. "echo-request".
+func validateICMPTypeName(name string) error {
+	if !isName(name, "-_") {
+		return fmt.Errorf("invalid icmp type %q", name)
+	}
+	return nil
+}
+
+// isName returns true for non-empty strings of ASCII letters, digits and extra.
+func isName(s, extra string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune(extra, r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneSettings_Validate(t *testing.T) {
+	valid := ZoneSettings{
+		Target:   "%%REJECT%%",
+		Services: []string{"ssh", "dhcpv6-client"},
+		Ports: []Port{
+			{Port: "8000-8100", Protocol: "tcp"},
+			{Port: "8000-8100", Protocol: "udp"},
+		},
+		Protocols:  []string{"gre", "47"},
+		ICMPBlocks: []string{"echo-request"},
+		ForwardPorts: []ForwardPort{
+			{Port: "80", Protocol: "tcp", ToPort: "8080", ToAddress: "192.0.2.5"},
+		},
+		Interfaces: []string{"eth0", "wg+", "enp0s31f6.100"},
+		SourceAddresses: []string{
+			"192.0.2.0/24", "2001:db8::1", "00:11:22:33:44:55", "ipset:mgmt",
+		},
+		RichRules: []string{
+			`rule family="ipv4" source address="198.51.100.0/24" service name="http" accept`,
+		},
+	}
+	require.NoError(t, valid.Validate())
+
+	invalid := ZoneSettings{
+		Target:   "REJECT",
+		Services: []string{"ssh", "ssh"},
+		Ports: []Port{
+			{Port: "80", Protocol: "tcp"},
+			{Port: "70000", Protocol: "tcp"},
+			{Port: "443", Protocol: "http"},
+		},
+		Protocols:  []string{"256"},
+		ICMPBlocks: []string{"echo request"},
+		ForwardPorts: []ForwardPort{
+			{Port: "80", Protocol: "tcp", ToAddress: "example.com"},
+		},
+		Interfaces:      []string{"a-very-long-interface-name", "eth/0"},
+		SourceAddresses: []string{"192.0.2.0/33", "ipset:"},
+		RichRules: []string{
+			`rule family="ipv4" source address="198.51.100.0/24" accept`,
+			`rule family='ipv4' source address=198.51.100.0/24 accept`,
+			`rule service name="ssh"`,
+		},
+	}
+	err := invalid.Validate()
+	require.Error(t, err)
+
+	var fields []string
+	for _, fe := range err.(*ValidationError).Errors {
+		fields = append(fields, fe.Field)
+	}
+	assert.Equal(t, []string{
+		"Target",
+		"Services[1]",
+		"Ports[1]",
+		"Ports[2]",
+		"Protocols[0]",
+		"ICMPBlocks[0]",
+		"ForwardPorts[0]",
+		"Interfaces[0]",
+		"Interfaces[1]",
+		"SourceAddresses[0]",
+		"SourceAddresses[1]",
+		"RichRules[2]",
+		"RichRules[1]",
+	}, fields)
+	assert.Contains(t, err.Error(), `Services[1]: duplicate entry "ssh"`)
+}
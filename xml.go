@@ -0,0 +1,404 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Element types shared by the firewalld XML configuration files,
+// see firewalld.zone(5) and friends.
+
+type xmlName struct {
+	Name string `xml:"name,attr"`
+}
+
+type xmlValue struct {
+	Value string `xml:"value,attr"`
+}
+
+type xmlPort struct {
+	Port     string `xml:"port,attr"`
+	Protocol string `xml:"protocol,attr"`
+}
+
+type xmlForwardPort struct {
+	Port      string `xml:"port,attr"`
+	Protocol  string `xml:"protocol,attr"`
+	ToPort    string `xml:"to-port,attr,omitempty"`
+	ToAddress string `xml:"to-addr,attr,omitempty"`
+}
+
+// xmlFlag is an element without content that is only checked for presence, e.g. <masquerade/>.
+type xmlFlag struct{}
+
+func newXMLFlag(set bool) *xmlFlag {
+	if set {
+		return &xmlFlag{}
+	}
+	return nil
+}
+
+func xmlNames(names []string) []xmlName {
+	var out []xmlName
+	for _, n := range names {
+		out = append(out, xmlName{Name: n})
+	}
+	return out
+}
+
+func namesFromXML(names []xmlName) []string {
+	var out []string
+	for _, n := range names {
+		out = append(out, n.Name)
+	}
+	return out
+}
+
+func xmlValues(values []string) []xmlValue {
+	var out []xmlValue
+	for _, v := range values {
+		out = append(out, xmlValue{Value: v})
+	}
+	return out
+}
+
+func valuesFromXML(values []xmlValue) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, v.Value)
+	}
+	return out
+}
+
+func xmlPorts(ports []Port) []xmlPort {
+	var out []xmlPort
+	for _, p := range ports {
+		out = append(out, xmlPort{Port: p.Port, Protocol: p.Protocol})
+	}
+	return out
+}
+
+func portsFromXML(ports []xmlPort) []Port {
+	var out []Port
+	for _, p := range ports {
+		out = append(out, Port{Port: p.Port, Protocol: p.Protocol})
+	}
+	return out
+}
+
+func xmlForwardPorts(ports []ForwardPort) []xmlForwardPort {
+	var out []xmlForwardPort
+	for _, p := range ports {
+		out = append(out, xmlForwardPort(p))
+	}
+	return out
+}
+
+func forwardPortsFromXML(ports []xmlForwardPort) []ForwardPort {
+	var out []ForwardPort
+	for _, p := range ports {
+		out = append(out, ForwardPort(p))
+	}
+	return out
+}
+
+// xmlRule is a rich rule in XML form.
+type xmlRule struct {
+	Family      string          `xml:"family,attr,omitempty"`
+	Priority    int             `xml:"priority,attr,omitempty"`
+	Source      *xmlRuleAddress `xml:"source"`
+	Destination *xmlRuleAddress `xml:"destination"`
+
+	Service     *xmlName        `xml:"service"`
+	Port        *xmlPort        `xml:"port"`
+	Protocol    *xmlValue       `xml:"protocol"`
+	ICMPBlock   *xmlName        `xml:"icmp-block"`
+	ICMPType    *xmlName        `xml:"icmp-type"`
+	Masquerade  *xmlFlag        `xml:"masquerade"`
+	ForwardPort *xmlForwardPort `xml:"forward-port"`
+	SourcePort  *xmlPort        `xml:"source-port"`
+
+	Log   *xmlLog   `xml:"log"`
+	NFLog *xmlNFLog `xml:"nflog"`
+	Audit *xmlAudit `xml:"audit"`
+
+	Accept *xmlAction `xml:"accept"`
+	Reject *xmlAction `xml:"reject"`
+	Drop   *xmlAction `xml:"drop"`
+	Mark   *xmlAction `xml:"mark"`
+}
+
+type xmlRuleAddress struct {
+	Address string `xml:"address,attr,omitempty"`
+	MAC     string `xml:"mac,attr,omitempty"`
+	IPSet   string `xml:"ipset,attr,omitempty"`
+	Invert  string `xml:"invert,attr,omitempty"`
+}
+
+type xmlLimit struct {
+	Value string `xml:"value,attr"`
+	Burst string `xml:"burst,attr,omitempty"`
+}
+
+type xmlLog struct {
+	Prefix string    `xml:"prefix,attr,omitempty"`
+	Level  string    `xml:"level,attr,omitempty"`
+	Limit  *xmlLimit `xml:"limit"`
+}
+
+type xmlNFLog struct {
+	Group     string    `xml:"group,attr,omitempty"`
+	Prefix    string    `xml:"prefix,attr,omitempty"`
+	QueueSize string    `xml:"queue-size,attr,omitempty"`
+	Limit     *xmlLimit `xml:"limit"`
+}
+
+type xmlAudit struct {
+	Limit *xmlLimit `xml:"limit"`
+}
+
+type xmlAction struct {
+	Type  string    `xml:"type,attr,omitempty"`
+	Set   string    `xml:"set,attr,omitempty"`
+	Limit *xmlLimit `xml:"limit"`
+}
+
+// xmlRichRules converts rich rule strings to their XML form.
+func xmlRichRules(rules []string) ([]xmlRule, error) {
+	var out []xmlRule
+	for i, s := range rules {
+		r, err := ParseRichRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("RichRules[%d]: %w", i, err)
+		}
+		out = append(out, xmlRuleFromRichRule(r))
+	}
+	return out, nil
+}
+
+// richRulesFromXML converts XML rules to rich rule strings in canonical form.
+func richRulesFromXML(rules []xmlRule) []string {
+	var out []string
+	for _, r := range rules {
+		out = append(out, r.richRule().String())
+	}
+	return out
+}
+
+func xmlRuleFromRichRule(r RichRule) xmlRule {
+	x := xmlRule{
+		Family:      r.Family,
+		Priority:    r.Priority,
+		Source:      xmlRuleAddressFrom(r.Source),
+		Destination: xmlRuleAddressFrom(r.Destination),
+		Masquerade:  newXMLFlag(r.Masquerade),
+	}
+	if len(r.Service) > 0 {
+		x.Service = &xmlName{Name: r.Service}
+	}
+	if r.Port != nil {
+		x.Port = &xmlPort{Port: r.Port.Port, Protocol: r.Port.Protocol}
+	}
+	if len(r.Protocol) > 0 {
+		x.Protocol = &xmlValue{Value: r.Protocol}
+	}
+	if len(r.ICMPBlock) > 0 {
+		x.ICMPBlock = &xmlName{Name: r.ICMPBlock}
+	}
+	if len(r.ICMPType) > 0 {
+		x.ICMPType = &xmlName{Name: r.ICMPType}
+	}
+	if r.ForwardPort != nil {
+		fp := xmlForwardPort(*r.ForwardPort)
+		x.ForwardPort = &fp
+	}
+	if r.SourcePort != nil {
+		x.SourcePort = &xmlPort{Port: r.SourcePort.Port, Protocol: r.SourcePort.Protocol}
+	}
+
+	if r.Log != nil {
+		x.Log = &xmlLog{Prefix: r.Log.Prefix, Level: r.Log.Level, Limit: xmlLimitFrom(r.Log.Limit)}
+	}
+	if r.NFLog != nil {
+		x.NFLog = &xmlNFLog{
+			Group:     r.NFLog.Group,
+			Prefix:    r.NFLog.Prefix,
+			QueueSize: r.NFLog.QueueSize,
+			Limit:     xmlLimitFrom(r.NFLog.Limit),
+		}
+	}
+	if r.Audit != nil {
+		x.Audit = &xmlAudit{Limit: xmlLimitFrom(r.Audit.Limit)}
+	}
+
+	if a := r.Action; a != nil {
+		action := &xmlAction{Type: a.RejectType, Set: a.MarkSet, Limit: xmlLimitFrom(a.Limit)}
+		switch a.Type {
+		case RichRuleAccept:
+			x.Accept = action
+		case RichRuleReject:
+			x.Reject = action
+		case RichRuleDrop:
+			x.Drop = action
+		case RichRuleMark:
+			x.Mark = action
+		}
+	}
+	return x
+}
+
+func (x xmlRule) richRule() RichRule {
+	r := RichRule{
+		Family:      x.Family,
+		Priority:    x.Priority,
+		Source:      x.Source.richRuleAddress(),
+		Destination: x.Destination.richRuleAddress(),
+		Masquerade:  x.Masquerade != nil,
+	}
+	if x.Service != nil {
+		r.Service = x.Service.Name
+	}
+	if x.Port != nil {
+		r.Port = &Port{Port: x.Port.Port, Protocol: x.Port.Protocol}
+	}
+	if x.Protocol != nil {
+		r.Protocol = x.Protocol.Value
+	}
+	if x.ICMPBlock != nil {
+		r.ICMPBlock = x.ICMPBlock.Name
+	}
+	if x.ICMPType != nil {
+		r.ICMPType = x.ICMPType.Name
+	}
+	if x.ForwardPort != nil {
+		fp := ForwardPort(*x.ForwardPort)
+		r.ForwardPort = &fp
+	}
+	if x.SourcePort != nil {
+		r.SourcePort = &Port{Port: x.SourcePort.Port, Protocol: x.SourcePort.Protocol}
+	}
+
+	if x.Log != nil {
+		r.Log = &RichRuleLog{Prefix: x.Log.Prefix, Level: x.Log.Level, Limit: x.Log.Limit.richRuleLimit()}
+	}
+	if x.NFLog != nil {
+		r.NFLog = &RichRuleNFLog{
+			Group:     x.NFLog.Group,
+			Prefix:    x.NFLog.Prefix,
+			QueueSize: x.NFLog.QueueSize,
+			Limit:     x.NFLog.Limit.richRuleLimit(),
+		}
+	}
+	if x.Audit != nil {
+		r.Audit = &RichRuleAudit{Limit: x.Audit.Limit.richRuleLimit()}
+	}
+
+	for _, a := range []struct {
+		typ    RichRuleActionType
+		action *xmlAction
+	}{
+		{RichRuleAccept, x.Accept},
+		{RichRuleReject, x.Reject},
+		{RichRuleDrop, x.Drop},
+		{RichRuleMark, x.Mark},
+	} {
+		if a.action == nil {
+			continue
+		}
+		r.Action = &RichRuleAction{Type: a.typ, Limit: a.action.Limit.richRuleLimit()}
+		switch a.typ {
+		case RichRuleReject:
+			r.Action.RejectType = a.action.Type
+		case RichRuleMark:
+			r.Action.MarkSet = a.action.Set
+		}
+		break
+	}
+	return r
+}
+
+func xmlRuleAddressFrom(a *RichRuleAddress) *xmlRuleAddress {
+	if a == nil {
+		return nil
+	}
+	x := &xmlRuleAddress{Address: a.Address, MAC: a.MAC, IPSet: a.IPSet}
+	if a.Invert {
+		x.Invert = "True"
+	}
+	return x
+}
+
+func (x *xmlRuleAddress) richRuleAddress() *RichRuleAddress {
+	if x == nil {
+		return nil
+	}
+	return &RichRuleAddress{
+		Invert:  xmlBool(x.Invert),
+		Address: x.Address,
+		MAC:     x.MAC,
+		IPSet:   x.IPSet,
+	}
+}
+
+func xmlLimitFrom(l *RichRuleLimit) *xmlLimit {
+	if l == nil {
+		return nil
+	}
+	return &xmlLimit{Value: l.Value, Burst: l.Burst}
+}
+
+func (x *xmlLimit) richRuleLimit() *RichRuleLimit {
+	if x == nil {
+		return nil
+	}
+	return &RichRuleLimit{Value: x.Value, Burst: x.Burst}
+}
+
+// xmlBool parses boolean attributes the way firewalld does.
+func xmlBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "yes", "true":
+		return true
+	}
+	return false
+}
+
+// writeXML writes v as a standalone, indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// checkXMLElement returns an error if start is not the expected root element.
+func checkXMLElement(start xml.StartElement, name string) error {
+	if start.Name.Local != name {
+		return fmt.Errorf("expected <%s> element, got <%s>", name, start.Name.Local)
+	}
+	return nil
+}
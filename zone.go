@@ -16,41 +16,59 @@ limitations under the License.
 
 package firewalld
 
+import "fmt"
+
 type ZoneSettings struct {
-	Version         string
-	Name            string
-	Description     string
-	Target          string
-	Services        []string
-	Ports           []Port
-	ICMPBlocks      []string
-	Masquerade      bool
-	ForwardPorts    []ForwardPort
-	Interfaces      []string
-	SourceAddresses []string
-	RichRules       []string
-	Protocols       []string
-	SourcePorts     []Port
-}
-
-func ZoneSettingsFromSlice(s []interface{}) ZoneSettings {
-	return ZoneSettings{
-		Version:     s[0].(string),
-		Name:        s[1].(string),
-		Description: s[2].(string),
-		// UNUSED s[3].(bool)
-		Target:          s[4].(string),
-		Services:        s[5].([]string),
-		Ports:           interfaceSliceToPorts(s[6]),
-		ICMPBlocks:      toStringSlice(s[7]),
-		Masquerade:      s[8].(bool),
-		ForwardPorts:    interfaceSliceToForwardPorts(s[9]),
-		Interfaces:      s[10].([]string),
-		SourceAddresses: s[11].([]string),
-		RichRules:       s[12].([]string),
-		Protocols:       s[13].([]string),
-		SourcePorts:     interfaceSliceToPorts(s[14]),
+	Version         string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Name            string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Description     string        `json:"description,omitempty" yaml:"description,omitempty"`
+	Target          string        `json:"target,omitempty" yaml:"target,omitempty"`
+	Services        []string      `json:"services,omitempty" yaml:"services,omitempty"`
+	Ports           []Port        `json:"ports,omitempty" yaml:"ports,omitempty"`
+	ICMPBlocks      []string      `json:"icmpBlocks,omitempty" yaml:"icmpBlocks,omitempty"`
+	Masquerade      bool          `json:"masquerade,omitempty" yaml:"masquerade,omitempty"`
+	ForwardPorts    []ForwardPort `json:"forwardPorts,omitempty" yaml:"forwardPorts,omitempty"`
+	Interfaces      []string      `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+	SourceAddresses []string      `json:"sourceAddresses,omitempty" yaml:"sourceAddresses,omitempty"`
+	RichRules       []string      `json:"richRules,omitempty" yaml:"richRules,omitempty"`
+	Protocols       []string      `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	SourcePorts     []Port        `json:"sourcePorts,omitempty" yaml:"sourcePorts,omitempty"`
+	// Invert the meaning of ICMPBlocks to allow only the listed ICMP types.
+	ICMPBlockInversion bool `json:"icmpBlockInversion,omitempty" yaml:"icmpBlockInversion,omitempty"`
+}
+
+// ZoneSettingsFromSlice decodes the zone settings tuple returned by firewalld.
+// Trailing fields that older firewalld versions don't send are left empty.
+func ZoneSettingsFromSlice(s []interface{}) (ZoneSettings, error) {
+	d := &decoder{kind: "zone settings"}
+	d.minLen(s, 13)
+	if d.err != nil {
+		return ZoneSettings{}, d.err
+	}
+
+	z := ZoneSettings{
+		Version:     d.string("Version", s[0]),
+		Name:        d.string("Name", s[1]),
+		Description: d.string("Description", s[2]),
+		// UNUSED s[3]
+		Target:          d.string("Target", s[4]),
+		Services:        d.strings("Services", s[5]),
+		Ports:           d.ports("Ports", s[6]),
+		ICMPBlocks:      d.strings("ICMPBlocks", s[7]),
+		Masquerade:      d.bool("Masquerade", s[8]),
+		ForwardPorts:    d.forwardPorts("ForwardPorts", s[9]),
+		Interfaces:      d.strings("Interfaces", s[10]),
+		SourceAddresses: d.strings("SourceAddresses", s[11]),
+		RichRules:       d.strings("RichRules", s[12]),
+		Protocols:       d.strings("Protocols", at(s, 13)),
+		SourcePorts:     d.ports("SourcePorts", at(s, 14)),
+
+		ICMPBlockInversion: d.bool("ICMPBlockInversion", at(s, 15)),
+	}
+	if d.err != nil {
+		return ZoneSettings{}, d.err
 	}
+	return z, nil
 }
 
 func (z *ZoneSettings) ToSlice() []interface{} {
@@ -70,20 +88,70 @@ func (z *ZoneSettings) ToSlice() []interface{} {
 		z.RichRules,
 		z.Protocols,
 		portsToInterfaceSlice(z.SourcePorts),
-		false, // needed but ???
+		z.ICMPBlockInversion,
+	}
+}
+
+// zoneStruct is encoded as D-Bus struct (sssbsasa(ss)asba(ssss)asasasasa(ss)b).
+type zoneStruct struct {
+	Version            string
+	Short              string
+	Description        string
+	Unused             bool
+	Target             string
+	Services           []string
+	Ports              []portStruct
+	ICMPBlocks         []string
+	Masquerade         bool
+	ForwardPorts       []forwardPortStruct
+	Interfaces         []string
+	Sources            []string
+	RichRules          []string
+	Protocols          []string
+	SourcePorts        []portStruct
+	ICMPBlockInversion bool
+}
+
+// toStruct returns the settings with the D-Bus signature firewalld expects,
+// ToSlice would be sent as array of variants.
+func (z *ZoneSettings) toStruct() zoneStruct {
+	return zoneStruct{
+		Version:            z.Version,
+		Short:              z.Name,
+		Description:        z.Description,
+		Target:             z.Target,
+		Services:           z.Services,
+		Ports:              portsToStructs(z.Ports),
+		ICMPBlocks:         z.ICMPBlocks,
+		Masquerade:         z.Masquerade,
+		ForwardPorts:       forwardPortsToStructs(z.ForwardPorts),
+		Interfaces:         z.Interfaces,
+		Sources:            z.SourceAddresses,
+		RichRules:          z.RichRules,
+		Protocols:          z.Protocols,
+		SourcePorts:        portsToStructs(z.SourcePorts),
+		ICMPBlockInversion: z.ICMPBlockInversion,
 	}
 }
 
 type Port struct {
-	Port     string
-	Protocol string
+	Port     string `json:"port" yaml:"port"`
+	Protocol string `json:"protocol" yaml:"protocol"`
 }
 
-func PortFromSlice(s []string) Port {
+func PortFromSlice(s []string) (Port, error) {
+	if len(s) != 2 {
+		return Port{}, fmt.Errorf("expected port tuple of 2 fields, got %d", len(s))
+	}
 	return Port{
 		Port:     s[0],
 		Protocol: s[1],
-	}
+	}, nil
+}
+
+// String returns the port in firewall-cmd notation, e.g. "8080/tcp".
+func (p Port) String() string {
+	return p.Port + "/" + p.Protocol
 }
 
 func (p *Port) ToSlice() []interface{} {
@@ -94,19 +162,29 @@ func (p *Port) ToSlice() []interface{} {
 }
 
 type ForwardPort struct {
-	Port      string
-	Protocol  string
-	ToPort    string
-	ToAddress string
+	Port      string `json:"port" yaml:"port"`
+	Protocol  string `json:"protocol" yaml:"protocol"`
+	ToPort    string `json:"toPort,omitempty" yaml:"toPort,omitempty"`
+	ToAddress string `json:"toAddress,omitempty" yaml:"toAddress,omitempty"`
 }
 
-func ForwardPortFromSlice(s []string) ForwardPort {
+func ForwardPortFromSlice(s []string) (ForwardPort, error) {
+	if len(s) != 4 {
+		return ForwardPort{}, fmt.Errorf("expected forward port tuple of 4 fields, got %d", len(s))
+	}
 	return ForwardPort{
 		Port:      s[0],
 		Protocol:  s[1],
 		ToPort:    s[2],
 		ToAddress: s[3],
-	}
+	}, nil
+}
+
+// String returns the forward port in firewall-cmd notation,
+// e.g. "port=22:proto=tcp:toport=2222:toaddr=192.0.2.55".
+func (p ForwardPort) String() string {
+	return "port=" + p.Port + ":proto=" + p.Protocol +
+		":toport=" + p.ToPort + ":toaddr=" + p.ToAddress
 }
 
 func (p *ForwardPort) ToSlice() []interface{} {
@@ -118,14 +196,6 @@ func (p *ForwardPort) ToSlice() []interface{} {
 	}
 }
 
-func interfaceSliceToPorts(s interface{}) []Port {
-	var out []Port
-	for _, p := range toStringSliceSlice(s) {
-		out = append(out, PortFromSlice(p))
-	}
-	return out
-}
-
 func portsToInterfaceSlice(ports []Port) [][]interface{} {
 	var out [][]interface{}
 	for _, p := range ports {
@@ -134,15 +204,16 @@ func portsToInterfaceSlice(ports []Port) [][]interface{} {
 	return out
 }
 
-func interfaceSliceToForwardPorts(s interface{}) []ForwardPort {
-	var out []ForwardPort
-	for _, p := range toStringSliceSlice(s) {
-		out = append(out, ForwardPort{
-			Port:      p[0],
-			Protocol:  p[1],
-			ToPort:    p[2],
-			ToAddress: p[3],
-		})
+// portStruct is encoded as D-Bus struct (ss).
+type portStruct struct {
+	Port     string
+	Protocol string
+}
+
+func portsToStructs(ports []Port) []portStruct {
+	var out []portStruct
+	for _, p := range ports {
+		out = append(out, portStruct{Port: p.Port, Protocol: p.Protocol})
 	}
 	return out
 }
@@ -155,34 +226,23 @@ func forwardPortsToInterfaceSlice(ports []ForwardPort) [][]interface{} {
 	return out
 }
 
-func toStringSliceSlice(in interface{}) (out [][]string) {
-	topSlice, ok := in.([][]interface{})
-	if !ok {
-		return nil
-	}
-
-	for _, slice := range topSlice {
-		s := toStringSlice(slice)
-		if len(s) == 0 {
-			continue
-		}
-		out = append(out, s)
-	}
-	return
+// forwardPortStruct is encoded as D-Bus struct (ssss).
+type forwardPortStruct struct {
+	Port      string
+	Protocol  string
+	ToPort    string
+	ToAddress string
 }
 
-func toStringSlice(in interface{}) (out []string) {
-	slice, ok := in.([]interface{})
-	if !ok {
-		return nil
-	}
-
-	for _, i := range slice {
-		s, ok := i.(string)
-		if !ok {
-			continue
-		}
-		out = append(out, s)
+func forwardPortsToStructs(ports []ForwardPort) []forwardPortStruct {
+	var out []forwardPortStruct
+	for _, p := range ports {
+		out = append(out, forwardPortStruct{
+			Port:      p.Port,
+			Protocol:  p.Protocol,
+			ToPort:    p.ToPort,
+			ToAddress: p.ToAddress,
+		})
 	}
-	return
+	return out
 }
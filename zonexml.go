@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlZone is the layout of a firewalld zone file, see firewalld.zone(5).
+type xmlZone struct {
+	Version            string           `xml:"version,attr,omitempty"`
+	Target             string           `xml:"target,attr,omitempty"`
+	Short              string           `xml:"short,omitempty"`
+	Description        string           `xml:"description,omitempty"`
+	Interfaces         []xmlName        `xml:"interface"`
+	Sources            []xmlZoneSource  `xml:"source"`
+	Services           []xmlName        `xml:"service"`
+	Ports              []xmlPort        `xml:"port"`
+	Protocols          []xmlValue       `xml:"protocol"`
+	ICMPBlocks         []xmlName        `xml:"icmp-block"`
+	ICMPBlockInversion *xmlFlag         `xml:"icmp-block-inversion"`
+	Masquerade         *xmlFlag         `xml:"masquerade"`
+	ForwardPorts       []xmlForwardPort `xml:"forward-port"`
+	SourcePorts        []xmlPort        `xml:"source-port"`
+	Rules              []xmlRule        `xml:"rule"`
+}
+
+type xmlZoneSource struct {
+	Address string `xml:"address,attr,omitempty"`
+	MAC     string `xml:"mac,attr,omitempty"`
+	IPSet   string `xml:"ipset,attr,omitempty"`
+}
+
+// The default zone target is not written to zone files.
+const defaultZoneTarget = "default"
+
+// MarshalXML encodes the zone in firewalld zone file format.
+// The zone name is not part of the file, it is the file name.
+func (z ZoneSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := xmlZone{
+		Version:            z.Version,
+		Short:              z.Name,
+		Description:        z.Description,
+		Interfaces:         xmlNames(z.Interfaces),
+		Services:           xmlNames(z.Services),
+		Ports:              xmlPorts(z.Ports),
+		Protocols:          xmlValues(z.Protocols),
+		ICMPBlocks:         xmlNames(z.ICMPBlocks),
+		ICMPBlockInversion: newXMLFlag(z.ICMPBlockInversion),
+		Masquerade:         newXMLFlag(z.Masquerade),
+		ForwardPorts:       xmlForwardPorts(z.ForwardPorts),
+		SourcePorts:        xmlPorts(z.SourcePorts),
+	}
+	if z.Target != defaultZoneTarget {
+		x.Target = z.Target
+	}
+	for _, s := range z.SourceAddresses {
+		x.Sources = append(x.Sources, xmlZoneSourceFrom(s))
+	}
+	rules, err := xmlRichRules(z.RichRules)
+	if err != nil {
+		return err
+	}
+	x.Rules = rules
+
+	return e.EncodeElement(x, xml.StartElement{Name: xml.Name{Local: "zone"}})
+}
+
+// UnmarshalXML decodes a zone from firewalld zone file format.
+// Rich rules are converted to canonical form.
+func (z *ZoneSettings) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkXMLElement(start, "zone"); err != nil {
+		return err
+	}
+	var x xmlZone
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*z = ZoneSettings{
+		Version:            x.Version,
+		Name:               x.Short,
+		Description:        x.Description,
+		Target:             x.Target,
+		Services:           namesFromXML(x.Services),
+		Ports:              portsFromXML(x.Ports),
+		ICMPBlocks:         namesFromXML(x.ICMPBlocks),
+		Masquerade:         x.Masquerade != nil,
+		ForwardPorts:       forwardPortsFromXML(x.ForwardPorts),
+		Interfaces:         namesFromXML(x.Interfaces),
+		RichRules:          richRulesFromXML(x.Rules),
+		Protocols:          valuesFromXML(x.Protocols),
+		SourcePorts:        portsFromXML(x.SourcePorts),
+		ICMPBlockInversion: x.ICMPBlockInversion != nil,
+	}
+	if len(z.Target) == 0 {
+		z.Target = defaultZoneTarget
+	}
+	for _, s := range x.Sources {
+		z.SourceAddresses = append(z.SourceAddresses, s.source())
+	}
+	return nil
+}
+
+func xmlZoneSourceFrom(s string) xmlZoneSource {
+	if strings.HasPrefix(s, ipsetSourcePrefix) {
+		return xmlZoneSource{IPSet: s[len(ipsetSourcePrefix):]}
+	}
+	if src, err := ParseSource(s); err == nil && src.Kind == SourceMAC {
+		return xmlZoneSource{MAC: s}
+	}
+	return xmlZoneSource{Address: s}
+}
+
+func (s xmlZoneSource) source() string {
+	switch {
+	case len(s.IPSet) > 0:
+		return ipsetSourcePrefix + s.IPSet
+	case len(s.MAC) > 0:
+		return s.MAC
+	}
+	return s.Address
+}
+
+// ReadZoneXML reads a zone from a firewalld zone file, e.g. /etc/firewalld/zones/public.xml.
+func ReadZoneXML(r io.Reader) (ZoneSettings, error) {
+	var z ZoneSettings
+	if err := xml.NewDecoder(r).Decode(&z); err != nil {
+		return ZoneSettings{}, err
+	}
+	return z, nil
+}
+
+// WriteZoneXML writes the zone in firewalld zone file format.
+func WriteZoneXML(w io.Writer, z ZoneSettings) error {
+	return writeXML(w, z)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The routerd authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testZoneXML = `<?xml version="1.0" encoding="utf-8"?>
+<zone target="%%REJECT%%">
+  <short>Public</short>
+  <description>For use in public areas.</description>
+  <interface name="eth0"/>
+  <source address="192.0.2.0/24"/>
+  <source mac="00:11:22:33:44:55"/>
+  <source ipset="admins"/>
+  <service name="ssh"/>
+  <service name="dhcpv6-client"/>
+  <port port="8080" protocol="tcp"/>
+  <protocol value="gre"/>
+  <icmp-block name="echo-request"/>
+  <icmp-block-inversion/>
+  <masquerade/>
+  <forward-port port="22" protocol="tcp" to-port="2222" to-addr="192.0.2.55"/>
+  <source-port port="1024-65535" protocol="udp"/>
+  <rule family="ipv4" priority="-10">
+    <source address="198.51.100.0/24" invert="True"/>
+    <service name="http"/>
+    <log prefix="http" level="info">
+      <limit value="3/m"/>
+    </log>
+    <reject type="icmp-port-unreachable"/>
+  </rule>
+  <rule>
+    <port port="3306" protocol="tcp"/>
+    <drop/>
+  </rule>
+</zone>
+`
+
+func TestReadZoneXML(t *testing.T) {
+	z, err := ReadZoneXML(strings.NewReader(testZoneXML))
+	require.NoError(t, err)
+
+	assert.Equal(t, ZoneSettings{
+		Name:        "Public",
+		Description: "For use in public areas.",
+		Target:      "%%REJECT%%",
+		Services:    []string{"ssh", "dhcpv6-client"},
+		Ports:       []Port{{Port: "8080", Protocol: "tcp"}},
+		ICMPBlocks:  []string{"echo-request"},
+		Masquerade:  true,
+		ForwardPorts: []ForwardPort{
+			{Port: "22", Protocol: "tcp", ToPort: "2222", ToAddress: "192.0.2.55"},
+		},
+		Interfaces: []string{"eth0"},
+		SourceAddresses: []string{
+			"192.0.2.0/24", "00:11:22:33:44:55", "ipset:admins",
+		},
+		RichRules: []string{
+			`rule priority="-10" family="ipv4" source NOT address="198.51.100.0/24" service name="http" log prefix="http" level="info" limit value="3/m" reject type="icmp-port-unreachable"`,
+			`rule port port="3306" protocol="tcp" drop`,
+		},
+		Protocols:          []string{"gre"},
+		SourcePorts:        []Port{{Port: "1024-65535", Protocol: "udp"}},
+		ICMPBlockInversion: true,
+	}, z)
+}
+
+func TestWriteZoneXML(t *testing.T) {
+	z, err := ReadZoneXML(strings.NewReader(testZoneXML))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteZoneXML(&buf, z))
+	assert.Contains(t, buf.String(), `<zone target="%%REJECT%%">`)
+	assert.Contains(t, buf.String(), `<source mac="00:11:22:33:44:55"></source>`)
+	assert.Contains(t, buf.String(), `<source address="198.51.100.0/24" invert="True"></source>`)
+
+	roundTrip, err := ReadZoneXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, z, roundTrip)
+
+	t.Run("default target", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteZoneXML(&buf, ZoneSettings{Target: "default"}))
+		assert.Contains(t, buf.String(), "<zone></zone>")
+
+		z, err := ReadZoneXML(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, "default", z.Target)
+	})
+
+	t.Run("invalid rich rule", func(t *testing.T) {
+		err := WriteZoneXML(&bytes.Buffer{}, ZoneSettings{
+			RichRules: []string{"rule accept", "rule foo"},
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "RichRules[1]")
+	})
+
+	t.Run("wrong root element", func(t *testing.T) {
+		_, err := ReadZoneXML(strings.NewReader(`<service></service>`))
+		assert.EqualError(t, err, "expected <zone> element, got <service>")
+	})
+}